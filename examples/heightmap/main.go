@@ -0,0 +1,91 @@
+//-----------------------------------------------------------------------------
+/*
+
+Heightmaps
+
+A terrain panel, and the same terrain as a cylindrical lithophane and a
+spherical panel.
+
+*/
+//-----------------------------------------------------------------------------
+
+package main
+
+import (
+	"log"
+	"math"
+
+	"github.com/deadsy/sdfx/obj"
+	"github.com/deadsy/sdfx/render"
+	"github.com/deadsy/sdfx/sdf"
+	v2 "github.com/deadsy/sdfx/vec/v2"
+)
+
+//-----------------------------------------------------------------------------
+
+// terrain returns a grid of heights with a few hills and valleys.
+func terrain(nx, ny int) [][]float64 {
+	hills := []struct {
+		x, y, r, h float64
+	}{
+		{0.3, 0.3, 0.15, 1.0},
+		{0.7, 0.4, 0.2, 0.7},
+		{0.5, 0.8, 0.1, -0.5},
+		{0.2, 0.7, 0.12, 0.4},
+	}
+	grid := make([][]float64, ny)
+	for j := range grid {
+		grid[j] = make([]float64, nx)
+		y := float64(j) / float64(ny-1)
+		for i := range grid[j] {
+			x := float64(i) / float64(nx-1)
+			h := 0.1 * math.Sin(6*math.Pi*x) * math.Cos(4*math.Pi*y)
+			for _, k := range hills {
+				dx, dy := x-k.x, y-k.y
+				h += k.h * math.Exp(-(dx*dx+dy*dy)/(k.r*k.r))
+			}
+			grid[j][i] = h
+		}
+	}
+	return grid
+}
+
+//-----------------------------------------------------------------------------
+
+func panel(shape obj.HeightmapShape, radius float64, invert bool) (sdf.SDF3, error) {
+	k := obj.HeightmapParms{
+		Heights:      terrain(64, 48),
+		Size:         v2.Vec{80, 60},
+		MinThickness: 0.8,
+		MaxThickness: 3.0,
+		Invert:       invert,
+		Border:       3,
+		Shape:        shape,
+		Radius:       radius,
+	}
+	return obj.Heightmap3D(&k)
+}
+
+//-----------------------------------------------------------------------------
+
+func main() {
+	s, err := panel(obj.HeightmapFlat, 0, false)
+	if err != nil {
+		log.Fatalf("error: %s", err)
+	}
+	render.ToSTL(s, "terrain.stl", render.NewMarchingCubesOctree(200))
+
+	s, err = panel(obj.HeightmapCylinder, 30, true)
+	if err != nil {
+		log.Fatalf("error: %s", err)
+	}
+	render.ToSTL(s, "lithophane.stl", render.NewMarchingCubesOctree(200))
+
+	s, err = panel(obj.HeightmapSphere, 60, false)
+	if err != nil {
+		log.Fatalf("error: %s", err)
+	}
+	render.ToSTL(s, "dome.stl", render.NewMarchingCubesOctree(200))
+}
+
+//-----------------------------------------------------------------------------
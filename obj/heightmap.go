@@ -0,0 +1,321 @@
+//-----------------------------------------------------------------------------
+/*
+
+Heightmaps and Lithophanes
+
+Solid panels with a thickness that follows a heightmap, either the brightness
+of a PNG image or a grid of values (e.g. terrain elevations). Lithophanes are
+heightmaps with the brightness inverted, so they're thick (and dark) where the
+image is dark when they're lit from behind.
+
+The panel can be flat, wrapped around a cylinder or projected onto a spherical
+cap, and can have a frame around the image.
+
+*/
+//-----------------------------------------------------------------------------
+
+package obj
+
+import (
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+
+	"github.com/deadsy/sdfx/sdf"
+	v2 "github.com/deadsy/sdfx/vec/v2"
+	v3 "github.com/deadsy/sdfx/vec/v3"
+)
+
+//-----------------------------------------------------------------------------
+
+// HeightmapShape is the shape of a heightmap panel.
+type HeightmapShape int
+
+// Heightmap shapes.
+const (
+	HeightmapFlat     HeightmapShape = iota // flat panel in the xy plane, the image faces +z
+	HeightmapCylinder                       // panel wrapped around the z-axis, the image faces -y
+	HeightmapSphere                         // image projected onto a spherical cap at the origin, the image faces -y
+)
+
+// HeightmapParms defines the parameters for a heightmap panel.
+type HeightmapParms struct {
+	Path         string         // png file, the brightness gives the height
+	Heights      [][]float64    // grid of heights (rows from top to bottom), used if there's no png file
+	Size         v2.Vec         // size of the image
+	MinThickness float64        // thickness for the lowest height
+	MaxThickness float64        // thickness for the highest height
+	Invert       bool           // invert the heights (lithophanes)
+	Border       float64        // width of a frame around the image (0 for no frame)
+	Shape        HeightmapShape // flat, cylindrical or spherical panel
+	Radius       float64        // inner radius of a cylindrical or spherical panel
+}
+
+//-----------------------------------------------------------------------------
+
+// heightmap is a grid of heights in [0, 1] covering a rectangle centered on the origin.
+type heightmap struct {
+	nx, ny int       // grid size
+	data   []float64 // heights (top row first)
+	size   v2.Vec    // size of the rectangle
+}
+
+// loadHeightmap returns the brightness of a png file as a heightmap.
+func loadHeightmap(path string) (*heightmap, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		return nil, err
+	}
+	r := img.Bounds()
+	h := heightmap{nx: r.Dx(), ny: r.Dy()}
+	if h.nx == 0 || h.ny == 0 {
+		return nil, sdf.ErrMsg("empty image")
+	}
+	h.data = make([]float64, h.nx*h.ny)
+	for j := 0; j < h.ny; j++ {
+		for i := 0; i < h.nx; i++ {
+			c := color.Gray16Model.Convert(img.At(r.Min.X+i, r.Min.Y+j)).(color.Gray16)
+			h.data[j*h.nx+i] = float64(c.Y) / 0xffff
+		}
+	}
+	return &h, nil
+}
+
+// gridHeightmap returns a grid of values as a heightmap.
+// The values are normalized so the lowest is 0 and the highest is 1.
+func gridHeightmap(grid [][]float64) (*heightmap, error) {
+	if len(grid) == 0 || len(grid[0]) == 0 {
+		return nil, sdf.ErrMsg("empty Heights")
+	}
+	h := heightmap{nx: len(grid[0]), ny: len(grid)}
+	h.data = make([]float64, 0, h.nx*h.ny)
+	for _, row := range grid {
+		if len(row) != h.nx {
+			return nil, sdf.ErrMsg("Heights rows have different lengths")
+		}
+		h.data = append(h.data, row...)
+	}
+	lo, hi := h.data[0], h.data[0]
+	for _, x := range h.data {
+		lo = math.Min(lo, x)
+		hi = math.Max(hi, x)
+	}
+	for i := range h.data {
+		if hi > lo {
+			h.data[i] = (h.data[i] - lo) / (hi - lo)
+		} else {
+			h.data[i] = 0
+		}
+	}
+	return &h, nil
+}
+
+// value returns a grid value, the grid is extended beyond its edges.
+func (h *heightmap) value(i, j int) float64 {
+	if i < 0 {
+		i = 0
+	} else if i >= h.nx {
+		i = h.nx - 1
+	}
+	if j < 0 {
+		j = 0
+	} else if j >= h.ny {
+		j = h.ny - 1
+	}
+	return h.data[j*h.nx+i]
+}
+
+// height returns the interpolated height at a point.
+func (h *heightmap) height(p v2.Vec) float64 {
+	// grid points are at the centers of the cells (as with sdf.Map2)
+	u := (p.X+0.5*h.size.X)*float64(h.nx)/h.size.X - 0.5
+	v := (0.5*h.size.Y-p.Y)*float64(h.ny)/h.size.Y - 0.5
+	x, y := math.Floor(u), math.Floor(v)
+	fx, fy := u-x, v-y
+	i, j := int(x), int(y)
+	h0 := h.value(i, j)*(1-fx) + h.value(i+1, j)*fx
+	h1 := h.value(i, j+1)*(1-fx) + h.value(i+1, j+1)*fx
+	return h0*(1-fy) + h1*fy
+}
+
+// slope returns the maximum gradient of the interpolated heights.
+func (h *heightmap) slope() float64 {
+	var dx, dy float64
+	for j := 0; j < h.ny; j++ {
+		for i := 0; i < h.nx; i++ {
+			x := h.value(i, j)
+			dx = math.Max(dx, math.Abs(h.value(i+1, j)-x))
+			dy = math.Max(dy, math.Abs(h.value(i, j+1)-x))
+		}
+	}
+	return math.Hypot(dx*float64(h.nx)/h.size.X, dy*float64(h.ny)/h.size.Y)
+}
+
+// texture returns the heightmap as a texture on the xy plane.
+func (h *heightmap) texture(invert bool) (sdf.Texture3, error) {
+	f := h.height
+	if invert {
+		f = func(p v2.Vec) float64 { return 1 - h.height(p) }
+	}
+	t, err := sdf.NewFuncTexture2(f, h.slope())
+	if err != nil {
+		return nil, err
+	}
+	return sdf.NewPlanarTexture3(t, sdf.PlaneXY)
+}
+
+//-----------------------------------------------------------------------------
+
+// heightmapBox returns a box with its base centered on the origin.
+func heightmapBox(size v2.Vec, height float64) (sdf.SDF3, error) {
+	box, err := sdf.Box3D(v3.Vec{size.X, size.Y, height}, 0)
+	if err != nil {
+		return nil, err
+	}
+	return sdf.Transform3D(box, sdf.Translate3d(v3.Vec{0, 0, 0.5 * height})), nil
+}
+
+// heightmapFlat returns a flat heightmap panel.
+func heightmapFlat(k *HeightmapParms, texture sdf.Texture3) (sdf.SDF3, error) {
+	slab, err := heightmapBox(k.Size, k.MinThickness)
+	if err != nil {
+		return nil, err
+	}
+	slab, err = sdf.Displace3D(slab, texture, k.MaxThickness-k.MinThickness)
+	if err != nil {
+		return nil, err
+	}
+	// The displacement raises the sides and lowers the base of the slab, trim them.
+	clip, err := heightmapBox(k.Size, k.MaxThickness)
+	if err != nil {
+		return nil, err
+	}
+	panel := sdf.Intersect3D(clip, slab)
+	if k.Border == 0 {
+		return panel, nil
+	}
+	frame, err := heightmapBox(k.Size.AddScalar(2*k.Border), k.MaxThickness)
+	if err != nil {
+		return nil, err
+	}
+	return sdf.Union3D(sdf.Difference3D(frame, clip), panel), nil
+}
+
+// heightmapSphere returns a heightmap panel on a spherical cap around the z-axis.
+func heightmapSphere(k *HeightmapParms, texture sdf.Texture3) (sdf.SDF3, error) {
+	outer, err := sdf.Sphere3D(k.Radius + k.MinThickness)
+	if err != nil {
+		return nil, err
+	}
+	outer, err = sdf.Displace3D(outer, texture, k.MaxThickness-k.MinThickness)
+	if err != nil {
+		return nil, err
+	}
+	inner, err := sdf.Sphere3D(k.Radius)
+	if err != nil {
+		return nil, err
+	}
+	clip, err := heightmapBox(k.Size, k.Radius+k.MaxThickness)
+	if err != nil {
+		return nil, err
+	}
+	panel := sdf.Difference3D(sdf.Intersect3D(clip, outer), inner)
+	if k.Border == 0 {
+		return panel, nil
+	}
+	shell, err := sdf.Sphere3D(k.Radius + k.MaxThickness)
+	if err != nil {
+		return nil, err
+	}
+	frame, err := heightmapBox(k.Size.AddScalar(2*k.Border), k.Radius+k.MaxThickness)
+	if err != nil {
+		return nil, err
+	}
+	frame = sdf.Difference3D(sdf.Intersect3D(sdf.Difference3D(frame, clip), shell), inner)
+	return sdf.Union3D(frame, panel), nil
+}
+
+// Heightmap3D returns a solid panel with a thickness given by a heightmap.
+// The lowest height (or the darkest pixel) has MinThickness and the highest (or brightest) has MaxThickness.
+// Grid heights are normalized, image brightness isn't.
+// A cylindrical panel is a flat panel wrapped around a cylinder (so the width of the panel,
+// including the frame, is at most 2 * Pi * Radius). A spherical panel is a planar projection of the image onto
+// a spherical cap, so the image is stretched towards the edge of the cap.
+func Heightmap3D(k *HeightmapParms) (sdf.SDF3, error) {
+	if k == nil {
+		return nil, sdf.ErrMsg("k == nil")
+	}
+	if k.Size.X <= 0 || k.Size.Y <= 0 {
+		return nil, sdf.ErrMsg("Size <= 0")
+	}
+	if k.MinThickness <= 0 {
+		return nil, sdf.ErrMsg("MinThickness <= 0")
+	}
+	if k.MaxThickness < k.MinThickness {
+		return nil, sdf.ErrMsg("MaxThickness < MinThickness")
+	}
+	if k.Border < 0 {
+		return nil, sdf.ErrMsg("Border < 0")
+	}
+	if k.Shape != HeightmapFlat && k.Radius <= 0 {
+		return nil, sdf.ErrMsg("Radius <= 0")
+	}
+
+	// read the heights
+	var h *heightmap
+	var err error
+	switch {
+	case k.Path != "" && k.Heights != nil:
+		return nil, sdf.ErrMsg("Path and Heights are both set")
+	case k.Path != "":
+		h, err = loadHeightmap(k.Path)
+	case k.Heights != nil:
+		h, err = gridHeightmap(k.Heights)
+	default:
+		return nil, sdf.ErrMsg("no Path or Heights")
+	}
+	if err != nil {
+		return nil, err
+	}
+	h.size = k.Size
+	texture, err := h.texture(k.Invert)
+	if err != nil {
+		return nil, err
+	}
+
+	switch k.Shape {
+	case HeightmapFlat:
+		return heightmapFlat(k, texture)
+	case HeightmapCylinder:
+		panel, err := heightmapFlat(k, texture)
+		if err != nil {
+			return nil, err
+		}
+		// bend the panel around the y-axis through (0, 0, -Radius)
+		panel, err = sdf.Bend3D(panel, v3.Vec{}, v3.Vec{1, 0, 0}, v3.Vec{0, 0, -1}, k.Radius)
+		if err != nil {
+			return nil, err
+		}
+		m := sdf.RotateX(sdf.DtoR(90)).Mul(sdf.Translate3d(v3.Vec{0, 0, k.Radius}))
+		return sdf.Transform3D(panel, m), nil
+	case HeightmapSphere:
+		// the corners of the frame must be on the sphere
+		if 0.5*k.Size.AddScalar(2*k.Border).Length() >= k.Radius {
+			return nil, sdf.ErrMsg("Size is too big for the Radius")
+		}
+		panel, err := heightmapSphere(k, texture)
+		if err != nil {
+			return nil, err
+		}
+		return sdf.Transform3D(panel, sdf.RotateX(sdf.DtoR(90))), nil
+	}
+	return nil, sdf.ErrMsg("unknown Shape")
+}
+
+//-----------------------------------------------------------------------------
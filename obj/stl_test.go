@@ -0,0 +1,120 @@
+//-----------------------------------------------------------------------------
+/*
+
+STL Import Testing
+
+*/
+//-----------------------------------------------------------------------------
+
+package obj
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/deadsy/sdfx/render"
+	"github.com/deadsy/sdfx/sdf"
+	v2 "github.com/deadsy/sdfx/vec/v2"
+	v3 "github.com/deadsy/sdfx/vec/v3"
+)
+
+//-----------------------------------------------------------------------------
+
+// lMesh returns a mesh for an L shaped prism (z = [0, 1]) with a sliver and a near-coplanar pair of triangles.
+func lMesh(l []v2.Vec) []*sdf.Triangle3 {
+	var mesh []*sdf.Triangle3
+	add := func(a, b, c v3.Vec) {
+		mesh = append(mesh, &sdf.Triangle3{a, b, c})
+	}
+	bottom := func(i int) v3.Vec { return v3.Vec{l[i].X, l[i].Y, 0} }
+	top := func(i int) v3.Vec { return v3.Vec{l[i].X, l[i].Y, 1} }
+	// the top edge of the wall from l[2] to l[3] has a vertex close to l[2]
+	m := v3.Vec{1.999, 1, 1}
+	for i := range l {
+		j := (i + 1) % len(l)
+		a, b, c, d := bottom(i), bottom(j), top(j), top(i)
+		switch i {
+		case 1:
+			// a very flat pyramid, its triangles are almost coplanar
+			apex := v3.Vec{2 + 1e-5, 0.5, 0.5}
+			add(a, b, apex)
+			add(b, c, apex)
+			add(c, d, apex)
+			add(d, a, apex)
+		case 2:
+			add(a, b, c)
+			add(a, c, m)
+			add(a, m, d) // sliver
+		default:
+			add(a, b, c)
+			add(a, c, d)
+		}
+	}
+	// caps (fans from l[0], the reflex vertex is l[3])
+	for i := 1; i < len(l)-1; i++ {
+		if i == 2 {
+			add(top(0), top(2), m) // sliver
+			add(top(0), m, top(3))
+		} else {
+			add(top(0), top(i), top(i+1))
+		}
+		add(bottom(0), bottom(i+1), bottom(i))
+	}
+	return mesh
+}
+
+func Test_ImportSTL(t *testing.T) {
+	l := []v2.Vec{{0, 0}, {2, 0}, {2, 1}, {1, 1}, {1, 2}, {0, 2}}
+	path := filepath.Join(t.TempDir(), "l.stl")
+	if err := render.SaveSTL(path, lMesh(l)); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	s, err := ImportSTL(path, 20, 3, 5)
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+
+	// compare to the extruded polygon
+	poly, err := sdf.Polygon2D(l)
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	ref := sdf.Transform3D(sdf.Extrude3D(poly, 1), sdf.Translate3d(v3.Vec{0, 0, 0.5}))
+	bb := ref.BoundingBox().ScaleAboutCenter(1.5)
+	for i, p := range bb.RandomSet(5000) {
+		d0 := ref.Evaluate(p)
+		d1 := s.Evaluate(p)
+		if d0 < -1e-3 && (d1 >= 0 || !sdf.EqualFloat64(d0, d1, 1e-4)) {
+			t.Errorf("inside test %d %v: expected %f, got %f", i, p, d0, d1)
+		}
+		if d0 > 1e-3 && d1 <= 0 {
+			t.Errorf("outside test %d %v: expected %f, got %f", i, p, d0, d1)
+		}
+	}
+	// around the reflex edge and the sliver
+	for _, p := range []v3.Vec{{1.01, 1.01, 0.5}, {1.999, 1.0001, 0.9999}, {1.5, 0.9999, 0.9999}, {2.00002, 0.5, 0.5}} {
+		d0 := ref.Evaluate(p)
+		if d1 := s.Evaluate(p); d0*d1 <= 0 {
+			t.Errorf("%v: expected %f, got %f", p, d0, d1)
+		}
+	}
+
+	// the imported mesh is serialized as a reference to the file
+	data, err := sdf.MarshalSDF3(s)
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if !strings.Contains(string(data), "l.stl") {
+		t.Errorf("expected a reference to the stl file")
+	}
+	s, err = sdf.UnmarshalSDF3(data)
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if d := s.Evaluate(v3.Vec{0.5, 0.5, 0.5}); !sdf.EqualFloat64(d, -0.5, 1e-6) {
+		t.Errorf("expected -0.5, got %f", d)
+	}
+}
+
+//-----------------------------------------------------------------------------
@@ -656,9 +656,5 @@ func dcApproximateZeroCrossingPosition(d sdf.SDF3, p0, p1 v3.Vec) v3.Vec {
 
 func dcCalculateSurfaceNormal(d sdf.SDF3, p v3.Vec) v3.Vec {
 	const eps = 0.001
-	return v3.Vec{
-		X: d.Evaluate(p.Add(v3.Vec{X: eps})) - d.Evaluate(p.Add(v3.Vec{X: -eps})),
-		Y: d.Evaluate(p.Add(v3.Vec{Y: eps})) - d.Evaluate(p.Add(v3.Vec{Y: -eps})),
-		Z: d.Evaluate(p.Add(v3.Vec{Z: eps})) - d.Evaluate(p.Add(v3.Vec{Z: -eps})),
-	}.Normalize()
+	return sdf.Normal3(d, p, eps)
 }
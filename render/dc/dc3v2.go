@@ -226,7 +226,8 @@ func (dc *DualContouringV2) placeVertex(s *dcSdf, cellStart, cellCenter, cellSiz
 			}
 			edgeSurfPos = dcApproximateZeroCrossingPosition(s, cornerPos1, cornerPos2)
 		}
-		edgeSurfNormal := sdf.Normal3(s, edgeSurfPos, 1e-3)
+		// use the underlying sdf so an analytic gradient can be used
+		edgeSurfNormal := sdf.Normal3(s.impl, edgeSurfPos, 1e-3)
 		normals = append(normals, edgeSurfNormal)
 		planeDs = append(planeDs, edgeSurfNormal.Dot(edgeSurfPos) /* - s.Evaluate(edgeSurfPos): 0.0 */)
 		if len(normals) == 6 {
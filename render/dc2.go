@@ -33,10 +33,7 @@ import (
 
 // norm2 returns the normal to the SDF2 at a point.
 func norm2(s sdf.SDF2, p v2.Vec, epsilon float64) v2.Vec {
-	return v2.Vec{
-		s.Evaluate(v2.Vec{p.X + epsilon, p.Y}) - s.Evaluate(v2.Vec{p.X - epsilon, p.Y}),
-		s.Evaluate(v2.Vec{p.X, p.Y + epsilon}) - s.Evaluate(v2.Vec{p.X, p.Y - epsilon}),
-	}.Normalize()
+	return sdf.Normal2(s, p, epsilon)
 }
 
 //-----------------------------------------------------------------------------
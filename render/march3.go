@@ -25,11 +25,11 @@ import (
 //-----------------------------------------------------------------------------
 
 // evalReq is used for processing evaluations in parallel.
-// A slice of V3 is evaluated with fn, the result is stored in out.
+// A slice of V3 is evaluated with the SDF3, the result is stored in out.
 type evalReq struct {
 	out []float64
 	p   []v3.Vec
-	fn  func(v3.Vec) float64
+	s   sdf.SDF3
 	wg  *sync.WaitGroup
 }
 
@@ -39,12 +39,8 @@ var evalProcessCh = make(chan evalReq, 100)
 func evalRoutines() {
 	for i := 0; i < runtime.NumCPU(); i++ {
 		go func() {
-			var i int
-			var p v3.Vec
 			for r := range evalProcessCh {
-				for i, p = range r.p {
-					r.out[i] = r.fn(p)
-				}
+				sdf.EvaluateBatch3(r.s, r.p, r.out[:len(r.p)])
 				r.wg.Done()
 			}
 		}()
@@ -86,7 +82,7 @@ func (l *layerYZ) Evaluate(s sdf.SDF3, x int) {
 	// define the base struct for requesting evaluation
 	eReq := evalReq{
 		wg:  new(sync.WaitGroup),
-		fn:  s.Evaluate,
+		s:   s,
 		out: l.val1,
 	}
 
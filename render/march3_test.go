@@ -0,0 +1,99 @@
+//-----------------------------------------------------------------------------
+/*
+
+Marching Cubes Testing
+
+*/
+//-----------------------------------------------------------------------------
+
+package render
+
+import (
+	"math"
+	"sync/atomic"
+	"testing"
+
+	"github.com/deadsy/sdfx/sdf"
+	v3 "github.com/deadsy/sdfx/vec/v3"
+)
+
+//-----------------------------------------------------------------------------
+
+// countSDF3 counts the evaluations of an SDF3 with interval evaluation.
+type countSDF3 struct {
+	sdf.IntervalSDF3
+	n int64
+}
+
+func (s *countSDF3) Evaluate(p v3.Vec) float64 {
+	atomic.AddInt64(&s.n, 1)
+	return s.IntervalSDF3.Evaluate(p)
+}
+
+// Test_OctreePruning checks the octree renderer skips the empty space around
+// SDFs that aren't true distance fields.
+func Test_OctreePruning(t *testing.T) {
+	const cells = 64
+	hex, err := sdf.Polygon2D(sdf.Nagon(6, 0.5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	box, err := sdf.Box3D(v3.Vec{2, 3, 4}, 0.2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, err := sdf.SplinePath3([]v3.Vec{{0, 0, 0}, {4, 2, 2}, {6, 6, 0}, {2, 8, -4}}, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sweep, err := sdf.Sweep3D(hex, path, sdf.Pi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	draft, err := sdf.Draft3D(box, v3.Vec{0, 0, 1}, 0, sdf.DtoR(5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	redistance, err := sdf.Redistance3DBand(box, 0.1, 0.3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sparse, err := sdf.NewSparseVoxelSDF3(box, 0.05, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		s    sdf.SDF3
+	}{
+		{"box", box},
+		{"sweep", sweep},
+		{"draft", draft},
+		{"voxel", sdf.NewVoxelSDF3(box, 32, nil)},
+		{"redistance", redistance},
+		{"sparse", sparse},
+	}
+	for _, test := range tests {
+		s, ok := test.s.(sdf.IntervalSDF3)
+		if !ok {
+			t.Errorf("%s has no interval evaluation", test.name)
+			continue
+		}
+		cs := &countSDF3{IntervalSDF3: s}
+		triangles := ToTriangles(cs, NewMarchingCubesOctreeSingle(cells))
+		if len(triangles) == 0 {
+			t.Errorf("%s has no triangles", test.name)
+		}
+		// A dense grid evaluates every point of the grid (at half the cell size).
+		// The octree should only evaluate the points near the surface, E.g. about
+		// 10% of them for the box.
+		size := test.s.BoundingBox().Size()
+		k := 2 * float64(cells) / size.MaxComponent()
+		points := math.Ceil(size.X*k+1) * math.Ceil(size.Y*k+1) * math.Ceil(size.Z*k+1)
+		if f := float64(cs.n) / points; f > 0.25 {
+			t.Errorf("%s evaluated %.0f%% of the grid points", test.name, 100*f)
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
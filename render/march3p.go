@@ -106,11 +106,12 @@ func (c *directCache) set(packed uint64, val float64) {
 // mechanism (sync.Map, sharded locks, etc.) — profiling confirmed this.
 
 type mcWorker struct {
-	origin     v3.Vec       // corner of the bounding cube in world space
-	resolution float64      // size of the smallest octree cube (half the requested mesh resolution)
-	hdiag      []float64    // precomputed half-diagonal length per octree level, for isEmpty checks
-	s          sdf.SDF3     // the SDF being rendered
-	cache      *directCache // per-worker evaluation cache (no sharing, no locks)
+	origin     v3.Vec           // corner of the bounding cube in world space
+	resolution float64          // size of the smallest octree cube (half the requested mesh resolution)
+	hdiag      []float64        // precomputed half-diagonal length per octree level, for isEmpty checks
+	s          sdf.SDF3         // the SDF being rendered
+	interval   sdf.IntervalSDF3 // the SDF with interval evaluation (or nil)
+	cache      *directCache     // per-worker evaluation cache (no sharing, no locks)
 }
 
 func newMCWorker(s sdf.SDF3, origin v3.Vec, resolution float64, levels uint) *mcWorker {
@@ -123,6 +124,7 @@ func newMCWorker(s sdf.SDF3, origin v3.Vec, resolution float64, levels uint) *mc
 		// typical models, small enough to stay in L3 cache per core.
 		cache: newDirectCache(18),
 	}
+	w.interval, _ = s.(sdf.IntervalSDF3)
 	// Precompute the half-diagonal distance for cubes at each octree level.
 	// Used by isEmpty to determine if a cube can possibly contain the surface.
 	for i := 0; i < len(w.hdiag); i++ {
@@ -146,14 +148,58 @@ func (w *mcWorker) evaluate(vi v3i.Vec) (v3.Vec, float64) {
 	return v, d
 }
 
+// evaluateCorners returns the world-space positions and SDF distances for the
+// 8 corners of a leaf cube. Corners that miss the cache are evaluated as a
+// single batch.
+func (w *mcWorker) evaluateCorners(c *cube) ([8]v3.Vec, [8]float64) {
+	var corners [8]v3.Vec
+	var values [8]float64
+	var keys [8]uint64
+	var miss [8]int
+	var ps [8]v3.Vec
+	var ds [8]float64
+	n := 0
+	for i, off := range mcOctreeOffsets(2) {
+		vi := c.v.Add(off)
+		corners[i] = w.origin.Add(conv.V3iToV3(vi).MulScalar(w.resolution))
+		keys[i] = packVec(vi)
+		if d, ok := w.cache.get(keys[i]); ok {
+			values[i] = d
+		} else {
+			miss[n] = i
+			ps[n] = corners[i]
+			n++
+		}
+	}
+	if n > 0 {
+		sdf.EvaluateBatch3(w.s, ps[:n], ds[:n])
+		for j, i := range miss[:n] {
+			values[i] = ds[j]
+			w.cache.set(keys[i], ds[j])
+		}
+	}
+	return corners, values
+}
+
 // isEmpty tests whether a cube can possibly contain any part of the surface.
 // It evaluates the SDF at the cube center: if the absolute distance exceeds
 // the half-diagonal (the farthest any corner can be from the center), the
 // surface cannot intersect this cube and we can skip it entirely.
+// That's only true for SDFs that return true distances, so if the SDF supports
+// interval evaluation we also check that the interval of SDF values within the
+// cube doesn't contain zero.
 func (w *mcWorker) isEmpty(c *cube) bool {
 	s := 1 << (c.n - 1)
 	_, d := w.evaluate(c.v.AddScalar(s))
-	return math.Abs(d) >= w.hdiag[c.n]
+	if math.Abs(d) < w.hdiag[c.n] {
+		return false
+	}
+	if w.interval != nil {
+		v0 := w.origin.Add(conv.V3iToV3(c.v).MulScalar(w.resolution))
+		v1 := w.origin.Add(conv.V3iToV3(c.v.AddScalar(2 * s)).MulScalar(w.resolution))
+		return !w.interval.EvaluateInterval(sdf.Box3{Min: v0, Max: v1}).Contains(0)
+	}
+	return true
 }
 
 // processCube recursively subdivides the octree. At the leaf level (n==1),
@@ -169,16 +215,7 @@ func (w *mcWorker) processCube(c *cube, tris []sdf.Triangle3) []sdf.Triangle3 {
 		// Leaf cube: evaluate all 8 corners and generate triangles.
 		// Corner offsets are 0 and 2 (not 0 and 1) because the level-0
 		// cube is at half resolution — see the resolution *= 0.5 below.
-		c0, d0 := w.evaluate(c.v.Add(v3i.Vec{0, 0, 0}))
-		c1, d1 := w.evaluate(c.v.Add(v3i.Vec{2, 0, 0}))
-		c2, d2 := w.evaluate(c.v.Add(v3i.Vec{2, 2, 0}))
-		c3, d3 := w.evaluate(c.v.Add(v3i.Vec{0, 2, 0}))
-		c4, d4 := w.evaluate(c.v.Add(v3i.Vec{0, 0, 2}))
-		c5, d5 := w.evaluate(c.v.Add(v3i.Vec{2, 0, 2}))
-		c6, d6 := w.evaluate(c.v.Add(v3i.Vec{2, 2, 2}))
-		c7, d7 := w.evaluate(c.v.Add(v3i.Vec{0, 2, 2}))
-		corners := [8]v3.Vec{c0, c1, c2, c3, c4, c5, c6, c7}
-		values := [8]float64{d0, d1, d2, d3, d4, d5, d6, d7}
+		corners, values := w.evaluateCorners(c)
 		return mcAppendTriangles(tris, corners, values, 0)
 	}
 	// Subdivide into 8 child cubes and recurse.
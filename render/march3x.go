@@ -39,6 +39,7 @@ type dcache3 struct {
 	resolution float64             // size of smallest octree cube
 	hdiag      []float64           // lookup table of cube half diagonals
 	s          sdf.SDF3            // the SDF3 to be rendered
+	interval   sdf.IntervalSDF3    // the SDF3 with interval evaluation (or nil)
 	cache      map[v3i.Vec]float64 // cache of distances
 	lock       sync.RWMutex        // lock the the cache during reads/writes
 }
@@ -53,6 +54,7 @@ func newDcache3(s sdf.SDF3, origin v3.Vec, resolution float64, n uint) *dcache3
 		s:          s,
 		cache:      make(map[v3i.Vec]float64),
 	}
+	dc.interval, _ = s.(sdf.IntervalSDF3)
 	// build a lut for cube half diagonal lengths
 	for i := range dc.hdiag {
 		si := 1 << uint(i)
@@ -97,7 +99,17 @@ func (dc *dcache3) isEmpty(c *cube) bool {
 	s := 1 << (c.n - 1) // half side
 	_, d := dc.evaluate(c.v.AddScalar(s))
 	// compare to the center/corner distance
-	return math.Abs(d) >= dc.hdiag[c.n]
+	if math.Abs(d) < dc.hdiag[c.n] {
+		return false
+	}
+	if dc.interval != nil {
+		// The center/corner test is only safe for a true distance field.
+		// Check that the interval of SDF3 values within the cube excludes the surface.
+		v0 := dc.origin.Add(conv.V3iToV3(c.v).MulScalar(dc.resolution))
+		v1 := dc.origin.Add(conv.V3iToV3(c.v.AddScalar(2 * s)).MulScalar(dc.resolution))
+		return !dc.interval.EvaluateInterval(sdf.Box3{Min: v0, Max: v1}).Contains(0)
+	}
+	return true
 }
 
 // Process a cube. Generate triangles, or more cubes.
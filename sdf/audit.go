@@ -0,0 +1,372 @@
+//-----------------------------------------------------------------------------
+/*
+
+Audit the distance quality of an SDF2/SDF3.
+
+Many SDFs return a bound on the distance rather than the true distance.
+E.g. non-linear extrusions, lofts, gyroids and some min/max blends.
+An audit samples the bounding box of an SDF and reports:
+
+1) The Lipschitz constant (gradient magnitude) of the field. A true distance
+field has a Lipschitz constant of 1.
+
+2) Overestimates: samples where the SDF returns a distance that is greater than the
+distance to the surface found by a brute force search of a dense grid.
+
+3) Sign mismatches: samples where the sign of the SDF disagrees with a voxel reference.
+Grid points that can be reached from the outside of the sampling region without
+crossing the reference surface are outside, the rest are inside. Samples within
+a grid cell or two of the reference surface aren't checked.
+
+Together these give the scaleAndSigmoid/stepScale values for Raycast3.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"fmt"
+	"math"
+
+	v2 "github.com/deadsy/sdfx/vec/v2"
+	v3 "github.com/deadsy/sdfx/vec/v3"
+)
+
+//-----------------------------------------------------------------------------
+
+const auditGrid3 = 64  // grid cells per axis for the 3d reference surface
+const auditGrid2 = 512 // grid cells per axis for the 2d reference surface
+
+// Audit3Result is the result of an SDF3 distance audit.
+type Audit3Result struct {
+	Samples           int     // number of samples
+	MaxLipschitz      float64 // worst lipschitz constant
+	MaxLipschitzAt    v3.Vec  // location of the worst lipschitz constant
+	Overestimates     int     // number of samples with a distance greater than the reference distance
+	MaxOverestimate   float64 // worst ratio of the distance to the reference distance
+	MaxOverestimateAt v3.Vec  // location of the worst overestimate
+	SignMismatches    int     // number of samples with a sign that disagrees with the reference
+	SignMismatchAt    v3.Vec  // location of a sign mismatch
+	Sigmoid           float64 // recommended scaleAndSigmoid value for Raycast3
+	StepScale         float64 // recommended stepScale value for Raycast3
+}
+
+// Audit2Result is the result of an SDF2 distance audit.
+type Audit2Result struct {
+	Samples           int     // number of samples
+	MaxLipschitz      float64 // worst lipschitz constant
+	MaxLipschitzAt    v2.Vec  // location of the worst lipschitz constant
+	Overestimates     int     // number of samples with a distance greater than the reference distance
+	MaxOverestimate   float64 // worst ratio of the distance to the reference distance
+	MaxOverestimateAt v2.Vec  // location of the worst overestimate
+	SignMismatches    int     // number of samples with a sign that disagrees with the reference
+	SignMismatchAt    v2.Vec  // location of a sign mismatch
+	Sigmoid           float64 // recommended scaleAndSigmoid value for Raycast2
+	StepScale         float64 // recommended stepScale value for Raycast2
+}
+
+//-----------------------------------------------------------------------------
+
+// auditor does the work for 2d and 3d audits.
+// 2d SDFs are evaluated on the z = 0 plane.
+type auditor struct {
+	eval    func(p v3.Vec) float64
+	bb      Box3     // sampling region
+	dims    int      // 2 or 3
+	h       float64  // reference grid size
+	n       [3]int   // reference grid points on each axis
+	surface []v3.Vec // reference surface points
+	outside []bool   // reference grid points that are outside the surface
+	// results
+	samples                           int
+	maxLipschitz, maxOverestimate     float64
+	maxLipschitzAt, maxOverestimateAt v3.Vec
+	overestimates, signMismatches     int
+	signMismatchAt                    v3.Vec
+	sigmoid, stepScale                float64
+}
+
+// axes returns the unit axes for the audit dimensions.
+func (a *auditor) axes() []v3.Vec {
+	if a.dims == 2 {
+		return []v3.Vec{{1, 0, 0}, {0, 1, 0}}
+	}
+	return []v3.Vec{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}
+}
+
+// random returns a random point within the sampling region.
+func (a *auditor) random() v3.Vec {
+	p := a.bb.Random()
+	if a.dims == 2 {
+		p.Z = 0
+	}
+	return p
+}
+
+// lipschitz estimates the lipschitz constant at a point.
+func (a *auditor) lipschitz(p v3.Vec) float64 {
+	// gradient
+	eps := a.h * 1e-3
+	g := 0.0
+	for _, u := range a.axes() {
+		d := (a.eval(p.Add(u.MulScalar(eps))) - a.eval(p.Sub(u.MulScalar(eps)))) / (2 * eps)
+		g += d * d
+	}
+	g = math.Sqrt(g)
+	// finite difference to a nearby point
+	q := a.random().Sub(p)
+	if l := q.Length(); l > 0 {
+		q = p.Add(q.MulScalar(a.h / l))
+		g = math.Max(g, math.Abs(a.eval(q)-a.eval(p))/a.h)
+	}
+	return g
+}
+
+// crossing returns true if there is a surface crossing between two field values a distance h apart.
+// A continuous field with lipschitz constant k can't change sign unless |d0| + |d1| <= k * h.
+func (a *auditor) crossing(d0, d1 float64) bool {
+	if (d0 < 0) == (d1 < 0) {
+		return false
+	}
+	return math.Abs(d0)+math.Abs(d1) <= 1.5*math.Max(a.maxLipschitz, 1)*a.h
+}
+
+// index returns the reference grid index of a grid point.
+func (a *auditor) index(i, j, k int) int {
+	return (i*a.n[1]+j)*a.n[2] + k
+}
+
+// position returns the position of a reference grid point.
+func (a *auditor) position(i, j, k int) v3.Vec {
+	return a.bb.Min.Add(v3.Vec{float64(i), float64(j), float64(k)}.MulScalar(a.h))
+}
+
+// buildSurface finds the reference surface points on a dense grid,
+// and the grid points that are outside the surface.
+func (a *auditor) buildSurface(n int) {
+	size := a.bb.Size()
+	a.h = size.MaxComponent() / float64(n)
+	a.n = [3]int{int(math.Ceil(size.X/a.h)) + 1, int(math.Ceil(size.Y/a.h)) + 1, int(math.Ceil(size.Z/a.h)) + 1}
+	if a.dims == 2 {
+		a.n[2] = 1
+	}
+	nx, ny, nz := a.n[0], a.n[1], a.n[2]
+	// evaluate the grid
+	d := make([]float64, nx*ny*nz)
+	for i := 0; i < nx; i++ {
+		for j := 0; j < ny; j++ {
+			for k := 0; k < nz; k++ {
+				d[a.index(i, j, k)] = a.eval(a.position(i, j, k))
+			}
+		}
+	}
+	// interpolate the surface crossings on the grid edges
+	for i := 0; i < nx; i++ {
+		for j := 0; j < ny; j++ {
+			for k := 0; k < nz; k++ {
+				d0 := d[a.index(i, j, k)]
+				p0 := a.position(i, j, k)
+				edge := func(d1 float64, p1 v3.Vec) {
+					if a.crossing(d0, d1) {
+						a.surface = append(a.surface, p0.Add(p1.Sub(p0).MulScalar(d0/(d0-d1))))
+					}
+				}
+				if i < nx-1 {
+					edge(d[a.index(i+1, j, k)], a.position(i+1, j, k))
+				}
+				if j < ny-1 {
+					edge(d[a.index(i, j+1, k)], a.position(i, j+1, k))
+				}
+				if k < nz-1 {
+					edge(d[a.index(i, j, k+1)], a.position(i, j, k+1))
+				}
+			}
+		}
+	}
+	// flood fill the outside from the faces of the grid without crossing the surface
+	a.outside = make([]bool, nx*ny*nz)
+	var stack [][3]int
+	visit := func(i, j, k int, d0 float64) {
+		if i < 0 || j < 0 || k < 0 || i >= nx || j >= ny || k >= nz {
+			return
+		}
+		x := a.index(i, j, k)
+		if a.outside[x] || a.crossing(d0, d[x]) {
+			return
+		}
+		a.outside[x] = true
+		stack = append(stack, [3]int{i, j, k})
+	}
+	for i := 0; i < nx; i++ {
+		for j := 0; j < ny; j++ {
+			for k := 0; k < nz; k++ {
+				face := i == 0 || j == 0 || i == nx-1 || j == ny-1
+				if a.dims == 3 {
+					face = face || k == 0 || k == nz-1
+				}
+				if face {
+					visit(i, j, k, d[a.index(i, j, k)])
+				}
+			}
+		}
+	}
+	for len(stack) != 0 {
+		g := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		d0 := d[a.index(g[0], g[1], g[2])]
+		visit(g[0]-1, g[1], g[2], d0)
+		visit(g[0]+1, g[1], g[2], d0)
+		visit(g[0], g[1]-1, g[2], d0)
+		visit(g[0], g[1]+1, g[2], d0)
+		visit(g[0], g[1], g[2]-1, d0)
+		visit(g[0], g[1], g[2]+1, d0)
+	}
+}
+
+// distance returns the brute force distance from a point to the reference surface.
+func (a *auditor) distance(p v3.Vec) float64 {
+	d2 := math.Inf(1)
+	for _, x := range a.surface {
+		d2 = math.Min(d2, x.Sub(p).Length2())
+	}
+	return math.Sqrt(d2)
+}
+
+// inside returns true if the nearest reference grid point to a point is inside the surface.
+func (a *auditor) inside(p v3.Vec) bool {
+	var g [3]int
+	q := p.Sub(a.bb.Min).DivScalar(a.h)
+	for i, x := range []float64{q.X, q.Y, q.Z} {
+		g[i] = int(Clamp(math.Round(x), 0, float64(a.n[i]-1)))
+	}
+	return !a.outside[a.index(g[0], g[1], g[2])]
+}
+
+func (a *auditor) run(samples int) {
+	a.samples = samples
+	ps := make([]v3.Vec, samples)
+	for i := range ps {
+		ps[i] = a.random()
+	}
+	// lipschitz constant
+	a.h = a.bb.Size().MaxComponent() / float64(auditGrid3)
+	for _, p := range ps {
+		if l := a.lipschitz(p); l > a.maxLipschitz {
+			a.maxLipschitz = l
+			a.maxLipschitzAt = p
+		}
+	}
+	// reference surface
+	if a.dims == 2 {
+		a.buildSurface(auditGrid2)
+	} else {
+		a.buildSurface(auditGrid3)
+	}
+	// overestimates and sign mismatches
+	a.maxOverestimate = 1
+	for _, p := range ps {
+		d := a.eval(p)
+		ref := math.Inf(1)
+		if len(a.surface) != 0 {
+			ref = a.distance(p)
+			// allow for the error in the reference surface
+			if math.Abs(d) > ref+a.h {
+				a.overestimates++
+				if k := math.Abs(d) / (ref + a.h); k > a.maxOverestimate {
+					a.maxOverestimate = k
+					a.maxOverestimateAt = p
+				}
+			}
+		}
+		// the surface can be between the sample and the nearest grid point
+		if ref > 2*a.h && (d < 0) != a.inside(p) {
+			a.signMismatches++
+			a.signMismatchAt = p
+		}
+	}
+	// recommended raycast parameters
+	a.stepScale = 1 / math.Max(1, math.Max(a.maxLipschitz, a.maxOverestimate))
+	if a.maxLipschitz > 2 || a.maxOverestimate > 2 {
+		// the field is badly behaved, clamp the step size
+		a.sigmoid = 1
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// Audit3D samples an SDF3 and reports the quality of the distance field.
+func Audit3D(s SDF3, samples int) (*Audit3Result, error) {
+	if samples <= 0 {
+		return nil, ErrMsg("samples <= 0")
+	}
+	bb := s.BoundingBox()
+	if bb.Size().MinComponent() <= 0 {
+		return nil, ErrMsg("empty bounding box")
+	}
+	a := auditor{
+		eval: s.Evaluate,
+		bb:   bb.ScaleAboutCenter(1.2),
+		dims: 3,
+	}
+	a.run(samples)
+	return &Audit3Result{
+		Samples:           a.samples,
+		MaxLipschitz:      a.maxLipschitz,
+		MaxLipschitzAt:    a.maxLipschitzAt,
+		Overestimates:     a.overestimates,
+		MaxOverestimate:   a.maxOverestimate,
+		MaxOverestimateAt: a.maxOverestimateAt,
+		SignMismatches:    a.signMismatches,
+		SignMismatchAt:    a.signMismatchAt,
+		Sigmoid:           a.sigmoid,
+		StepScale:         a.stepScale,
+	}, nil
+}
+
+// Audit2D samples an SDF2 and reports the quality of the distance field.
+func Audit2D(s SDF2, samples int) (*Audit2Result, error) {
+	if samples <= 0 {
+		return nil, ErrMsg("samples <= 0")
+	}
+	bb := s.BoundingBox()
+	if bb.Size().MinComponent() <= 0 {
+		return nil, ErrMsg("empty bounding box")
+	}
+	bb = bb.ScaleAboutCenter(1.2)
+	a := auditor{
+		eval: func(p v3.Vec) float64 { return s.Evaluate(v2.Vec{p.X, p.Y}) },
+		bb:   Box3{v3.Vec{bb.Min.X, bb.Min.Y, 0}, v3.Vec{bb.Max.X, bb.Max.Y, 0}},
+		dims: 2,
+	}
+	a.run(samples)
+	xy := func(p v3.Vec) v2.Vec { return v2.Vec{p.X, p.Y} }
+	return &Audit2Result{
+		Samples:           a.samples,
+		MaxLipschitz:      a.maxLipschitz,
+		MaxLipschitzAt:    xy(a.maxLipschitzAt),
+		Overestimates:     a.overestimates,
+		MaxOverestimate:   a.maxOverestimate,
+		MaxOverestimateAt: xy(a.maxOverestimateAt),
+		SignMismatches:    a.signMismatches,
+		SignMismatchAt:    xy(a.signMismatchAt),
+		Sigmoid:           a.sigmoid,
+		StepScale:         a.stepScale,
+	}, nil
+}
+
+//-----------------------------------------------------------------------------
+
+// String returns a summary of the SDF3 audit.
+func (r *Audit3Result) String() string {
+	return fmt.Sprintf("samples %d lipschitz %.3f at %v overestimates %d (worst %.3f at %v) sign mismatches %d raycast sigmoid %g step scale %.3f",
+		r.Samples, r.MaxLipschitz, r.MaxLipschitzAt, r.Overestimates, r.MaxOverestimate, r.MaxOverestimateAt, r.SignMismatches, r.Sigmoid, r.StepScale)
+}
+
+// String returns a summary of the SDF2 audit.
+func (r *Audit2Result) String() string {
+	return fmt.Sprintf("samples %d lipschitz %.3f at %v overestimates %d (worst %.3f at %v) sign mismatches %d raycast sigmoid %g step scale %.3f",
+		r.Samples, r.MaxLipschitz, r.MaxLipschitzAt, r.Overestimates, r.MaxOverestimate, r.MaxOverestimateAt, r.SignMismatches, r.Sigmoid, r.StepScale)
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,119 @@
+//-----------------------------------------------------------------------------
+/*
+
+Batch Evaluation
+
+An SDF that implements EvaluateBatch evaluates a slice of points in one call.
+This avoids the per point interface calls through a deep SDF tree. Nodes that
+don't implement it are evaluated one point at a time.
+
+EvaluateBatch must return the same values as Evaluate.
+
+Nodes that need scratch space (transformed points, child distances) take it
+from a pool, so the render loops don't allocate on every batch.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"sync"
+
+	v2 "github.com/deadsy/sdfx/vec/v2"
+	v3 "github.com/deadsy/sdfx/vec/v3"
+)
+
+//-----------------------------------------------------------------------------
+
+// BatchSDF3 is an SDF3 that can evaluate a slice of points.
+type BatchSDF3 interface {
+	SDF3
+	EvaluateBatch(ps []v3.Vec, out []float64)
+}
+
+// BatchSDF2 is an SDF2 that can evaluate a slice of points.
+type BatchSDF2 interface {
+	SDF2
+	EvaluateBatch(ps []v2.Vec, out []float64)
+}
+
+//-----------------------------------------------------------------------------
+
+// EvaluateBatch3 evaluates an SDF3 at each point of ps and stores the results in out.
+func EvaluateBatch3(s SDF3, ps []v3.Vec, out []float64) {
+	if sb, ok := s.(BatchSDF3); ok {
+		sb.EvaluateBatch(ps, out)
+		return
+	}
+	for i, p := range ps {
+		out[i] = s.Evaluate(p)
+	}
+}
+
+// EvaluateBatch2 evaluates an SDF2 at each point of ps and stores the results in out.
+func EvaluateBatch2(s SDF2, ps []v2.Vec, out []float64) {
+	if sb, ok := s.(BatchSDF2); ok {
+		sb.EvaluateBatch(ps, out)
+		return
+	}
+	for i, p := range ps {
+		out[i] = s.Evaluate(p)
+	}
+}
+
+//-----------------------------------------------------------------------------
+// Scratch buffers for batch evaluation.
+
+var (
+	batchPool3 = sync.Pool{New: func() interface{} { return new([]v3.Vec) }}
+	batchPool2 = sync.Pool{New: func() interface{} { return new([]v2.Vec) }}
+	batchPool1 = sync.Pool{New: func() interface{} { return new([]float64) }}
+)
+
+// getBatch3 returns a buffer of n points. Return it with putBatch3.
+func getBatch3(n int) *[]v3.Vec {
+	b := batchPool3.Get().(*[]v3.Vec)
+	if cap(*b) < n {
+		*b = make([]v3.Vec, n)
+	}
+	*b = (*b)[:n]
+	return b
+}
+
+// putBatch3 returns a buffer to the pool.
+func putBatch3(b *[]v3.Vec) {
+	batchPool3.Put(b)
+}
+
+// getBatch2 returns a buffer of n points. Return it with putBatch2.
+func getBatch2(n int) *[]v2.Vec {
+	b := batchPool2.Get().(*[]v2.Vec)
+	if cap(*b) < n {
+		*b = make([]v2.Vec, n)
+	}
+	*b = (*b)[:n]
+	return b
+}
+
+// putBatch2 returns a buffer to the pool.
+func putBatch2(b *[]v2.Vec) {
+	batchPool2.Put(b)
+}
+
+// getBatch1 returns a buffer of n values. Return it with putBatch1.
+func getBatch1(n int) *[]float64 {
+	b := batchPool1.Get().(*[]float64)
+	if cap(*b) < n {
+		*b = make([]float64, n)
+	}
+	*b = (*b)[:n]
+	return b
+}
+
+// putBatch1 returns a buffer to the pool.
+func putBatch1(b *[]float64) {
+	batchPool1.Put(b)
+}
+
+//-----------------------------------------------------------------------------
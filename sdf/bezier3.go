@@ -0,0 +1,609 @@
+//-----------------------------------------------------------------------------
+/*
+
+Bezier Surface Patches
+
+A patch is defined by a (m+1) x (n+1) grid of control points giving a
+surface of degree m in u and degree n in v. The common case is bicubic
+(4 x 4 control points).
+
+The distance to a patch is found by subdividing the control points (de
+Casteljau). A patch is within the bounding box of its control points, so
+parts of the patch that can't be closer than the closest point found so far
+are skipped. Parts that are close to flat are refined with Newton-Raphson.
+
+A set of patches may be stitched into a closed solid. The patches must
+share control points along their boundaries so that the solid is watertight.
+The sign of the distance is given by the patch normals at the closest point.
+The closest point may be on an edge or a corner shared by patches, so the
+normals of all the patches it's on are added.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"errors"
+	"math"
+
+	v3 "github.com/deadsy/sdfx/vec/v3"
+)
+
+//-----------------------------------------------------------------------------
+
+const bezierMaxDegree = 7
+
+// bernstein returns the bernstein basis polynomials of degree n at t.
+func bernstein(n int, t float64) [bezierMaxDegree + 1]float64 {
+	var b [bezierMaxDegree + 1]float64
+	b[0] = 1
+	for j := 1; j <= n; j++ {
+		saved := 0.0
+		for i := 0; i < j; i++ {
+			tmp := b[i]
+			b[i] = saved + (1-t)*tmp
+			saved = t * tmp
+		}
+		b[j] = saved
+	}
+	return b
+}
+
+// bernsteinDerivatives returns the bernstein basis polynomials of degree n
+// at t and their 1st and 2nd derivatives.
+func bernsteinDerivatives(n int, t float64) (b0, b1, b2 [bezierMaxDegree + 1]float64) {
+	b0 = bernstein(n, t)
+	if n >= 1 {
+		x := bernstein(n-1, t)
+		k := float64(n)
+		for i := 0; i <= n; i++ {
+			if i >= 1 {
+				b1[i] += k * x[i-1]
+			}
+			if i < n {
+				b1[i] -= k * x[i]
+			}
+		}
+	}
+	if n >= 2 {
+		x := bernstein(n-2, t)
+		k := float64(n * (n - 1))
+		for i := 0; i <= n; i++ {
+			if i >= 2 {
+				b2[i] += k * x[i-2]
+			}
+			if i >= 1 && i <= n-1 {
+				b2[i] -= 2 * k * x[i-1]
+			}
+			if i <= n-2 {
+				b2[i] += k * x[i]
+			}
+		}
+	}
+	return
+}
+
+//-----------------------------------------------------------------------------
+
+// bezierMaxDepth is the maximum number of times a patch is subdivided for the closest point search.
+const bezierMaxDepth = 10
+
+// bezierFlatness is the largest distance (relative to their size) of the control points of a subdivided
+// patch from a bilinear patch for the Newton-Raphson refinement of the closest point.
+const bezierFlatness = 0.1
+
+// bezierPatch is a bezier surface patch.
+type bezierPatch struct {
+	cp     [][]v3.Vec // control points [u][v]
+	nu, nv int        // degree in u and v
+	net    []v3.Vec   // control points (indexed by i * (nv + 1) + j)
+	bb     Box3       // bounding box of the control points
+}
+
+// bezierNet is part of a patch, given by its control points and parameter range.
+type bezierNet struct {
+	cp             []v3.Vec // control points (indexed by i * (nv + 1) + j)
+	u0, u1, v0, v1 float64  // parameter range
+	depth          int      // number of subdivisions
+	bb             Box3     // bounding box of the control points
+}
+
+// newBezierPatch returns a bezier patch given a grid of control points.
+func newBezierPatch(cp [][]v3.Vec) (*bezierPatch, error) {
+	if len(cp) < 2 || len(cp) > bezierMaxDegree+1 {
+		return nil, errors.New("bezier patches need 2..8 rows of control points")
+	}
+	for i := range cp {
+		if len(cp[i]) != len(cp[0]) {
+			return nil, errors.New("bezier patch control point rows have different lengths")
+		}
+	}
+	if len(cp[0]) < 2 || len(cp[0]) > bezierMaxDegree+1 {
+		return nil, errors.New("bezier patches need 2..8 columns of control points")
+	}
+	p := bezierPatch{}
+	p.cp = cp
+	p.nu = len(cp) - 1
+	p.nv = len(cp[0]) - 1
+	// bezier surfaces are contained within the convex hull of the control points
+	p.bb = Box3{cp[0][0], cp[0][0]}
+	for i := range cp {
+		for j := range cp[i] {
+			p.bb = p.bb.Include(cp[i][j])
+		}
+	}
+	for i := range cp {
+		p.net = append(p.net, cp[i]...)
+	}
+	return &p, nil
+}
+
+// position returns the position of the surface at (u, v).
+func (p *bezierPatch) position(u, v float64) v3.Vec {
+	bu := bernstein(p.nu, u)
+	bv := bernstein(p.nv, v)
+	var s v3.Vec
+	for i := 0; i <= p.nu; i++ {
+		for j := 0; j <= p.nv; j++ {
+			s = s.Add(p.cp[i][j].MulScalar(bu[i] * bv[j]))
+		}
+	}
+	return s
+}
+
+// derivatives returns the position and 1st/2nd partial derivatives of the surface at (u, v).
+func (p *bezierPatch) derivatives(u, v float64) (s, su, sv, suu, suv, svv v3.Vec) {
+	bu0, bu1, bu2 := bernsteinDerivatives(p.nu, u)
+	bv0, bv1, bv2 := bernsteinDerivatives(p.nv, v)
+	for i := 0; i <= p.nu; i++ {
+		for j := 0; j <= p.nv; j++ {
+			c := p.cp[i][j]
+			s = s.Add(c.MulScalar(bu0[i] * bv0[j]))
+			su = su.Add(c.MulScalar(bu1[i] * bv0[j]))
+			sv = sv.Add(c.MulScalar(bu0[i] * bv1[j]))
+			suu = suu.Add(c.MulScalar(bu2[i] * bv0[j]))
+			suv = suv.Add(c.MulScalar(bu1[i] * bv1[j]))
+			svv = svv.Add(c.MulScalar(bu0[i] * bv2[j]))
+		}
+	}
+	return
+}
+
+// normal returns the (unnormalized) surface normal at (u, v).
+func (p *bezierPatch) normal(u, v float64) v3.Vec {
+	_, su, sv, _, _, _ := p.derivatives(u, v)
+	return su.Cross(sv)
+}
+
+const bezierMaxIters = 10
+
+// netBox returns the bounding box of the control points of a subdivided patch.
+func netBox(cp []v3.Vec) Box3 {
+	bb := Box3{cp[0], cp[0]}
+	for _, x := range cp[1:] {
+		bb = bb.Include(x)
+	}
+	return bb
+}
+
+// flat returns true if the control points of a subdivided patch are close to a bilinear patch.
+func (p *bezierPatch) flat(cp []v3.Vec, size float64) bool {
+	m := p.nv + 1
+	c00, c01, c10, c11 := cp[0], cp[p.nv], cp[p.nu*m], cp[p.nu*m+p.nv]
+	tol := bezierFlatness * size
+	for i := 0; i <= p.nu; i++ {
+		u := float64(i) / float64(p.nu)
+		for j := 0; j <= p.nv; j++ {
+			// the control points of a bilinear patch (raised to degree nu x nv)
+			v := float64(j) / float64(p.nv)
+			b := c00.MulScalar((1 - u) * (1 - v)).Add(c01.MulScalar((1 - u) * v)).Add(c10.MulScalar(u * (1 - v))).Add(c11.MulScalar(u * v))
+			if cp[i*m+j].Sub(b).Length() > tol {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// bezierSplit splits the control points of a bezier curve in half (de Casteljau).
+// The control points are c[0], c[stride], c[2 * stride]... and the halves are written in the same way.
+func bezierSplit(c, a, b []v3.Vec, n, stride int) {
+	var t [bezierMaxDegree + 1]v3.Vec
+	for i := 0; i <= n; i++ {
+		t[i] = c[i*stride]
+	}
+	for i := 0; i <= n; i++ {
+		a[i*stride] = t[0]
+		b[(n-i)*stride] = t[n-i]
+		for k := 0; k < n-i; k++ {
+			t[k] = t[k].Add(t[k+1]).MulScalar(0.5)
+		}
+	}
+}
+
+// split returns the 4 quarters of a subdivided patch.
+func (p *bezierPatch) split(n *bezierNet) [4]bezierNet {
+	m := p.nv + 1
+	size := len(n.cp)
+	buf := make([]v3.Vec, 6*size)
+	// split in u
+	lo, hi := buf[:size], buf[size:2*size]
+	for j := 0; j <= p.nv; j++ {
+		bezierSplit(n.cp[j:], lo[j:], hi[j:], p.nu, m)
+	}
+	// split in v
+	var q [4]bezierNet
+	for k, x := range [][]v3.Vec{lo, hi} {
+		a, b := buf[(2*k+2)*size:(2*k+3)*size], buf[(2*k+3)*size:(2*k+4)*size]
+		for i := 0; i <= p.nu; i++ {
+			bezierSplit(x[i*m:], a[i*m:], b[i*m:], p.nv, 1)
+		}
+		u0, u1 := n.u0, 0.5*(n.u0+n.u1)
+		if k == 1 {
+			u0, u1 = u1, n.u1
+		}
+		vm := 0.5 * (n.v0 + n.v1)
+		q[2*k] = bezierNet{a, u0, u1, n.v0, vm, n.depth + 1, netBox(a)}
+		q[2*k+1] = bezierNet{b, u0, u1, vm, n.v1, n.depth + 1, netBox(b)}
+	}
+	return q
+}
+
+// closest returns the (u, v) parameters of the closest surface point to p,
+// and the distance squared to that point. Only points closer than sqrt(d2)
+// are looked for, d2 is returned if there are none.
+func (p *bezierPatch) closest(x v3.Vec, d2 float64) (float64, float64, float64) {
+	var u, v float64
+	// Search the subdivided patches that may be closer (nearest first).
+	stack := []bezierNet{{p.net, 0, 1, 0, 1, 0, p.bb}}
+	m := p.nv + 1
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if n.bb.minDist2(x) >= d2 {
+			continue
+		}
+		// the patch goes through its corner control points
+		for i, k := range [4]int{0, p.nv, p.nu * m, p.nu*m + p.nv} {
+			if d := n.cp[k].Sub(x).Length2(); d < d2 {
+				u, v, d2 = Mix(n.u0, n.u1, float64(i>>1)), Mix(n.v0, n.v1, float64(i&1)), d
+			}
+		}
+		if n.depth == bezierMaxDepth || p.flat(n.cp, n.bb.Size().Length()) {
+			nu, nv, nd2 := p.newton(x, 0.5*(n.u0+n.u1), 0.5*(n.v0+n.v1))
+			if nd2 < d2 {
+				u, v, d2 = nu, nv, nd2
+			}
+			continue
+		}
+		// push the farthest first
+		q := p.split(&n)
+		var dq [4]float64
+		for i := range q {
+			dq[i] = q[i].bb.minDist2(x)
+		}
+		order := [4]int{0, 1, 2, 3}
+		for i := 1; i < 4; i++ {
+			for j := i; j > 0 && dq[order[j]] > dq[order[j-1]]; j-- {
+				order[j], order[j-1] = order[j-1], order[j]
+			}
+		}
+		for _, i := range order {
+			if dq[i] < d2 {
+				stack = append(stack, q[i])
+			}
+		}
+	}
+	return u, v, d2
+}
+
+// newton refines the closest surface point to p starting from (u, v).
+// It returns the (u, v) parameters of the point and the distance squared to it.
+func (p *bezierPatch) newton(x v3.Vec, u, v float64) (float64, float64, float64) {
+	// Newton-Raphson minimisation of |s(u,v) - x|^2
+	for i := 0; i < bezierMaxIters; i++ {
+		s, su, sv, suu, suv, svv := p.derivatives(u, v)
+		r := s.Sub(x)
+		// gradient
+		gu := r.Dot(su)
+		gv := r.Dot(sv)
+		// hessian
+		huu := su.Dot(su) + r.Dot(suu)
+		huv := su.Dot(sv) + r.Dot(suv)
+		hvv := sv.Dot(sv) + r.Dot(svv)
+		det := huu*hvv - huv*huv
+		if huu <= 0 || det <= 0 {
+			// not positive definite, use gauss-newton
+			huu = su.Dot(su)
+			huv = su.Dot(sv)
+			hvv = sv.Dot(sv)
+			det = huu*hvv - huv*huv
+		}
+		// On an edge of the patch (with the minimum beyond it) only move along the edge.
+		fixu := (u <= 0 && gu > 0) || (u >= 1 && gu < 0)
+		fixv := (v <= 0 && gv > 0) || (v >= 1 && gv < 0)
+		var du, dv float64
+		switch {
+		case fixu && fixv:
+			return u, v, r.Length2()
+		case fixu:
+			if hvv <= epsilon {
+				return u, v, r.Length2()
+			}
+			dv = gv / hvv
+		case fixv:
+			if huu <= epsilon {
+				return u, v, r.Length2()
+			}
+			du = gu / huu
+		default:
+			if det <= epsilon {
+				return u, v, r.Length2()
+			}
+			du = (hvv*gu - huv*gv) / det
+			dv = (huu*gv - huv*gu) / det
+		}
+		// shorten the step until it reduces the distance
+		done := true
+		for t := 1.0; t > 1e-3; t *= 0.5 {
+			un := Clamp(u-t*du, 0, 1)
+			vn := Clamp(v-t*dv, 0, 1)
+			if math.Abs(un-u) < tolerance && math.Abs(vn-v) < tolerance {
+				break
+			}
+			if p.position(un, vn).Sub(x).Length2() < r.Length2() {
+				u, v = un, vn
+				done = false
+				break
+			}
+		}
+		if done {
+			break
+		}
+	}
+	return u, v, p.position(u, v).Sub(x).Length2()
+}
+
+// edge returns the control points for an edge of the patch (0..3 = u0, u1, v0, v1).
+func (p *bezierPatch) edge(i int) []v3.Vec {
+	switch i {
+	case 0:
+		return p.cp[0]
+	case 1:
+		return p.cp[p.nu]
+	}
+	e := make([]v3.Vec, p.nu+1)
+	for k := range e {
+		if i == 2 {
+			e[k] = p.cp[k][0]
+		} else {
+			e[k] = p.cp[k][p.nv]
+		}
+	}
+	return e
+}
+
+// triangles returns a tessellation of the patch with n x n quads.
+func (p *bezierPatch) triangles(n int) []Triangle3 {
+	v := make([][]v3.Vec, n+1)
+	for i := range v {
+		v[i] = make([]v3.Vec, n+1)
+		for j := range v[i] {
+			v[i][j] = p.position(float64(i)/float64(n), float64(j)/float64(n))
+		}
+	}
+	t := make([]Triangle3, 0, 2*n*n)
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			t = append(t, Triangle3{v[i][j], v[i+1][j], v[i+1][j+1]})
+			t = append(t, Triangle3{v[i][j], v[i+1][j+1], v[i][j+1]})
+		}
+	}
+	return t
+}
+
+//-----------------------------------------------------------------------------
+
+// BezierPatchSDF3 is a thin shell made from a bezier surface patch.
+type BezierPatchSDF3 struct {
+	patch     *bezierPatch
+	thickness float64 // half thickness
+	bb        Box3
+}
+
+// BezierPatch3D returns a thin shell of the given thickness centered on a bezier surface patch.
+// The control points are a (m+1) x (n+1) grid for a patch of degree m x n (4 x 4 for a bicubic patch).
+func BezierPatch3D(cp [][]v3.Vec, thickness float64) (SDF3, error) {
+	if thickness <= 0 {
+		return nil, ErrMsg("thickness <= 0")
+	}
+	patch, err := newBezierPatch(cp)
+	if err != nil {
+		return nil, err
+	}
+	s := BezierPatchSDF3{}
+	s.patch = patch
+	s.thickness = thickness * 0.5
+	s.bb = patch.bb.Enlarge(v3.Vec{thickness, thickness, thickness})
+	return &s, nil
+}
+
+// Evaluate returns the minimum distance to a bezier patch shell.
+func (s *BezierPatchSDF3) Evaluate(p v3.Vec) float64 {
+	_, _, d2 := s.patch.closest(p, math.Inf(1))
+	return math.Sqrt(d2) - s.thickness
+}
+
+// EvaluateInterval returns an interval containing the values of a bezier patch shell within a box.
+func (s *BezierPatchSDF3) EvaluateInterval(b Box3) Interval {
+	// exact distance field
+	return exactInterval3(s, b)
+}
+
+// BoundingBox returns the bounding box for a bezier patch shell.
+func (s *BezierPatchSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
+
+// bezierTessellation is the number of quads per axis used to tessellate a patch for the volume.
+const bezierTessellation = 16
+
+// BezierSolidSDF3 is a closed solid made from a set of bezier surface patches.
+type BezierSolidSDF3 struct {
+	patch []*bezierPatch
+	sign  float64 // +1 for outward facing patches, -1 for inward facing patches
+	tol   float64 // distance within which closest points on different patches are the same point
+	bb    Box3
+}
+
+// edgeEquals returns true if two patch edges have the same control points in either direction.
+func edgeEquals(a, b []v3.Vec) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	fwd, rev := true, true
+	n := len(a) - 1
+	for i := range a {
+		fwd = fwd && a[i].Equals(b[i], tolerance)
+		rev = rev && a[i].Equals(b[n-i], tolerance)
+	}
+	return fwd || rev
+}
+
+// edgeDegenerate returns true if all of the control points on an edge are the same.
+func edgeDegenerate(a []v3.Vec) bool {
+	for i := range a {
+		if !a[i].Equals(a[0], tolerance) {
+			return false
+		}
+	}
+	return true
+}
+
+// BezierSolid3D returns a closed solid made by stitching together a set of bezier surface patches.
+// Each non-degenerate patch edge must be shared with exactly one other patch edge.
+// The patches must have a consistent orientation (all inward or all outward facing).
+func BezierSolid3D(cp [][][]v3.Vec) (SDF3, error) {
+	if len(cp) < 2 {
+		return nil, errors.New("bezier solids need at least 2 patches")
+	}
+	s := BezierSolidSDF3{}
+	s.patch = make([]*bezierPatch, len(cp))
+	for i := range cp {
+		patch, err := newBezierPatch(cp[i])
+		if err != nil {
+			return nil, err
+		}
+		s.patch[i] = patch
+		if i == 0 {
+			s.bb = patch.bb
+		} else {
+			s.bb = s.bb.Extend(patch.bb)
+		}
+	}
+
+	// check that the patches are watertight
+	for i, pi := range s.patch {
+		for ei := 0; ei < 4; ei++ {
+			e := pi.edge(ei)
+			if edgeDegenerate(e) {
+				continue
+			}
+			n := 0
+			for j, pj := range s.patch {
+				for ej := 0; ej < 4; ej++ {
+					if (i != j || ei != ej) && edgeEquals(e, pj.edge(ej)) {
+						n++
+					}
+				}
+			}
+			if n != 1 {
+				return nil, errors.New("bezier patches are not watertight")
+			}
+		}
+	}
+
+	// tessellate the patches and work out the orientation from the signed volume
+	volume := 0.0
+	for _, patch := range s.patch {
+		for _, t := range patch.triangles(bezierTessellation) {
+			volume += t[0].Dot(t[1].Cross(t[2]))
+		}
+	}
+	if volume == 0 {
+		return nil, errors.New("bezier solid has zero volume")
+	}
+	s.sign = 1
+	if volume < 0 {
+		s.sign = -1
+	}
+
+	s.tol = 1e-6 * s.bb.Size().Length()
+	// make the bounding box a little larger than the solid
+	s.bb = s.bb.ScaleAboutCenter(1.01)
+	return &s, nil
+}
+
+// unitNormal returns the unit surface normal of a patch at (u, v).
+// The normal at a degenerate point (E.g. a collapsed edge) is taken from a point just inside the patch.
+func (p *bezierPatch) unitNormal(u, v float64) v3.Vec {
+	for i := 0; i < 4; i++ {
+		n := p.normal(u, v)
+		if l := n.Length(); l > epsilon {
+			return n.DivScalar(l)
+		}
+		u += 1e-4 * (0.5 - u)
+		v += 1e-4 * (0.5 - v)
+	}
+	return v3.Vec{}
+}
+
+// Evaluate returns the minimum distance to a bezier solid.
+func (s *BezierSolidSDF3) Evaluate(p v3.Vec) float64 {
+	type closest struct {
+		patch *bezierPatch
+		u, v  float64
+		d     float64
+	}
+	// find the closest point on each patch that may be closest
+	var c []closest
+	d := math.Inf(1)
+	for _, x := range s.patch {
+		// look for points within the tolerance of the closest so far
+		b := d + s.tol
+		u, v, d2 := x.closest(p, b*b)
+		if d2 < b*b {
+			c = append(c, closest{x, u, v, math.Sqrt(d2)})
+			d = math.Min(d, math.Sqrt(d2))
+		}
+	}
+	// The sign is given by the normal at the closest point. The point may be on an
+	// edge (or corner) of several patches, so add the normals of all of them.
+	var n, q v3.Vec
+	for _, x := range c {
+		if x.d <= d+s.tol {
+			n = n.Add(x.patch.unitNormal(x.u, x.v))
+			q = x.patch.position(x.u, x.v)
+		}
+	}
+	if p.Sub(q).Dot(n)*s.sign < 0 {
+		return -d
+	}
+	return d
+}
+
+// EvaluateInterval returns an interval containing the values of a bezier solid within a box.
+func (s *BezierSolidSDF3) EvaluateInterval(b Box3) Interval {
+	// exact distance field
+	return exactInterval3(s, b)
+}
+
+// BoundingBox returns the bounding box for a bezier solid.
+func (s *BezierSolidSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,312 @@
+//-----------------------------------------------------------------------------
+/*
+
+Variable Blending
+
+UnionSDF3.SetMin and DifferenceSDF3.SetMax use one blend size for the
+whole object. These SDFs vary the blend size, either per child or with a
+function of position.
+
+The blend size is passed to the BlendFunc of a Blend (E.g. RoundBlend) to get
+the minimum function at each point. These get smaller (more blending) as the
+blend size increases, so a varying blend size adds to the gradient of the
+field. The blends themselves can also have gradients greater than 1 (E.g.
+RoundMin where the surfaces are parallel), and blending the blended union of
+the earlier children with the next child compounds this. The result is scaled
+down by the worst case lipschitz constant so it remains a bound on the
+distance to the surface.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"math"
+
+	v3 "github.com/deadsy/sdfx/vec/v3"
+)
+
+//-----------------------------------------------------------------------------
+
+// BlendFunc returns a minimum function for a blend size k.
+// E.g. RoundMin, ChamferMin, PolyMin.
+type BlendFunc func(k float64) MinFunc
+
+// RadiusFunc returns the blend size at a point.
+type RadiusFunc func(p v3.Vec) float64
+
+//-----------------------------------------------------------------------------
+
+// Blend is a named family of minimum functions with a blend size.
+// SDFs blended with a Blend (rather than with a MinFunc or MaxFunc) can be serialized.
+type Blend struct {
+	Name string    // name of the minimum function
+	Min  BlendFunc // minimum function for a blend size
+	// Lipschitz returns the lipschitz constant of the blend of two fields with lipschitz constants a and b.
+	// It's nil if this isn't known.
+	Lipschitz func(a, b float64) float64
+	// Slope is the maximum rate of change of the minimum functions with the blend size.
+	// It's 0 if the blend size can't vary with position.
+	Slope float64
+}
+
+// Blends that can be serialized.
+var (
+	// The gradients of the blended fields may be aligned, giving their length.
+	RoundBlend = &Blend{Name: "RoundMin", Min: RoundMin, Lipschitz: math.Hypot, Slope: math.Sqrt2 - 1}
+	// The chamfer is at 45 degrees to both surfaces.
+	ChamferBlend = &Blend{Name: "ChamferMin", Min: ChamferMin, Lipschitz: chamferLipschitz, Slope: sqrtHalf}
+	// ExpMin is a weighted average of the gradients, k is a sharpness rather than a blend size.
+	ExpBlend = &Blend{Name: "ExpMin", Min: ExpMin, Lipschitz: math.Max}
+	PowBlend = &Blend{Name: "PowMin", Min: PowMin}
+	// PolyMin is a weighted average of the gradients.
+	PolyBlend = &Blend{Name: "PolyMin", Min: PolyMin, Lipschitz: math.Max, Slope: 0.25}
+)
+
+// chamferLipschitz returns the lipschitz constant of a chamfered blend of two fields.
+func chamferLipschitz(a, b float64) float64 {
+	return math.Max(math.Max(a, b), (a+b)*sqrtHalf)
+}
+
+var blends = []*Blend{RoundBlend, ChamferBlend, ExpBlend, PowBlend, PolyBlend}
+
+// blendParms records the blend used to make the min/max function of an SDF.
+type blendParms struct {
+	blend  *Blend  // nil for math.Min/math.Max
+	k      float64 // blend size
+	custom bool    // the function was set with SetMin/SetMax
+}
+
+// min returns the minimum function for a blend size (math.Min for a nil blend or a blend size <= 0).
+func (b *Blend) min(k float64) MinFunc {
+	if b == nil || k <= 0 {
+		return math.Min
+	}
+	return b.Min(k)
+}
+
+// max returns the maximum function for a blend size, max(a, b) = -min(-a, -b) (math.Max for a nil blend).
+func (b *Blend) max(k float64) MaxFunc {
+	if b == nil || k <= 0 {
+		return math.Max
+	}
+	min := b.Min(k)
+	return func(x, y float64) float64 {
+		return -min(-x, -y)
+	}
+}
+
+// fieldMin returns the minimum function for a blend size that varies.
+// RoundMin and ChamferMin don't go to math.Min within the solid as the blend size goes to 0,
+// so they're used with a zero blend size to keep the field continuous.
+func (b *Blend) fieldMin(k float64) MinFunc {
+	return b.Min(math.Max(k, 0))
+}
+
+//-----------------------------------------------------------------------------
+
+// radiusInterval returns the range of blend sizes within a box.
+func radiusInterval(radius RadiusFunc, slope float64, b Box3) (float64, float64) {
+	k := radius(b.Center())
+	h := slope * 0.5 * b.Size().Length()
+	return math.Max(k-h, 0), math.Max(k+h, 0)
+}
+
+//-----------------------------------------------------------------------------
+
+// BlendUnionSDF3 is a union of SDF3s with a variable blend size.
+type BlendUnionSDF3 struct {
+	sdf    []SDF3
+	blend  *Blend
+	radii  []float64  // blend size for each child (after the first)
+	min    []MinFunc  // minimum function for each child (after the first)
+	radius RadiusFunc // blend size as a function of position
+	slope  float64    // maximum rate of change of the blend size
+	k      float64    // lipschitz constant of the blended field
+	bb     Box3
+}
+
+// newBlendUnion3D returns a blended union with the common fields set.
+func newBlendUnion3D(sdf []SDF3, blend *Blend) (*BlendUnionSDF3, error) {
+	if len(sdf) < 2 {
+		return nil, ErrMsg("len(sdf) < 2")
+	}
+	if blend == nil {
+		return nil, ErrMsg("blend == nil")
+	}
+	if blend.Lipschitz == nil {
+		return nil, ErrMsg("unknown lipschitz constant for " + blend.Name)
+	}
+	bb := sdf[0].BoundingBox()
+	for _, x := range sdf {
+		if x == nil {
+			return nil, ErrMsg("sdf == nil")
+		}
+		bb = bb.Extend(x.BoundingBox())
+	}
+	return &BlendUnionSDF3{
+		sdf:   sdf,
+		blend: blend,
+		k:     1,
+		bb:    bb,
+	}, nil
+}
+
+// SmoothUnion3D returns the union of SDF3s with a blend size for each child.
+// The children are joined in order, radii[i] is the blend size used to join sdf[i+1]
+// to the union of sdf[0] to sdf[i]. A blend size of 0 is a sharp edge.
+func SmoothUnion3D(sdf []SDF3, radii []float64, blend *Blend) (SDF3, error) {
+	s, err := newBlendUnion3D(sdf, blend)
+	if err != nil {
+		return nil, err
+	}
+	if len(radii) != len(sdf)-1 {
+		return nil, ErrMsg("len(radii) != len(sdf) - 1")
+	}
+	s.radii = radii
+	s.min = make([]MinFunc, len(radii))
+	for i, k := range radii {
+		if k < 0 {
+			return nil, ErrMsg("radius < 0")
+		}
+		if k > 0 {
+			// the union so far is blended with the next child
+			s.k = blend.Lipschitz(s.k, 1)
+		}
+		s.min[i] = blend.min(k)
+	}
+	return s, nil
+}
+
+// FieldUnion3D returns the union of SDF3s with a blend size that is a function of position.
+// The slope is the maximum rate of change of the blend size with distance (its lipschitz constant).
+// The radius function can't be serialized, so unlike SmoothUnion3D the result can't be marshalled.
+func FieldUnion3D(sdf []SDF3, radius RadiusFunc, slope float64, blend *Blend) (SDF3, error) {
+	s, err := newBlendUnion3D(sdf, blend)
+	if err != nil {
+		return nil, err
+	}
+	if blend.Slope == 0 {
+		return nil, ErrMsg("the blend size of " + blend.Name + " can't vary")
+	}
+	if radius == nil {
+		return nil, ErrMsg("radius == nil")
+	}
+	if slope < 0 {
+		return nil, ErrMsg("slope < 0")
+	}
+	s.radius = radius
+	s.slope = slope
+	for range sdf[1:] {
+		s.k = blend.Lipschitz(s.k, 1) + blend.Slope*slope
+	}
+	return s, nil
+}
+
+// Evaluate returns the minimum distance to a blended SDF3 union.
+func (s *BlendUnionSDF3) Evaluate(p v3.Vec) float64 {
+	d := s.sdf[0].Evaluate(p)
+	if s.radius == nil {
+		for i, x := range s.sdf[1:] {
+			d = s.min[i](d, x.Evaluate(p))
+		}
+	} else {
+		min := s.blend.fieldMin(s.radius(p))
+		for _, x := range s.sdf[1:] {
+			d = min(d, x.Evaluate(p))
+		}
+	}
+	return d / s.k
+}
+
+// EvaluateInterval returns an interval containing the values of a blended SDF3 union within a box.
+func (s *BlendUnionSDF3) EvaluateInterval(b Box3) Interval {
+	d := EvaluateInterval3(s.sdf[0], b)
+	if s.radius == nil {
+		for i, x := range s.sdf[1:] {
+			d = minInterval(s.min[i], d, EvaluateInterval3(x, b))
+		}
+	} else {
+		// more blending gives smaller values
+		k0, k1 := radiusInterval(s.radius, s.slope, b)
+		min0, min1 := s.blend.fieldMin(k1), s.blend.fieldMin(k0)
+		for _, x := range s.sdf[1:] {
+			dx := EvaluateInterval3(x, b)
+			d = Interval{min0(d[0], dx[0]), min1(d[1], dx[1])}
+		}
+	}
+	return Interval{d[0] / s.k, d[1] / s.k}
+}
+
+// BoundingBox returns the bounding box of a blended SDF3 union.
+func (s *BlendUnionSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
+
+// BlendDifferenceSDF3 is the difference of two SDF3s with a variable blend size.
+type BlendDifferenceSDF3 struct {
+	s0, s1 SDF3
+	blend  *Blend
+	radius RadiusFunc // blend size as a function of position
+	slope  float64    // maximum rate of change of the blend size
+	k      float64    // lipschitz constant of the blended field
+}
+
+// FieldDifference3D returns the difference of two SDF3s (s0 - s1) with a blend size that is a function of position.
+// The slope is the maximum rate of change of the blend size with distance (its lipschitz constant).
+// The radius function can't be serialized, so the result can't be marshalled.
+func FieldDifference3D(s0, s1 SDF3, radius RadiusFunc, slope float64, blend *Blend) (SDF3, error) {
+	if s0 == nil || s1 == nil {
+		return nil, ErrMsg("sdf == nil")
+	}
+	if blend == nil {
+		return nil, ErrMsg("blend == nil")
+	}
+	if blend.Lipschitz == nil {
+		return nil, ErrMsg("unknown lipschitz constant for " + blend.Name)
+	}
+	if blend.Slope == 0 {
+		return nil, ErrMsg("the blend size of " + blend.Name + " can't vary")
+	}
+	if radius == nil {
+		return nil, ErrMsg("radius == nil")
+	}
+	if slope < 0 {
+		return nil, ErrMsg("slope < 0")
+	}
+	return &BlendDifferenceSDF3{
+		s0:     s0,
+		s1:     s1,
+		blend:  blend,
+		radius: radius,
+		slope:  slope,
+		k:      blend.Lipschitz(1, 1) + blend.Slope*slope,
+	}, nil
+}
+
+// Evaluate returns the minimum distance to a blended SDF3 difference.
+func (s *BlendDifferenceSDF3) Evaluate(p v3.Vec) float64 {
+	// max(a, b) = -min(-a, -b)
+	min := s.blend.fieldMin(s.radius(p))
+	return -min(-s.s0.Evaluate(p), s.s1.Evaluate(p)) / s.k
+}
+
+// EvaluateInterval returns an interval containing the values of a blended SDF3 difference within a box.
+func (s *BlendDifferenceSDF3) EvaluateInterval(b Box3) Interval {
+	d0 := EvaluateInterval3(s.s0, b).neg()
+	d1 := EvaluateInterval3(s.s1, b)
+	k0, k1 := radiusInterval(s.radius, s.slope, b)
+	lo := s.blend.fieldMin(k1)(d0[0], d1[0])
+	hi := s.blend.fieldMin(k0)(d0[1], d1[1])
+	return Interval{-hi / s.k, -lo / s.k}
+}
+
+// BoundingBox returns the bounding box of a blended SDF3 difference.
+func (s *BlendDifferenceSDF3) BoundingBox() Box3 {
+	return s.s0.BoundingBox()
+}
+
+//-----------------------------------------------------------------------------
@@ -80,6 +80,22 @@ func (a Box2) Contains(v v2.Vec) bool {
 		v.Y <= a.Max.Y
 }
 
+// overlap returns true if two 2d boxes overlap.
+func (a Box2) overlap(b Box2) bool {
+	return a.Min.X <= b.Max.X &&
+		a.Min.Y <= b.Max.Y &&
+		b.Min.X <= a.Max.X &&
+		b.Min.Y <= a.Max.Y
+}
+
+// intersect returns the intersection of two 2d boxes.
+// Disjoint boxes give a zero size box between them.
+func (a Box2) intersect(b Box2) Box2 {
+	lo := a.Min.Max(b.Min)
+	hi := a.Max.Min(b.Max)
+	return Box2{lo.Min(hi), hi.Max(lo)}
+}
+
 // Vertices returns a slice of 2d box corner vertices.
 func (a Box2) Vertices() v2.VecSet {
 	return []v2.Vec{
@@ -202,6 +218,26 @@ func (m *Map2) ToV2i(p v2.Vec) v2i.Vec {
 //-----------------------------------------------------------------------------
 // Minimum/Maximum distances from a point to a box
 
+// minDist2 returns the minimum dist * dist from a point to a box.
+// Points within the box have minimum distance = 0.
+func (a Box2) minDist2(p v2.Vec) float64 {
+	dx := rangeDist(a.Min.X, a.Max.X, p.X)
+	dy := rangeDist(a.Min.Y, a.Max.Y, p.Y)
+	return dx*dx + dy*dy
+}
+
+// rangeDist returns the distance from x to the range [min, max].
+// This is on the hot path for BVH searches, so it avoids math.Max.
+func rangeDist(min, max, x float64) float64 {
+	if x < min {
+		return min - x
+	}
+	if x > max {
+		return x - max
+	}
+	return 0
+}
+
 // MinMaxDist2 returns the minimum and maximum dist * dist from a point to a box.
 // Points within the box have minimum distance = 0.
 func (a Box2) MinMaxDist2(p v2.Vec) Interval {
@@ -320,18 +356,6 @@ func (a *Box2) lineIntersect(l *Line2) *Line2 {
 	return &Line2{pSet[1], pSet[0]}
 }
 
-// lineFilter returns the intersection of a box and a set of line segments.
-func (a *Box2) lineFilter(lSet []*Line2) []*Line2 {
-	var out []*Line2
-	for _, l := range lSet {
-		x := a.lineIntersect(l)
-		if x != nil {
-			out = append(out, x)
-		}
-	}
-	return out
-}
-
 //-----------------------------------------------------------------------------
 
 // Random returns a random point within a 2d box.
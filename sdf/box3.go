@@ -79,6 +79,24 @@ func (a Box3) Contains(v v3.Vec) bool {
 		v.Z <= a.Max.Z
 }
 
+// overlap returns true if two 3d boxes overlap.
+func (a Box3) overlap(b Box3) bool {
+	return a.Min.X <= b.Max.X &&
+		a.Min.Y <= b.Max.Y &&
+		a.Min.Z <= b.Max.Z &&
+		b.Min.X <= a.Max.X &&
+		b.Min.Y <= a.Max.Y &&
+		b.Min.Z <= a.Max.Z
+}
+
+// intersect returns the intersection of two 3d boxes.
+// Disjoint boxes give a zero size box between them.
+func (a Box3) intersect(b Box3) Box3 {
+	lo := a.Min.Max(b.Min)
+	hi := a.Max.Min(b.Max)
+	return Box3{lo.Min(hi), hi.Max(lo)}
+}
+
 // Vertices returns a slice of 3d box corner vertices.
 func (a Box3) Vertices() v3.VecSet {
 	return []v3.Vec{
@@ -163,6 +181,32 @@ func (a Box3) oct7() Box3 {
 //-----------------------------------------------------------------------------
 // Minimum/Maximum distances from a point to a box
 
+// minDist2 returns the minimum dist * dist from a point to a box.
+// Points within the box have minimum distance = 0.
+func (a Box3) minDist2(p v3.Vec) float64 {
+	dx := rangeDist(a.Min.X, a.Max.X, p.X)
+	dy := rangeDist(a.Min.Y, a.Max.Y, p.Y)
+	dz := rangeDist(a.Min.Z, a.Max.Z, p.Z)
+	return dx*dx + dy*dy + dz*dz
+}
+
+// boxDist2 returns the minimum dist * dist between two boxes.
+// Overlapping boxes have minimum distance = 0.
+func (a Box3) boxDist2(b Box3) float64 {
+	dx := math.Max(0, math.Max(b.Min.X-a.Max.X, a.Min.X-b.Max.X))
+	dy := math.Max(0, math.Max(b.Min.Y-a.Max.Y, a.Min.Y-b.Max.Y))
+	dz := math.Max(0, math.Max(b.Min.Z-a.Max.Z, a.Min.Z-b.Max.Z))
+	return dx*dx + dy*dy + dz*dz
+}
+
+// maxDist2 returns the maximum over the points of box b of the minimum dist * dist to box a.
+func (a Box3) maxDist2(b Box3) float64 {
+	dx := math.Max(rangeDist(a.Min.X, a.Max.X, b.Min.X), rangeDist(a.Min.X, a.Max.X, b.Max.X))
+	dy := math.Max(rangeDist(a.Min.Y, a.Max.Y, b.Min.Y), rangeDist(a.Min.Y, a.Max.Y, b.Max.Y))
+	dz := math.Max(rangeDist(a.Min.Z, a.Max.Z, b.Min.Z), rangeDist(a.Min.Z, a.Max.Z, b.Max.Z))
+	return dx*dx + dy*dy + dz*dz
+}
+
 // MinMaxDist2 returns the minimum and maximum dist * dist from a point to a box.
 // Points within the box have minimum distance = 0.
 func (a Box3) MinMaxDist2(p v3.Vec) Interval {
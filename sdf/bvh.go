@@ -0,0 +1,338 @@
+//-----------------------------------------------------------------------------
+/*
+
+Bounding Volume Hierarchies
+
+A BVH is a binary tree of bounding boxes built over a set of objects
+(e.g. the members of a union or the triangles of a mesh). The minimum
+distance is found with a branch and bound search of the tree. A subtree is
+skipped when the distance to its bounding box is no less than the minimum
+distance found so far.
+
+This assumes the distance to an SDF is no less than the distance to its
+bounding box. That's true for a distance field, so the minimum is the same
+as evaluating every member of the union. It isn't true for SDFs that return
+a bound on the distance (e.g. the max of an extrusion, or a scaled
+transform), so unions only use a BVH if every member is known to be exact
+outside of its bounding box.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"math"
+	"sort"
+
+	v2 "github.com/deadsy/sdfx/vec/v2"
+	v3 "github.com/deadsy/sdfx/vec/v3"
+)
+
+//-----------------------------------------------------------------------------
+
+// bvhLeafSize is the maximum number of objects in a BVH leaf node.
+const bvhLeafSize = 2
+
+// bvhMinSize is the minimum number of SDFs for which a BVH is built.
+const bvhMinSize = 4
+
+// bvhStackSize is the size of the BVH traversal stack.
+// The tree is balanced so this is deep enough for any practical union.
+const bvhStackSize = 64
+
+// bvhSkip returns true if a subtree at minimum distance squared d2 can't improve on the minimum distance d.
+func bvhSkip(d2, d float64) bool {
+	// Points outside a bounding box have a positive distance to the SDF.
+	return d2 > 0 && (d <= 0 || d2 >= d*d)
+}
+
+// isRigid3 returns true if a transform is a rotation and a translation.
+func isRigid3(m M44) bool {
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			x := m[4*i]*m[4*j] + m[4*i+1]*m[4*j+1] + m[4*i+2]*m[4*j+2]
+			if i == j {
+				x--
+			}
+			if !isZero(x) {
+				return false
+			}
+		}
+	}
+	return isZero(m[12]) && isZero(m[13]) && isZero(m[14]) && isZero(m[15]-1)
+}
+
+// isRigid2 returns true if a transform is a rotation and a translation.
+func isRigid2(m M33) bool {
+	for i := 0; i < 2; i++ {
+		for j := 0; j < 2; j++ {
+			x := m[3*i]*m[3*j] + m[3*i+1]*m[3*j+1]
+			if i == j {
+				x--
+			}
+			if !isZero(x) {
+				return false
+			}
+		}
+	}
+	return isZero(m[6]) && isZero(m[7]) && isZero(m[8]-1)
+}
+
+// bvhExact3 returns true if an SDF3 is no less than the distance to its bounding box.
+func bvhExact3(s SDF3) bool {
+	switch s := s.(type) {
+	case *SphereSDF3, *BoxSDF3, *CylinderSDF3, *ConeSDF3, *MeshSDF3:
+		return true
+	case *translateSDF3:
+		return bvhExact3(s.sdf)
+	case *ScaleUniformSDF3:
+		return bvhExact3(s.sdf)
+	case *TransformSDF3:
+		return isRigid3(s.matrix) && bvhExact3(s.sdf)
+	case *UnionSDF3:
+		if !isMin(s.min) {
+			return false
+		}
+		for _, x := range s.sdf {
+			if !bvhExact3(x) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// bvhExact2 returns true if an SDF2 is no less than the distance to its bounding box.
+func bvhExact2(s SDF2) bool {
+	switch s := s.(type) {
+	case *CircleSDF2, *BoxSDF2, *MeshSDF2:
+		return true
+	case *translateSDF2:
+		return bvhExact2(s.sdf)
+	case *ScaleUniformSDF2:
+		return bvhExact2(s.sdf)
+	case *TransformSDF2:
+		return isRigid2(s.matrix) && bvhExact2(s.sdf)
+	case *UnionSDF2:
+		if !isMin(s.min) {
+			return false
+		}
+		for _, x := range s.sdf {
+			if !bvhExact2(x) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+//-----------------------------------------------------------------------------
+
+type bvhNode3 struct {
+	bb          Box3
+	left, right int // child nodes (left < 0 for a leaf)
+	start, end  int // leaf object indices
+}
+
+// bvh3 is a bounding volume hierarchy for a set of SDF3s.
+type bvh3 struct {
+	node  []bvhNode3
+	index []int // object indices sorted into leaf order
+}
+
+// newBVH3 returns a BVH for a set of SDF3s.
+func newBVH3(sdf []SDF3) *bvh3 {
+	bb := make([]Box3, len(sdf))
+	for i, s := range sdf {
+		bb[i] = s.BoundingBox()
+	}
+	return boxBVH3(bb)
+}
+
+// boxBVH3 returns a BVH for a set of bounding boxes.
+func boxBVH3(bb []Box3) *bvh3 {
+	b := bvh3{
+		node:  make([]bvhNode3, 0, 2*len(bb)),
+		index: make([]int, len(bb)),
+	}
+	for i := range bb {
+		b.index[i] = i
+	}
+	b.build(bb, 0, len(bb))
+	return &b
+}
+
+// build adds the nodes for a range of object indices and returns the index of the root node.
+func (b *bvh3) build(bb []Box3, start, end int) int {
+	k := len(b.node)
+	b.node = append(b.node, bvhNode3{left: -1, start: start, end: end})
+	box := bb[b.index[start]]
+	centers := Box3{box.Center(), box.Center()}
+	for _, i := range b.index[start+1 : end] {
+		box = box.Extend(bb[i])
+		centers = centers.Include(bb[i].Center())
+	}
+	b.node[k].bb = box
+	if end-start <= bvhLeafSize {
+		return k
+	}
+	// split the objects at the median of the axis with the largest spread of centers
+	size := centers.Size()
+	axis := func(v v3.Vec) float64 { return v.X }
+	if size.Y > size.X && size.Y >= size.Z {
+		axis = func(v v3.Vec) float64 { return v.Y }
+	} else if size.Z > size.X && size.Z > size.Y {
+		axis = func(v v3.Vec) float64 { return v.Z }
+	}
+	index := b.index[start:end]
+	sort.SliceStable(index, func(i, j int) bool {
+		return axis(bb[index[i]].Center()) < axis(bb[index[j]].Center())
+	})
+	mid := (start + end) / 2
+	left := b.build(bb, start, mid)
+	right := b.build(bb, mid, end)
+	b.node[k].left = left
+	b.node[k].right = right
+	return k
+}
+
+// min returns the minimum distance to a set of SDF3s.
+func (b *bvh3) min(sdf []SDF3, p v3.Vec) float64 {
+	d := math.Inf(1)
+	var stack [bvhStackSize]int
+	n := 1
+	for n > 0 {
+		n--
+		node := &b.node[stack[n]]
+		if node.left < 0 {
+			for _, i := range b.index[node.start:node.end] {
+				d = math.Min(d, sdf[i].Evaluate(p))
+			}
+			continue
+		}
+		// visit the closer child first
+		l, r := node.left, node.right
+		dl := b.node[l].bb.minDist2(p)
+		dr := b.node[r].bb.minDist2(p)
+		if dl > dr {
+			l, r = r, l
+			dl, dr = dr, dl
+		}
+		if !bvhSkip(dr, d) {
+			stack[n] = r
+			n++
+		}
+		if !bvhSkip(dl, d) {
+			stack[n] = l
+			n++
+		}
+	}
+	return d
+}
+
+//-----------------------------------------------------------------------------
+
+type bvhNode2 struct {
+	bb          Box2
+	left, right int // child nodes (left < 0 for a leaf)
+	start, end  int // leaf object indices
+}
+
+// bvh2 is a bounding volume hierarchy for a set of SDF2s.
+type bvh2 struct {
+	node  []bvhNode2
+	index []int // object indices sorted into leaf order
+}
+
+// newBVH2 returns a BVH for a set of SDF2s.
+func newBVH2(sdf []SDF2) *bvh2 {
+	bb := make([]Box2, len(sdf))
+	for i, s := range sdf {
+		bb[i] = s.BoundingBox()
+	}
+	return boxBVH2(bb)
+}
+
+// boxBVH2 returns a BVH for a set of bounding boxes.
+func boxBVH2(bb []Box2) *bvh2 {
+	b := bvh2{
+		node:  make([]bvhNode2, 0, 2*len(bb)),
+		index: make([]int, len(bb)),
+	}
+	for i := range bb {
+		b.index[i] = i
+	}
+	b.build(bb, 0, len(bb))
+	return &b
+}
+
+// build adds the nodes for a range of object indices and returns the index of the root node.
+func (b *bvh2) build(bb []Box2, start, end int) int {
+	k := len(b.node)
+	b.node = append(b.node, bvhNode2{left: -1, start: start, end: end})
+	box := bb[b.index[start]]
+	centers := Box2{box.Center(), box.Center()}
+	for _, i := range b.index[start+1 : end] {
+		box = box.Extend(bb[i])
+		centers = centers.Include(bb[i].Center())
+	}
+	b.node[k].bb = box
+	if end-start <= bvhLeafSize {
+		return k
+	}
+	// split the objects at the median of the axis with the largest spread of centers
+	size := centers.Size()
+	axis := func(v v2.Vec) float64 { return v.X }
+	if size.Y > size.X {
+		axis = func(v v2.Vec) float64 { return v.Y }
+	}
+	index := b.index[start:end]
+	sort.SliceStable(index, func(i, j int) bool {
+		return axis(bb[index[i]].Center()) < axis(bb[index[j]].Center())
+	})
+	mid := (start + end) / 2
+	left := b.build(bb, start, mid)
+	right := b.build(bb, mid, end)
+	b.node[k].left = left
+	b.node[k].right = right
+	return k
+}
+
+// min returns the minimum distance to a set of SDF2s.
+func (b *bvh2) min(sdf []SDF2, p v2.Vec) float64 {
+	d := math.Inf(1)
+	var stack [bvhStackSize]int
+	n := 1
+	for n > 0 {
+		n--
+		node := &b.node[stack[n]]
+		if node.left < 0 {
+			for _, i := range b.index[node.start:node.end] {
+				d = math.Min(d, sdf[i].Evaluate(p))
+			}
+			continue
+		}
+		// visit the closer child first
+		l, r := node.left, node.right
+		dl := b.node[l].bb.minDist2(p)
+		dr := b.node[r].bb.minDist2(p)
+		if dl > dr {
+			l, r = r, l
+			dl, dr = dr, dl
+		}
+		if !bvhSkip(dr, d) {
+			stack[n] = r
+			n++
+		}
+		if !bvhSkip(dl, d) {
+			stack[n] = l
+			n++
+		}
+	}
+	return d
+}
+
+//-----------------------------------------------------------------------------
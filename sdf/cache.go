@@ -0,0 +1,254 @@
+//-----------------------------------------------------------------------------
+/*
+
+Evaluation Caches
+
+In some cases (E.g. extrusion) SDFs get evaluated repeatedly at the same points.
+If a map lookup is cheaper than a distance evaluation it's possible to save time
+by caching evaluation results. These SDFs wrap an underlying SDF and cache the
+evaluations.
+
+The cache is split into shards, each with its own lock, so concurrent
+evaluations (E.g. the workers of a renderer) don't contend for a single lock.
+The cache size can be limited, the limit is divided between the shards. When a
+shard is full the oldest entry is evicted.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+
+	v2 "github.com/deadsy/sdfx/vec/v2"
+	v3 "github.com/deadsy/sdfx/vec/v3"
+)
+
+//-----------------------------------------------------------------------------
+
+// cacheShardBits sets the number of cache shards.
+const cacheShardBits = 6
+const cacheShards = 1 << cacheShardBits
+
+// cacheShard is a shard of an evaluation cache.
+type cacheShard struct {
+	lock  sync.RWMutex
+	cache map[v3.Vec]float64
+	fifo  []v3.Vec // keys in insertion order (if the cache size is limited)
+	next  int      // next fifo slot to be evicted
+	limit int      // maximum number of entries (if the cache size is limited)
+}
+
+// evalCache is a sharded cache of SDF evaluations.
+// 2d points are stored with z = 0.
+type evalCache struct {
+	shard       [cacheShards]cacheShard
+	limit       int // maximum number of entries (0 is unlimited)
+	reads, hits atomic.Uint64
+}
+
+// init initializes the cache shards with a maximum number of entries (0 is unlimited).
+func (c *evalCache) init(limit int) {
+	c.limit = limit
+	for i := range c.shard {
+		s := &c.shard[i]
+		s.lock.Lock()
+		s.cache = make(map[v3.Vec]float64)
+		s.fifo = nil
+		s.next = 0
+		// the first shards take the remainder, so the shard limits add up to the limit
+		s.limit = limit / cacheShards
+		if i < limit%cacheShards {
+			s.limit++
+		}
+		s.lock.Unlock()
+	}
+}
+
+// cacheHash returns a hash of a point.
+func cacheHash(p v3.Vec) uint64 {
+	// -0 == 0 so they're the same map key, adding 0 gives them the same bits
+	h := math.Float64bits(p.X+0) * 0x9e3779b97f4a7c15
+	h ^= math.Float64bits(p.Y+0) * 0xc2b2ae3d27d4eb4f
+	h ^= math.Float64bits(p.Z+0) * 0x165667b19e3779f9
+	return h ^ (h >> 29)
+}
+
+// read returns a cached value.
+func (c *evalCache) read(p v3.Vec) (float64, bool) {
+	c.reads.Add(1)
+	s := &c.shard[cacheHash(p)>>(64-cacheShardBits)]
+	s.lock.RLock()
+	d, ok := s.cache[p]
+	s.lock.RUnlock()
+	if ok {
+		c.hits.Add(1)
+	}
+	return d, ok
+}
+
+// write adds a value to the cache.
+func (c *evalCache) write(p v3.Vec, d float64) {
+	s := &c.shard[cacheHash(p)>>(64-cacheShardBits)]
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.cache[p]; ok {
+		// another goroutine got here first
+		return
+	}
+	if c.limit > 0 {
+		switch {
+		case s.limit == 0:
+			// a limit smaller than the number of shards leaves some shards empty
+			return
+		case len(s.fifo) < s.limit:
+			s.fifo = append(s.fifo, p)
+		default:
+			// evict the oldest entry
+			delete(s.cache, s.fifo[s.next])
+			s.fifo[s.next] = p
+			s.next = (s.next + 1) % s.limit
+		}
+	}
+	s.cache[p] = d
+}
+
+// size returns the number of cached values.
+func (c *evalCache) size() int {
+	n := 0
+	for i := range c.shard {
+		s := &c.shard[i]
+		s.lock.RLock()
+		n += len(s.cache)
+		s.lock.RUnlock()
+	}
+	return n
+}
+
+// setLimit sets the maximum number of cached values (0 is unlimited) and clears the cache.
+func (c *evalCache) setLimit(n int) {
+	c.init(n)
+}
+
+func (c *evalCache) String() string {
+	reads, hits := c.reads.Load(), c.hits.Load()
+	r := float64(hits) / float64(reads)
+	return fmt.Sprintf("reads %d hits %d (%.2f) size %d", reads, hits, r, c.size())
+}
+
+//-----------------------------------------------------------------------------
+
+// CacheSDF3 is an SDF3 cache.
+type CacheSDF3 struct {
+	sdf   SDF3
+	cache evalCache
+}
+
+// Cache3D wraps the passed SDF3 with an evaluation cache.
+func Cache3D(sdf SDF3) SDF3 {
+	s := CacheSDF3{sdf: sdf}
+	s.cache.init(0)
+	return &s
+}
+
+// SetLimit sets the maximum number of cached evaluations (0 is unlimited).
+// This clears the cache, so call it before the cache is in use.
+func (s *CacheSDF3) SetLimit(n int) {
+	s.cache.setLimit(n)
+}
+
+// Stats returns the number of reads and hits for the cache.
+func (s *CacheSDF3) Stats() (uint64, uint64) {
+	return s.cache.reads.Load(), s.cache.hits.Load()
+}
+
+func (s *CacheSDF3) String() string {
+	return s.cache.String()
+}
+
+// Evaluate returns the minimum distance to a cached 3d sdf.
+func (s *CacheSDF3) Evaluate(p v3.Vec) float64 {
+	if d, ok := s.cache.read(p); ok {
+		return d
+	}
+	d := s.sdf.Evaluate(p)
+	s.cache.write(p, d)
+	return d
+}
+
+// EvaluateInterval returns an interval containing the values of a cached 3d sdf within a box.
+func (s *CacheSDF3) EvaluateInterval(b Box3) Interval {
+	return EvaluateInterval3(s.sdf, b)
+}
+
+// Gradient returns the gradient of a cached 3d sdf.
+func (s *CacheSDF3) Gradient(p v3.Vec, eps float64) v3.Vec {
+	return Gradient3(s.sdf, p, eps)
+}
+
+// BoundingBox returns the bounding box of a cached 3d sdf.
+func (s *CacheSDF3) BoundingBox() Box3 {
+	return s.sdf.BoundingBox()
+}
+
+//-----------------------------------------------------------------------------
+
+// CacheSDF2 is an SDF2 cache.
+type CacheSDF2 struct {
+	sdf   SDF2
+	cache evalCache
+}
+
+// Cache2D wraps the passed SDF2 with an evaluation cache.
+func Cache2D(sdf SDF2) SDF2 {
+	s := CacheSDF2{sdf: sdf}
+	s.cache.init(0)
+	return &s
+}
+
+// SetLimit sets the maximum number of cached evaluations (0 is unlimited).
+// This clears the cache, so call it before the cache is in use.
+func (s *CacheSDF2) SetLimit(n int) {
+	s.cache.setLimit(n)
+}
+
+// Stats returns the number of reads and hits for the cache.
+func (s *CacheSDF2) Stats() (uint64, uint64) {
+	return s.cache.reads.Load(), s.cache.hits.Load()
+}
+
+func (s *CacheSDF2) String() string {
+	return s.cache.String()
+}
+
+// Evaluate returns the minimum distance to a cached 2d sdf.
+func (s *CacheSDF2) Evaluate(p v2.Vec) float64 {
+	k := v3.Vec{X: p.X, Y: p.Y}
+	if d, ok := s.cache.read(k); ok {
+		return d
+	}
+	d := s.sdf.Evaluate(p)
+	s.cache.write(k, d)
+	return d
+}
+
+// EvaluateInterval returns an interval containing the values of a cached 2d sdf within a box.
+func (s *CacheSDF2) EvaluateInterval(b Box2) Interval {
+	return EvaluateInterval2(s.sdf, b)
+}
+
+// Gradient returns the gradient of a cached 2d sdf.
+func (s *CacheSDF2) Gradient(p v2.Vec, eps float64) v2.Vec {
+	return Gradient2(s.sdf, p, eps)
+}
+
+// BoundingBox returns the bounding box of a cached 2d sdf.
+func (s *CacheSDF2) BoundingBox() Box2 {
+	return s.sdf.BoundingBox()
+}
+
+//-----------------------------------------------------------------------------
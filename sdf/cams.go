@@ -81,6 +81,11 @@ func (s *FlatFlankCamSDF2) Evaluate(p v2.Vec) float64 {
 	return d
 }
 
+// EvaluateInterval returns an interval containing the values of the cam within a box.
+func (s *FlatFlankCamSDF2) EvaluateInterval(b Box2) Interval {
+	return exactInterval2(s, b)
+}
+
 // BoundingBox returns the bounding box for the cam.
 func (s *FlatFlankCamSDF2) BoundingBox() Box2 {
 	return s.bb
@@ -196,6 +201,11 @@ func (s *ThreeArcCamSDF2) Evaluate(p v2.Vec) float64 {
 	return d
 }
 
+// EvaluateInterval returns an interval containing the values of the cam within a box.
+func (s *ThreeArcCamSDF2) EvaluateInterval(b Box2) Interval {
+	return exactInterval2(s, b)
+}
+
 // BoundingBox returns the bounding box for the cam.
 func (s *ThreeArcCamSDF2) BoundingBox() Box2 {
 	return s.bb
@@ -0,0 +1,347 @@
+//-----------------------------------------------------------------------------
+/*
+
+Deformations
+
+Twist3D, Taper3D and Bend3D warp space around an axis. The SDF3 is evaluated
+at the point mapped back to the undeformed space. The mapping stretches space,
+so the result is divided by the lipschitz constant of the mapping (worked out
+over the bounding box) to keep it a bound on the distance to the surface.
+
+Large deformations give large lipschitz constants, so the field gets smaller
+and raycasting takes more steps.
+
+Interval evaluation works out the lipschitz constant within the box, which
+is smaller than the global one for boxes close to the axis.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"math"
+
+	v3 "github.com/deadsy/sdfx/vec/v3"
+)
+
+//-----------------------------------------------------------------------------
+
+// deformMargin scales the bounding box to give the region where the lipschitz constant holds.
+// The renderers (and Audit3D) evaluate SDFs a little outside the bounding box.
+const deformMargin = 1.2
+
+// frame3 is an orthonormal coordinate frame.
+type frame3 struct {
+	a       v3.Vec // origin
+	u, v, w v3.Vec // x, y and z axes
+}
+
+// toLocal converts a point to frame coordinates.
+func (f *frame3) toLocal(p v3.Vec) v3.Vec {
+	d := p.Sub(f.a)
+	return v3.Vec{d.Dot(f.u), d.Dot(f.v), d.Dot(f.w)}
+}
+
+// toWorld converts frame coordinates to a point.
+func (f *frame3) toWorld(q v3.Vec) v3.Vec {
+	return f.a.Add(f.u.MulScalar(q.X)).Add(f.v.MulScalar(q.Y)).Add(f.w.MulScalar(q.Z))
+}
+
+// localBox returns a box (in frame coordinates) containing a box.
+func (f *frame3) localBox(bb Box3) Box3 {
+	v := bb.Vertices()
+	b := Box3{f.toLocal(v[0]), f.toLocal(v[0])}
+	for _, x := range v[1:] {
+		b = b.Include(f.toLocal(x))
+	}
+	return b
+}
+
+// worldBox returns a box containing a box in frame coordinates.
+func (f *frame3) worldBox(bb Box3) Box3 {
+	v := bb.Vertices()
+	b := Box3{f.toWorld(v[0]), f.toWorld(v[0])}
+	for _, x := range v[1:] {
+		b = b.Include(f.toWorld(x))
+	}
+	return b
+}
+
+// axisFrame returns a frame with its z-axis along an axis through a point.
+func axisFrame(a, axis v3.Vec) (*frame3, error) {
+	if axis.Length() == 0 {
+		return nil, ErrMsg("axis has zero length")
+	}
+	w := axis.Normalize()
+	u, v := perpendicularBasis(w)
+	return &frame3{a, u, v, w}, nil
+}
+
+// maxRadius returns the maximum distance from the frame z-axis of the vertices of a box (in frame coordinates).
+func maxRadius(bb Box3) float64 {
+	r := 0.0
+	for _, x := range bb.Vertices() {
+		r = math.Max(r, math.Hypot(x.X, x.Y))
+	}
+	return r
+}
+
+// twistLipschitz returns the lipschitz constant of a twist within a radius of the axis.
+func twistLipschitz(twist, r float64) float64 {
+	// The twist shears space by twist*radius.
+	shear := math.Abs(twist) * r
+	return 0.5 * (shear + math.Sqrt(shear*shear+4))
+}
+
+// taperLipschitz returns the lipschitz constant of a taper within a radius of the axis,
+// for a minimum scale of the cross section.
+func taperLipschitz(taper, scale, r float64) float64 {
+	// The cross section is scaled by 1/scale and sheared by taper*radius/scale^2.
+	a := 1 / scale
+	b := math.Abs(taper) * r / (scale * scale)
+	t := a*a + b*b + 1
+	return math.Max(a, math.Sqrt(0.5*(t+math.Sqrt(t*t-4*a*a))))
+}
+
+//-----------------------------------------------------------------------------
+
+// TwistSDF3 is an SDF3 twisted about an axis.
+type TwistSDF3 struct {
+	sdf   SDF3
+	frame *frame3
+	axis  v3.Vec
+	twist float64 // radians per unit length
+	k     float64 // lipschitz constant
+	bb    Box3
+}
+
+// Twist3D returns an SDF3 twisted about an axis through a point.
+// The twist is the rotation (radians) per unit length along the axis, with no rotation at the point.
+func Twist3D(sdf SDF3, a, axis v3.Vec, twist float64) (SDF3, error) {
+	f, err := axisFrame(a, axis)
+	if err != nil {
+		return nil, err
+	}
+	s := TwistSDF3{
+		sdf:   sdf,
+		frame: f,
+		axis:  axis,
+		twist: twist,
+	}
+	// the twisted sdf is within a cylinder about the axis
+	bb := f.localBox(sdf.BoundingBox())
+	r := maxRadius(bb)
+	s.bb = f.worldBox(Box3{v3.Vec{-r, -r, bb.Min.Z}, v3.Vec{r, r, bb.Max.Z}})
+	s.k = twistLipschitz(twist, maxRadius(f.localBox(s.bb.ScaleAboutCenter(deformMargin))))
+	return &s, nil
+}
+
+// Evaluate returns the minimum distance to a twisted SDF3.
+func (s *TwistSDF3) Evaluate(p v3.Vec) float64 {
+	q := s.frame.toLocal(p)
+	sin, cos := math.Sincos(-s.twist * q.Z)
+	q.X, q.Y = q.X*cos-q.Y*sin, q.X*sin+q.Y*cos
+	return s.sdf.Evaluate(s.frame.toWorld(q)) / s.k
+}
+
+// EvaluateInterval returns an interval containing the values of a twisted SDF3 within a box.
+func (s *TwistSDF3) EvaluateInterval(b Box3) Interval {
+	// the lipschitz constant within the box
+	k := twistLipschitz(s.twist, maxRadius(s.frame.localBox(b)))
+	return lipschitzInterval3(s, b, k/s.k)
+}
+
+// BoundingBox returns the bounding box of a twisted SDF3.
+func (s *TwistSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
+
+// TaperSDF3 is an SDF3 tapered along an axis.
+type TaperSDF3 struct {
+	sdf    SDF3
+	frame  *frame3
+	axis   v3.Vec
+	taper  float64 // change in scale per unit length
+	t0, t1 float64 // range of the sdf along the axis
+	k      float64 // lipschitz constant
+	bb     Box3
+}
+
+// Taper3D returns an SDF3 tapered along an axis through a point.
+// The cross section perpendicular to the axis is scaled by 1 + taper * t at a distance t along the axis from the point.
+func Taper3D(sdf SDF3, a, axis v3.Vec, taper float64) (SDF3, error) {
+	f, err := axisFrame(a, axis)
+	if err != nil {
+		return nil, err
+	}
+	bb := f.localBox(sdf.BoundingBox())
+	s := TaperSDF3{
+		sdf:   sdf,
+		frame: f,
+		axis:  axis,
+		taper: taper,
+		t0:    bb.Min.Z,
+		t1:    bb.Max.Z,
+	}
+	s0, s1 := 1+taper*bb.Min.Z, 1+taper*bb.Max.Z
+	if s0 <= 0 || s1 <= 0 {
+		return nil, ErrMsg("the scale is <= 0 within the sdf")
+	}
+	r := math.Max(s0, s1) * maxRadius(bb)
+	s.bb = f.worldBox(Box3{v3.Vec{-r, -r, bb.Min.Z}, v3.Vec{r, r, bb.Max.Z}})
+	s.k = taperLipschitz(taper, math.Min(s0, s1), maxRadius(f.localBox(s.bb.ScaleAboutCenter(deformMargin))))
+	return &s, nil
+}
+
+// Evaluate returns the minimum distance to a tapered SDF3.
+func (s *TaperSDF3) Evaluate(p v3.Vec) float64 {
+	q := s.frame.toLocal(p)
+	// The scale is constant beyond the ends of the sdf, this keeps it > 0.
+	k := 1 / (1 + s.taper*Clamp(q.Z, s.t0, s.t1))
+	q.X *= k
+	q.Y *= k
+	return s.sdf.Evaluate(s.frame.toWorld(q)) / s.k
+}
+
+// EvaluateInterval returns an interval containing the values of a tapered SDF3 within a box.
+func (s *TaperSDF3) EvaluateInterval(b Box3) Interval {
+	// the lipschitz constant within the box
+	lb := s.frame.localBox(b)
+	s0 := 1 + s.taper*Clamp(lb.Min.Z, s.t0, s.t1)
+	s1 := 1 + s.taper*Clamp(lb.Max.Z, s.t0, s.t1)
+	k := taperLipschitz(s.taper, math.Min(s0, s1), maxRadius(lb))
+	return lipschitzInterval3(s, b, k/s.k)
+}
+
+// BoundingBox returns the bounding box of a tapered SDF3.
+func (s *TaperSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
+
+// BendSDF3 is an SDF3 bent around an axis.
+type BendSDF3 struct {
+	sdf        SDF3
+	frame      *frame3 // x-axis along dir, y-axis towards the bend axis
+	dir, up    v3.Vec
+	radius     float64
+	theta      float64 // angle of the middle of the bent sdf
+	sector     float64 // half the angle of the bent sdf
+	rmin, rmax float64 // range of distances from the bend axis to the bent sdf
+	zmin, zmax float64 // range of the bent sdf along the bend axis
+	k          float64 // scale for the distance
+	bb         Box3
+}
+
+// Bend3D returns an SDF3 bent around an axis.
+// The line through a in direction dir is bent into a circle with the given radius. The center
+// of the circle is at a + radius * up (up is made perpendicular to dir), so the bend axis is
+// perpendicular to both dir and up. The SDF3 is bent towards up.
+func Bend3D(sdf SDF3, a, dir, up v3.Vec, radius float64) (SDF3, error) {
+	if dir.Length() == 0 {
+		return nil, ErrMsg("dir has zero length")
+	}
+	if radius <= 0 {
+		return nil, ErrMsg("radius <= 0")
+	}
+	u := dir.Normalize()
+	v := up.Sub(u.MulScalar(up.Dot(u)))
+	if v.Length() < epsilon {
+		return nil, ErrMsg("up is parallel to dir")
+	}
+	v = v.Normalize()
+	f := &frame3{a, u, v, u.Cross(v)}
+	s := BendSDF3{
+		sdf:    sdf,
+		frame:  f,
+		dir:    dir,
+		up:     up,
+		radius: radius,
+	}
+	bb := f.localBox(sdf.BoundingBox())
+	s.rmin = radius - bb.Max.Y
+	if s.rmin <= 0 {
+		return nil, ErrMsg("the sdf is too thick for the bend radius")
+	}
+	if bb.Max.X-bb.Min.X > Tau*radius {
+		return nil, ErrMsg("the sdf is too long for the bend radius")
+	}
+	// angles are measured from the center of the bent sdf, so any discontinuity is on the far side
+	s.theta = 0.5 * (bb.Min.X + bb.Max.X) / radius
+	s.sector = 0.5 * (bb.Max.X - bb.Min.X) / radius
+	s.rmax = radius - bb.Min.Y
+	s.zmin, s.zmax = bb.Min.Z, bb.Max.Z
+	// Arcs are stretched by radius/r, the sdf is only evaluated for r > rmin/2.
+	s.k = math.Min(1, 0.5*s.rmin/radius)
+	// the bent sdf is within an annular sector around the bend axis
+	t0, t1 := bb.Min.X/radius, bb.Max.X/radius
+	arc := Box3{s.bendPoint(t0, s.rmin, 0), s.bendPoint(t0, s.rmin, 0)}
+	for _, t := range []float64{t0, t1} {
+		arc = arc.Include(s.bendPoint(t, s.rmin, 0))
+		arc = arc.Include(s.bendPoint(t, s.rmax, 0))
+	}
+	for t := math.Ceil(t0/(0.5*Pi)) * 0.5 * Pi; t < t1; t += 0.5 * Pi {
+		arc = arc.Include(s.bendPoint(t, s.rmax, 0))
+	}
+	arc.Min.Z, arc.Max.Z = bb.Min.Z, bb.Max.Z
+	s.bb = f.worldBox(arc)
+	return &s, nil
+}
+
+// bendPoint returns the frame coordinates of a point at an angle and distance from the bend axis.
+func (s *BendSDF3) bendPoint(theta, r, z float64) v3.Vec {
+	sin, cos := math.Sincos(theta)
+	return v3.Vec{r * sin, s.radius - r*cos, z}
+}
+
+// wedgeDistance returns the signed distance (a bound inside) from a point at distance r from an axis
+// to the half-planes at angles +/-a about the axis. The point is at angle phi in [-Pi, Pi].
+func wedgeDistance(r, phi, a float64) float64 {
+	x := math.Abs(phi) - a
+	if x >= 0.5*Pi {
+		return r
+	}
+	if x <= -0.5*Pi {
+		return -r
+	}
+	return r * math.Sin(x)
+}
+
+// Evaluate returns the minimum distance to a bent SDF3.
+func (s *BendSDF3) Evaluate(p v3.Vec) float64 {
+	q := s.frame.toLocal(p)
+	x, y := q.X, s.radius-q.Y
+	r := math.Hypot(x, y)
+	phi := SawTooth(math.Atan2(x, y)-s.theta, Tau)
+	// the distance to the annular sector containing the bent sdf
+	d := math.Max(s.rmin-r, r-s.rmax)
+	d = math.Max(d, math.Max(s.zmin-q.Z, q.Z-s.zmax))
+	d = math.Max(d, wedgeDistance(r, phi, s.sector))
+	// The mapping back to the unbent sdf has a lipschitz constant of 1/k for r > rmin/2, away from
+	// the discontinuity on the far side. A closer surface point is no closer than the edge of this
+	// region, so the distance is clamped to the distance to the edge.
+	e := math.Min(r-0.5*s.rmin, -wedgeDistance(r, phi, Pi))
+	if e <= 0 {
+		return d
+	}
+	// map the arc back to a line
+	q.X, q.Y = s.radius*(s.theta+phi), s.radius-r
+	return math.Max(d, Clamp(s.sdf.Evaluate(s.frame.toWorld(q))*s.k, -e, e))
+}
+
+// EvaluateInterval returns an interval containing the values of a bent SDF3 within a box.
+func (s *BendSDF3) EvaluateInterval(b Box3) Interval {
+	// the distance is clamped to keep the lipschitz constant <= 1
+	return exactInterval3(s, b)
+}
+
+// BoundingBox returns the bounding box of a bent SDF3.
+func (s *BendSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
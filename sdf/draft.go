@@ -0,0 +1,268 @@
+//-----------------------------------------------------------------------------
+/*
+
+Draft Angles
+
+Moulded and cast parts need their walls tapered (drafted) so they can be
+pulled from the mould. Draft3D tapers every wall of an SDF3 relative to a pull
+direction. The cross section of the SDF3 at height t above the neutral plane is
+eroded by t*tan(angle), so walls lean inwards above the neutral plane and
+outwards below it. Faces perpendicular to the pull direction don't move.
+
+The erosion (or dilation) of a cross section is the maximum (or minimum) of
+the SDF3 over a disc perpendicular to the pull direction. The disc is sampled
+along the gradient and at a fixed number of points on its edge.
+
+DraftAnalysis3D finds the surface points of an SDF3 with less than a given draft,
+including undercuts (negative draft) that lock the part in the mould.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/deadsy/sdfx/vec/conv"
+	v3 "github.com/deadsy/sdfx/vec/v3"
+)
+
+//-----------------------------------------------------------------------------
+
+// draftSamples is the number of samples on the edge of the erosion/dilation disc.
+const draftSamples = 16
+
+// draftBand is the minimum width (relative to the bounding box) of the band around
+// the surface that is fully evaluated. This keeps the gradient accurate near the
+// neutral plane.
+const draftBand = 1e-3
+
+// perpendicularBasis returns two unit vectors perpendicular to a unit vector and each other.
+func perpendicularBasis(n v3.Vec) (v3.Vec, v3.Vec) {
+	// cross with the axis least aligned with n
+	a := v3.Vec{1, 0, 0}
+	if math.Abs(n.Y) < math.Abs(n.X) && math.Abs(n.Y) <= math.Abs(n.Z) {
+		a = v3.Vec{0, 1, 0}
+	} else if math.Abs(n.Z) < math.Abs(n.X) {
+		a = v3.Vec{0, 0, 1}
+	}
+	u := n.Cross(a).Normalize()
+	return u, n.Cross(u)
+}
+
+//-----------------------------------------------------------------------------
+
+// DraftSDF3 is an SDF3 with drafted walls.
+type DraftSDF3 struct {
+	sdf     SDF3
+	n       v3.Vec   // unit pull direction
+	neutral float64  // position of the neutral plane along the pull direction
+	tan     float64  // tan(draft angle)
+	disc    []v3.Vec // unit vectors perpendicular to the pull direction
+	k       float64  // lipschitz constant
+	band    float64  // minimum width of the band around the surface that is fully evaluated
+	pull    v3.Vec   // pull direction (for serialization)
+	angle   float64  // draft angle (for serialization)
+	bb      Box3
+}
+
+// Draft3D returns an SDF3 with the walls tapered by a draft angle (radians) relative to a pull direction.
+// The walls are unchanged at the neutral plane (n.p = neutralPlane for a unit pull direction n) and
+// lean inwards in the pull direction.
+func Draft3D(sdf SDF3, pullDir v3.Vec, neutralPlane, angle float64) (SDF3, error) {
+	if pullDir.Length() == 0 {
+		return nil, ErrMsg("pullDir has zero length")
+	}
+	if angle < 0 || angle >= 0.5*Pi {
+		return nil, ErrMsg("angle must be in the range [0, Pi/2)")
+	}
+	s := DraftSDF3{
+		sdf:     sdf,
+		n:       pullDir.Normalize(),
+		neutral: neutralPlane,
+		tan:     math.Tan(angle),
+		pull:    pullDir,
+		angle:   angle,
+	}
+	u, v := perpendicularBasis(s.n)
+	s.disc = make([]v3.Vec, draftSamples)
+	for i := range s.disc {
+		theta := Tau * float64(i) / draftSamples
+		s.disc[i] = u.MulScalar(math.Cos(theta)).Add(v.MulScalar(math.Sin(theta)))
+	}
+	// The disc radius changes by tan(angle) per unit of height.
+	s.k = 1 + s.tan
+	// The walls move outwards below the neutral plane.
+	bb := sdf.BoundingBox()
+	r := 0.0
+	for _, x := range bb.Vertices() {
+		r = math.Max(r, -s.radius(x))
+	}
+	s.bb = bb.Enlarge(v3.Vec{2 * r, 2 * r, 2 * r})
+	s.band = draftBand * s.bb.Size().Length()
+	return &s, nil
+}
+
+// radius returns the signed erosion radius at a point (< 0 is a dilation).
+func (s *DraftSDF3) radius(p v3.Vec) float64 {
+	return (s.n.Dot(p) - s.neutral) * s.tan
+}
+
+// gradientDirection returns the direction of the gradient perpendicular to the pull direction.
+func (s *DraftSDF3) gradientDirection(p v3.Vec) (v3.Vec, bool) {
+	g := Gradient3(s.sdf, p, gradientEpsilon)
+	g = g.Sub(s.n.MulScalar(g.Dot(s.n)))
+	l := g.Length()
+	if l == 0 {
+		return v3.Vec{}, false
+	}
+	return g.DivScalar(l), true
+}
+
+// Evaluate returns the minimum distance to a drafted SDF3.
+func (s *DraftSDF3) Evaluate(p v3.Vec) float64 {
+	d := s.sdf.Evaluate(p)
+	r := s.radius(p)
+	w := math.Max(math.Abs(r), s.band)
+	if r >= 0 {
+		// erosion: d <= max <= d + r
+		if d > w {
+			return d / s.k
+		}
+		if d < -2*w {
+			return (d + r) / s.k
+		}
+		// The maximum is usually along the gradient. The disc samples
+		// find it when the gradient points elsewhere (E.g. near an edge).
+		if u, ok := s.gradientDirection(p); ok {
+			d = math.Max(d, s.sdf.Evaluate(p.Add(u.MulScalar(r))))
+		}
+		for _, u := range s.disc {
+			d = math.Max(d, s.sdf.Evaluate(p.Add(u.MulScalar(r))))
+		}
+		return d / s.k
+	}
+	// dilation: d - |r| <= min <= d
+	if d < -w {
+		return d / s.k
+	}
+	if d > 2*w {
+		return (d + r) / s.k
+	}
+	if u, ok := s.gradientDirection(p); ok {
+		d = math.Min(d, s.sdf.Evaluate(p.Add(u.MulScalar(r))))
+	}
+	for _, u := range s.disc {
+		d = math.Min(d, s.sdf.Evaluate(p.Add(u.MulScalar(r))))
+	}
+	return d / s.k
+}
+
+// EvaluateInterval returns an interval containing the values of a drafted SDF3 within a box.
+func (s *DraftSDF3) EvaluateInterval(b Box3) Interval {
+	// range of the erosion radius
+	r := Interval{math.Inf(1), math.Inf(-1)}
+	for _, x := range b.Vertices() {
+		r = r.extend(Interval{s.radius(x), s.radius(x)})
+	}
+	// the samples are within the erosion/dilation disc of each point
+	k := math.Max(-r[0], r[1])
+	i := EvaluateInterval3(s.sdf, b.Enlarge(v3.Vec{2 * k, 2 * k, 2 * k}))
+	return Interval{math.Min(i[0], i[0]+r[0]), math.Max(i[1], i[1]+r[1])}.scale(1 / s.k)
+}
+
+// BoundingBox returns the bounding box of a drafted SDF3.
+func (s *DraftSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
+// Draft Analysis
+
+// DraftFault is a surface point with too little draft.
+type DraftFault struct {
+	Point  v3.Vec  // surface point
+	Normal v3.Vec  // surface normal
+	Draft  float64 // draft angle (radians)
+}
+
+// DraftResult is the result of a draft analysis.
+type DraftResult struct {
+	Samples    int          // number of surface points
+	MinDraft   float64      // smallest draft angle (radians)
+	MinDraftAt v3.Vec       // location of the smallest draft angle
+	Faults     []DraftFault // surface points with less than the required draft
+}
+
+// DraftAnalysis3D finds the surface points of an SDF3 with a draft angle (radians) smaller than minAngle.
+// The draft angle is the angle between the surface and the pull direction. It's < 0 if the surface
+// faces away from the pull direction, these are undercuts. Surfaces facing directly away from the pull
+// direction (within minAngle) are parting faces, they aren't faults and don't count towards MinDraft.
+// The surface points are found on a grid with the given number of cells on the longest side of the
+// bounding box.
+func DraftAnalysis3D(s SDF3, pullDir v3.Vec, minAngle float64, cells int) (*DraftResult, error) {
+	if pullDir.Length() == 0 {
+		return nil, ErrMsg("pullDir has zero length")
+	}
+	if cells <= 0 {
+		return nil, ErrMsg("cells <= 0")
+	}
+	n := pullDir.Normalize()
+	bb := s.BoundingBox().ScaleAboutCenter(1.05)
+	size := bb.Size()
+	h := size.MaxComponent() / float64(cells)
+	g := newGrid3(bb, conv.V3ToV3i(size.DivScalar(h).Ceil()).AddScalar(1))
+	g.sample(s, nil)
+
+	r := DraftResult{MinDraft: 0.5 * Pi}
+	// check the surface crossings on the grid edges
+	check := func(k0, k1 int, p0, p1 v3.Vec) {
+		d0, d1 := g.data[k0], g.data[k1]
+		if (d0 < 0) == (d1 < 0) {
+			return
+		}
+		p := p0.Add(p1.Sub(p0).MulScalar(d0 / (d0 - d1)))
+		normal := Gradient3(s, p, gradientEpsilon).Normalize()
+		draft := math.Asin(Clamp(normal.Dot(n), -1, 1))
+		r.Samples++
+		if draft <= minAngle-0.5*Pi {
+			// parting face
+			return
+		}
+		if draft < r.MinDraft {
+			r.MinDraft = draft
+			r.MinDraftAt = p
+		}
+		if draft < minAngle {
+			r.Faults = append(r.Faults, DraftFault{p, normal, draft})
+		}
+	}
+	for z := 0; z < g.n.Z; z++ {
+		for y := 0; y < g.n.Y; y++ {
+			for x := 0; x < g.n.X; x++ {
+				k := g.index(x, y, z)
+				p := g.point(x, y, z)
+				if x < g.n.X-1 {
+					check(k, g.index(x+1, y, z), p, g.point(x+1, y, z))
+				}
+				if y < g.n.Y-1 {
+					check(k, g.index(x, y+1, z), p, g.point(x, y+1, z))
+				}
+				if z < g.n.Z-1 {
+					check(k, g.index(x, y, z+1), p, g.point(x, y, z+1))
+				}
+			}
+		}
+	}
+	return &r, nil
+}
+
+// String returns a summary of the draft analysis.
+func (r *DraftResult) String() string {
+	return fmt.Sprintf("samples %d faults %d min draft %.2f degrees at %v",
+		r.Samples, len(r.Faults), RtoD(r.MinDraft), r.MinDraftAt)
+}
+
+//-----------------------------------------------------------------------------
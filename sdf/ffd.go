@@ -0,0 +1,463 @@
+//-----------------------------------------------------------------------------
+/*
+
+Free-Form Deformation
+
+An FFDLattice is a grid of control points covering a box. Moving the control
+points deforms the space within the box (and moves the space outside the box
+with the faces of the lattice). The deformation is a trilinear (or tricubic)
+interpolation of the control point displacements.
+
+FFD3D evaluates an SDF3 at the undeformed position of the query point. The
+forward mapping is easy, the inverse mapping is solved with Newton's method.
+The distance is scaled by a lower bound on the smallest singular value of the
+jacobian of the forward mapping. This is worked out once for the lattice with
+interval arithmetic over subdivisions of each lattice cell, so the distance is
+a bound. If the inverse mapping doesn't converge, the distance is reduced by
+the residual so it's still a bound.
+The lattice can't fold over itself or the inverse mapping isn't unique.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"math"
+	"runtime"
+	"sync"
+
+	v3 "github.com/deadsy/sdfx/vec/v3"
+	"github.com/deadsy/sdfx/vec/v3i"
+)
+
+//-----------------------------------------------------------------------------
+
+// ffdIterations is the maximum number of Newton iterations for the inverse mapping.
+const ffdIterations = 20
+
+// ffdTolerance is the inverse mapping tolerance (relative to the lattice size).
+const ffdTolerance = 1e-9
+
+// ffdDepth is the maximum number of times a lattice cell is halved for bounding the jacobian.
+const ffdDepth = 4
+
+// ffdTarget is the fraction of the estimated smallest singular value of the jacobian that the bound aims for.
+const ffdTarget = 0.8
+
+// Polynomial coefficients (1, t, t^2, t^3) of the interpolation weights and their derivatives.
+var (
+	linearWeights = [][4]float64{{1, -1, 0, 0}, {0, 1, 0, 0}}
+	linearDerivs  = [][4]float64{{-1, 0, 0, 0}, {1, 0, 0, 0}}
+	// the Catmull-Rom weights of catmullRom
+	cubicWeights = [][4]float64{{0, -0.5, 1, -0.5}, {1, 0, -2.5, 1.5}, {0, 0.5, 2, -1.5}, {0, 0, -0.5, 0.5}}
+	cubicDerivs  = [][4]float64{{-0.5, 2, -1.5, 0}, {0, -5, 4.5, 0}, {0.5, 4, -4.5, 0}, {0, -1, 1.5, 0}}
+)
+
+// polyInterval returns the range of a cubic polynomial over [t0, t1].
+func polyInterval(c [4]float64, t0, t1 float64) Interval {
+	f := func(t float64) float64 {
+		return c[0] + t*(c[1]+t*(c[2]+t*c[3]))
+	}
+	i := Interval{math.Min(f(t0), f(t1)), math.Max(f(t0), f(t1))}
+	// the extrema are at the roots of the derivative
+	a, b, k := 3*c[3], 2*c[2], c[1]
+	var roots []float64
+	if a == 0 {
+		if b != 0 {
+			roots = append(roots, -k/b)
+		}
+	} else if disc := b*b - 4*a*k; disc >= 0 {
+		q := math.Sqrt(disc)
+		roots = append(roots, (-b-q)/(2*a), (-b+q)/(2*a))
+	}
+	for _, t := range roots {
+		if t > t0 && t < t1 {
+			i = i.extend(Interval{f(t), f(t)})
+		}
+	}
+	return i
+}
+
+// minSingularValue returns the smallest singular value of a 3x3 matrix with rows a, b, c.
+func minSingularValue(a, b, c v3.Vec) float64 {
+	// eigenvalues of the symmetric matrix M.Mt
+	s00, s11, s22 := a.Dot(a), b.Dot(b), c.Dot(c)
+	s01, s02, s12 := a.Dot(b), a.Dot(c), b.Dot(c)
+	p1 := s01*s01 + s02*s02 + s12*s12
+	if p1 == 0 {
+		return math.Sqrt(math.Min(s00, math.Min(s11, s22)))
+	}
+	q := (s00 + s11 + s22) / 3
+	d0, d1, d2 := s00-q, s11-q, s22-q
+	p := math.Sqrt((d0*d0 + d1*d1 + d2*d2 + 2*p1) / 6)
+	// r = det((S - qI)/p)/2
+	r := (d0*(d1*d2-s12*s12) - s01*(s01*d2-s12*s02) + s02*(s01*s12-d1*s02)) / (2 * p * p * p)
+	phi := math.Acos(Clamp(r, -1, 1)) / 3
+	e := q + 2*p*math.Cos(phi+Tau/3)
+	return math.Sqrt(math.Max(e, 0))
+}
+
+//-----------------------------------------------------------------------------
+
+// FFDLattice is a grid of control points for a free-form deformation.
+type FFDLattice struct {
+	dx, dy, dz *grid3 // control point displacements
+	tricubic   bool
+}
+
+// NewFFDLattice returns an undeformed lattice with n control points on each axis covering a box.
+func NewFFDLattice(bb Box3, n v3i.Vec) (*FFDLattice, error) {
+	if n.X < 2 || n.Y < 2 || n.Z < 2 {
+		return nil, ErrMsg("n < 2")
+	}
+	size := bb.Size()
+	if size.X <= 0 || size.Y <= 0 || size.Z <= 0 {
+		return nil, ErrMsg("bb has zero size")
+	}
+	return &FFDLattice{
+		dx: newGrid3(bb, n),
+		dy: newGrid3(bb, n),
+		dz: newGrid3(bb, n),
+	}, nil
+}
+
+// SetTricubic sets tricubic (rather than trilinear) interpolation of the control points.
+// The deformation is smoother, but evaluation is slower.
+func (l *FFDLattice) SetTricubic(tricubic bool) {
+	l.tricubic = tricubic
+}
+
+// Point returns the position of a control point.
+func (l *FFDLattice) Point(x, y, z int) v3.Vec {
+	k := l.dx.index(x, y, z)
+	return l.dx.point(x, y, z).Add(v3.Vec{l.dx.data[k], l.dy.data[k], l.dz.data[k]})
+}
+
+// SetPoint sets the position of a control point.
+func (l *FFDLattice) SetPoint(x, y, z int, p v3.Vec) {
+	k := l.dx.index(x, y, z)
+	d := p.Sub(l.dx.point(x, y, z))
+	l.dx.data[k], l.dy.data[k], l.dz.data[k] = d.X, d.Y, d.Z
+}
+
+// clone returns a copy of the lattice.
+func (l *FFDLattice) clone() *FFDLattice {
+	c := *l
+	for _, g := range []**grid3{&c.dx, &c.dy, &c.dz} {
+		x := **g
+		x.data = append([]float64(nil), x.data...)
+		*g = &x
+	}
+	return &c
+}
+
+// displacement returns the interpolated displacement of a grid at a point, and its gradient.
+func (l *FFDLattice) displacement(g *grid3, p v3.Vec) (float64, v3.Vec) {
+	if l.tricubic {
+		return g.tricubic(p)
+	}
+	return g.trilinear(p), g.trilinearGradient(p)
+}
+
+// forward returns the deformed position of a point and the rows of the jacobian.
+func (l *FFDLattice) forward(p v3.Vec) (v3.Vec, [3]v3.Vec) {
+	// Outside the lattice the displacement is the same as on the nearest face.
+	bb := l.dx.bb
+	q := p.Clamp(bb.Min, bb.Max)
+	dx, gx := l.displacement(l.dx, q)
+	dy, gy := l.displacement(l.dy, q)
+	dz, gz := l.displacement(l.dz, q)
+	// the displacement doesn't change along the clamped axes
+	mask := v3.Vec{1, 1, 1}
+	if q.X != p.X {
+		mask.X = 0
+	}
+	if q.Y != p.Y {
+		mask.Y = 0
+	}
+	if q.Z != p.Z {
+		mask.Z = 0
+	}
+	j := [3]v3.Vec{
+		v3.Vec{1, 0, 0}.Add(gx.Mul(mask)),
+		v3.Vec{0, 1, 0}.Add(gy.Mul(mask)),
+		v3.Vec{0, 0, 1}.Add(gz.Mul(mask)),
+	}
+	return p.Add(v3.Vec{dx, dy, dz}), j
+}
+
+// inverse returns the undeformed position of a point and the distance from its
+// deformed position to the point (the residual of the inverse mapping).
+func (l *FFDLattice) inverse(q v3.Vec) (v3.Vec, float64) {
+	tol := ffdTolerance * l.dx.bb.Size().MaxComponent()
+	p := q
+	x, j := l.forward(p)
+	r := x.Sub(q)
+	for i := 0; i < ffdIterations && r.Length() >= tol; i++ {
+		// Newton step: p -= J^-1 * r
+		step := r
+		c0, c1, c2 := j[1].Cross(j[2]), j[2].Cross(j[0]), j[0].Cross(j[1])
+		if det := j[0].Dot(c0); math.Abs(det) >= epsilon {
+			step = c0.MulScalar(r.X).Add(c1.MulScalar(r.Y)).Add(c2.MulScalar(r.Z)).DivScalar(det)
+		}
+		// shorten the step until it reduces the residual
+		done := true
+		for t := 1.0; t > 1e-3; t *= 0.5 {
+			pt := p.Sub(step.MulScalar(t))
+			xt, jt := l.forward(pt)
+			if rt := xt.Sub(q); rt.Length() < r.Length() {
+				p, j, r = pt, jt, rt
+				done = false
+				break
+			}
+		}
+		if done {
+			break
+		}
+	}
+	return p, r.Length()
+}
+
+// jacobianCell is a lattice cell for bounding the jacobian.
+type jacobianCell struct {
+	l               *FFDLattice
+	weights, derivs [][4]float64 // interpolation weights and their derivatives
+	i               v3i.Vec      // cell index
+	v               [3][]float64 // displacements around the cell (indexed by (z*m+y)*m+x)
+	target          float64      // the cell is subdivided until its bound is at least this
+}
+
+// gradient returns intervals containing the gradient of the displacements for the x, y and z weights (w)
+// and their derivatives (dw).
+func (c *jacobianCell) gradient(v []float64, w, dw [3][]Interval) [3]Interval {
+	m := len(w[0])
+	var g [3]Interval
+	for z := 0; z < m; z++ {
+		// sums over y of the sums over x
+		var sy, dsy, sdx Interval
+		for y := 0; y < m; y++ {
+			var sx, dx Interval
+			for x := 0; x < m; x++ {
+				d := v[(z*m+y)*m+x]
+				sx = sx.add(w[0][x].scale(d))
+				dx = dx.add(dw[0][x].scale(d))
+			}
+			sy = sy.add(w[1][y].mul(sx))
+			dsy = dsy.add(dw[1][y].mul(sx))
+			sdx = sdx.add(w[1][y].mul(dx))
+		}
+		g[0] = g[0].add(w[2][z].mul(sdx))
+		g[1] = g[1].add(w[2][z].mul(dsy))
+		g[2] = g[2].add(dw[2][z].mul(sy))
+	}
+	return g
+}
+
+// bound returns a lower bound on the smallest singular value of the jacobian
+// for the part of the cell from u0 to u0 + size (in cell units).
+func (c *jacobianCell) bound(u0 v3.Vec, size float64, depth int) float64 {
+	m := len(c.weights)
+	var w, dw [3][]Interval
+	for axis := 0; axis < 3; axis++ {
+		t0 := u0.Get(axis)
+		w[axis] = make([]Interval, m)
+		dw[axis] = make([]Interval, m)
+		for a := 0; a < m; a++ {
+			w[axis][a] = polyInterval(c.weights[a], t0, t0+size)
+			dw[axis][a] = polyInterval(c.derivs[a], t0, t0+size)
+		}
+	}
+	n, h := c.l.dx.n, c.l.dx.h
+	ci := [3]int{c.i.X, c.i.Y, c.i.Z}
+	ni := [3]int{n.X, n.Y, n.Z}
+	var mid [3]v3.Vec
+	var e float64
+	for r, v := range c.v {
+		row := c.gradient(v, w, dw)
+		for axis := range row {
+			row[axis] = row[axis].scale(1 / h.Get(axis))
+			// outside the lattice the gradient along the clamped axes is 0
+			t0 := u0.Get(axis)
+			if (ci[axis] == 0 && t0 == 0) || (ci[axis] == ni[axis]-2 && t0+size == 1) {
+				row[axis] = row[axis].extend(Interval{})
+			}
+		}
+		row[r] = row[r].offset(1)
+		for axis, x := range row {
+			mid[r].Set(axis, 0.5*(x[0]+x[1]))
+			e += 0.25 * (x[1] - x[0]) * (x[1] - x[0])
+		}
+	}
+	// The singular values move by no more than the (frobenius) norm of the change in the matrix.
+	b := minSingularValue(mid[0], mid[1], mid[2]) - math.Sqrt(e)
+	if b >= c.target || depth == ffdDepth {
+		return b
+	}
+	// the bounds for the halves are tighter than for the whole
+	size *= 0.5
+	b = math.Inf(1)
+	for i := 0; i < 8; i++ {
+		u := u0.Add(v3.Vec{float64(i & 1), float64((i >> 1) & 1), float64(i >> 2)}.MulScalar(size))
+		b = math.Min(b, c.bound(u, size, depth+1))
+	}
+	return b
+}
+
+// jacobianBound returns a lower bound on the smallest singular value of the jacobian of the forward mapping.
+func (l *FFDLattice) jacobianBound() float64 {
+	c := jacobianCell{l: l, weights: linearWeights, derivs: linearDerivs}
+	offset := 0
+	value := func(g *grid3, x, y, z int) float64 {
+		return g.data[g.index(x, y, z)]
+	}
+	if l.tricubic {
+		c.weights, c.derivs, offset = cubicWeights, cubicDerivs, -1
+		value = (*grid3).cubicValue
+	}
+	m := len(c.weights)
+	n := l.dx.n
+	// The smallest singular value at the cell centers is an upper bound for the lower bound.
+	// The cells are subdivided until their bound is close to it.
+	c.target = math.Inf(1)
+	for z := 0; z < n.Z-1; z++ {
+		for y := 0; y < n.Y-1; y++ {
+			for x := 0; x < n.X-1; x++ {
+				p := l.dx.point(x, y, z).Add(l.dx.h.MulScalar(0.5))
+				_, j := l.forward(p)
+				c.target = math.Min(c.target, minSingularValue(j[0], j[1], j[2]))
+			}
+		}
+	}
+	c.target *= ffdTarget
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	smin := math.Inf(1)
+	cells := make(chan v3i.Vec)
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func(c jacobianCell) {
+			defer wg.Done()
+			for i := range c.v {
+				c.v[i] = make([]float64, m*m*m)
+			}
+			b := math.Inf(1)
+			for c.i = range cells {
+				for r, g := range []*grid3{l.dx, l.dy, l.dz} {
+					v := c.v[r]
+					mean := 0.0
+					for z := 0; z < m; z++ {
+						for y := 0; y < m; y++ {
+							for x := 0; x < m; x++ {
+								d := value(g, c.i.X+x+offset, c.i.Y+y+offset, c.i.Z+z+offset)
+								v[(z*m+y)*m+x] = d
+								mean += d
+							}
+						}
+					}
+					// The derivatives of the weights add up to 0, so subtracting the mean doesn't change
+					// the gradient. It makes the intervals narrower.
+					mean /= float64(len(v))
+					for i := range v {
+						v[i] -= mean
+					}
+				}
+				b = math.Min(b, c.bound(v3.Vec{}, 1, 0))
+			}
+			lock.Lock()
+			smin = math.Min(smin, b)
+			lock.Unlock()
+		}(c)
+	}
+	for z := 0; z < n.Z-1; z++ {
+		for y := 0; y < n.Y-1; y++ {
+			for x := 0; x < n.X-1; x++ {
+				cells <- v3i.Vec{x, y, z}
+			}
+		}
+	}
+	close(cells)
+	wg.Wait()
+	return smin
+}
+
+// bounds returns the range of the displacements.
+func (l *FFDLattice) bounds() (v3.Vec, v3.Vec) {
+	var lo, hi v3.Vec
+	for i, g := range []*grid3{l.dx, l.dy, l.dz} {
+		d0, d1 := g.data[0], g.data[0]
+		for _, x := range g.data {
+			d0 = math.Min(d0, x)
+			d1 = math.Max(d1, x)
+		}
+		if l.tricubic {
+			// The grid is extrapolated by one point and the Catmull-Rom spline overshoots
+			// the control points, the positive weights add up to < 1.5.
+			d0, d1 = 2*d0-d1, 2*d1-d0
+			w := 0.5 * (d1 - d0)
+			d0, d1 = d0-w, d1+w
+		}
+		lo.Set(i, d0)
+		hi.Set(i, d1)
+	}
+	return lo, hi
+}
+
+//-----------------------------------------------------------------------------
+
+// FFDSDF3 is an SDF3 deformed by a control point lattice.
+type FFDSDF3 struct {
+	sdf     SDF3
+	lattice *FFDLattice
+	k       float64 // lower bound on the smallest singular value of the jacobian
+	bb      Box3
+}
+
+// FFD3D returns an SDF3 deformed by a control point lattice (a free-form deformation).
+// The lattice is copied, so it can be changed afterwards without changing the SDF3.
+func FFD3D(sdf SDF3, lattice *FFDLattice) (SDF3, error) {
+	if sdf == nil {
+		return nil, ErrMsg("sdf == nil")
+	}
+	if lattice == nil {
+		return nil, ErrMsg("lattice == nil")
+	}
+	l := lattice.clone()
+	k := l.jacobianBound()
+	if k <= 0 {
+		return nil, ErrMsg("the lattice folds over itself (or is too distorted)")
+	}
+	bb := sdf.BoundingBox()
+	lo, hi := l.bounds()
+	return &FFDSDF3{
+		sdf:     sdf,
+		lattice: l,
+		k:       k,
+		bb:      Box3{bb.Min.Add(lo), bb.Max.Add(hi)},
+	}, nil
+}
+
+// Evaluate returns the minimum distance to a deformed SDF3.
+func (s *FFDSDF3) Evaluate(p v3.Vec) float64 {
+	q, r := s.lattice.inverse(p)
+	d := s.sdf.Evaluate(q) * s.k
+	// q is deformed to within r of p, so the distance at p is within r of the distance there
+	if d > 0 {
+		return math.Max(d-r, 0)
+	}
+	return math.Min(d+r, 0)
+}
+
+// EvaluateInterval returns an interval containing the values of a deformed SDF3 within a box.
+func (s *FFDSDF3) EvaluateInterval(b Box3) Interval {
+	// The inverse mapping stretches distances by at most 1/k and the distance
+	// is scaled by k, so the lipschitz constant is 1.
+	return lipschitzInterval3(s, b, 1)
+}
+
+// BoundingBox returns the bounding box of a deformed SDF3.
+func (s *FFDSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
@@ -78,6 +78,11 @@ func (s *Flange1) Evaluate(p v2.Vec) float64 {
 	return d
 }
 
+// EvaluateInterval returns an interval containing the values of the flange within a box.
+func (s *Flange1) EvaluateInterval(b Box2) Interval {
+	return exactInterval2(s, b)
+}
+
 // BoundingBox returns the bounding box for the flange.
 func (s *Flange1) BoundingBox() Box2 {
 	return s.bb
@@ -0,0 +1,203 @@
+//-----------------------------------------------------------------------------
+/*
+
+Gradients
+
+An SDF that implements Gradient returns the gradient of the distance field.
+For a true distance field this is the unit normal to the closest surface.
+
+Many SDFs have an exact gradient. Transforms, unions, differences, etc.
+use the chain rule on the gradients of their children. Anything else
+falls back to central differences.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"math"
+
+	v2 "github.com/deadsy/sdfx/vec/v2"
+	v3 "github.com/deadsy/sdfx/vec/v3"
+)
+
+//-----------------------------------------------------------------------------
+
+// gradientEpsilon is the central difference step used when an SDF has no gradient.
+const gradientEpsilon = 1e-6
+
+// GradientSDF3 is an SDF3 that returns its gradient.
+// eps is the central difference step for any children without a Gradient method.
+// It's the eps passed to Normal3, so a caller that picks a step for the scale of
+// the model gets the same normals whether or not every node has a Gradient method.
+type GradientSDF3 interface {
+	SDF3
+	Gradient(p v3.Vec, eps float64) v3.Vec
+}
+
+// GradientSDF2 is an SDF2 that returns its gradient.
+// eps is the central difference step for any children without a Gradient method.
+// It's the eps passed to Normal2, so a caller that picks a step for the scale of
+// the model gets the same normals whether or not every node has a Gradient method.
+type GradientSDF2 interface {
+	SDF2
+	Gradient(p v2.Vec, eps float64) v2.Vec
+}
+
+//-----------------------------------------------------------------------------
+
+// Gradient3 returns the gradient of an SDF3 at a point.
+// SDF3s (or their children) without a Gradient method use central differences with a step of eps.
+// A step <= 0 uses the default step.
+func Gradient3(s SDF3, p v3.Vec, eps float64) v3.Vec {
+	if eps <= 0 {
+		eps = gradientEpsilon
+	}
+	if sg, ok := s.(GradientSDF3); ok {
+		return sg.Gradient(p, eps)
+	}
+	return centralGradient3(s, p, eps)
+}
+
+// Gradient2 returns the gradient of an SDF2 at a point.
+// SDF2s (or their children) without a Gradient method use central differences with a step of eps.
+// A step <= 0 uses the default step.
+func Gradient2(s SDF2, p v2.Vec, eps float64) v2.Vec {
+	if eps <= 0 {
+		eps = gradientEpsilon
+	}
+	if sg, ok := s.(GradientSDF2); ok {
+		return sg.Gradient(p, eps)
+	}
+	return centralGradient2(s, p, eps)
+}
+
+// centralGradient3 returns the gradient of an SDF3 using central differences.
+func centralGradient3(s SDF3, p v3.Vec, eps float64) v3.Vec {
+	return v3.Vec{
+		X: s.Evaluate(p.Add(v3.Vec{X: eps})) - s.Evaluate(p.Add(v3.Vec{X: -eps})),
+		Y: s.Evaluate(p.Add(v3.Vec{Y: eps})) - s.Evaluate(p.Add(v3.Vec{Y: -eps})),
+		Z: s.Evaluate(p.Add(v3.Vec{Z: eps})) - s.Evaluate(p.Add(v3.Vec{Z: -eps})),
+	}.DivScalar(2 * eps)
+}
+
+// centralGradient2 returns the gradient of an SDF2 using central differences.
+func centralGradient2(s SDF2, p v2.Vec, eps float64) v2.Vec {
+	return v2.Vec{
+		X: s.Evaluate(p.Add(v2.Vec{X: eps})) - s.Evaluate(p.Add(v2.Vec{X: -eps})),
+		Y: s.Evaluate(p.Add(v2.Vec{Y: eps})) - s.Evaluate(p.Add(v2.Vec{Y: -eps})),
+	}.DivScalar(2 * eps)
+}
+
+//-----------------------------------------------------------------------------
+
+// sign returns +/- 1 with the sign of x.
+func sign(x float64) float64 {
+	return math.Copysign(1, x)
+}
+
+// unitVector3 returns a vector normalized to unit length.
+// Vectors along an axis are returned exactly.
+func unitVector3(v v3.Vec) v3.Vec {
+	l := v.Length()
+	if l == 0 {
+		return v3.Vec{}
+	}
+	return v3.Vec{v.X / l, v.Y / l, v.Z / l}
+}
+
+// unitVector2 returns a vector normalized to unit length.
+// Vectors along an axis are returned exactly.
+func unitVector2(v v2.Vec) v2.Vec {
+	l := v.Length()
+	if l == 0 {
+		return v2.Vec{}
+	}
+	return v2.Vec{v.X / l, v.Y / l}
+}
+
+// sdfBox3dGradient returns the gradient of sdfBox3d.
+func sdfBox3dGradient(p, s v3.Vec) v3.Vec {
+	d := p.Abs().Sub(s)
+	if d.X > 0 || d.Y > 0 || d.Z > 0 {
+		// outside: the gradient points away from the closest box feature
+		d = d.Max(v3.Vec{})
+		return unitVector3(v3.Vec{d.X * sign(p.X), d.Y * sign(p.Y), d.Z * sign(p.Z)})
+	}
+	// inside: the gradient is normal to the closest face
+	if d.X >= d.Y && d.X >= d.Z {
+		return v3.Vec{sign(p.X), 0, 0}
+	}
+	if d.Y >= d.Z {
+		return v3.Vec{0, sign(p.Y), 0}
+	}
+	return v3.Vec{0, 0, sign(p.Z)}
+}
+
+// sdfBox2dGradient returns the gradient of sdfBox2d.
+func sdfBox2dGradient(p, s v2.Vec) v2.Vec {
+	d := p.Abs().Sub(s)
+	if d.X > 0 || d.Y > 0 {
+		// outside: the gradient points away from the closest box feature
+		d = d.Max(v2.Vec{})
+		return unitVector2(v2.Vec{d.X * sign(p.X), d.Y * sign(p.Y)})
+	}
+	// inside: the gradient is normal to the closest edge
+	if d.X >= d.Y {
+		return v2.Vec{sign(p.X), 0}
+	}
+	return v2.Vec{0, sign(p.Y)}
+}
+
+// sorGradient maps the gradient of a 2d profile (r, z) to a solid of revolution.
+func sorGradient(g v2.Vec, p v3.Vec) v3.Vec {
+	r := math.Sqrt(p.X*p.X + p.Y*p.Y)
+	if r == 0 {
+		return v3.Vec{0, 0, g.Y}
+	}
+	return v3.Vec{g.X * p.X / r, g.X * p.Y / r, g.Y}
+}
+
+//-----------------------------------------------------------------------------
+// Blending functions are black boxes, so work out their partial derivatives numerically.
+
+// blendPartials returns the partial derivatives of a min/max function with respect to a and b.
+func blendPartials(f func(a, b float64) float64, a, b float64) (float64, float64) {
+	h := gradientEpsilon * (1 + math.Abs(a) + math.Abs(b))
+	d := f(a, b)
+	// Is the result just a or b? (E.g. math.Min/math.Max away from a tie)
+	if f(a+h, b) == a+h && f(a-h, b) == a-h && f(a, b+h) == d && f(a, b-h) == d {
+		return 1, 0
+	}
+	if f(a, b+h) == b+h && f(a, b-h) == b-h && f(a+h, b) == d && f(a-h, b) == d {
+		return 0, 1
+	}
+	fa := (f(a+h, b) - f(a-h, b)) / (2 * h)
+	fb := (f(a, b+h) - f(a, b-h)) / (2 * h)
+	return fa, fb
+}
+
+// blendWeights returns the weights of each value in the gradient of a min/max function folded over the values.
+func blendWeights(f func(a, b float64) float64, d []float64) []float64 {
+	w := make([]float64, len(d))
+	if len(d) == 0 {
+		return w
+	}
+	fa := make([]float64, len(d))
+	x := d[0]
+	for i := 1; i < len(d); i++ {
+		fa[i], w[i] = blendPartials(f, x, d[i])
+		x = f(x, d[i])
+	}
+	// back propagate the partial derivatives
+	k := 1.0
+	for i := len(d) - 1; i > 0; i-- {
+		w[i] *= k
+		k *= fa[i]
+	}
+	w[0] = k
+	return w
+}
+
+//-----------------------------------------------------------------------------
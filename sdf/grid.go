@@ -0,0 +1,342 @@
+//-----------------------------------------------------------------------------
+/*
+
+Grids
+
+Dense grids of values sampled at the points of a box, with interpolation of
+the values (and their gradients) between the grid points.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"math"
+	"runtime"
+	"sync"
+
+	v2 "github.com/deadsy/sdfx/vec/v2"
+	"github.com/deadsy/sdfx/vec/v2i"
+	v3 "github.com/deadsy/sdfx/vec/v3"
+	"github.com/deadsy/sdfx/vec/v3i"
+)
+
+//-----------------------------------------------------------------------------
+// 3D grids
+
+// grid3 is a dense grid of values sampled at the points of a 3d box.
+type grid3 struct {
+	bb   Box3      // grid bounds
+	n    v3i.Vec   // number of grid points on each axis
+	h    v3.Vec    // grid point spacing
+	data []float64 // values (x varies fastest)
+}
+
+// newGrid3 returns a grid with n points on each axis covering a box.
+func newGrid3(bb Box3, n v3i.Vec) *grid3 {
+	return &grid3{
+		bb:   bb,
+		n:    n,
+		h:    bb.Size().Div(v3.Vec{float64(n.X - 1), float64(n.Y - 1), float64(n.Z - 1)}),
+		data: make([]float64, n.X*n.Y*n.Z),
+	}
+}
+
+// index returns the data index of a grid point.
+func (g *grid3) index(x, y, z int) int {
+	return (z*g.n.Y+y)*g.n.X + x
+}
+
+// point returns the position of a grid point.
+func (g *grid3) point(x, y, z int) v3.Vec {
+	return g.bb.Min.Add(g.h.Mul(v3.Vec{float64(x), float64(y), float64(z)}))
+}
+
+// sample sets the grid values to the values of an SDF3.
+// The z-slices of the grid are evaluated in parallel.
+// The progress listener may be nil.
+func (g *grid3) sample(s SDF3, progress chan float64) {
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	done := 0
+	slices := make(chan int)
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ps := make([]v3.Vec, g.n.X)
+			for z := range slices {
+				for y := 0; y < g.n.Y; y++ {
+					for x := range ps {
+						ps[x] = g.point(x, y, z)
+					}
+					k := g.index(0, y, z)
+					EvaluateBatch3(s, ps, g.data[k:k+g.n.X])
+				}
+				if progress != nil {
+					lock.Lock()
+					done++
+					progress <- float64(done) / float64(g.n.Z)
+					lock.Unlock()
+				}
+			}
+		}()
+	}
+	for z := 0; z < g.n.Z; z++ {
+		slices <- z
+	}
+	close(slices)
+	wg.Wait()
+}
+
+// slope returns the largest difference between neighbouring grid values along each axis,
+// divided by the grid spacing. The trilinear interpolation of the grid has a lipschitz
+// constant of slope().Length().
+func (g *grid3) slope() v3.Vec {
+	var d v3.Vec
+	for z := 0; z < g.n.Z; z++ {
+		for y := 0; y < g.n.Y; y++ {
+			for x := 0; x < g.n.X; x++ {
+				k := g.index(x, y, z)
+				if x > 0 {
+					d.X = math.Max(d.X, math.Abs(g.data[k]-g.data[k-1]))
+				}
+				if y > 0 {
+					d.Y = math.Max(d.Y, math.Abs(g.data[k]-g.data[k-g.n.X]))
+				}
+				if z > 0 {
+					d.Z = math.Max(d.Z, math.Abs(g.data[k]-g.data[k-g.n.X*g.n.Y]))
+				}
+			}
+		}
+	}
+	return d.Div(g.h)
+}
+
+// cell returns the grid cell containing a point and the position of the point within the cell.
+func (g *grid3) cell(p v3.Vec) (v3i.Vec, v3.Vec) {
+	u := p.Sub(g.bb.Min).Div(g.h)
+	i := v3i.Vec{
+		minInt(maxInt(int(math.Floor(u.X)), 0), g.n.X-2),
+		minInt(maxInt(int(math.Floor(u.Y)), 0), g.n.Y-2),
+		minInt(maxInt(int(math.Floor(u.Z)), 0), g.n.Z-2),
+	}
+	return i, u.Sub(v3.Vec{float64(i.X), float64(i.Y), float64(i.Z)})
+}
+
+// corners returns the values at the corners of a grid cell.
+func (g *grid3) corners(i v3i.Vec) [8]float64 {
+	k := g.index(i.X, i.Y, i.Z)
+	dy, dz := g.n.X, g.n.X*g.n.Y
+	return [8]float64{
+		g.data[k], g.data[k+1], g.data[k+dy], g.data[k+dy+1],
+		g.data[k+dz], g.data[k+dz+1], g.data[k+dz+dy], g.data[k+dz+dy+1],
+	}
+}
+
+// trilinear returns the trilinear interpolation of the grid values at a point.
+func (g *grid3) trilinear(p v3.Vec) float64 {
+	i, u := g.cell(p)
+	return trilinear(g.corners(i), u)
+}
+
+// trilinearGradient returns the gradient of the trilinear interpolation at a point.
+func (g *grid3) trilinearGradient(p v3.Vec) v3.Vec {
+	i, u := g.cell(p)
+	return trilinearGradient(g.corners(i), u).Div(g.h)
+}
+
+// trilinear returns the trilinear interpolation of the values at the corners of a
+// cell for a position u within the cell.
+func trilinear(c [8]float64, u v3.Vec) float64 {
+	c00 := Mix(c[0], c[1], u.X)
+	c10 := Mix(c[2], c[3], u.X)
+	c01 := Mix(c[4], c[5], u.X)
+	c11 := Mix(c[6], c[7], u.X)
+	return Mix(Mix(c00, c10, u.Y), Mix(c01, c11, u.Y), u.Z)
+}
+
+// trilinearGradient returns the gradient (in cell units) of the trilinear
+// interpolation of the values at the corners of a cell.
+func trilinearGradient(c [8]float64, u v3.Vec) v3.Vec {
+	// differences along x, y and z
+	dx00, dx10, dx01, dx11 := c[1]-c[0], c[3]-c[2], c[5]-c[4], c[7]-c[6]
+	dy00, dy10, dy01, dy11 := c[2]-c[0], c[3]-c[1], c[6]-c[4], c[7]-c[5]
+	dz00, dz10, dz01, dz11 := c[4]-c[0], c[5]-c[1], c[6]-c[2], c[7]-c[3]
+	return v3.Vec{
+		Mix(Mix(dx00, dx10, u.Y), Mix(dx01, dx11, u.Y), u.Z),
+		Mix(Mix(dy00, dy10, u.X), Mix(dy01, dy11, u.X), u.Z),
+		Mix(Mix(dz00, dz10, u.X), Mix(dz01, dz11, u.X), u.Y),
+	}
+}
+
+// tricubicSlope bounds the slope of the tricubic interpolation along an axis relative to
+// the slope of the grid values. The sum of the magnitudes of the partial sums of the
+// Catmull-Rom derivative weights is <= 1.5, and the sum of the weight magnitudes on each
+// of the other two axes is <= 1.5 (allowing for the extrapolation beyond the grid faces).
+const tricubicSlope = 1.5 * 1.5 * 1.5
+
+// catmullRom returns the Catmull-Rom spline weights of the 4 grid points around
+// a position t within a grid cell, and the derivatives of the weights.
+func catmullRom(t float64) ([4]float64, [4]float64) {
+	t2 := t * t
+	t3 := t2 * t
+	w := [4]float64{
+		0.5 * (-t3 + 2*t2 - t),
+		0.5 * (3*t3 - 5*t2 + 2),
+		0.5 * (-3*t3 + 4*t2 + t),
+		0.5 * (t3 - t2),
+	}
+	dw := [4]float64{
+		0.5 * (-3*t2 + 4*t - 1),
+		0.5 * (9*t2 - 10*t),
+		0.5 * (-9*t2 + 8*t + 1),
+		0.5 * (3*t2 - 2*t),
+	}
+	return w, dw
+}
+
+// cubicValue returns the value at a grid point for cubic interpolation.
+// The grid is linearly extrapolated by one point beyond each face.
+func (g *grid3) cubicValue(x, y, z int) float64 {
+	switch {
+	case x < 0:
+		return 2*g.cubicValue(0, y, z) - g.cubicValue(1, y, z)
+	case x >= g.n.X:
+		return 2*g.cubicValue(g.n.X-1, y, z) - g.cubicValue(g.n.X-2, y, z)
+	case y < 0:
+		return 2*g.cubicValue(x, 0, z) - g.cubicValue(x, 1, z)
+	case y >= g.n.Y:
+		return 2*g.cubicValue(x, g.n.Y-1, z) - g.cubicValue(x, g.n.Y-2, z)
+	case z < 0:
+		return 2*g.cubicValue(x, y, 0) - g.cubicValue(x, y, 1)
+	case z >= g.n.Z:
+		return 2*g.cubicValue(x, y, g.n.Z-1) - g.cubicValue(x, y, g.n.Z-2)
+	}
+	return g.data[g.index(x, y, z)]
+}
+
+// tricubic returns the tricubic (Catmull-Rom) interpolation of the grid values at a point, and its gradient.
+func (g *grid3) tricubic(p v3.Vec) (float64, v3.Vec) {
+	i, u := g.cell(p)
+	wx, dwx := catmullRom(u.X)
+	wy, dwy := catmullRom(u.Y)
+	wz, dwz := catmullRom(u.Z)
+	var d float64
+	var grad v3.Vec
+	for c := 0; c < 4; c++ {
+		for b := 0; b < 4; b++ {
+			// interpolate along x
+			var vx, dvx float64
+			for a := 0; a < 4; a++ {
+				v := g.cubicValue(i.X+a-1, i.Y+b-1, i.Z+c-1)
+				vx += wx[a] * v
+				dvx += dwx[a] * v
+			}
+			d += wz[c] * wy[b] * vx
+			grad.X += wz[c] * wy[b] * dvx
+			grad.Y += wz[c] * dwy[b] * vx
+			grad.Z += dwz[c] * wy[b] * vx
+		}
+	}
+	return d, grad.Div(g.h)
+}
+
+//-----------------------------------------------------------------------------
+// 2D grids
+
+// grid2 is a dense grid of values sampled at the points of a 2d box.
+type grid2 struct {
+	bb   Box2      // grid bounds
+	n    v2i.Vec   // number of grid points on each axis
+	h    v2.Vec    // grid point spacing
+	data []float64 // values (x varies fastest)
+}
+
+// newGrid2 returns a grid with n points on each axis covering a box.
+func newGrid2(bb Box2, n v2i.Vec) *grid2 {
+	return &grid2{
+		bb:   bb,
+		n:    n,
+		h:    bb.Size().Div(v2.Vec{float64(n.X - 1), float64(n.Y - 1)}),
+		data: make([]float64, n.X*n.Y),
+	}
+}
+
+// index returns the data index of a grid point.
+func (g *grid2) index(x, y int) int {
+	return y*g.n.X + x
+}
+
+// point returns the position of a grid point.
+func (g *grid2) point(x, y int) v2.Vec {
+	return g.bb.Min.Add(g.h.Mul(v2.Vec{float64(x), float64(y)}))
+}
+
+// sample sets the grid values to the values of an SDF2.
+func (g *grid2) sample(s SDF2) {
+	ps := make([]v2.Vec, g.n.X)
+	for y := 0; y < g.n.Y; y++ {
+		for x := range ps {
+			ps[x] = g.point(x, y)
+		}
+		k := g.index(0, y)
+		EvaluateBatch2(s, ps, g.data[k:k+g.n.X])
+	}
+}
+
+// slope returns the largest difference between neighbouring grid values along each axis,
+// divided by the grid spacing. The bilinear interpolation of the grid has a lipschitz
+// constant of slope().Length().
+func (g *grid2) slope() v2.Vec {
+	var d v2.Vec
+	for y := 0; y < g.n.Y; y++ {
+		for x := 0; x < g.n.X; x++ {
+			k := g.index(x, y)
+			if x > 0 {
+				d.X = math.Max(d.X, math.Abs(g.data[k]-g.data[k-1]))
+			}
+			if y > 0 {
+				d.Y = math.Max(d.Y, math.Abs(g.data[k]-g.data[k-g.n.X]))
+			}
+		}
+	}
+	return d.Div(g.h)
+}
+
+// cell returns the grid cell containing a point and the position of the point within the cell.
+func (g *grid2) cell(p v2.Vec) (v2i.Vec, v2.Vec) {
+	u := p.Sub(g.bb.Min).Div(g.h)
+	i := v2i.Vec{
+		minInt(maxInt(int(math.Floor(u.X)), 0), g.n.X-2),
+		minInt(maxInt(int(math.Floor(u.Y)), 0), g.n.Y-2),
+	}
+	return i, u.Sub(v2.Vec{float64(i.X), float64(i.Y)})
+}
+
+// corners returns the values at the corners of a grid cell.
+func (g *grid2) corners(i v2i.Vec) [4]float64 {
+	k := g.index(i.X, i.Y)
+	dy := g.n.X
+	return [4]float64{g.data[k], g.data[k+1], g.data[k+dy], g.data[k+dy+1]}
+}
+
+// bilinear returns the bilinear interpolation of the grid values at a point.
+func (g *grid2) bilinear(p v2.Vec) float64 {
+	i, u := g.cell(p)
+	c := g.corners(i)
+	return Mix(Mix(c[0], c[1], u.X), Mix(c[2], c[3], u.X), u.Y)
+}
+
+// bilinearGradient returns the gradient of the bilinear interpolation at a point.
+func (g *grid2) bilinearGradient(p v2.Vec) v2.Vec {
+	i, u := g.cell(p)
+	c := g.corners(i)
+	return v2.Vec{
+		Mix(c[1]-c[0], c[3]-c[2], u.Y) / g.h.X,
+		Mix(c[2]-c[0], c[3]-c[1], u.X) / g.h.Y,
+	}
+}
+
+//-----------------------------------------------------------------------------
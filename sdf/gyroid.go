@@ -16,13 +16,15 @@ import v3 "github.com/deadsy/sdfx/vec/v3"
 
 // GyroidSDF3 is a 3d gyroid.
 type GyroidSDF3 struct {
-	k v3.Vec // scaling factor
+	k     v3.Vec // scaling factor
+	scale v3.Vec // period of the gyroid (for serialization)
 }
 
 // Gyroid3D returns a 3d gyroid.
 func Gyroid3D(scale v3.Vec) (SDF3, error) {
 	return &GyroidSDF3{
-		k: v3.Vec{Tau / scale.X, Tau / scale.Y, Tau / scale.Z},
+		k:     v3.Vec{Tau / scale.X, Tau / scale.Y, Tau / scale.Z},
+		scale: scale,
 	}, nil
 }
 
@@ -32,6 +34,17 @@ func (s *GyroidSDF3) Evaluate(p v3.Vec) float64 {
 	return p.Sin().Dot(v3.Vec{p.Y, p.Z, p.X}.Cos())
 }
 
+// EvaluateInterval returns an interval containing the values of a 3d gyroid within a box.
+func (s *GyroidSDF3) EvaluateInterval(b Box3) Interval {
+	x := Interval{b.Min.X * s.k.X, b.Max.X * s.k.X}.Sort()
+	y := Interval{b.Min.Y * s.k.Y, b.Max.Y * s.k.Y}.Sort()
+	z := Interval{b.Min.Z * s.k.Z, b.Max.Z * s.k.Z}.Sort()
+	d0 := sinInterval(x).mul(cosInterval(y))
+	d1 := sinInterval(y).mul(cosInterval(z))
+	d2 := sinInterval(z).mul(cosInterval(x))
+	return Interval{d0[0] + d1[0] + d2[0], d0[1] + d1[1] + d2[1]}
+}
+
 // BoundingBox returns the bounding box for a 3d gyroid.
 func (s *GyroidSDF3) BoundingBox() Box3 {
 	// The surface is defined for all xyz, so the bounding box is a point at the origin.
@@ -0,0 +1,279 @@
+//-----------------------------------------------------------------------------
+/*
+
+Interval Evaluation
+
+An SDF that implements EvaluateInterval returns an interval that contains
+all of the values of the SDF within a box. Renderers use this to decide
+if a box can contain the surface without assuming the SDF returns a true
+distance.
+
+SDFs that don't implement the interface may return a bound on the distance
+(with a lipschitz constant > 1), so their interval is unbounded. Renderers
+can't rule out the surface within the box and fall back to sampling the SDF.
+SDFs that return a true distance bound their values with the value at the
+center of the box +/- the half diagonal of the box.
+
+The min/max functions used to blend SDFs are assumed to be monotonic.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"math"
+
+	v2 "github.com/deadsy/sdfx/vec/v2"
+	v3 "github.com/deadsy/sdfx/vec/v3"
+)
+
+//-----------------------------------------------------------------------------
+
+// IntervalSDF3 is an SDF3 that can bound its values within a box.
+type IntervalSDF3 interface {
+	SDF3
+	EvaluateInterval(b Box3) Interval
+}
+
+// IntervalSDF2 is an SDF2 that can bound its values within a box.
+type IntervalSDF2 interface {
+	SDF2
+	EvaluateInterval(b Box2) Interval
+}
+
+//-----------------------------------------------------------------------------
+
+// unboundedInterval is the interval for SDFs that can't bound their values.
+var unboundedInterval = Interval{math.Inf(-1), math.Inf(1)}
+
+// EvaluateInterval3 returns an interval containing the values of an SDF3 within a box.
+func EvaluateInterval3(s SDF3, b Box3) Interval {
+	if si, ok := s.(IntervalSDF3); ok {
+		return si.EvaluateInterval(b)
+	}
+	return unboundedInterval
+}
+
+// EvaluateInterval2 returns an interval containing the values of an SDF2 within a box.
+func EvaluateInterval2(s SDF2, b Box2) Interval {
+	if si, ok := s.(IntervalSDF2); ok {
+		return si.EvaluateInterval(b)
+	}
+	return unboundedInterval
+}
+
+// exactInterval3 returns the interval for an SDF3 that is a true distance field.
+func exactInterval3(s SDF3, b Box3) Interval {
+	d := s.Evaluate(b.Center())
+	h := 0.5 * b.Size().Length()
+	return Interval{d - h, d + h}
+}
+
+// exactInterval2 returns the interval for an SDF2 that is a true distance field.
+func exactInterval2(s SDF2, b Box2) Interval {
+	d := s.Evaluate(b.Center())
+	h := 0.5 * b.Size().Length()
+	return Interval{d - h, d + h}
+}
+
+// lipschitzInterval3 returns the interval for an SDF3 with a lipschitz constant k.
+func lipschitzInterval3(s SDF3, b Box3, k float64) Interval {
+	d := s.Evaluate(b.Center())
+	h := 0.5 * k * b.Size().Length()
+	return Interval{d - h, d + h}
+}
+
+// lipschitzInterval2 returns the interval for an SDF2 with a lipschitz constant k.
+func lipschitzInterval2(s SDF2, b Box2, k float64) Interval {
+	d := s.Evaluate(b.Center())
+	h := 0.5 * k * b.Size().Length()
+	return Interval{d - h, d + h}
+}
+
+// convexInterval3 returns the interval for an SDF3 that is the true distance field of a convex solid.
+// The distance field is a convex function, so the maximum within a box is at a vertex of the box.
+func convexInterval3(s SDF3, b Box3) Interval {
+	i := exactInterval3(s, b)
+	i[1] = math.Inf(-1)
+	for _, v := range b.Vertices() {
+		i[1] = math.Max(i[1], s.Evaluate(v))
+	}
+	return i
+}
+
+// convexInterval2 returns the interval for an SDF2 that is the true distance field of a convex area.
+// The distance field is a convex function, so the maximum within a box is at a vertex of the box.
+func convexInterval2(s SDF2, b Box2) Interval {
+	i := exactInterval2(s, b)
+	i[1] = math.Inf(-1)
+	for _, v := range b.Vertices() {
+		i[1] = math.Max(i[1], s.Evaluate(v))
+	}
+	return i
+}
+
+//-----------------------------------------------------------------------------
+// interval arithmetic
+
+// offset adds x to an interval.
+func (a Interval) offset(x float64) Interval {
+	return Interval{a[0] + x, a[1] + x}
+}
+
+// add adds two intervals.
+func (a Interval) add(b Interval) Interval {
+	return Interval{a[0] + b[0], a[1] + b[1]}
+}
+
+// scale multiplies an interval by x.
+func (a Interval) scale(x float64) Interval {
+	if x < 0 {
+		return Interval{a[1] * x, a[0] * x}
+	}
+	return Interval{a[0] * x, a[1] * x}
+}
+
+// neg negates an interval.
+func (a Interval) neg() Interval {
+	return Interval{-a[1], -a[0]}
+}
+
+// abs returns the interval of absolute values.
+func (a Interval) abs() Interval {
+	if a[0] >= 0 {
+		return a
+	}
+	if a[1] <= 0 {
+		return a.neg()
+	}
+	return Interval{0, math.Max(-a[0], a[1])}
+}
+
+// mul multiplies two intervals.
+func (a Interval) mul(b Interval) Interval {
+	x0 := a[0] * b[0]
+	x1 := a[0] * b[1]
+	x2 := a[1] * b[0]
+	x3 := a[1] * b[1]
+	return Interval{math.Min(math.Min(x0, x1), math.Min(x2, x3)), math.Max(math.Max(x0, x1), math.Max(x2, x3))}
+}
+
+// extend returns the interval that contains both intervals.
+func (a Interval) extend(b Interval) Interval {
+	return Interval{math.Min(a[0], b[0]), math.Max(a[1], b[1])}
+}
+
+// bounded replaces NaN values (e.g. from blending unbounded intervals) with infinities.
+func (a Interval) bounded() Interval {
+	if math.IsNaN(a[0]) {
+		a[0] = math.Inf(-1)
+	}
+	if math.IsNaN(a[1]) {
+		a[1] = math.Inf(1)
+	}
+	return a
+}
+
+// minInterval applies a (monotonic) min function to two intervals.
+func minInterval(min MinFunc, a, b Interval) Interval {
+	return Interval{min(a[0], b[0]), min(a[1], b[1])}.bounded()
+}
+
+// maxInterval applies a (monotonic) max function to two intervals.
+func maxInterval(max MaxFunc, a, b Interval) Interval {
+	return Interval{max(a[0], b[0]), max(a[1], b[1])}.bounded()
+}
+
+// sinInterval returns the interval of sin(x) for x in [a, b].
+func sinInterval(a Interval) Interval {
+	if a[1]-a[0] >= Tau {
+		return Interval{-1, 1}
+	}
+	s0 := math.Sin(a[0])
+	s1 := math.Sin(a[1])
+	i := Interval{math.Min(s0, s1), math.Max(s0, s1)}
+	// is there a maximum (pi/2 + 2*pi*n) within the interval?
+	if math.Floor((a[1]-0.5*Pi)/Tau) > math.Floor((a[0]-0.5*Pi)/Tau) {
+		i[1] = 1
+	}
+	// is there a minimum (-pi/2 + 2*pi*n) within the interval?
+	if math.Floor((a[1]+0.5*Pi)/Tau) > math.Floor((a[0]+0.5*Pi)/Tau) {
+		i[0] = -1
+	}
+	return i
+}
+
+// cosInterval returns the interval of cos(x) for x in [a, b].
+func cosInterval(a Interval) Interval {
+	return sinInterval(a.offset(0.5 * Pi))
+}
+
+// linearInterval3 returns the interval of n.p + k for p within a box.
+func linearInterval3(n v3.Vec, k float64, b Box3) Interval {
+	x := Interval{n.X * b.Min.X, n.X * b.Max.X}.Sort()
+	y := Interval{n.Y * b.Min.Y, n.Y * b.Max.Y}.Sort()
+	z := Interval{n.Z * b.Min.Z, n.Z * b.Max.Z}.Sort()
+	return Interval{x[0] + y[0] + z[0] + k, x[1] + y[1] + z[1] + k}
+}
+
+// linearInterval2 returns the interval of n.p + k for p within a box.
+func linearInterval2(n v2.Vec, k float64, b Box2) Interval {
+	x := Interval{n.X * b.Min.X, n.X * b.Max.X}.Sort()
+	y := Interval{n.Y * b.Min.Y, n.Y * b.Max.Y}.Sort()
+	return Interval{x[0] + y[0] + k, x[1] + y[1] + k}
+}
+
+// radialInterval returns the interval of distances from the origin for a 2d box.
+func radialInterval(b Box2) Interval {
+	d := b.MinMaxDist2(v2.Vec{})
+	return Interval{math.Sqrt(d[0]), math.Sqrt(d[1])}
+}
+
+// rotateBox2 returns a box containing a 2d box rotated by all of the angles within an interval.
+func rotateBox2(b Box2, a Interval) Box2 {
+	v := b.Vertices()
+	r := 0.0
+	for _, x := range v {
+		r = math.Max(r, x.Length())
+	}
+	if a[1]-a[0] >= Pi {
+		return Box2{v2.Vec{-r, -r}, v2.Vec{r, r}}
+	}
+	// rotate to the middle angle
+	m := Rotate(0.5 * (a[0] + a[1]))
+	for i := range v {
+		v[i] = m.MulPosition(v[i])
+	}
+	// the remaining rotation moves a point by at most the chord length
+	k := 2 * r * math.Sin(0.25*(a[1]-a[0]))
+	return Box2{v.Min(), v.Max()}.Enlarge(v2.Vec{2 * k, 2 * k})
+}
+
+// sectorBox2 returns a box containing the points of a 2d box mapped to the copy sector
+// [-theta/2, theta/2] (see RotateCopy2D).
+func sectorBox2(b Box2, theta float64) Box2 {
+	r := radialInterval(b)
+	a := Interval{-0.5 * theta, 0.5 * theta}
+	if !b.Contains(v2.Vec{}) {
+		// The box angles span < pi about the angle of the center.
+		// The extreme angles are at the vertices of the box.
+		c := b.Center()
+		c0 := math.Atan2(c.Y, c.X)
+		m := Rotate(-c0)
+		x := Interval{math.Inf(1), math.Inf(-1)}
+		for _, v := range b.Vertices() {
+			v = m.MulPosition(v)
+			t := math.Atan2(v.Y, v.X)
+			x = x.extend(Interval{t, t})
+		}
+		x = x.offset(SawTooth(c0, theta))
+		if x[0] >= a[0] && x[1] <= a[1] {
+			// the box is within a single sector
+			a = x
+		}
+	}
+	return rotateBox2(Box2{v2.Vec{r[0], 0}, v2.Vec{r[1], 0}}, a)
+}
+
+//-----------------------------------------------------------------------------
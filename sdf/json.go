@@ -0,0 +1,1398 @@
+//-----------------------------------------------------------------------------
+/*
+
+JSON Serialization
+
+Write an SDF construction tree to a JSON document and rebuild it.
+
+Each node is a JSON object with a "type" (the name of the function that
+builds it) and the arguments to that function. E.g.
+
+{
+  "sdf3": {
+    "radius": 1,
+    "type": "Sphere3D"
+  },
+  "version": 1
+}
+
+Blends set with SetBlend are stored with their blend size, min/max functions
+set with SetMin/SetMax can't be serialized. Values are stored as they were
+passed to the constructors, so a document is rebuilt exactly. Grid based SDFs
+(redistanced, rounded and sparse voxel SDFs) store the SDF they were sampled
+from, and are sampled again when the document is rebuilt. Nodes that can't be
+described by their arguments (e.g. an imported mesh or an image texture) are
+stored as a reference to the file they were loaded from. Anything else (e.g.
+custom extrusion functions or function textures) can't be serialized.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"runtime"
+
+	v2 "github.com/deadsy/sdfx/vec/v2"
+	"github.com/deadsy/sdfx/vec/v2i"
+	v3 "github.com/deadsy/sdfx/vec/v3"
+	"github.com/deadsy/sdfx/vec/v3i"
+)
+
+//-----------------------------------------------------------------------------
+
+// jsonVersion is the version of the JSON document format.
+const jsonVersion = 1
+
+// jsonDocument is the top level JSON document.
+type jsonDocument struct {
+	Version int             `json:"version"`
+	SDF2    json.RawMessage `json:"sdf2,omitempty"`
+	SDF3    json.RawMessage `json:"sdf3,omitempty"`
+}
+
+// MarshalSDF3 returns a JSON document describing the construction tree of an SDF3.
+func MarshalSDF3(s SDF3) ([]byte, error) {
+	e := jsonEncoder{}
+	n := e.sdf3(s)
+	if e.err != nil {
+		return nil, e.err
+	}
+	return json.MarshalIndent(map[string]interface{}{"version": jsonVersion, "sdf3": n}, "", "  ")
+}
+
+// MarshalSDF2 returns a JSON document describing the construction tree of an SDF2.
+func MarshalSDF2(s SDF2) ([]byte, error) {
+	e := jsonEncoder{}
+	n := e.sdf2(s)
+	if e.err != nil {
+		return nil, e.err
+	}
+	return json.MarshalIndent(map[string]interface{}{"version": jsonVersion, "sdf2": n}, "", "  ")
+}
+
+// unmarshalDocument reads the top level JSON document.
+func unmarshalDocument(data []byte) (*jsonDocument, error) {
+	var doc jsonDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Version < 1 || doc.Version > jsonVersion {
+		return nil, ErrMsg(fmt.Sprintf("unsupported version %d", doc.Version))
+	}
+	return &doc, nil
+}
+
+// UnmarshalSDF3 builds an SDF3 from a JSON document written by MarshalSDF3.
+func UnmarshalSDF3(data []byte) (SDF3, error) {
+	doc, err := unmarshalDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	if doc.SDF3 == nil {
+		return nil, ErrMsg("no sdf3 in document")
+	}
+	return decodeSDF3(doc.SDF3)
+}
+
+// UnmarshalSDF2 builds an SDF2 from a JSON document written by MarshalSDF2.
+func UnmarshalSDF2(data []byte) (SDF2, error) {
+	doc, err := unmarshalDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	if doc.SDF2 == nil {
+		return nil, ErrMsg("no sdf2 in document")
+	}
+	return decodeSDF2(doc.SDF2)
+}
+
+//-----------------------------------------------------------------------------
+// File References
+
+// FileLoader3 loads an SDF3 from a file.
+type FileLoader3 func(path string, args []float64) (SDF3, error)
+
+var fileLoaders3 = map[string]FileLoader3{}
+
+// RegisterFileLoader3 registers a named file loader.
+// An SDF3 loaded with File3D is serialized by reference and is reloaded with the loader of the same name.
+func RegisterFileLoader3(name string, loader FileLoader3) {
+	fileLoaders3[name] = loader
+}
+
+// FileSDF3 is an SDF3 loaded from a file.
+type FileSDF3 struct {
+	sdf    SDF3
+	loader string    // name of the file loader
+	path   string    // path to the file
+	args   []float64 // loader arguments
+}
+
+// File3D loads an SDF3 from a file using a registered file loader.
+func File3D(loader, path string, args ...float64) (SDF3, error) {
+	fn, ok := fileLoaders3[loader]
+	if !ok {
+		return nil, ErrMsg(fmt.Sprintf("no file loader \"%s\"", loader))
+	}
+	s, err := fn(path, args)
+	if err != nil {
+		return nil, err
+	}
+	if s == nil {
+		return nil, ErrMsg(fmt.Sprintf("nothing loaded from \"%s\"", path))
+	}
+	return &FileSDF3{
+		sdf:    s,
+		loader: loader,
+		path:   path,
+		args:   args,
+	}, nil
+}
+
+// Evaluate returns the minimum distance to an SDF3 loaded from a file.
+func (s *FileSDF3) Evaluate(p v3.Vec) float64 {
+	return s.sdf.Evaluate(p)
+}
+
+// EvaluateInterval returns an interval containing the values of an SDF3 loaded from a file within a box.
+func (s *FileSDF3) EvaluateInterval(b Box3) Interval {
+	return EvaluateInterval3(s.sdf, b)
+}
+
+// BoundingBox returns the bounding box of an SDF3 loaded from a file.
+func (s *FileSDF3) BoundingBox() Box3 {
+	return s.sdf.BoundingBox()
+}
+
+//-----------------------------------------------------------------------------
+// Function Identification
+
+// funcName returns the name of a function.
+func funcName(f interface{}) string {
+	return runtime.FuncForPC(reflect.ValueOf(f).Pointer()).Name()
+}
+
+// nameIndex returns the index of a name in a list of names (or -1).
+func nameIndex(names []string, name string) int {
+	for i, x := range names {
+		if x == name {
+			return i
+		}
+	}
+	return -1
+}
+
+//-----------------------------------------------------------------------------
+// Encoding
+
+type jsonNode map[string]interface{}
+
+type jsonEncoder struct {
+	err error
+}
+
+// fail records the first encoding error.
+func (e *jsonEncoder) fail(err error) {
+	if e.err == nil {
+		e.err = err
+	}
+}
+
+func jsonV2(v v2.Vec) []float64 {
+	return []float64{v.X, v.Y}
+}
+
+func jsonV3(v v3.Vec) []float64 {
+	return []float64{v.X, v.Y, v.Z}
+}
+
+func arrayToV2(x [2]float64) v2.Vec {
+	return v2.Vec{x[0], x[1]}
+}
+
+func arrayToV3(x [3]float64) v3.Vec {
+	return v3.Vec{x[0], x[1], x[2]}
+}
+
+// arrayToPatch returns the control points of a bezier patch.
+func arrayToPatch(x [][][3]float64) [][]v3.Vec {
+	cp := make([][]v3.Vec, len(x))
+	for i := range x {
+		cp[i] = make([]v3.Vec, len(x[i]))
+		for j := range x[i] {
+			cp[i][j] = arrayToV3(x[i][j])
+		}
+	}
+	return cp
+}
+
+// addBlend adds the blend of a min/max function to a node (nothing for the default function).
+func (e *jsonEncoder) addBlend(n jsonNode, key string, b blendParms) jsonNode {
+	if b.custom {
+		e.fail(ErrMsg(fmt.Sprintf("can't marshal a %s function that wasn't set with SetBlend", key)))
+		return n
+	}
+	if b.blend != nil {
+		n[key] = jsonNode{"type": e.blendName(b.blend), "k": b.k}
+	}
+	return n
+}
+
+// blendName returns the name of a blend, it must be one of the predefined blends.
+func (e *jsonEncoder) blendName(b *Blend) string {
+	for _, x := range blends {
+		if x == b {
+			return b.Name
+		}
+	}
+	e.fail(ErrMsg(fmt.Sprintf("can't marshal blend \"%s\"", b.Name)))
+	return ""
+}
+
+// sdf3 returns the node for an SDF3.
+func (e *jsonEncoder) sdf3(s SDF3) jsonNode {
+	switch s := s.(type) {
+	case *SorSDF3:
+		return jsonNode{"type": "RevolveTheta3D", "sdf": e.sdf2(s.sdf), "theta": s.theta}
+	case *ExtrudeSDF3:
+		if s.custom {
+			e.fail(ErrMsg("can't marshal a custom extrusion function"))
+			return nil
+		}
+		n := jsonNode{"sdf": e.sdf2(s.sdf), "height": 2 * s.height}
+		scaled := s.scale != v2.Vec{1, 1}
+		switch {
+		case s.twist == 0 && !scaled:
+			n["type"] = "Extrude3D"
+		case !scaled:
+			n["type"] = "TwistExtrude3D"
+			n["twist"] = s.twist
+		case s.twist == 0:
+			n["type"] = "ScaleExtrude3D"
+			n["scale"] = jsonV2(s.scale)
+		default:
+			n["type"] = "ScaleTwistExtrude3D"
+			n["twist"] = s.twist
+			n["scale"] = jsonV2(s.scale)
+		}
+		return n
+	case *ExtrudeRoundedSDF3:
+		return jsonNode{"type": "ExtrudeRounded3D", "sdf": e.sdf2(s.sdf), "height": s.h, "round": s.round}
+	case *LoftSDF3:
+		return jsonNode{"type": "Loft3D", "sdf0": e.sdf2(s.sdf0), "sdf1": e.sdf2(s.sdf1), "height": s.h, "round": s.round}
+	case *BoxSDF3:
+		return jsonNode{"type": "Box3D", "size": jsonV3(s.bb.Max.MulScalar(2)), "round": s.round}
+	case *SphereSDF3:
+		return jsonNode{"type": "Sphere3D", "radius": s.radius}
+	case *CylinderSDF3:
+		return jsonNode{"type": "Cylinder3D", "height": 2 * s.bb.Max.Z, "radius": s.bb.Max.X, "round": s.round}
+	case *ConeSDF3:
+		return jsonNode{
+			"type":   "Cone3D",
+			"height": 2 * s.bb.Max.Z,
+			"r0":     s.radii.X,
+			"r1":     s.radii.Y,
+			"round":  s.round,
+		}
+	case *TransformSDF3:
+		return jsonNode{"type": "Transform3D", "sdf": e.sdf3(s.sdf), "matrix": s.matrix}
+	case *ScaleUniformSDF3:
+		return jsonNode{"type": "ScaleUniform3D", "sdf": e.sdf3(s.sdf), "k": s.k}
+	case *translateSDF3:
+		return jsonNode{"type": "Transform3D", "sdf": e.sdf3(s.sdf), "matrix": s.matrix}
+	case *UnionSDF3:
+		sdf := make([]jsonNode, len(s.sdf))
+		for i, x := range s.sdf {
+			sdf[i] = e.sdf3(x)
+		}
+		return e.addBlend(jsonNode{"type": "Union3D", "sdf": sdf}, "min", s.blend)
+	case *BlendUnionSDF3:
+		if s.radius != nil {
+			e.fail(ErrMsg("can't marshal a radius function"))
+			return nil
+		}
+		sdf := make([]jsonNode, len(s.sdf))
+		for i, x := range s.sdf {
+			sdf[i] = e.sdf3(x)
+		}
+		return jsonNode{"type": "SmoothUnion3D", "sdf": sdf, "radii": s.radii, "blend": e.blendName(s.blend)}
+	case *BlendDifferenceSDF3:
+		e.fail(ErrMsg("can't marshal a radius function"))
+		return nil
+	case *DifferenceSDF3:
+		return e.addBlend(jsonNode{"type": "Difference3D", "s0": e.sdf3(s.s0), "s1": e.sdf3(s.s1)}, "max", s.blend)
+	case *IntersectionSDF3:
+		return e.addBlend(jsonNode{"type": "Intersect3D", "s0": e.sdf3(s.s0), "s1": e.sdf3(s.s1)}, "max", s.blend)
+	case *intersectionSDF3:
+		n := e.sdf3(s.sdf[0])
+		for _, x := range s.sdf[1:] {
+			n = jsonNode{"type": "Intersect3D", "s0": n, "s1": e.sdf3(x)}
+		}
+		return n
+	case *ElongateSDF3:
+		return jsonNode{"type": "Elongate3D", "sdf": e.sdf3(s.sdf), "h": jsonV3(s.hp.MulScalar(2))}
+	case *CutSDF3:
+		return jsonNode{"type": "Cut3D", "sdf": e.sdf3(s.sdf), "a": jsonV3(s.a), "n": jsonV3(s.dir)}
+	case *ArraySDF3:
+		n := jsonNode{"type": "Array3D", "sdf": e.sdf3(s.sdf), "num": []int{s.num.X, s.num.Y, s.num.Z}, "step": jsonV3(s.step)}
+		return e.addBlend(n, "min", s.blend)
+	case *RotateUnionSDF3:
+		n := jsonNode{"type": "RotateUnion3D", "sdf": e.sdf3(s.sdf), "num": s.num, "step": s.matrix}
+		return e.addBlend(n, "min", s.blend)
+	case *RotateCopySDF3:
+		return jsonNode{"type": "RotateCopy3D", "sdf": e.sdf3(s.sdf), "num": int(math.Round(Tau / s.theta))}
+	case *RepeatSDF3:
+		if !s.lattice.finite {
+			return jsonNode{"type": "RepeatInfinite3D", "sdf": e.sdf3(s.sdf), "step": jsonV3(s.step)}
+		}
+		return jsonNode{"type": "Repeat3D", "sdf": e.sdf3(s.sdf), "num": []int{s.num.X, s.num.Y, s.num.Z}, "step": jsonV3(s.step)}
+	case *RepeatPolarSDF3:
+		return jsonNode{"type": "RepeatPolar3D", "sdf": e.sdf3(s.sdf), "num": s.lattice.num}
+	case *MirrorSDF3:
+		var planes []string
+		for _, p := range s.planes() {
+			planes = append(planes, plane3Names[p])
+		}
+		return jsonNode{"type": "Symmetry3D", "sdf": e.sdf3(s.sdf), "planes": planes}
+	case *MirrorPlaneSDF3:
+		return jsonNode{"type": "Mirror3D", "sdf": e.sdf3(s.sdf), "point": jsonV3(s.point), "normal": jsonV3(s.normal)}
+	case *TwistSDF3:
+		return jsonNode{"type": "Twist3D", "sdf": e.sdf3(s.sdf), "a": jsonV3(s.frame.a), "axis": jsonV3(s.axis), "twist": s.twist}
+	case *TaperSDF3:
+		return jsonNode{"type": "Taper3D", "sdf": e.sdf3(s.sdf), "a": jsonV3(s.frame.a), "axis": jsonV3(s.axis), "taper": s.taper}
+	case *BendSDF3:
+		return jsonNode{"type": "Bend3D", "sdf": e.sdf3(s.sdf), "a": jsonV3(s.frame.a), "dir": jsonV3(s.dir), "up": jsonV3(s.up), "radius": s.radius}
+	case *FFDSDF3:
+		l := s.lattice
+		n := l.dx.n
+		points := make([][]float64, 0, len(l.dx.data))
+		for z := 0; z < n.Z; z++ {
+			for y := 0; y < n.Y; y++ {
+				for x := 0; x < n.X; x++ {
+					points = append(points, jsonV3(l.Point(x, y, z)))
+				}
+			}
+		}
+		return jsonNode{
+			"type":     "FFD3D",
+			"sdf":      e.sdf3(s.sdf),
+			"min":      jsonV3(l.dx.bb.Min),
+			"max":      jsonV3(l.dx.bb.Max),
+			"n":        []int{n.X, n.Y, n.Z},
+			"tricubic": l.tricubic,
+			"points":   points,
+		}
+	case *OffsetSDF3:
+		return jsonNode{"type": "Offset3D", "sdf": e.sdf3(s.sdf), "offset": s.offset}
+	case *DraftSDF3:
+		return jsonNode{
+			"type":    "Draft3D",
+			"sdf":     e.sdf3(s.sdf),
+			"pull":    jsonV3(s.pull),
+			"neutral": s.neutral,
+			"angle":   s.angle,
+		}
+	case *ShellSDF3:
+		return jsonNode{"type": "Shell3D", "sdf": e.sdf3(s.sdf), "thickness": 2 * s.delta}
+	case *ScrewSDF3:
+		return jsonNode{
+			"type":   "Screw3D",
+			"thread": e.sdf2(s.thread),
+			"length": 2 * s.length,
+			"taper":  s.taper,
+			"pitch":  s.pitch,
+			"starts": int(math.Round(-s.lead / s.pitch)),
+		}
+	case *GyroidSDF3:
+		return jsonNode{"type": "Gyroid3D", "scale": jsonV3(s.scale)}
+	case *MeshSDF3:
+		triangles := make([][3][]float64, len(s.mesh))
+		for i, t := range s.mesh {
+			triangles[i] = [3][]float64{jsonV3(t[0]), jsonV3(t[1]), jsonV3(t[2])}
+		}
+		return jsonNode{"type": "Mesh3D", "triangles": triangles}
+	case *FileSDF3:
+		return jsonNode{"type": "File3D", "loader": s.loader, "path": s.path, "args": s.args}
+	case *SweepSDF3:
+		if s.custom {
+			e.fail(ErrMsg("can't marshal a custom sweep extrusion function"))
+			return nil
+		}
+		path := make([][]float64, 0, len(s.seg)+1)
+		for _, sg := range s.seg {
+			path = append(path, jsonV3(sg.p0))
+		}
+		path = append(path, jsonV3(s.seg[len(s.seg)-1].p1))
+		return jsonNode{"type": "Sweep3D", "profile": e.sdf2(s.profile), "path": path, "twist": s.twist}
+	case *BezierPatchSDF3:
+		return jsonNode{"type": "BezierPatch3D", "cp": jsonPatch(s.patch), "thickness": 2 * s.thickness}
+	case *BezierSolidSDF3:
+		cp := make([][][][]float64, len(s.patch))
+		for i, p := range s.patch {
+			cp[i] = jsonPatch(p)
+		}
+		return jsonNode{"type": "BezierSolid3D", "cp": cp}
+	case *DisplaceSDF3:
+		return jsonNode{"type": "Displace3D", "sdf": e.sdf3(s.sdf), "texture": e.texture3(s.texture), "depth": s.depth}
+	case *CacheSDF3:
+		return jsonNode{"type": "Cache3D", "sdf": e.sdf3(s.sdf), "limit": s.cache.limit}
+	case *RedistanceSDF3:
+		switch {
+		case s.r > 0:
+			return jsonNode{"type": "RoundEdges3D", "sdf": e.sdf3(s.sdf), "r": s.r}
+		case s.r < 0:
+			return jsonNode{"type": "FillCorners3D", "sdf": e.sdf3(s.sdf), "r": -s.r}
+		}
+		if s.band == redistanceBand*s.cellSize {
+			return jsonNode{"type": "Redistance3D", "sdf": e.sdf3(s.sdf), "cellSize": s.cellSize}
+		}
+		return jsonNode{"type": "Redistance3DBand", "sdf": e.sdf3(s.sdf), "cellSize": s.cellSize, "band": s.band}
+	case *SparseVoxelSDF3:
+		return jsonNode{"type": "NewSparseVoxelSDF3", "sdf": e.sdf3(s.sdf), "cellSize": s.h}
+	}
+	e.fail(ErrMsg(fmt.Sprintf("can't marshal %T", s)))
+	return nil
+}
+
+// jsonPatch returns the control points of a bezier patch.
+func jsonPatch(p *bezierPatch) [][][]float64 {
+	cp := make([][][]float64, len(p.cp))
+	for i := range p.cp {
+		cp[i] = make([][]float64, len(p.cp[i]))
+		for j := range p.cp[i] {
+			cp[i][j] = jsonV3(p.cp[i][j])
+		}
+	}
+	return cp
+}
+
+// texture2 returns the node for a 2d texture.
+func (e *jsonEncoder) texture2(t Texture2) jsonNode {
+	switch t := t.(type) {
+	case *ImageTexture2:
+		if t.path == "" {
+			e.fail(ErrMsg("can't marshal an image texture that wasn't loaded from a file"))
+			return nil
+		}
+		return jsonNode{"type": "LoadImageTexture2", "path": t.path, "size": jsonV2(t.size)}
+	}
+	e.fail(ErrMsg(fmt.Sprintf("can't marshal %T", t)))
+	return nil
+}
+
+// texture3 returns the node for a 3d texture.
+func (e *jsonEncoder) texture3(t Texture3) jsonNode {
+	switch t := t.(type) {
+	case *PlanarTexture3:
+		return jsonNode{"type": "NewPlanarTexture3", "texture": e.texture2(t.t), "plane": plane3Names[t.plane]}
+	case *CylindricalTexture3:
+		return jsonNode{"type": "NewCylindricalTexture3", "texture": e.texture2(t.t), "radius": t.radius}
+	case *SphericalTexture3:
+		return jsonNode{"type": "NewSphericalTexture3", "texture": e.texture2(t.t), "radius": t.radius}
+	case *TriplanarTexture3:
+		return jsonNode{"type": "NewTriplanarTexture3", "texture": e.texture2(t.t), "center": jsonV3(t.center), "radius": t.radius}
+	}
+	e.fail(ErrMsg(fmt.Sprintf("can't marshal %T", t)))
+	return nil
+}
+
+// polygonVertices returns the vertices of line segments that form a single closed polygon.
+func polygonVertices(mesh []*Line2) []v2.Vec {
+	n := len(mesh)
+	if n < 3 || mesh[n-1][1] != mesh[0][0] {
+		return nil
+	}
+	vertex := make([]v2.Vec, n)
+	for i, l := range mesh {
+		if i > 0 && mesh[i-1][1] != l[0] {
+			return nil
+		}
+		vertex[i] = l[0]
+	}
+	return vertex
+}
+
+// sdf2 returns the node for an SDF2.
+func (e *jsonEncoder) sdf2(s SDF2) jsonNode {
+	switch s := s.(type) {
+	case *CircleSDF2:
+		return jsonNode{"type": "Circle2D", "radius": s.radius}
+	case *BoxSDF2:
+		return jsonNode{"type": "Box2D", "size": jsonV2(s.bb.Max.MulScalar(2)), "round": s.round}
+	case *LineSDF2:
+		return jsonNode{"type": "Line2D", "l": 2 * s.l, "round": s.round}
+	case *OffsetSDF2:
+		return jsonNode{"type": "Offset2D", "sdf": e.sdf2(s.sdf), "offset": s.offset}
+	case *IntersectionSDF2:
+		return e.addBlend(jsonNode{"type": "Intersect2D", "s0": e.sdf2(s.s0), "s1": e.sdf2(s.s1)}, "max", s.blend)
+	case *intersectionSDF2:
+		n := e.sdf2(s.sdf[0])
+		for _, x := range s.sdf[1:] {
+			n = jsonNode{"type": "Intersect2D", "s0": n, "s1": e.sdf2(x)}
+		}
+		return n
+	case *CutSDF2:
+		return jsonNode{"type": "Cut2D", "sdf": e.sdf2(s.sdf), "a": jsonV2(s.a), "v": jsonV2(s.v)}
+	case *TransformSDF2:
+		return jsonNode{"type": "Transform2D", "sdf": e.sdf2(s.sdf), "matrix": s.matrix}
+	case *ScaleUniformSDF2:
+		return jsonNode{"type": "ScaleUniform2D", "sdf": e.sdf2(s.sdf), "k": s.k}
+	case *translateSDF2:
+		return jsonNode{"type": "Transform2D", "sdf": e.sdf2(s.sdf), "matrix": s.matrix}
+	case *ArraySDF2:
+		n := jsonNode{"type": "Array2D", "sdf": e.sdf2(s.sdf), "num": []int{s.num.X, s.num.Y}, "step": jsonV2(s.step)}
+		return e.addBlend(n, "min", s.blend)
+	case *RotateUnionSDF2:
+		n := jsonNode{"type": "RotateUnion2D", "sdf": e.sdf2(s.sdf), "num": s.num, "step": s.matrix}
+		return e.addBlend(n, "min", s.blend)
+	case *RotateCopySDF2:
+		return jsonNode{"type": "RotateCopy2D", "sdf": e.sdf2(s.sdf), "num": int(math.Round(Tau / s.theta))}
+	case *RepeatSDF2:
+		if !s.lattice.finite {
+			return jsonNode{"type": "RepeatInfinite2D", "sdf": e.sdf2(s.sdf), "step": jsonV2(s.step)}
+		}
+		return jsonNode{"type": "Repeat2D", "sdf": e.sdf2(s.sdf), "num": []int{s.num.X, s.num.Y}, "step": jsonV2(s.step)}
+	case *RepeatPolarSDF2:
+		return jsonNode{"type": "RepeatPolar2D", "sdf": e.sdf2(s.sdf), "num": s.lattice.num}
+	case *MirrorSDF2:
+		var axes []string
+		for _, a := range s.axes() {
+			axes = append(axes, axis2Names[a])
+		}
+		return jsonNode{"type": "Symmetry2D", "sdf": e.sdf2(s.sdf), "axes": axes}
+	case *MirrorLineSDF2:
+		return jsonNode{"type": "Mirror2D", "sdf": e.sdf2(s.sdf), "point": jsonV2(s.point), "normal": jsonV2(s.normal)}
+	case *SliceSDF2:
+		return jsonNode{"type": "Slice2D", "sdf": e.sdf3(s.sdf), "a": jsonV3(s.a), "n": jsonV3(s.n)}
+	case *UnionSDF2:
+		sdf := make([]jsonNode, len(s.sdf))
+		for i, x := range s.sdf {
+			sdf[i] = e.sdf2(x)
+		}
+		return e.addBlend(jsonNode{"type": "Union2D", "sdf": sdf}, "min", s.blend)
+	case *DifferenceSDF2:
+		return e.addBlend(jsonNode{"type": "Difference2D", "s0": e.sdf2(s.s0), "s1": e.sdf2(s.s1)}, "max", s.blend)
+	case *ElongateSDF2:
+		return jsonNode{"type": "Elongate2D", "sdf": e.sdf2(s.sdf), "h": jsonV2(s.hp.MulScalar(2))}
+	case *MeshSDF2:
+		if vertex := polygonVertices(s.mesh); vertex != nil {
+			v := make([][]float64, len(vertex))
+			for i := range vertex {
+				v[i] = jsonV2(vertex[i])
+			}
+			return jsonNode{"type": "Polygon2D", "vertices": v}
+		}
+		lines := make([][2][]float64, len(s.mesh))
+		for i, l := range s.mesh {
+			lines[i] = [2][]float64{jsonV2(l[0]), jsonV2(l[1])}
+		}
+		return jsonNode{"type": "Mesh2D", "lines": lines}
+	case *CubicSplineSDF2:
+		knots := make([][]float64, 0, len(s.spline)+1)
+		for i := range s.spline {
+			knots = append(knots, jsonV2(s.spline[i].p0))
+		}
+		knots = append(knots, jsonV2(s.spline[len(s.spline)-1].p1))
+		return jsonNode{"type": "CubicSpline2D", "knots": knots}
+	case *CacheSDF2:
+		return jsonNode{"type": "Cache2D", "sdf": e.sdf2(s.sdf), "limit": s.cache.limit}
+	case *RedistanceSDF2:
+		switch {
+		case s.r > 0:
+			return jsonNode{"type": "RoundEdges2D", "sdf": e.sdf2(s.sdf), "r": s.r}
+		case s.r < 0:
+			return jsonNode{"type": "FillCorners2D", "sdf": e.sdf2(s.sdf), "r": -s.r}
+		}
+		if s.band == redistanceBand*s.cellSize {
+			return jsonNode{"type": "Redistance2D", "sdf": e.sdf2(s.sdf), "cellSize": s.cellSize}
+		}
+		return jsonNode{"type": "Redistance2DBand", "sdf": e.sdf2(s.sdf), "cellSize": s.cellSize, "band": s.band}
+	}
+	e.fail(ErrMsg(fmt.Sprintf("can't marshal %T", s)))
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+// Decoding
+
+type jsonDecoder struct {
+	typ  string
+	node map[string]json.RawMessage
+	err  error
+}
+
+// newJSONDecoder returns a decoder for a node.
+func newJSONDecoder(data json.RawMessage) (*jsonDecoder, error) {
+	d := jsonDecoder{}
+	if err := json.Unmarshal(data, &d.node); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(d.node["type"], &d.typ); err != nil {
+		return nil, ErrMsg("node has no type")
+	}
+	return &d, nil
+}
+
+// ok returns true if there have been no decoding errors.
+func (d *jsonDecoder) ok() bool {
+	return d.err == nil
+}
+
+// fail records the first decoding error.
+func (d *jsonDecoder) fail(err error) {
+	if d.err == nil {
+		d.err = err
+	}
+}
+
+// has returns true if the node has a named value.
+func (d *jsonDecoder) has(name string) bool {
+	_, ok := d.node[name]
+	return ok
+}
+
+// get decodes a named value.
+func (d *jsonDecoder) get(name string, v interface{}) {
+	if d.err != nil {
+		return
+	}
+	data, ok := d.node[name]
+	if !ok {
+		d.fail(ErrMsg(fmt.Sprintf("%s: no \"%s\"", d.typ, name)))
+		return
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		d.fail(ErrMsg(fmt.Sprintf("%s: bad \"%s\": %s", d.typ, name, err)))
+	}
+}
+
+func (d *jsonDecoder) float(name string) float64 {
+	var x float64
+	d.get(name, &x)
+	return x
+}
+
+func (d *jsonDecoder) int(name string) int {
+	var x int
+	d.get(name, &x)
+	return x
+}
+
+func (d *jsonDecoder) string(name string) string {
+	var x string
+	d.get(name, &x)
+	return x
+}
+
+func (d *jsonDecoder) v2(name string) v2.Vec {
+	var x [2]float64
+	d.get(name, &x)
+	return arrayToV2(x)
+}
+
+func (d *jsonDecoder) v3(name string) v3.Vec {
+	var x [3]float64
+	d.get(name, &x)
+	return arrayToV3(x)
+}
+
+func (d *jsonDecoder) sdf2(name string) SDF2 {
+	var x json.RawMessage
+	d.get(name, &x)
+	if d.err != nil {
+		return nil
+	}
+	s, err := decodeSDF2(x)
+	d.fail(err)
+	return s
+}
+
+func (d *jsonDecoder) sdf3(name string) SDF3 {
+	var x json.RawMessage
+	d.get(name, &x)
+	if d.err != nil {
+		return nil
+	}
+	s, err := decodeSDF3(x)
+	d.fail(err)
+	return s
+}
+
+// blend decodes the optional blend of a min/max function.
+func (d *jsonDecoder) blend(name string) blendParms {
+	if !d.has(name) {
+		return blendParms{}
+	}
+	var b struct {
+		Type string  `json:"type"`
+		K    float64 `json:"k"`
+	}
+	d.get(name, &b)
+	return blendParms{blend: d.blendByName(b.Type), k: b.K}
+}
+
+// blendByName returns the blend with a name.
+func (d *jsonDecoder) blendByName(name string) *Blend {
+	for _, x := range blends {
+		if x.Name == name {
+			return x
+		}
+	}
+	d.fail(ErrMsg(fmt.Sprintf("%s: unknown blend \"%s\"", d.typ, name)))
+	return nil
+}
+
+// planes decodes a list of mirror plane names.
+func (d *jsonDecoder) planes(name string) []Plane3 {
+	var names []string
+	d.get(name, &names)
+	var planes []Plane3
+	for _, x := range names {
+		i := nameIndex(plane3Names, x)
+		if i < 0 {
+			d.fail(ErrMsg(fmt.Sprintf("%s: unknown plane \"%s\"", d.typ, x)))
+			return nil
+		}
+		planes = append(planes, Plane3(i))
+	}
+	return planes
+}
+
+// axes decodes a list of mirror axis names.
+func (d *jsonDecoder) axes(name string) []Axis2 {
+	var names []string
+	d.get(name, &names)
+	var axes []Axis2
+	for _, x := range names {
+		i := nameIndex(axis2Names, x)
+		if i < 0 {
+			d.fail(ErrMsg(fmt.Sprintf("%s: unknown axis \"%s\"", d.typ, x)))
+			return nil
+		}
+		axes = append(axes, Axis2(i))
+	}
+	return axes
+}
+
+func (d *jsonDecoder) texture2(name string) Texture2 {
+	var x json.RawMessage
+	d.get(name, &x)
+	if d.err != nil {
+		return nil
+	}
+	t, err := decodeTexture2(x)
+	d.fail(err)
+	return t
+}
+
+func (d *jsonDecoder) texture3(name string) Texture3 {
+	var x json.RawMessage
+	d.get(name, &x)
+	if d.err != nil {
+		return nil
+	}
+	t, err := decodeTexture3(x)
+	d.fail(err)
+	return t
+}
+
+// decodeTexture2 builds a 2d texture from a node.
+func decodeTexture2(data json.RawMessage) (Texture2, error) {
+	d, err := newJSONDecoder(data)
+	if err != nil {
+		return nil, err
+	}
+	var t Texture2
+	switch d.typ {
+	case "LoadImageTexture2":
+		path, size := d.string("path"), d.v2("size")
+		if d.ok() {
+			t, err = LoadImageTexture2(path, size)
+		}
+	default:
+		d.fail(ErrMsg(fmt.Sprintf("unknown texture2 type \"%s\"", d.typ)))
+	}
+	d.fail(err)
+	if d.err != nil {
+		return nil, d.err
+	}
+	return t, nil
+}
+
+// decodeTexture3 builds a 3d texture from a node.
+func decodeTexture3(data json.RawMessage) (Texture3, error) {
+	d, err := newJSONDecoder(data)
+	if err != nil {
+		return nil, err
+	}
+	var t Texture3
+	switch d.typ {
+	case "NewPlanarTexture3":
+		var plane string
+		texture := d.texture2("texture")
+		d.get("plane", &plane)
+		i := nameIndex(plane3Names, plane)
+		if d.ok() && i < 0 {
+			d.fail(ErrMsg(fmt.Sprintf("%s: unknown plane \"%s\"", d.typ, plane)))
+		}
+		if d.ok() {
+			t, err = NewPlanarTexture3(texture, Plane3(i))
+		}
+	case "NewCylindricalTexture3":
+		texture, radius := d.texture2("texture"), d.float("radius")
+		if d.ok() {
+			t, err = NewCylindricalTexture3(texture, radius)
+		}
+	case "NewSphericalTexture3":
+		texture, radius := d.texture2("texture"), d.float("radius")
+		if d.ok() {
+			t, err = NewSphericalTexture3(texture, radius)
+		}
+	case "NewTriplanarTexture3":
+		texture, center, radius := d.texture2("texture"), d.v3("center"), d.float("radius")
+		if d.ok() {
+			t, err = NewTriplanarTexture3(texture, center, radius)
+		}
+	default:
+		d.fail(ErrMsg(fmt.Sprintf("unknown texture3 type \"%s\"", d.typ)))
+	}
+	d.fail(err)
+	if d.err != nil {
+		return nil, d.err
+	}
+	return t, nil
+}
+
+// decodeSDF3 builds an SDF3 from a node.
+func decodeSDF3(data json.RawMessage) (SDF3, error) {
+	d, err := newJSONDecoder(data)
+	if err != nil {
+		return nil, err
+	}
+	var s SDF3
+	switch d.typ {
+	case "RevolveTheta3D":
+		sdf, theta := d.sdf2("sdf"), d.float("theta")
+		if d.ok() {
+			s, err = RevolveTheta3D(sdf, theta)
+		}
+	case "Extrude3D":
+		sdf, height := d.sdf2("sdf"), d.float("height")
+		if d.ok() {
+			s = Extrude3D(sdf, height)
+		}
+	case "TwistExtrude3D":
+		sdf, height, twist := d.sdf2("sdf"), d.float("height"), d.float("twist")
+		if d.ok() {
+			s = TwistExtrude3D(sdf, height, twist)
+		}
+	case "ScaleExtrude3D":
+		sdf, height, scale := d.sdf2("sdf"), d.float("height"), d.v2("scale")
+		if d.ok() {
+			s = ScaleExtrude3D(sdf, height, scale)
+		}
+	case "ScaleTwistExtrude3D":
+		sdf, height, twist, scale := d.sdf2("sdf"), d.float("height"), d.float("twist"), d.v2("scale")
+		if d.ok() {
+			s = ScaleTwistExtrude3D(sdf, height, twist, scale)
+		}
+	case "ExtrudeRounded3D":
+		sdf, height, round := d.sdf2("sdf"), d.float("height"), d.float("round")
+		if d.ok() {
+			s, err = ExtrudeRounded3D(sdf, height, round)
+		}
+	case "Loft3D":
+		sdf0, sdf1, height, round := d.sdf2("sdf0"), d.sdf2("sdf1"), d.float("height"), d.float("round")
+		if d.ok() {
+			s, err = Loft3D(sdf0, sdf1, height, round)
+		}
+	case "Box3D":
+		s, err = Box3D(d.v3("size"), d.float("round"))
+	case "Sphere3D":
+		s, err = Sphere3D(d.float("radius"))
+	case "Cylinder3D":
+		s, err = Cylinder3D(d.float("height"), d.float("radius"), d.float("round"))
+	case "Cone3D":
+		s, err = Cone3D(d.float("height"), d.float("r0"), d.float("r1"), d.float("round"))
+	case "Transform3D":
+		var m M44
+		sdf := d.sdf3("sdf")
+		d.get("matrix", &m)
+		if d.ok() {
+			s = Transform3D(sdf, m)
+		}
+	case "ScaleUniform3D":
+		sdf, k := d.sdf3("sdf"), d.float("k")
+		if d.ok() {
+			s = ScaleUniform3D(sdf, k)
+		}
+	case "Union3D":
+		var nodes []json.RawMessage
+		d.get("sdf", &nodes)
+		sdf := make([]SDF3, len(nodes))
+		for i := range nodes {
+			if d.ok() {
+				sdf[i], err = decodeSDF3(nodes[i])
+				d.fail(err)
+			}
+		}
+		min := d.blend("min")
+		if d.ok() {
+			s = Union3D(sdf...)
+			if u, ok := s.(*UnionSDF3); ok {
+				u.SetBlend(min.blend, min.k)
+			}
+		}
+	case "SmoothUnion3D":
+		var nodes []json.RawMessage
+		var radii []float64
+		d.get("sdf", &nodes)
+		d.get("radii", &radii)
+		sdf := make([]SDF3, len(nodes))
+		for i := range nodes {
+			if d.ok() {
+				sdf[i], err = decodeSDF3(nodes[i])
+				d.fail(err)
+			}
+		}
+		blend := d.blendByName(d.string("blend"))
+		if d.ok() {
+			s, err = SmoothUnion3D(sdf, radii, blend)
+		}
+	case "Difference3D":
+		s0, s1, max := d.sdf3("s0"), d.sdf3("s1"), d.blend("max")
+		if d.ok() {
+			s = Difference3D(s0, s1)
+			s.(*DifferenceSDF3).SetBlend(max.blend, max.k)
+		}
+	case "Intersect3D":
+		s0, s1, max := d.sdf3("s0"), d.sdf3("s1"), d.blend("max")
+		if d.ok() {
+			s = Intersect3D(s0, s1)
+			s.(*IntersectionSDF3).SetBlend(max.blend, max.k)
+		}
+	case "Elongate3D":
+		sdf, h := d.sdf3("sdf"), d.v3("h")
+		if d.ok() {
+			s = Elongate3D(sdf, h)
+		}
+	case "Cut3D":
+		sdf, a, n := d.sdf3("sdf"), d.v3("a"), d.v3("n")
+		if d.ok() {
+			s = Cut3D(sdf, a, n)
+		}
+	case "Array3D":
+		var num [3]int
+		sdf, step, min := d.sdf3("sdf"), d.v3("step"), d.blend("min")
+		d.get("num", &num)
+		if d.ok() {
+			s = Array3D(sdf, v3i.Vec{num[0], num[1], num[2]}, step)
+			if a, ok := s.(*ArraySDF3); ok {
+				a.SetBlend(min.blend, min.k)
+			}
+		}
+	case "RotateUnion3D":
+		var step M44
+		sdf, num, min := d.sdf3("sdf"), d.int("num"), d.blend("min")
+		d.get("step", &step)
+		if d.ok() {
+			s = RotateUnion3D(sdf, num, step)
+			if r, ok := s.(*RotateUnionSDF3); ok {
+				r.SetBlend(min.blend, min.k)
+			}
+		}
+	case "RotateCopy3D":
+		sdf, num := d.sdf3("sdf"), d.int("num")
+		if d.ok() {
+			s = RotateCopy3D(sdf, num)
+		}
+	case "Repeat3D":
+		var num [3]int
+		sdf, step := d.sdf3("sdf"), d.v3("step")
+		d.get("num", &num)
+		if d.ok() {
+			s, err = Repeat3D(sdf, v3i.Vec{num[0], num[1], num[2]}, step)
+		}
+	case "RepeatInfinite3D":
+		sdf, step := d.sdf3("sdf"), d.v3("step")
+		if d.ok() {
+			s, err = RepeatInfinite3D(sdf, step)
+		}
+	case "RepeatPolar3D":
+		sdf, num := d.sdf3("sdf"), d.int("num")
+		if d.ok() {
+			s, err = RepeatPolar3D(sdf, num)
+		}
+	case "Symmetry3D":
+		sdf, planes := d.sdf3("sdf"), d.planes("planes")
+		if d.ok() {
+			s, err = Symmetry3D(sdf, planes...)
+		}
+	case "Mirror3D":
+		sdf, point, normal := d.sdf3("sdf"), d.v3("point"), d.v3("normal")
+		if d.ok() {
+			s, err = Mirror3D(sdf, point, normal)
+		}
+	case "Twist3D":
+		sdf, a, axis, twist := d.sdf3("sdf"), d.v3("a"), d.v3("axis"), d.float("twist")
+		if d.ok() {
+			s, err = Twist3D(sdf, a, axis, twist)
+		}
+	case "Taper3D":
+		sdf, a, axis, taper := d.sdf3("sdf"), d.v3("a"), d.v3("axis"), d.float("taper")
+		if d.ok() {
+			s, err = Taper3D(sdf, a, axis, taper)
+		}
+	case "Bend3D":
+		sdf, a, dir, up, radius := d.sdf3("sdf"), d.v3("a"), d.v3("dir"), d.v3("up"), d.float("radius")
+		if d.ok() {
+			s, err = Bend3D(sdf, a, dir, up, radius)
+		}
+	case "FFD3D":
+		var n [3]int
+		var points [][3]float64
+		var tricubic bool
+		sdf, bmin, bmax := d.sdf3("sdf"), d.v3("min"), d.v3("max")
+		d.get("n", &n)
+		d.get("points", &points)
+		d.get("tricubic", &tricubic)
+		if d.ok() {
+			var l *FFDLattice
+			l, err = NewFFDLattice(Box3{bmin, bmax}, v3i.Vec{n[0], n[1], n[2]})
+			if err == nil && len(points) != n[0]*n[1]*n[2] {
+				err = ErrMsg("FFD3D: wrong number of points")
+			}
+			if err == nil {
+				l.SetTricubic(tricubic)
+				for i, x := range points {
+					l.SetPoint(i%n[0], (i/n[0])%n[1], i/(n[0]*n[1]), arrayToV3(x))
+				}
+				s, err = FFD3D(sdf, l)
+			}
+		}
+	case "Offset3D":
+		sdf, offset := d.sdf3("sdf"), d.float("offset")
+		if d.ok() {
+			s = Offset3D(sdf, offset)
+		}
+	case "Draft3D":
+		sdf, pull, neutral, angle := d.sdf3("sdf"), d.v3("pull"), d.float("neutral"), d.float("angle")
+		if d.ok() {
+			s, err = Draft3D(sdf, pull, neutral, angle)
+		}
+	case "Shell3D":
+		sdf, thickness := d.sdf3("sdf"), d.float("thickness")
+		if d.ok() {
+			s, err = Shell3D(sdf, thickness)
+		}
+	case "Screw3D":
+		thread, length, taper, pitch, starts := d.sdf2("thread"), d.float("length"), d.float("taper"), d.float("pitch"), d.int("starts")
+		if d.ok() {
+			s, err = Screw3D(thread, length, taper, pitch, starts)
+		}
+	case "Gyroid3D":
+		s, err = Gyroid3D(d.v3("scale"))
+	case "Mesh3D":
+		var triangles [][3][3]float64
+		d.get("triangles", &triangles)
+		mesh := make([]*Triangle3, len(triangles))
+		for i, t := range triangles {
+			mesh[i] = &Triangle3{arrayToV3(t[0]), arrayToV3(t[1]), arrayToV3(t[2])}
+		}
+		if d.ok() {
+			s, err = Mesh3D(mesh)
+		}
+	case "File3D":
+		var args []float64
+		loader, path := d.string("loader"), d.string("path")
+		if d.has("args") {
+			d.get("args", &args)
+		}
+		if d.ok() {
+			s, err = File3D(loader, path, args...)
+		}
+	case "Sweep3D":
+		var vertices [][3]float64
+		profile, twist := d.sdf2("profile"), d.float("twist")
+		d.get("path", &vertices)
+		v := make([]v3.Vec, len(vertices))
+		for i := range vertices {
+			v[i] = arrayToV3(vertices[i])
+		}
+		if d.ok() {
+			var path Path3
+			path, err = PolylinePath3(v)
+			if err == nil {
+				s, err = Sweep3D(profile, path, twist)
+			}
+		}
+	case "BezierPatch3D":
+		var cp [][][3]float64
+		d.get("cp", &cp)
+		thickness := d.float("thickness")
+		if d.ok() {
+			s, err = BezierPatch3D(arrayToPatch(cp), thickness)
+		}
+	case "BezierSolid3D":
+		var cp [][][][3]float64
+		d.get("cp", &cp)
+		patches := make([][][]v3.Vec, len(cp))
+		for i := range cp {
+			patches[i] = arrayToPatch(cp[i])
+		}
+		if d.ok() {
+			s, err = BezierSolid3D(patches)
+		}
+	case "Displace3D":
+		sdf, texture, depth := d.sdf3("sdf"), d.texture3("texture"), d.float("depth")
+		if d.ok() {
+			s, err = Displace3D(sdf, texture, depth)
+		}
+	case "Cache3D":
+		sdf, limit := d.sdf3("sdf"), d.int("limit")
+		if d.ok() {
+			c := Cache3D(sdf)
+			c.(*CacheSDF3).SetLimit(limit)
+			s = c
+		}
+	case "Redistance3D":
+		sdf, cellSize := d.sdf3("sdf"), d.float("cellSize")
+		if d.ok() {
+			s, err = Redistance3D(sdf, cellSize)
+		}
+	case "Redistance3DBand":
+		sdf, cellSize, band := d.sdf3("sdf"), d.float("cellSize"), d.float("band")
+		if d.ok() {
+			s, err = Redistance3DBand(sdf, cellSize, band)
+		}
+	case "RoundEdges3D":
+		sdf, r := d.sdf3("sdf"), d.float("r")
+		if d.ok() {
+			s, err = RoundEdges3D(sdf, r)
+		}
+	case "FillCorners3D":
+		sdf, r := d.sdf3("sdf"), d.float("r")
+		if d.ok() {
+			s, err = FillCorners3D(sdf, r)
+		}
+	case "NewSparseVoxelSDF3":
+		sdf, cellSize := d.sdf3("sdf"), d.float("cellSize")
+		if d.ok() {
+			s, err = NewSparseVoxelSDF3(sdf, cellSize, nil)
+		}
+	default:
+		d.fail(ErrMsg(fmt.Sprintf("unknown sdf3 type \"%s\"", d.typ)))
+	}
+	d.fail(err)
+	if d.err != nil {
+		return nil, d.err
+	}
+	if s == nil {
+		return nil, ErrMsg(fmt.Sprintf("%s: bad arguments", d.typ))
+	}
+	return s, nil
+}
+
+// decodeSDF2 builds an SDF2 from a node.
+func decodeSDF2(data json.RawMessage) (SDF2, error) {
+	d, err := newJSONDecoder(data)
+	if err != nil {
+		return nil, err
+	}
+	var s SDF2
+	switch d.typ {
+	case "Circle2D":
+		s, err = Circle2D(d.float("radius"))
+	case "Box2D":
+		s = Box2D(d.v2("size"), d.float("round"))
+	case "Line2D":
+		s = Line2D(d.float("l"), d.float("round"))
+	case "Offset2D":
+		sdf, offset := d.sdf2("sdf"), d.float("offset")
+		if d.ok() {
+			s = Offset2D(sdf, offset)
+		}
+	case "Intersect2D":
+		s0, s1, max := d.sdf2("s0"), d.sdf2("s1"), d.blend("max")
+		if d.ok() {
+			s = Intersect2D(s0, s1)
+			s.(*IntersectionSDF2).SetBlend(max.blend, max.k)
+		}
+	case "Cut2D":
+		sdf, a, v := d.sdf2("sdf"), d.v2("a"), d.v2("v")
+		if d.ok() {
+			s = Cut2D(sdf, a, v)
+		}
+	case "Transform2D":
+		var m M33
+		sdf := d.sdf2("sdf")
+		d.get("matrix", &m)
+		if d.ok() {
+			s = Transform2D(sdf, m)
+		}
+	case "ScaleUniform2D":
+		sdf, k := d.sdf2("sdf"), d.float("k")
+		if d.ok() {
+			s = ScaleUniform2D(sdf, k)
+		}
+	case "Array2D":
+		var num [2]int
+		sdf, step, min := d.sdf2("sdf"), d.v2("step"), d.blend("min")
+		d.get("num", &num)
+		if d.ok() {
+			s = Array2D(sdf, v2i.Vec{num[0], num[1]}, step)
+			if a, ok := s.(*ArraySDF2); ok {
+				a.SetBlend(min.blend, min.k)
+			}
+		}
+	case "RotateUnion2D":
+		var step M33
+		sdf, num, min := d.sdf2("sdf"), d.int("num"), d.blend("min")
+		d.get("step", &step)
+		if d.ok() {
+			s = RotateUnion2D(sdf, num, step)
+			if r, ok := s.(*RotateUnionSDF2); ok {
+				r.SetBlend(min.blend, min.k)
+			}
+		}
+	case "RotateCopy2D":
+		sdf, num := d.sdf2("sdf"), d.int("num")
+		if d.ok() {
+			s = RotateCopy2D(sdf, num)
+		}
+	case "Repeat2D":
+		var num [2]int
+		sdf, step := d.sdf2("sdf"), d.v2("step")
+		d.get("num", &num)
+		if d.ok() {
+			s, err = Repeat2D(sdf, v2i.Vec{num[0], num[1]}, step)
+		}
+	case "RepeatInfinite2D":
+		sdf, step := d.sdf2("sdf"), d.v2("step")
+		if d.ok() {
+			s, err = RepeatInfinite2D(sdf, step)
+		}
+	case "RepeatPolar2D":
+		sdf, num := d.sdf2("sdf"), d.int("num")
+		if d.ok() {
+			s, err = RepeatPolar2D(sdf, num)
+		}
+	case "Symmetry2D":
+		sdf, axes := d.sdf2("sdf"), d.axes("axes")
+		if d.ok() {
+			s, err = Symmetry2D(sdf, axes...)
+		}
+	case "Mirror2D":
+		sdf, point, normal := d.sdf2("sdf"), d.v2("point"), d.v2("normal")
+		if d.ok() {
+			s, err = Mirror2D(sdf, point, normal)
+		}
+	case "Slice2D":
+		sdf, a, n := d.sdf3("sdf"), d.v3("a"), d.v3("n")
+		if d.ok() {
+			s = Slice2D(sdf, a, n)
+		}
+	case "Union2D":
+		var nodes []json.RawMessage
+		d.get("sdf", &nodes)
+		sdf := make([]SDF2, len(nodes))
+		for i := range nodes {
+			if d.ok() {
+				sdf[i], err = decodeSDF2(nodes[i])
+				d.fail(err)
+			}
+		}
+		min := d.blend("min")
+		if d.ok() {
+			s = Union2D(sdf...)
+			if u, ok := s.(*UnionSDF2); ok {
+				u.SetBlend(min.blend, min.k)
+			}
+		}
+	case "Difference2D":
+		s0, s1, max := d.sdf2("s0"), d.sdf2("s1"), d.blend("max")
+		if d.ok() {
+			s = Difference2D(s0, s1)
+			s.(*DifferenceSDF2).SetBlend(max.blend, max.k)
+		}
+	case "Elongate2D":
+		sdf, h := d.sdf2("sdf"), d.v2("h")
+		if d.ok() {
+			s = Elongate2D(sdf, h)
+		}
+	case "Polygon2D":
+		var vertices [][2]float64
+		d.get("vertices", &vertices)
+		v := make([]v2.Vec, len(vertices))
+		for i := range vertices {
+			v[i] = arrayToV2(vertices[i])
+		}
+		if d.ok() {
+			s, err = Polygon2D(v)
+		}
+	case "Mesh2D":
+		var lines [][2][2]float64
+		d.get("lines", &lines)
+		mesh := make([]*Line2, len(lines))
+		for i, l := range lines {
+			mesh[i] = &Line2{arrayToV2(l[0]), arrayToV2(l[1])}
+		}
+		if d.ok() {
+			s, err = Mesh2D(mesh)
+		}
+	case "CubicSpline2D":
+		var knots [][2]float64
+		d.get("knots", &knots)
+		v := make([]v2.Vec, len(knots))
+		for i := range knots {
+			v[i] = arrayToV2(knots[i])
+		}
+		if d.ok() {
+			s, err = CubicSpline2D(v)
+		}
+	case "Cache2D":
+		sdf, limit := d.sdf2("sdf"), d.int("limit")
+		if d.ok() {
+			c := Cache2D(sdf)
+			c.(*CacheSDF2).SetLimit(limit)
+			s = c
+		}
+	case "Redistance2D":
+		sdf, cellSize := d.sdf2("sdf"), d.float("cellSize")
+		if d.ok() {
+			s, err = Redistance2D(sdf, cellSize)
+		}
+	case "Redistance2DBand":
+		sdf, cellSize, band := d.sdf2("sdf"), d.float("cellSize"), d.float("band")
+		if d.ok() {
+			s, err = Redistance2DBand(sdf, cellSize, band)
+		}
+	case "RoundEdges2D":
+		sdf, r := d.sdf2("sdf"), d.float("r")
+		if d.ok() {
+			s, err = RoundEdges2D(sdf, r)
+		}
+	case "FillCorners2D":
+		sdf, r := d.sdf2("sdf"), d.float("r")
+		if d.ok() {
+			s, err = FillCorners2D(sdf, r)
+		}
+	default:
+		d.fail(ErrMsg(fmt.Sprintf("unknown sdf2 type \"%s\"", d.typ)))
+	}
+	d.fail(err)
+	if d.err != nil {
+		return nil, d.err
+	}
+	if s == nil {
+		return nil, ErrMsg(fmt.Sprintf("%s: bad arguments", d.typ))
+	}
+	return s, nil
+}
+
+//-----------------------------------------------------------------------------
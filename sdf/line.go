@@ -34,6 +34,11 @@ func (a Interval) Equals(b Interval, tolerance float64) bool {
 	return math.Abs(a[0]-b[0]) <= tolerance && math.Abs(a[1]-b[1]) <= tolerance
 }
 
+// Contains returns true if x is within the interval.
+func (a Interval) Contains(x float64) bool {
+	return a[0] <= x && x <= a[1]
+}
+
 // Overlap returns true if two intervals overlap.
 func (a Interval) Overlap(b Interval) bool {
 	return b[0] <= a[1] && a[0] <= b[1]
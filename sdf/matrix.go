@@ -329,6 +329,24 @@ func (a M22) MulPosition(b v2.Vec) v2.Vec {
 	return v2.Vec{a[0]*b.X + a[1]*b.Y, a[2]*b.X + a[3]*b.Y}
 }
 
+// mulTranspose multiplies a v3.Vec direction with the transpose of the rotate/scale part of a matrix.
+// This maps the gradient of a transformed SDF3 back to the untransformed space.
+func (a M44) mulTranspose(b v3.Vec) v3.Vec {
+	return v3.Vec{a[0]*b.X + a[4]*b.Y + a[8]*b.Z,
+		a[1]*b.X + a[5]*b.Y + a[9]*b.Z,
+		a[2]*b.X + a[6]*b.Y + a[10]*b.Z}
+}
+
+// mulTranspose multiplies a v2.Vec direction with the transpose of the rotate/scale part of a matrix.
+func (a M33) mulTranspose(b v2.Vec) v2.Vec {
+	return v2.Vec{a[0]*b.X + a[3]*b.Y, a[1]*b.X + a[4]*b.Y}
+}
+
+// mulTranspose multiplies a v2.Vec direction with the transpose of a matrix.
+func (a M22) mulTranspose(b v2.Vec) v2.Vec {
+	return v2.Vec{a[0]*b.X + a[2]*b.Y, a[1]*b.X + a[3]*b.Y}
+}
+
 //-----------------------------------------------------------------------------
 
 // mulVertices2 multiples a set of v2.Vec vertices by a rotate/translate matrix.
@@ -10,6 +10,7 @@ package sdf
 
 import (
 	"math"
+	"math/big"
 
 	v2 "github.com/deadsy/sdfx/vec/v2"
 )
@@ -45,6 +46,10 @@ func convertLines(lSet []*Line2) []*lineInfo {
 func (a *lineInfo) minDistance2(p v2.Vec) float64 {
 	var d2 float64
 	pa := p.Sub(a.line[0])
+	if a.length == 0 {
+		// the line is a point
+		return pa.Length2()
+	}
 	// t-parameter of projection onto line
 	t := pa.Dot(a.unitVector)
 	if t < 0 {
@@ -65,13 +70,12 @@ func (a *lineInfo) minDistance2(p v2.Vec) float64 {
 func (a *lineInfo) winding(p v2.Vec) int {
 	ay := a.line[0].Y
 	by := a.line[1].Y
-	dn := p.Sub(a.line[0]).Dot(v2.Vec{a.unitVector.Y, -a.unitVector.X})
 	if ay <= p.Y {
-		if by > p.Y && dn < 0 { // upward crossing
+		if by > p.Y && orient2d(a.line[0], a.line[1], p) > 0 { // upward crossing
 			return 1
 		}
 	} else {
-		if by <= p.Y && dn > 0 { // downward crossing
+		if by <= p.Y && orient2d(a.line[0], a.line[1], p) < 0 { // downward crossing
 			return -1
 		}
 	}
@@ -79,226 +83,138 @@ func (a *lineInfo) winding(p v2.Vec) int {
 }
 
 //-----------------------------------------------------------------------------
+// Robust orientation test.
+// See: "Adaptive Precision Floating-Point Arithmetic and Fast Robust Geometric Predicates", Shewchuk, 1997
+
+// orient2dErrorBound bounds the rounding error of the floating point determinant.
+const orient2dErrorBound = (3.0 + 16.0*0x1p-53) * 0x1p-53
+
+// orient2d returns a positive value if c is to the left of the line a->b, a negative
+// value if c is to the right, and zero if the points are collinear. The sign is exact.
+func orient2d(a, b, c v2.Vec) float64 {
+	detLeft := (a.X - c.X) * (b.Y - c.Y)
+	detRight := (a.Y - c.Y) * (b.X - c.X)
+	det := detLeft - detRight
+	if math.Abs(det) > orient2dErrorBound*(math.Abs(detLeft)+math.Abs(detRight)) {
+		return det
+	}
+	// the points are nearly collinear, use exact arithmetic
+	r := func(x float64) *big.Rat {
+		return new(big.Rat).SetFloat64(x)
+	}
+	sub := func(x, y float64) *big.Rat {
+		return new(big.Rat).Sub(r(x), r(y))
+	}
+	l := new(big.Rat).Mul(sub(a.X, c.X), sub(b.Y, c.Y))
+	rt := new(big.Rat).Mul(sub(a.Y, c.Y), sub(b.X, c.X))
+	return float64(l.Cmp(rt))
+}
 
-const qtMaxLevel = 3
+//-----------------------------------------------------------------------------
+// Mesh2D. 2D mesh evaluation with BVH speedup.
 
-type qtNode struct {
-	level    int         // quadtree level
-	box      Box2        // bounding box for the node
-	center   v2.Vec      // pre-calculated from box
-	halfSide float64     // pre-calculated from box
-	child    [4]*qtNode  // child nodes (sw, se, nw, ne)
-	leaf     []*lineInfo // leaf information (non-nil for a leaf node)
+// MeshSDF2 is SDF2 made from a set of line segments.
+type MeshSDF2 struct {
+	mesh []*Line2    // line segments
+	line []*lineInfo // pre-calculated line segment information
+	bvh  *bvh2       // bvh over the line segments
+	bb   Box2        // bounding box
 }
 
-func qtBuild(level int, box Box2, lSet []*Line2) *qtNode {
-
-	if len(lSet) == 0 {
-		// empty node
-		return nil
+// Mesh2D returns an SDF2 made from a set of line segments.
+func Mesh2D(mesh []*Line2) (SDF2, error) {
+	n := len(mesh)
+	if n == 0 {
+		return nil, ErrMsg("no 2d line segments")
 	}
 
-	halfSide := 0.5 * (box.Max.X - box.Min.X)
-	center := box.Center()
-
-	if len(lSet) == 1 || level == qtMaxLevel {
-		// leaf node
-		return &qtNode{
-			level:    level,
-			box:      box,
-			halfSide: halfSide,
-			center:   center,
-			leaf:     convertLines(lSet),
-		}
+	// work out the bounding boxes
+	boxes := make([]Box2, n)
+	for i, edge := range mesh {
+		boxes[i] = edge.BoundingBox()
 	}
-
-	// non-leaf node
-	box0 := box.quad0()
-	box1 := box.quad1()
-	box2 := box.quad2()
-	box3 := box.quad3()
-	return &qtNode{
-		level:    level,
-		box:      box,
-		halfSide: halfSide,
-		center:   center,
-		child: [4]*qtNode{
-			qtBuild(level+1, box0, box0.lineFilter(lSet)),
-			qtBuild(level+1, box1, box1.lineFilter(lSet)),
-			qtBuild(level+1, box2, box2.lineFilter(lSet)),
-			qtBuild(level+1, box3, box3.lineFilter(lSet)),
-		},
+	bb := boxes[0]
+	for _, b := range boxes {
+		bb = bb.Extend(b)
 	}
-}
 
-// boxes returns the set of boxes used by this node.
-func (node *qtNode) boxes() []*Box2 {
-	if node == nil {
-		return nil
-	}
-	if node.leaf != nil {
-		return []*Box2{&node.box}
-	}
-	boxes := []*Box2{&node.box}
-	boxes = append(boxes, node.child[0].boxes()...)
-	boxes = append(boxes, node.child[1].boxes()...)
-	boxes = append(boxes, node.child[2].boxes()...)
-	boxes = append(boxes, node.child[3].boxes()...)
-	return boxes
+	return &MeshSDF2{
+		mesh: mesh,
+		line: convertLines(mesh),
+		bvh:  boxBVH2(boxes),
+		bb:   bb,
+	}, nil
 }
 
-// searchOrder returns the child search order for this node.
-// Order by minimum distance to the child boxes.
-func (node *qtNode) searchOrder(p v2.Vec) [4]int {
-	// translate the point so the node box center is at the origin
-	p = p.Sub(node.center)
-	if p.X >= 0 {
-		if p.Y >= 0 {
-			// quad3
-			if p.Y >= p.X {
-				return [4]int{3, 2, 1, 0}
+// minDist2 returns the minimum distance squared from a point to the mesh.
+func (s *MeshSDF2) minDist2(p v2.Vec) float64 {
+	d2 := math.MaxFloat64
+	var stack [bvhStackSize]int
+	n := 1
+	for n > 0 {
+		n--
+		node := &s.bvh.node[stack[n]]
+		if node.bb.minDist2(p) >= d2 {
+			// no new minimums here
+			continue
+		}
+		if node.left < 0 {
+			for _, i := range s.bvh.index[node.start:node.end] {
+				if d := s.line[i].minDistance2(p); d < d2 {
+					d2 = d
+				}
 			}
-			return [4]int{3, 1, 2, 0}
+			continue
 		}
-		// quad1
-		if p.Y <= -p.X {
-			return [4]int{1, 0, 3, 2}
+		// search the closer child first
+		l, r := node.left, node.right
+		dl := s.bvh.node[l].bb.minDist2(p)
+		dr := s.bvh.node[r].bb.minDist2(p)
+		if dl > dr {
+			l, r = r, l
+			dl, dr = dr, dl
 		}
-		return [4]int{1, 3, 0, 2}
-	}
-	if p.Y >= 0 {
-		// quad2
-		if p.Y >= -p.X {
-			return [4]int{2, 3, 0, 1}
+		if dr < d2 {
+			stack[n] = r
+			n++
+		}
+		if dl < d2 {
+			stack[n] = l
+			n++
 		}
-		return [4]int{2, 0, 3, 1}
-	}
-	// quad0
-	if p.Y <= p.X {
-		return [4]int{0, 1, 2, 3}
-	}
-	return [4]int{0, 2, 1, 3}
-}
-
-// minBoxDist2 returns the minimum distance squared from a point to the node box.
-// Inside the box is a zero distance.
-func (node *qtNode) minBoxDist2(p v2.Vec) float64 {
-	// translate the point so the node box center is at the origin
-	// work in a single quadrant
-	p = p.Sub(node.center).Abs()
-	dx := p.X - node.halfSide
-	dy := p.Y - node.halfSide
-	// inside the box
-	if dx < 0 && dy < 0 {
-		return 0
-	}
-	if dy < 0 {
-		return dx * dx
-	}
-	if dx < 0 {
-		return dy * dy
-	}
-	return (dx * dx) + (dy * dy)
-}
-
-// minFeatureDist2 returns the minimum distance squared from a point to the leaf feature.
-func (node *qtNode) minLeafDist2(p v2.Vec) float64 {
-	dd := math.MaxFloat64
-	for _, li := range node.leaf {
-		dd = math.Min(dd, li.minDistance2(p))
-	}
-	return dd
-}
-
-func (node *qtNode) minDist2(p v2.Vec, dd float64) float64 {
-	if node == nil || node.minBoxDist2(p) >= dd {
-		// no new minimums here
-		return dd
-	}
-	if node.leaf != nil {
-		// measure the leaf
-		return math.Min(dd, node.minLeafDist2(p))
-	}
-	// search the child nodes
-	for _, i := range node.searchOrder(p) {
-		dd = node.child[i].minDist2(p, dd)
 	}
-	return dd
+	return d2
 }
 
-// winding returns the winding number for the quadtree node
-func (node *qtNode) winding(p v2.Vec, wn int) int {
-	if node == nil {
-		return wn
-	}
-	// leaf node
-	if node.leaf != nil {
-		for _, li := range node.leaf {
-			wn += li.winding(p)
-		}
-		return wn
-	}
-	// child nodes: explore in +ve x-axis order
-	// translate the point so the node box center is at the origin
-	q := p.Sub(node.center)
-	if q.X < 0 {
-		if q.Y < 0 {
-			wn = node.child[0].winding(p, wn)
-			wn = node.child[1].winding(p, wn)
-		} else {
-			wn = node.child[2].winding(p, wn)
-			wn = node.child[3].winding(p, wn)
+// winding returns the winding number of the mesh at a point.
+func (s *MeshSDF2) winding(p v2.Vec) int {
+	// Only line segments that cross the +ve x-axis ray from p count.
+	wn := 0
+	var stack [bvhStackSize]int
+	n := 1
+	for n > 0 {
+		n--
+		node := &s.bvh.node[stack[n]]
+		if p.Y < node.bb.Min.Y || p.Y >= node.bb.Max.Y || p.X > node.bb.Max.X {
+			continue
 		}
-	} else {
-		if q.Y < 0 {
-			wn = node.child[1].winding(p, wn)
-		} else {
-			wn = node.child[3].winding(p, wn)
+		if node.left < 0 {
+			for _, i := range s.bvh.index[node.start:node.end] {
+				wn += s.line[i].winding(p)
+			}
+			continue
 		}
+		stack[n] = node.left
+		stack[n+1] = node.right
+		n += 2
 	}
 	return wn
 }
 
-//-----------------------------------------------------------------------------
-// Mesh2D. 2D mesh evaluation with quadtree speedup.
-
-// MeshSDF2 is SDF2 made from a set of line segments.
-type MeshSDF2 struct {
-	qt *qtNode // quadtree root
-	bb Box2    // bounding box
-}
-
-// Mesh2D returns an SDF2 made from a set of line segments.
-func Mesh2D(mesh []*Line2) (SDF2, error) {
-	n := len(mesh)
-	if n == 0 {
-		return nil, ErrMsg("no 2d line segments")
-	}
-
-	// work out the bounding box
-	bb := mesh[0].BoundingBox()
-	for _, edge := range mesh {
-		bb = bb.Include(edge[0]).Include(edge[1])
-	}
-
-	// The quadtree box is derived from the bounding box.
-	// Square it up for simpler math.
-	// Scale it slightly to contain line segments on the top/right edges.
-	qtBox := bb.Square().ScaleAboutCenter(1.01)
-
-	// build the quadtree
-	qt := qtBuild(0, qtBox, mesh)
-
-	return &MeshSDF2{
-		qt: qt,
-		bb: bb,
-	}, nil
-}
-
 // Evaluate returns the minimum distance for a 2d mesh.
 func (s *MeshSDF2) Evaluate(p v2.Vec) float64 {
-	d2 := s.qt.minDist2(p, math.MaxFloat64)
-	wn := s.qt.winding(p, 0)
+	d2 := s.minDist2(p)
+	wn := s.winding(p)
 	// normalise d*d to d
 	d := math.Sqrt(d2)
 	if wn != 0 {
@@ -308,9 +224,19 @@ func (s *MeshSDF2) Evaluate(p v2.Vec) float64 {
 	return d
 }
 
-// Boxes returns the full set of quadtree boxes.
+// EvaluateInterval returns an interval containing the values of a 2d mesh within a box.
+func (s *MeshSDF2) EvaluateInterval(b Box2) Interval {
+	// exact distance field
+	return exactInterval2(s, b)
+}
+
+// Boxes returns the full set of BVH boxes.
 func (s *MeshSDF2) Boxes() []*Box2 {
-	return s.qt.boxes()
+	boxes := make([]*Box2, len(s.bvh.node))
+	for i := range s.bvh.node {
+		boxes[i] = &s.bvh.node[i].bb
+	}
+	return boxes
 }
 
 // BoundingBox returns the bounding box of a 2d mesh.
@@ -351,11 +277,7 @@ func Polygon2D(vertex []v2.Vec) (SDF2, error) {
 //-----------------------------------------------------------------------------
 // Mesh2D Slow. Provided for testing and benchmarking purposes.
 
-// Note: Mesh2DSlow should produce the same distance results as Mesh2D but there
-// may be small floating point differences because Mesh2D is breaking the line
-// segments into smaller pieces to contain them within the quadtree nodes.
-// Experimentally these deltas are very small, but can result in different STL
-// and DXF files.
+// Note: Mesh2DSlow produces the same distance results as Mesh2D.
 
 // MeshSDF2Slow is SDF2 made from a set of line segments.
 type MeshSDF2Slow struct {
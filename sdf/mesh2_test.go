@@ -9,7 +9,10 @@ Mesh 2D Testing and Benchmarking
 package sdf
 
 import (
+	"math"
 	"testing"
+
+	v2 "github.com/deadsy/sdfx/vec/v2"
 )
 
 //-----------------------------------------------------------------------------
@@ -92,6 +95,40 @@ func Benchmark_Mesh2DSlow(b *testing.B) {
 	})
 }
 
+// starLines returns the line segments for a star shaped polygon with n vertices.
+func starLines(n int) []*Line2 {
+	v := make([]v2.Vec, n)
+	for i := range v {
+		theta := Tau * float64(i) / float64(n)
+		r := 100.0 + 20.0*math.Sin(37*theta) + 5.0*float64(i%2)
+		v[i] = v2.Vec{r * math.Cos(theta), r * math.Sin(theta)}
+	}
+	return VertexToLine(v, true)
+}
+
+func Benchmark_Mesh2DLarge(b *testing.B) {
+	m := starLines(5000)
+	s0, err := Mesh2D(m)
+	if err != nil {
+		b.Fatalf("error: %s", err)
+	}
+	s1, err := Mesh2DSlow(m)
+	if err != nil {
+		b.Fatalf("error: %s", err)
+	}
+	bb := s0.BoundingBox()
+	b.Run("Mesh2D", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_ = s0.Evaluate(bb.Random())
+		}
+	})
+	b.Run("Mesh2DSlow", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_ = s1.Evaluate(bb.Random())
+		}
+	})
+}
+
 //-----------------------------------------------------------------------------
 
 const nPoints = 20000
@@ -152,3 +189,63 @@ func Test_Mesh2D_Cache(t *testing.T) {
 }
 
 //-----------------------------------------------------------------------------
+
+func Test_Mesh2D_Robust(t *testing.T) {
+
+	// a large polygon
+	m := starLines(5000)
+	s0, err := Mesh2D(m)
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	s1, err := Mesh2DSlow(m)
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	bb := s0.BoundingBox()
+	for _, p := range bb.RandomSet(nPoints) {
+		d0 := s0.Evaluate(p)
+		d1 := s1.Evaluate(p)
+		if d0 != d1 {
+			t.Errorf("%v fast %f slow %f", p, d0, d1)
+		}
+	}
+
+	// nearly collinear vertices and zero length segments
+	s2, err := Polygon2D([]v2.Vec{{0, 0}, {1, 1e-17}, {2, 0}, {2, 0}, {2, 1}, {1, 1 - 1e-17}, {0, 1}})
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	testSet := []struct {
+		p v2.Vec
+		d float64
+	}{
+		{v2.Vec{1, 0.5}, -0.5},
+		{v2.Vec{0.1, 0.1}, -0.1},
+		{v2.Vec{1, -1}, 1},
+		{v2.Vec{3, 0}, 1},
+		{v2.Vec{1, 0}, 0},
+		{v2.Vec{0.5, 1}, 0},
+		{v2.Vec{-1, 0}, 1},
+		{v2.Vec{-1, 1}, 1},
+	}
+	for i, test := range testSet {
+		d := s2.Evaluate(test.p)
+		if !EqualFloat64(d, test.d, tolerance) {
+			t.Errorf("test %d: expected %f, got %f", i, test.d, d)
+		}
+	}
+
+	// orientation test
+	if orient2d(v2.Vec{0, 0}, v2.Vec{1, 1}, v2.Vec{0.5, math.Nextafter(0.5, 1)}) <= 0 {
+		t.Errorf("expected left")
+	}
+	if orient2d(v2.Vec{0, 0}, v2.Vec{1, 1}, v2.Vec{0.5, math.Nextafter(0.5, 0)}) >= 0 {
+		t.Errorf("expected right")
+	}
+	if orient2d(v2.Vec{0.1, 0.1}, v2.Vec{0.3, 0.3}, v2.Vec{0.2, 0.2}) != 0 {
+		t.Errorf("expected collinear")
+	}
+}
+
+//-----------------------------------------------------------------------------
@@ -9,6 +9,8 @@
 package sdf
 
 import (
+	"math"
+
 	v2 "github.com/deadsy/sdfx/vec/v2"
 	v3 "github.com/deadsy/sdfx/vec/v3"
 )
@@ -135,12 +137,96 @@ func (a *triangleInfo) minDistance2(p v3.Vec) float64 {
 }
 
 //-----------------------------------------------------------------------------
-// Mesh3D. 3D mesh evaluation with octree speedup.
+
+// segmentDistance2 returns the minimum distance squared between a point and a line segment.
+func segmentDistance2(p, a, b v3.Vec) float64 {
+	ab := b.Sub(a)
+	ap := p.Sub(a)
+	l2 := ab.Length2()
+	if l2 == 0 {
+		return ap.Length2()
+	}
+	t := Clamp(ap.Dot(ab)/l2, 0, 1)
+	return ap.Sub(ab.MulScalar(t)).Length2()
+}
+
+// meshTriangle is a mesh triangle with pre-calculated distance information.
+type meshTriangle struct {
+	t    *Triangle3
+	info *triangleInfo // nil for degenerate (zero area) triangles
+}
+
+func newMeshTriangle(t *Triangle3) meshTriangle {
+	e1 := t[1].Sub(t[0])
+	e2 := t[2].Sub(t[0])
+	if e1.Cross(e2).Length() <= epsilon*(e1.Length2()+e2.Length2()) {
+		return meshTriangle{t: t}
+	}
+	return meshTriangle{t: t, info: newTriangleInfo(t)}
+}
+
+// distance2 returns the minimum distance squared between a point and the triangle.
+func (a *meshTriangle) distance2(p v3.Vec) float64 {
+	if a.info != nil {
+		return a.info.minDistance2(p)
+	}
+	// the triangle is a line segment
+	t := a.t
+	return math.Min(segmentDistance2(p, t[0], t[1]), math.Min(segmentDistance2(p, t[1], t[2]), segmentDistance2(p, t[2], t[0])))
+}
+
+func convertMesh(mesh []*Triangle3) []meshTriangle {
+	mt := make([]meshTriangle, len(mesh))
+	for i := range mesh {
+		mt[i] = newMeshTriangle(mesh[i])
+	}
+	return mt
+}
+
+// meshSign returns +1 for outward facing triangles and -1 for inward facing triangles.
+func meshSign(mesh []*Triangle3) float64 {
+	// work out the orientation from the signed volume
+	volume := 0.0
+	for _, t := range mesh {
+		volume += t[0].Dot(t[1].Cross(t[2]))
+	}
+	if volume < 0 {
+		return -1
+	}
+	return 1
+}
+
+//-----------------------------------------------------------------------------
+// Mesh3D. 3D mesh evaluation with BVH speedup.
+
+// The distance to the mesh is the distance to the closest triangle. This is
+// found with a branch and bound search of a BVH over the triangles.
+//
+// The sign comes from the generalized winding number of the mesh. This is ~1
+// inside the mesh and ~0 outside, even when the mesh has holes, overlaps or
+// non-manifold edges. Distant BVH nodes are approximated as dipoles.
+// See: "Fast Winding Numbers for Soups and Clouds", Barill et al, 2018.
+
+// meshBeta sets the accuracy of the far field winding number approximation.
+// Nodes further away than meshBeta * node radius are approximated.
+const meshBeta = 2.0
+
+// meshNode is the winding number information for a BVH node.
+type meshNode struct {
+	n    v3.Vec  // sum of the triangle area vectors
+	c    v3.Vec  // area weighted center of the triangles
+	area float64 // total triangle area
+	r    float64 // radius of the node about c
+}
 
 // MeshSDF3 is an SDF3 made from a set of 3d triangles.
 type MeshSDF3 struct {
-	mesh []*Triangle3
-	bb   Box3 // bounding box
+	mesh     []*Triangle3
+	triangle []meshTriangle
+	bvh      *bvh3      // bvh over the triangles
+	node     []meshNode // winding number information for each bvh node
+	sign     float64    // orientation of the triangles
+	bb       Box3       // bounding box
 }
 
 // Mesh3D returns an SDF3 made from a set of triangles.
@@ -150,22 +236,165 @@ func Mesh3D(mesh []*Triangle3) (SDF3, error) {
 		return nil, ErrMsg("no triangles")
 	}
 
-	// work out the bounding box
-	bb := mesh[0].BoundingBox()
-	for _, t := range mesh {
-		bb = bb.Extend(t.BoundingBox())
+	// work out the bounding boxes
+	boxes := make([]Box3, n)
+	for i, t := range mesh {
+		boxes[i] = t.BoundingBox()
+	}
+	bb := boxes[0]
+	for _, b := range boxes {
+		bb = bb.Extend(b)
 	}
 
-	return &MeshSDF3{
-		mesh: mesh,
-		bb:   bb,
-	}, nil
+	s := MeshSDF3{
+		mesh:     mesh,
+		triangle: convertMesh(mesh),
+		bvh:      boxBVH3(boxes),
+		sign:     meshSign(mesh),
+		bb:       bb,
+	}
+
+	// work out the winding number information for the bvh nodes.
+	// child nodes come after their parents, so work backwards.
+	s.node = make([]meshNode, len(s.bvh.node))
+	for k := len(s.bvh.node) - 1; k >= 0; k-- {
+		node := &s.bvh.node[k]
+		x := &s.node[k]
+		if node.left < 0 {
+			for _, i := range s.bvh.index[node.start:node.end] {
+				t := mesh[i]
+				a := t[1].Sub(t[0]).Cross(t[2].Sub(t[0])).MulScalar(0.5)
+				area := a.Length()
+				x.n = x.n.Add(a)
+				x.c = x.c.Add(t[0].Add(t[1]).Add(t[2]).MulScalar(area / 3))
+				x.area += area
+			}
+		} else {
+			l := &s.node[node.left]
+			r := &s.node[node.right]
+			x.n = l.n.Add(r.n)
+			x.c = l.c.MulScalar(l.area).Add(r.c.MulScalar(r.area))
+			x.area = l.area + r.area
+		}
+		if x.area > 0 {
+			x.c = x.c.DivScalar(x.area)
+		} else {
+			x.c = node.bb.Center()
+		}
+		for _, v := range node.bb.Vertices() {
+			x.r = math.Max(x.r, v.Sub(x.c).Length())
+		}
+	}
+
+	return &s, nil
+}
+
+// distance2 returns the minimum distance squared from a point to the mesh.
+func (s *MeshSDF3) distance2(p v3.Vec) float64 {
+	d2, _ := s.closest(p, -1)
+	return d2
 }
 
-// Evaluate returns the minimum distance for a 2d mesh.
+// closest returns the minimum distance squared from a point to the mesh and the closest triangle.
+// The search starts with triangle j (if j >= 0), a close triangle prunes more of the bvh.
+func (s *MeshSDF3) closest(p v3.Vec, j int) (float64, int) {
+	d2 := math.Inf(1)
+	if j >= 0 {
+		d2 = s.triangle[j].distance2(p)
+	}
+	var stack [bvhStackSize]int
+	n := 1
+	for n > 0 {
+		n--
+		node := &s.bvh.node[stack[n]]
+		if node.bb.minDist2(p) >= d2 {
+			continue
+		}
+		if node.left < 0 {
+			for _, i := range s.bvh.index[node.start:node.end] {
+				if x := s.triangle[i].distance2(p); x < d2 {
+					d2, j = x, i
+				}
+			}
+			continue
+		}
+		// visit the closer child first
+		l, r := node.left, node.right
+		dl := s.bvh.node[l].bb.minDist2(p)
+		dr := s.bvh.node[r].bb.minDist2(p)
+		if dl > dr {
+			l, r = r, l
+			dl, dr = dr, dl
+		}
+		if dr < d2 {
+			stack[n] = r
+			n++
+		}
+		if dl < d2 {
+			stack[n] = l
+			n++
+		}
+	}
+	return d2, j
+}
+
+// winding returns the generalized winding number of the mesh at a point.
+func (s *MeshSDF3) winding(p v3.Vec) float64 {
+	w := 0.0
+	var stack [bvhStackSize]int
+	n := 1
+	for n > 0 {
+		n--
+		k := stack[n]
+		node := &s.bvh.node[k]
+		if node.left < 0 {
+			for _, i := range s.bvh.index[node.start:node.end] {
+				w += s.mesh[i].solidAngle(p)
+			}
+			continue
+		}
+		x := &s.node[k]
+		q := x.c.Sub(p)
+		if l := q.Length(); l > meshBeta*x.r {
+			// far field: the solid angle of a dipole
+			w += q.Dot(x.n) / (l * l * l)
+			continue
+		}
+		stack[n] = node.left
+		stack[n+1] = node.right
+		n += 2
+	}
+	return s.sign * w / (4 * Pi)
+}
+
+// Evaluate returns the minimum distance for a 3d mesh.
 func (s *MeshSDF3) Evaluate(p v3.Vec) float64 {
-	// TODO
-	return 0
+	d := math.Sqrt(s.distance2(p))
+	if s.winding(p) > 0.5 {
+		return -d
+	}
+	return d
+}
+
+// EvaluateInterval returns an interval containing the values of a 3d mesh within a box.
+func (s *MeshSDF3) EvaluateInterval(b Box3) Interval {
+	// exact distance field
+	return exactInterval3(s, b)
+}
+
+// EvaluateBatch evaluates a 3d mesh at a slice of points.
+// Batches are usually close together, so the closest triangle to the previous point starts the search.
+func (s *MeshSDF3) EvaluateBatch(ps []v3.Vec, out []float64) {
+	j := -1
+	for i, p := range ps {
+		var d2 float64
+		d2, j = s.closest(p, j)
+		d := math.Sqrt(d2)
+		if s.winding(p) > 0.5 {
+			d = -d
+		}
+		out[i] = d
+	}
 }
 
 // BoundingBox returns the bounding box of a 3d mesh.
@@ -178,8 +407,10 @@ func (s *MeshSDF3) BoundingBox() Box3 {
 
 // MeshSDF3Slow is an SDF3 made from a set of 3d triangles.
 type MeshSDF3Slow struct {
-	mesh []*Triangle3
-	bb   Box3 // bounding box
+	mesh     []*Triangle3
+	triangle []meshTriangle
+	sign     float64 // orientation of the triangles
+	bb       Box3    // bounding box
 }
 
 // Mesh3DSlow returns an SDF3 made from a set of triangles.
@@ -196,15 +427,26 @@ func Mesh3DSlow(mesh []*Triangle3) (SDF3, error) {
 	}
 
 	return &MeshSDF3Slow{
-		mesh: mesh,
-		bb:   bb,
+		mesh:     mesh,
+		triangle: convertMesh(mesh),
+		sign:     meshSign(mesh),
+		bb:       bb,
 	}, nil
 }
 
-// Evaluate returns the minimum distance for a 2d mesh.
+// Evaluate returns the minimum distance for a 3d mesh.
 func (s *MeshSDF3Slow) Evaluate(p v3.Vec) float64 {
-	// TODO
-	return 0
+	d2 := math.Inf(1)
+	w := 0.0
+	for i := range s.triangle {
+		d2 = math.Min(d2, s.triangle[i].distance2(p))
+		w += s.mesh[i].solidAngle(p)
+	}
+	d := math.Sqrt(d2)
+	if s.sign*w/(4*Pi) > 0.5 {
+		return -d
+	}
+	return d
 }
 
 // BoundingBox returns the bounding box of a 3d mesh.
@@ -9,6 +9,7 @@ Mesh 3D Testing and Benchmarking
 package sdf
 
 import (
+	"math"
 	"testing"
 
 	v3 "github.com/deadsy/sdfx/vec/v3"
@@ -77,3 +78,173 @@ func Test_Mesh3_minDistance2(t *testing.T) {
 }
 
 //-----------------------------------------------------------------------------
+
+// sphereMesh returns a triangle mesh for a sphere of radius r (outward facing).
+func sphereMesh(r float64, nLat, nLong int) []*Triangle3 {
+	vertex := func(i, j int) v3.Vec {
+		theta := Pi * float64(i) / float64(nLat)
+		phi := Tau * float64(j) / float64(nLong)
+		return v3.Vec{math.Sin(theta) * math.Cos(phi), math.Sin(theta) * math.Sin(phi), math.Cos(theta)}.MulScalar(r)
+	}
+	var mesh []*Triangle3
+	for i := 0; i < nLat; i++ {
+		for j := 0; j < nLong; j++ {
+			v0 := vertex(i, j)
+			v1 := vertex(i+1, j)
+			v2 := vertex(i+1, j+1)
+			v3 := vertex(i, j+1)
+			if i != 0 {
+				mesh = append(mesh, &Triangle3{v0, v1, v3})
+			}
+			if i != nLat-1 {
+				mesh = append(mesh, &Triangle3{v1, v2, v3})
+			}
+		}
+	}
+	return mesh
+}
+
+// boxMesh returns a triangle mesh for a box centered on the origin (outward facing).
+func boxMesh(size v3.Vec) []*Triangle3 {
+	v := NewBox3(v3.Vec{}, size).Vertices()
+	face := [][4]int{{0, 1, 3, 2}, {4, 6, 7, 5}, {0, 4, 5, 1}, {2, 3, 7, 6}, {0, 2, 6, 4}, {1, 5, 7, 3}}
+	var mesh []*Triangle3
+	for _, f := range face {
+		mesh = append(mesh, &Triangle3{v[f[0]], v[f[1]], v[f[2]]})
+		mesh = append(mesh, &Triangle3{v[f[0]], v[f[2]], v[f[3]]})
+	}
+	return mesh
+}
+
+func Test_Mesh3D(t *testing.T) {
+	// a box mesh has the same distance field as the box
+	size := v3.Vec{2, 3, 4}
+	box, err := Box3D(size, 0)
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	s0, err := Mesh3D(boxMesh(size))
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	b := s0.BoundingBox().ScaleAboutCenter(2)
+	for i, p := range b.RandomSet(nPoints) {
+		d0 := box.Evaluate(p)
+		d1 := s0.Evaluate(p)
+		if !EqualFloat64(d0, d1, tolerance) {
+			t.Errorf("box test %d: expected %f, got %f", i, d0, d1)
+		}
+	}
+
+	// compare to the brute force evaluation
+	mesh := sphereMesh(10, 20, 40)
+	s1, err := Mesh3D(mesh)
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	s2, err := Mesh3DSlow(mesh)
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	b = s1.BoundingBox().ScaleAboutCenter(1.5)
+	for i, p := range b.RandomSet(5000) {
+		d1 := s1.Evaluate(p)
+		d2 := s2.Evaluate(p)
+		if !EqualFloat64(d1, d2, tolerance) {
+			t.Errorf("sphere test %d: expected %f, got %f", i, d2, d1)
+		}
+	}
+
+	// batch evaluation (a row of points and a random set) is the same as one point at a time
+	ps := make([]v3.Vec, 500)
+	for i := range ps {
+		ps[i] = v3.Vec{-15 + 0.06*float64(i), 3, 2}
+	}
+	ps = append(ps, b.RandomSet(500)...)
+	out := make([]float64, len(ps))
+	s1.(BatchSDF3).EvaluateBatch(ps, out)
+	for i, p := range ps {
+		if d := s1.Evaluate(p); out[i] != d {
+			t.Errorf("batch test %d: expected %f, got %f", i, d, out[i])
+		}
+	}
+
+	// inward facing triangles
+	flipped := make([]*Triangle3, len(mesh))
+	for i, x := range mesh {
+		flipped[i] = &Triangle3{x[0], x[2], x[1]}
+	}
+	s3, err := Mesh3D(flipped)
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	for i, p := range b.RandomSet(1000) {
+		d1 := s1.Evaluate(p)
+		d3 := s3.Evaluate(p)
+		if !EqualFloat64(d1, d3, tolerance) {
+			t.Errorf("flipped test %d: expected %f, got %f", i, d1, d3)
+		}
+	}
+
+	// a mesh with holes and degenerate triangles still has the right sign
+	var holes []*Triangle3
+	for i, x := range mesh {
+		if i%50 != 0 {
+			holes = append(holes, x)
+		}
+	}
+	holes = append(holes, &Triangle3{{0, 0, 0}, {1, 1, 1}, {2, 2, 2}}, &Triangle3{{1, 0, 0}, {1, 0, 0}, {1, 0, 0}})
+	s4, err := Mesh3D(holes)
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	for i, p := range b.RandomSet(1000) {
+		r := p.Length()
+		if r < 9 && s4.Evaluate(p) >= 0 {
+			t.Errorf("holes test %d: expected inside", i)
+		}
+		if r > 11 && s4.Evaluate(p) <= 0 {
+			t.Errorf("holes test %d: expected outside", i)
+		}
+	}
+}
+
+func Benchmark_Mesh3D(b *testing.B) {
+	s0, err := Mesh3D(sphereMesh(10, 50, 100))
+	if err != nil {
+		b.Fatalf("error: %s", err)
+	}
+	bb := s0.BoundingBox()
+	b.Run("Mesh3D", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_ = s0.Evaluate(bb.Random())
+		}
+	})
+	// rows of points, as a renderer evaluates them
+	ps := make([]v3.Vec, 100)
+	out := make([]float64, len(ps))
+	b.Run("Mesh3DBatch", func(b *testing.B) {
+		for i := 0; i < b.N; i += len(ps) {
+			p := bb.Random()
+			for j := range ps {
+				ps[j] = p.Add(v3.Vec{X: 0.1 * float64(j)})
+			}
+			s0.(BatchSDF3).EvaluateBatch(ps, out)
+		}
+	})
+}
+
+func Benchmark_Mesh3DSlow(b *testing.B) {
+	s0, err := Mesh3DSlow(sphereMesh(10, 50, 100))
+	if err != nil {
+		b.Fatalf("error: %s", err)
+	}
+	bb := s0.BoundingBox()
+	b.Run("Mesh3DSlow", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_ = s0.Evaluate(bb.Random())
+		}
+	})
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,525 @@
+//-----------------------------------------------------------------------------
+/*
+
+Mirror Symmetry
+
+A union of an SDF with a mirrored copy of itself (Transform3D with MirrorYZ)
+evaluates the SDF twice. These SDFs fold the query point into one half-space
+with abs() instead, so a part with n mirror planes is evaluated once.
+
+The part of the SDF on the positive side of each mirror plane is kept and
+mirrored to the negative side. Anything on the negative side is discarded.
+If the SDF crosses a mirror plane the discarded surface may still be closer
+to an inside point, so the distance is a bound on the inside.
+
+Mirror3D and Mirror2D take any plane (or line). They use the coordinate planes
+(or axes) of Symmetry3D and Symmetry2D when they can.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"math"
+
+	v2 "github.com/deadsy/sdfx/vec/v2"
+	v3 "github.com/deadsy/sdfx/vec/v3"
+)
+
+//-----------------------------------------------------------------------------
+
+// Plane3 is a mirror plane through the origin.
+type Plane3 int
+
+// Mirror planes, these mirror in the same way as MirrorXY, MirrorXZ and MirrorYZ.
+const (
+	PlaneXY Plane3 = iota // z = 0
+	PlaneXZ               // y = 0
+	PlaneYZ               // x = 0
+)
+
+var plane3Names = []string{"XY", "XZ", "YZ"}
+
+// Axis2 is a mirror axis through the origin.
+type Axis2 int
+
+// Mirror axes, these mirror in the same way as MirrorX and MirrorY.
+const (
+	AxisX Axis2 = iota // y = 0
+	AxisY              // x = 0
+)
+
+var axis2Names = []string{"X", "Y"}
+
+// foldInterval returns the interval of abs(x) for x in [lo, hi].
+func foldInterval(lo, hi float64) (float64, float64) {
+	if lo >= 0 {
+		return lo, hi
+	}
+	if hi <= 0 {
+		return -hi, -lo
+	}
+	return 0, math.Max(-lo, hi)
+}
+
+// foldBox returns the range [-max, max] of a mirrored bounding box.
+func foldBox(max float64) (float64, float64) {
+	max = math.Max(max, 0)
+	return -max, max
+}
+
+//-----------------------------------------------------------------------------
+
+// MirrorSDF3 is an SDF3 mirrored across one or more of the XY, XZ and YZ planes.
+type MirrorSDF3 struct {
+	sdf     SDF3
+	x, y, z bool // fold the coordinate
+	bb      Box3
+}
+
+// Mirror3D returns an SDF3 with the part on the positive side of a plane mirrored to the other side.
+// The plane goes through a point and the normal points to the positive side.
+func Mirror3D(sdf SDF3, point, normal v3.Vec) (SDF3, error) {
+	if sdf == nil {
+		return nil, ErrMsg("sdf == nil")
+	}
+	if normal.Length() == 0 {
+		return nil, ErrMsg("normal has zero length")
+	}
+	n := normal.Normalize()
+	if point.Length() == 0 {
+		for i, x := range []v3.Vec{{0, 0, 1}, {0, 1, 0}, {1, 0, 0}} {
+			if n.Equals(x, epsilon) {
+				return Symmetry3D(sdf, Plane3(i))
+			}
+		}
+	}
+	bb, ok := mirrorBox3(sdf.BoundingBox(), point, n)
+	if !ok {
+		return nil, ErrMsg("sdf is on the negative side of the plane")
+	}
+	return &MirrorPlaneSDF3{sdf: sdf, point: point, normal: n, bb: bb}, nil
+}
+
+// Symmetry3D returns an SDF3 with the part on the positive side of the planes mirrored across each plane.
+// E.g. PlaneXZ and PlaneYZ give a part with 4-fold symmetry modelled by its positive XY quadrant.
+func Symmetry3D(sdf SDF3, planes ...Plane3) (SDF3, error) {
+	if sdf == nil {
+		return nil, ErrMsg("sdf == nil")
+	}
+	if len(planes) == 0 {
+		return nil, ErrMsg("no planes")
+	}
+	s := MirrorSDF3{sdf: sdf}
+	for _, plane := range planes {
+		switch plane {
+		case PlaneXY:
+			s.z = true
+		case PlaneXZ:
+			s.y = true
+		case PlaneYZ:
+			s.x = true
+		default:
+			return nil, ErrMsg("unknown plane")
+		}
+	}
+	s.bb = sdf.BoundingBox()
+	if s.x {
+		s.bb.Min.X, s.bb.Max.X = foldBox(s.bb.Max.X)
+	}
+	if s.y {
+		s.bb.Min.Y, s.bb.Max.Y = foldBox(s.bb.Max.Y)
+	}
+	if s.z {
+		s.bb.Min.Z, s.bb.Max.Z = foldBox(s.bb.Max.Z)
+	}
+	return &s, nil
+}
+
+// fold returns the point folded into the positive half-spaces.
+func (s *MirrorSDF3) fold(p v3.Vec) v3.Vec {
+	if s.x {
+		p.X = math.Abs(p.X)
+	}
+	if s.y {
+		p.Y = math.Abs(p.Y)
+	}
+	if s.z {
+		p.Z = math.Abs(p.Z)
+	}
+	return p
+}
+
+// Evaluate returns the minimum distance to a mirrored SDF3.
+func (s *MirrorSDF3) Evaluate(p v3.Vec) float64 {
+	return s.sdf.Evaluate(s.fold(p))
+}
+
+// EvaluateInterval returns an interval containing the values of a mirrored SDF3 within a box.
+func (s *MirrorSDF3) EvaluateInterval(b Box3) Interval {
+	if s.x {
+		b.Min.X, b.Max.X = foldInterval(b.Min.X, b.Max.X)
+	}
+	if s.y {
+		b.Min.Y, b.Max.Y = foldInterval(b.Min.Y, b.Max.Y)
+	}
+	if s.z {
+		b.Min.Z, b.Max.Z = foldInterval(b.Min.Z, b.Max.Z)
+	}
+	return EvaluateInterval3(s.sdf, b)
+}
+
+// Gradient returns the gradient of a mirrored SDF3.
+func (s *MirrorSDF3) Gradient(p v3.Vec, eps float64) v3.Vec {
+	g := Gradient3(s.sdf, s.fold(p), eps)
+	if s.x && p.X < 0 {
+		g.X = -g.X
+	}
+	if s.y && p.Y < 0 {
+		g.Y = -g.Y
+	}
+	if s.z && p.Z < 0 {
+		g.Z = -g.Z
+	}
+	return g
+}
+
+// BoundingBox returns the bounding box of a mirrored SDF3.
+func (s *MirrorSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+// planes returns the mirror planes of a mirrored SDF3.
+func (s *MirrorSDF3) planes() []Plane3 {
+	var planes []Plane3
+	if s.z {
+		planes = append(planes, PlaneXY)
+	}
+	if s.y {
+		planes = append(planes, PlaneXZ)
+	}
+	if s.x {
+		planes = append(planes, PlaneYZ)
+	}
+	return planes
+}
+
+//-----------------------------------------------------------------------------
+
+// MirrorPlaneSDF3 is an SDF3 mirrored across a plane.
+type MirrorPlaneSDF3 struct {
+	sdf    SDF3
+	point  v3.Vec // point on the plane
+	normal v3.Vec // unit normal
+	bb     Box3
+}
+
+// mirrorBox3 returns the bounding box of the part of a box on the positive side of a plane and its mirror image.
+// It returns false if the box is on the negative side of the plane.
+func mirrorBox3(bb Box3, point, n v3.Vec) (Box3, bool) {
+	// the corners on the positive side and the edge crossings
+	v := bb.Vertices()
+	var points []v3.Vec
+	for i, a := range v {
+		da := a.Sub(point).Dot(n)
+		if da >= 0 {
+			points = append(points, a)
+		}
+		// the corners differ by one coordinate for each bit of the index
+		for bit := 1; bit < len(v); bit <<= 1 {
+			if i&bit != 0 {
+				continue
+			}
+			b := v[i|bit]
+			db := b.Sub(point).Dot(n)
+			if (da < 0) != (db < 0) {
+				points = append(points, a.Add(b.Sub(a).MulScalar(da/(da-db))))
+			}
+		}
+	}
+	if len(points) == 0 {
+		return Box3{}, false
+	}
+	box := Box3{points[0], points[0]}
+	for _, p := range points {
+		box = box.Include(p).Include(p.Sub(n.MulScalar(2 * p.Sub(point).Dot(n))))
+	}
+	return box, true
+}
+
+// foldBox3 returns the bounding box of a box with the part on the negative side of a plane mirrored to the positive side.
+func foldBox3(bb Box3, point, n v3.Vec) Box3 {
+	// the folded corners and the edge crossings
+	v := bb.Vertices()
+	fold := func(p v3.Vec) v3.Vec {
+		if d := p.Sub(point).Dot(n); d < 0 {
+			return p.Sub(n.MulScalar(2 * d))
+		}
+		return p
+	}
+	box := Box3{fold(v[0]), fold(v[0])}
+	for i, a := range v {
+		box = box.Include(fold(a))
+		da := a.Sub(point).Dot(n)
+		for bit := 1; bit < len(v); bit <<= 1 {
+			if i&bit != 0 {
+				continue
+			}
+			b := v[i|bit]
+			db := b.Sub(point).Dot(n)
+			if (da < 0) != (db < 0) {
+				box = box.Include(a.Add(b.Sub(a).MulScalar(da / (da - db))))
+			}
+		}
+	}
+	return box
+}
+
+// Evaluate returns the minimum distance to a mirrored SDF3.
+func (s *MirrorPlaneSDF3) Evaluate(p v3.Vec) float64 {
+	if d := p.Sub(s.point).Dot(s.normal); d < 0 {
+		p = p.Sub(s.normal.MulScalar(2 * d))
+	}
+	return s.sdf.Evaluate(p)
+}
+
+// EvaluateInterval returns an interval containing the values of a mirrored SDF3 within a box.
+func (s *MirrorPlaneSDF3) EvaluateInterval(b Box3) Interval {
+	return EvaluateInterval3(s.sdf, foldBox3(b, s.point, s.normal))
+}
+
+// Gradient returns the gradient of a mirrored SDF3.
+func (s *MirrorPlaneSDF3) Gradient(p v3.Vec, eps float64) v3.Vec {
+	d := p.Sub(s.point).Dot(s.normal)
+	if d >= 0 {
+		return Gradient3(s.sdf, p, eps)
+	}
+	g := Gradient3(s.sdf, p.Sub(s.normal.MulScalar(2*d)), eps)
+	return g.Sub(s.normal.MulScalar(2 * g.Dot(s.normal)))
+}
+
+// BoundingBox returns the bounding box of a mirrored SDF3.
+func (s *MirrorPlaneSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
+
+// MirrorSDF2 is an SDF2 mirrored across one or both of the X and Y axes.
+type MirrorSDF2 struct {
+	sdf  SDF2
+	x, y bool // fold the coordinate
+	bb   Box2
+}
+
+// Mirror2D returns an SDF2 with the part on the positive side of a line mirrored to the other side.
+// The line goes through a point and the normal points to the positive side.
+func Mirror2D(sdf SDF2, point, normal v2.Vec) (SDF2, error) {
+	if sdf == nil {
+		return nil, ErrMsg("sdf == nil")
+	}
+	if normal.Length() == 0 {
+		return nil, ErrMsg("normal has zero length")
+	}
+	n := normal.Normalize()
+	if point.Length() == 0 {
+		for i, x := range []v2.Vec{{0, 1}, {1, 0}} {
+			if n.Equals(x, epsilon) {
+				return Symmetry2D(sdf, Axis2(i))
+			}
+		}
+	}
+	bb, ok := mirrorBox2(sdf.BoundingBox(), point, n)
+	if !ok {
+		return nil, ErrMsg("sdf is on the negative side of the line")
+	}
+	return &MirrorLineSDF2{sdf: sdf, point: point, normal: n, bb: bb}, nil
+}
+
+// Symmetry2D returns an SDF2 with the part on the positive side of the axes mirrored across each axis.
+// E.g. AxisX and AxisY give a part with 4-fold symmetry modelled by its positive quadrant.
+func Symmetry2D(sdf SDF2, axes ...Axis2) (SDF2, error) {
+	if sdf == nil {
+		return nil, ErrMsg("sdf == nil")
+	}
+	if len(axes) == 0 {
+		return nil, ErrMsg("no axes")
+	}
+	s := MirrorSDF2{sdf: sdf}
+	for _, axis := range axes {
+		switch axis {
+		case AxisX:
+			s.y = true
+		case AxisY:
+			s.x = true
+		default:
+			return nil, ErrMsg("unknown axis")
+		}
+	}
+	s.bb = sdf.BoundingBox()
+	if s.x {
+		s.bb.Min.X, s.bb.Max.X = foldBox(s.bb.Max.X)
+	}
+	if s.y {
+		s.bb.Min.Y, s.bb.Max.Y = foldBox(s.bb.Max.Y)
+	}
+	return &s, nil
+}
+
+// fold returns the point folded into the positive half-planes.
+func (s *MirrorSDF2) fold(p v2.Vec) v2.Vec {
+	if s.x {
+		p.X = math.Abs(p.X)
+	}
+	if s.y {
+		p.Y = math.Abs(p.Y)
+	}
+	return p
+}
+
+// Evaluate returns the minimum distance to a mirrored SDF2.
+func (s *MirrorSDF2) Evaluate(p v2.Vec) float64 {
+	return s.sdf.Evaluate(s.fold(p))
+}
+
+// EvaluateInterval returns an interval containing the values of a mirrored SDF2 within a box.
+func (s *MirrorSDF2) EvaluateInterval(b Box2) Interval {
+	if s.x {
+		b.Min.X, b.Max.X = foldInterval(b.Min.X, b.Max.X)
+	}
+	if s.y {
+		b.Min.Y, b.Max.Y = foldInterval(b.Min.Y, b.Max.Y)
+	}
+	return EvaluateInterval2(s.sdf, b)
+}
+
+// Gradient returns the gradient of a mirrored SDF2.
+func (s *MirrorSDF2) Gradient(p v2.Vec, eps float64) v2.Vec {
+	g := Gradient2(s.sdf, s.fold(p), eps)
+	if s.x && p.X < 0 {
+		g.X = -g.X
+	}
+	if s.y && p.Y < 0 {
+		g.Y = -g.Y
+	}
+	return g
+}
+
+// BoundingBox returns the bounding box of a mirrored SDF2.
+func (s *MirrorSDF2) BoundingBox() Box2 {
+	return s.bb
+}
+
+// axes returns the mirror axes of a mirrored SDF2.
+func (s *MirrorSDF2) axes() []Axis2 {
+	var axes []Axis2
+	if s.y {
+		axes = append(axes, AxisX)
+	}
+	if s.x {
+		axes = append(axes, AxisY)
+	}
+	return axes
+}
+
+//-----------------------------------------------------------------------------
+
+// MirrorLineSDF2 is an SDF2 mirrored across a line.
+type MirrorLineSDF2 struct {
+	sdf    SDF2
+	point  v2.Vec // point on the line
+	normal v2.Vec // unit normal
+	bb     Box2
+}
+
+// mirrorBox2 returns the bounding box of the part of a box on the positive side of a line and its mirror image.
+// It returns false if the box is on the negative side of the line.
+func mirrorBox2(bb Box2, point, n v2.Vec) (Box2, bool) {
+	// the corners on the positive side and the edge crossings
+	v := bb.Vertices()
+	var points []v2.Vec
+	for i, a := range v {
+		da := a.Sub(point).Dot(n)
+		if da >= 0 {
+			points = append(points, a)
+		}
+		// the corners differ by one coordinate for each bit of the index
+		for bit := 1; bit < len(v); bit <<= 1 {
+			if i&bit != 0 {
+				continue
+			}
+			b := v[i|bit]
+			db := b.Sub(point).Dot(n)
+			if (da < 0) != (db < 0) {
+				points = append(points, a.Add(b.Sub(a).MulScalar(da/(da-db))))
+			}
+		}
+	}
+	if len(points) == 0 {
+		return Box2{}, false
+	}
+	box := Box2{points[0], points[0]}
+	for _, p := range points {
+		box = box.Include(p).Include(p.Sub(n.MulScalar(2 * p.Sub(point).Dot(n))))
+	}
+	return box, true
+}
+
+// foldBox2 returns the bounding box of a box with the part on the negative side of a line mirrored to the positive side.
+func foldBox2(bb Box2, point, n v2.Vec) Box2 {
+	// the folded corners and the edge crossings
+	v := bb.Vertices()
+	fold := func(p v2.Vec) v2.Vec {
+		if d := p.Sub(point).Dot(n); d < 0 {
+			return p.Sub(n.MulScalar(2 * d))
+		}
+		return p
+	}
+	box := Box2{fold(v[0]), fold(v[0])}
+	for i, a := range v {
+		box = box.Include(fold(a))
+		da := a.Sub(point).Dot(n)
+		for bit := 1; bit < len(v); bit <<= 1 {
+			if i&bit != 0 {
+				continue
+			}
+			b := v[i|bit]
+			db := b.Sub(point).Dot(n)
+			if (da < 0) != (db < 0) {
+				box = box.Include(a.Add(b.Sub(a).MulScalar(da / (da - db))))
+			}
+		}
+	}
+	return box
+}
+
+// Evaluate returns the minimum distance to a mirrored SDF2.
+func (s *MirrorLineSDF2) Evaluate(p v2.Vec) float64 {
+	if d := p.Sub(s.point).Dot(s.normal); d < 0 {
+		p = p.Sub(s.normal.MulScalar(2 * d))
+	}
+	return s.sdf.Evaluate(p)
+}
+
+// EvaluateInterval returns an interval containing the values of a mirrored SDF2 within a box.
+func (s *MirrorLineSDF2) EvaluateInterval(b Box2) Interval {
+	return EvaluateInterval2(s.sdf, foldBox2(b, s.point, s.normal))
+}
+
+// Gradient returns the gradient of a mirrored SDF2.
+func (s *MirrorLineSDF2) Gradient(p v2.Vec, eps float64) v2.Vec {
+	d := p.Sub(s.point).Dot(s.normal)
+	if d >= 0 {
+		return Gradient2(s.sdf, p, eps)
+	}
+	g := Gradient2(s.sdf, p.Sub(s.normal.MulScalar(2*d)), eps)
+	return g.Sub(s.normal.MulScalar(2 * g.Dot(s.normal)))
+}
+
+// BoundingBox returns the bounding box of a mirrored SDF2.
+func (s *MirrorLineSDF2) BoundingBox() Box2 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,149 @@
+//-----------------------------------------------------------------------------
+/*
+
+Morphological Opening and Closing
+
+An opening (erode then dilate) rounds the outside edges of an object.
+A closing (dilate then erode) fills the inside corners of an object.
+
+Offsetting an SDF out and back in by the same amount does nothing, so the
+intermediate field has to be a true distance field. The SDF is sampled on a
+grid and redistanced, offset, then redistanced again before the final offset.
+The result is a grid based SDF, so features smaller than a cell may be lost.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"math"
+
+	v2 "github.com/deadsy/sdfx/vec/v2"
+	v3 "github.com/deadsy/sdfx/vec/v3"
+)
+
+//-----------------------------------------------------------------------------
+
+// morphologyCells is the minimum number of grid cells across the rounding radius
+// (unless the grid would have more than redistanceMaxPoints).
+const morphologyCells = 8
+
+// offsetGrid offsets the values of a redistanced grid.
+func offsetGrid(data []float64, r float64) {
+	for i := range data {
+		data[i] += r
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// morphologyGrid3 returns the grid (and its cell size) for the morphology of an SDF3.
+func morphologyGrid3(bb Box3, r float64) (*grid3, float64, error) {
+	if r < 0 {
+		// the dilated surface is outside the bounding box
+		bb = bb.Enlarge(v3.Vec{-2 * r, -2 * r, -2 * r})
+	}
+	size := bb.Size()
+	h := redistanceCellSize(math.Abs(r)/morphologyCells, size.X, size.Y, size.Z)
+	g, err := redistanceGrid3(bb, h)
+	return g, h, err
+}
+
+// morphology3 erodes an SDF3 by r, then dilates it by r (or the reverse for r < 0).
+func morphology3(sdf SDF3, r float64) (SDF3, error) {
+	g, h, err := morphologyGrid3(sdf.BoundingBox(), r)
+	if err != nil {
+		return nil, err
+	}
+	// redistance the whole grid, the result is a distance field everywhere
+	band := math.Inf(1)
+	sampleBand3(g, sdf, band)
+	// the sdf may be a bound, so redistance it before the first offset
+	if !redistance3(g, h, band) {
+		return nil, ErrMsg("sdf has no surface")
+	}
+	offsetGrid(g.data, r)
+	if !redistance3(g, h, band) {
+		return nil, ErrMsg("r is too large for the sdf")
+	}
+	offsetGrid(g.data, -r)
+	s := newRedistanceSDF3(g)
+	s.sdf, s.r = sdf, r
+	return s, nil
+}
+
+// RoundEdges3D returns an SDF3 with the outside edges rounded to radius r (a morphological opening).
+// Parts of the SDF3 thinner than 2r are removed.
+func RoundEdges3D(sdf SDF3, r float64) (SDF3, error) {
+	if r <= 0 {
+		return nil, ErrMsg("r <= 0")
+	}
+	return morphology3(sdf, r)
+}
+
+// FillCorners3D returns an SDF3 with the inside corners filled to radius r (a morphological closing).
+// Gaps in the SDF3 narrower than 2r are filled.
+func FillCorners3D(sdf SDF3, r float64) (SDF3, error) {
+	if r <= 0 {
+		return nil, ErrMsg("r <= 0")
+	}
+	return morphology3(sdf, -r)
+}
+
+//-----------------------------------------------------------------------------
+
+// morphologyGrid2 returns the grid (and its cell size) for the morphology of an SDF2.
+func morphologyGrid2(bb Box2, r float64) (*grid2, float64, error) {
+	if r < 0 {
+		// the dilated surface is outside the bounding box
+		bb = bb.Enlarge(v2.Vec{-2 * r, -2 * r})
+	}
+	size := bb.Size()
+	h := redistanceCellSize(math.Abs(r)/morphologyCells, size.X, size.Y)
+	g, err := redistanceGrid2(bb, h)
+	return g, h, err
+}
+
+// morphology2 erodes an SDF2 by r, then dilates it by r (or the reverse for r < 0).
+func morphology2(sdf SDF2, r float64) (SDF2, error) {
+	g, h, err := morphologyGrid2(sdf.BoundingBox(), r)
+	if err != nil {
+		return nil, err
+	}
+	// redistance the whole grid, the result is a distance field everywhere
+	band := math.Inf(1)
+	sampleBand2(g, sdf, band)
+	// the sdf may be a bound, so redistance it before the first offset
+	if !redistance2(g, h, band) {
+		return nil, ErrMsg("sdf has no surface")
+	}
+	offsetGrid(g.data, r)
+	if !redistance2(g, h, band) {
+		return nil, ErrMsg("r is too large for the sdf")
+	}
+	offsetGrid(g.data, -r)
+	s := newRedistanceSDF2(g)
+	s.sdf, s.r = sdf, r
+	return s, nil
+}
+
+// RoundEdges2D returns an SDF2 with the outside corners rounded to radius r (a morphological opening).
+// Parts of the SDF2 thinner than 2r are removed.
+func RoundEdges2D(sdf SDF2, r float64) (SDF2, error) {
+	if r <= 0 {
+		return nil, ErrMsg("r <= 0")
+	}
+	return morphology2(sdf, r)
+}
+
+// FillCorners2D returns an SDF2 with the inside corners filled to radius r (a morphological closing).
+// Gaps in the SDF2 narrower than 2r are filled.
+func FillCorners2D(sdf SDF2, r float64) (SDF2, error) {
+	if r <= 0 {
+		return nil, ErrMsg("r <= 0")
+	}
+	return morphology2(sdf, -r)
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,817 @@
+//-----------------------------------------------------------------------------
+/*
+
+CSG Tree Optimization
+
+Designs built up in loops tend to have deep trees of nested unions and
+transforms. Optimize3D/Optimize2D rewrite an SDF tree into an equivalent
+tree that is cheaper to evaluate:
+
+* Unions of unions and intersections of intersections are flattened.
+* Consecutive transforms are multiplied together.
+* Pure translation/uniform scaling transforms become a cheaper node.
+* Subtracted objects whose bounding boxes can't touch the object they are
+subtracted from are dropped.
+* Union members within another member are dropped.
+* Intersection members containing another member are dropped. If two members
+are disjoint the intersection is empty and only those two are kept.
+
+Only the default min/max functions are associative, so blended unions and
+intersections are left alone. The optimized field is the same as the original
+to within floating point error. Dropped objects leave a true distance field
+unchanged, otherwise the surface is the same.
+
+The original SDF tree is not modified.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"math"
+
+	v2 "github.com/deadsy/sdfx/vec/v2"
+	v3 "github.com/deadsy/sdfx/vec/v3"
+)
+
+//-----------------------------------------------------------------------------
+
+// optimizeTolerance is the tolerance used to classify transformation matrices.
+const optimizeTolerance = 1e-12
+
+// isMin returns true if a min function is the default (math.Min).
+func isMin(f MinFunc) bool {
+	return funcName(f) == "math.Min"
+}
+
+// isMax returns true if a max function is the default (math.Max).
+func isMax(f MaxFunc) bool {
+	return funcName(f) == "math.Max"
+}
+
+// isZero returns true if x is zero to within the optimization tolerance.
+func isZero(x float64) bool {
+	return math.Abs(x) <= optimizeTolerance
+}
+
+//-----------------------------------------------------------------------------
+
+// Optimize3D returns an SDF3 with the same distance field that is cheaper to evaluate.
+func Optimize3D(s SDF3) SDF3 {
+	if s == nil {
+		return nil
+	}
+	return optimize3(s)
+}
+
+func optimize3(sdf SDF3) SDF3 {
+	switch s := sdf.(type) {
+	case *TransformSDF3:
+		// multiply consecutive transforms
+		m := s.matrix
+		x := s.sdf
+		for {
+			t, ok := x.(*TransformSDF3)
+			if !ok {
+				break
+			}
+			m = m.Mul(t.matrix)
+			x = t.sdf
+		}
+		return transform3(optimize3(x), m)
+	case *ScaleUniformSDF3:
+		// multiply consecutive uniform scales
+		k := s.k
+		x := s.sdf
+		for {
+			t, ok := x.(*ScaleUniformSDF3)
+			if !ok {
+				break
+			}
+			k *= t.k
+			x = t.sdf
+		}
+		return ScaleUniform3D(optimize3(x), k)
+	case *UnionSDF3:
+		if !isMin(s.min) {
+			c := *s
+			c.sdf = make([]SDF3, len(s.sdf))
+			for i, x := range s.sdf {
+				c.sdf[i] = optimize3(x)
+			}
+			return &c
+		}
+		return Union3D(unionPrune3(unionList3(s.sdf))...)
+	case *BlendUnionSDF3:
+		c := *s
+		c.sdf = make([]SDF3, len(s.sdf))
+		for i, x := range s.sdf {
+			c.sdf[i] = optimize3(x)
+		}
+		return &c
+	case *BlendDifferenceSDF3:
+		c := *s
+		c.s0, c.s1 = optimize3(s.s0), optimize3(s.s1)
+		return &c
+	case *IntersectionSDF3:
+		s0 := optimize3(s.s0)
+		s1 := optimize3(s.s1)
+		if !isMax(s.max) {
+			c := *s
+			c.s0, c.s1 = s0, s1
+			return &c
+		}
+		return intersect3(append(intersectionList3(s0), intersectionList3(s1)...))
+	case *intersectionSDF3:
+		return s
+	case *DifferenceSDF3:
+		s0 := optimize3(s.s0)
+		s1 := optimize3(s.s1)
+		if isMax(s.max) {
+			s1 = difference3(s0.BoundingBox(), s1)
+			if s1 == nil {
+				return s0
+			}
+		}
+		c := *s
+		c.s0, c.s1 = s0, s1
+		return &c
+	case *SorSDF3:
+		c := *s
+		c.sdf = optimize2(s.sdf)
+		return &c
+	case *ExtrudeSDF3:
+		c := *s
+		c.sdf = optimize2(s.sdf)
+		return &c
+	case *ExtrudeRoundedSDF3:
+		c := *s
+		c.sdf = optimize2(s.sdf)
+		return &c
+	case *LoftSDF3:
+		c := *s
+		c.sdf0 = optimize2(s.sdf0)
+		c.sdf1 = optimize2(s.sdf1)
+		return &c
+	case *ScrewSDF3:
+		c := *s
+		c.thread = optimize2(s.thread)
+		return &c
+	case *ElongateSDF3:
+		c := *s
+		c.sdf = optimize3(s.sdf)
+		return &c
+	case *CutSDF3:
+		c := *s
+		c.sdf = optimize3(s.sdf)
+		return &c
+	case *ArraySDF3:
+		c := *s
+		c.sdf = optimize3(s.sdf)
+		return &c
+	case *RotateUnionSDF3:
+		c := *s
+		c.sdf = optimize3(s.sdf)
+		return &c
+	case *RotateCopySDF3:
+		c := *s
+		c.sdf = optimize3(s.sdf)
+		return &c
+	case *RepeatSDF3:
+		c := *s
+		c.sdf = optimize3(s.sdf)
+		return &c
+	case *RepeatPolarSDF3:
+		c := *s
+		c.sdf = optimize3(s.sdf)
+		return &c
+	case *MirrorSDF3:
+		c := *s
+		c.sdf = optimize3(s.sdf)
+		return &c
+	case *TwistSDF3:
+		c := *s
+		c.sdf = optimize3(s.sdf)
+		return &c
+	case *TaperSDF3:
+		c := *s
+		c.sdf = optimize3(s.sdf)
+		return &c
+	case *BendSDF3:
+		c := *s
+		c.sdf = optimize3(s.sdf)
+		return &c
+	case *FFDSDF3:
+		c := *s
+		c.sdf = optimize3(s.sdf)
+		return &c
+	case *DisplaceSDF3:
+		c := *s
+		c.sdf = optimize3(s.sdf)
+		return &c
+	case *DraftSDF3:
+		c := *s
+		c.sdf = optimize3(s.sdf)
+		return &c
+	case *OffsetSDF3:
+		c := *s
+		c.sdf = optimize3(s.sdf)
+		return &c
+	case *ShellSDF3:
+		c := *s
+		c.sdf = optimize3(s.sdf)
+		return &c
+	}
+	return sdf
+}
+
+// unionList3 returns the optimized members of a union with unions flattened into it.
+func unionList3(sdf []SDF3) []SDF3 {
+	list := make([]SDF3, 0, len(sdf))
+	for _, x := range sdf {
+		if x == nil {
+			continue
+		}
+		x = optimize3(x)
+		if u, ok := x.(*UnionSDF3); ok && isMin(u.min) {
+			list = append(list, u.sdf...)
+		} else {
+			list = append(list, x)
+		}
+	}
+	return list
+}
+
+// intersectionList3 returns the members of an optimized intersection.
+func intersectionList3(s SDF3) []SDF3 {
+	if x, ok := s.(*intersectionSDF3); ok {
+		return x.sdf
+	}
+	return []SDF3{s}
+}
+
+// difference3 drops the subtracted objects that are outside a bounding box.
+func difference3(bb Box3, s SDF3) SDF3 {
+	if u, ok := s.(*UnionSDF3); ok && isMin(u.min) {
+		list := make([]SDF3, 0, len(u.sdf))
+		for _, x := range u.sdf {
+			if bb.overlap(x.BoundingBox()) {
+				list = append(list, x)
+			}
+		}
+		if len(list) == len(u.sdf) {
+			return s
+		}
+		return Union3D(list...)
+	}
+	if !bb.overlap(s.BoundingBox()) {
+		return nil
+	}
+	return s
+}
+
+// transform3 returns the cheapest SDF3 for a transformed SDF3.
+func transform3(s SDF3, m M44) SDF3 {
+	// the transform must be a uniform scale and a translation
+	k := m[0]
+	if k == 0 ||
+		!isZero(m[5]-k) || !isZero(m[10]-k) ||
+		!isZero(m[1]) || !isZero(m[2]) || !isZero(m[4]) || !isZero(m[6]) || !isZero(m[8]) || !isZero(m[9]) ||
+		!isZero(m[12]) || !isZero(m[13]) || !isZero(m[14]) || !isZero(m[15]-1) {
+		return Transform3D(s, m)
+	}
+	v := v3.Vec{m[3], m[7], m[11]}
+	if isZero(k-1) && v == (v3.Vec{}) {
+		return s
+	}
+	return &translateSDF3{
+		sdf:    s,
+		v:      v,
+		invK:   1 / k,
+		matrix: m,
+		bb:     m.MulBox(s.BoundingBox()),
+	}
+}
+
+// prune3 drops the members of a list that are redundant given another member.
+// Members before x are compared with the pruned list, so of two members that
+// are redundant given each other one is kept.
+func prune3(sdf []SDF3, redundant func(x, y SDF3) bool) []SDF3 {
+	list := make([]SDF3, 0, len(sdf))
+	for i, x := range sdf {
+		drop := false
+		for _, y := range list {
+			if drop = redundant(x, y); drop {
+				break
+			}
+		}
+		if !drop {
+			for _, y := range sdf[i+1:] {
+				if drop = redundant(x, y); drop {
+					break
+				}
+			}
+		}
+		if !drop {
+			list = append(list, x)
+		}
+	}
+	return list
+}
+
+// unionPrune3 drops the members of a union that are within another member.
+func unionPrune3(sdf []SDF3) []SDF3 {
+	// x is within y if y is solid over the bounding box of x
+	within := func(x, y SDF3) bool {
+		bb, yb := x.BoundingBox(), y.BoundingBox()
+		return yb.Contains(bb.Min) && yb.Contains(bb.Max) && EvaluateInterval3(y, bb)[1] <= 0
+	}
+	return prune3(sdf, within)
+}
+
+// intersect3 returns the intersection of a list of SDF3s.
+// Members containing another member are dropped. If two members are
+// disjoint the intersection is empty and only those two are kept.
+func intersect3(sdf []SDF3) SDF3 {
+disjoint:
+	for i, x := range sdf {
+		for _, y := range sdf[i+1:] {
+			if !x.BoundingBox().overlap(y.BoundingBox()) {
+				sdf = []SDF3{x, y}
+				break disjoint
+			}
+		}
+	}
+	// x contains y if x is solid over the bounding box of y
+	contains := func(x, y SDF3) bool {
+		bb, xb := y.BoundingBox(), x.BoundingBox()
+		return xb.Contains(bb.Min) && xb.Contains(bb.Max) && EvaluateInterval3(x, bb)[1] <= 0
+	}
+	list := prune3(sdf, contains)
+	if len(list) == 1 {
+		return list[0]
+	}
+	bb := list[0].BoundingBox()
+	for _, x := range list[1:] {
+		bb = bb.intersect(x.BoundingBox())
+	}
+	return &intersectionSDF3{
+		sdf: list,
+		bb:  bb,
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// Optimize2D returns an SDF2 with the same distance field that is cheaper to evaluate.
+func Optimize2D(s SDF2) SDF2 {
+	if s == nil {
+		return nil
+	}
+	return optimize2(s)
+}
+
+func optimize2(sdf SDF2) SDF2 {
+	switch s := sdf.(type) {
+	case *TransformSDF2:
+		// multiply consecutive transforms
+		m := s.matrix
+		x := s.sdf
+		for {
+			t, ok := x.(*TransformSDF2)
+			if !ok {
+				break
+			}
+			m = m.Mul(t.matrix)
+			x = t.sdf
+		}
+		return transform2(optimize2(x), m)
+	case *ScaleUniformSDF2:
+		// multiply consecutive uniform scales
+		k := s.k
+		x := s.sdf
+		for {
+			t, ok := x.(*ScaleUniformSDF2)
+			if !ok {
+				break
+			}
+			k *= t.k
+			x = t.sdf
+		}
+		return ScaleUniform2D(optimize2(x), k)
+	case *UnionSDF2:
+		if !isMin(s.min) {
+			c := *s
+			c.sdf = make([]SDF2, len(s.sdf))
+			for i, x := range s.sdf {
+				c.sdf[i] = optimize2(x)
+			}
+			return &c
+		}
+		return Union2D(unionPrune2(unionList2(s.sdf))...)
+	case *IntersectionSDF2:
+		s0 := optimize2(s.s0)
+		s1 := optimize2(s.s1)
+		if !isMax(s.max) {
+			c := *s
+			c.s0, c.s1 = s0, s1
+			return &c
+		}
+		return intersect2(append(intersectionList2(s0), intersectionList2(s1)...))
+	case *intersectionSDF2:
+		return s
+	case *DifferenceSDF2:
+		s0 := optimize2(s.s0)
+		s1 := optimize2(s.s1)
+		if isMax(s.max) {
+			s1 = difference2(s0.BoundingBox(), s1)
+			if s1 == nil {
+				return s0
+			}
+		}
+		c := *s
+		c.s0, c.s1 = s0, s1
+		return &c
+	case *OffsetSDF2:
+		c := *s
+		c.sdf = optimize2(s.sdf)
+		return &c
+	case *CutSDF2:
+		c := *s
+		c.sdf = optimize2(s.sdf)
+		return &c
+	case *ArraySDF2:
+		c := *s
+		c.sdf = optimize2(s.sdf)
+		return &c
+	case *RotateUnionSDF2:
+		c := *s
+		c.sdf = optimize2(s.sdf)
+		return &c
+	case *RotateCopySDF2:
+		c := *s
+		c.sdf = optimize2(s.sdf)
+		return &c
+	case *RepeatSDF2:
+		c := *s
+		c.sdf = optimize2(s.sdf)
+		return &c
+	case *RepeatPolarSDF2:
+		c := *s
+		c.sdf = optimize2(s.sdf)
+		return &c
+	case *MirrorSDF2:
+		c := *s
+		c.sdf = optimize2(s.sdf)
+		return &c
+	case *SliceSDF2:
+		c := *s
+		c.sdf = optimize3(s.sdf)
+		return &c
+	case *ElongateSDF2:
+		c := *s
+		c.sdf = optimize2(s.sdf)
+		return &c
+	}
+	return sdf
+}
+
+// unionList2 returns the optimized members of a union with unions flattened into it.
+func unionList2(sdf []SDF2) []SDF2 {
+	list := make([]SDF2, 0, len(sdf))
+	for _, x := range sdf {
+		if x == nil {
+			continue
+		}
+		x = optimize2(x)
+		if u, ok := x.(*UnionSDF2); ok && isMin(u.min) {
+			list = append(list, u.sdf...)
+		} else {
+			list = append(list, x)
+		}
+	}
+	return list
+}
+
+// intersectionList2 returns the members of an optimized intersection.
+func intersectionList2(s SDF2) []SDF2 {
+	if x, ok := s.(*intersectionSDF2); ok {
+		return x.sdf
+	}
+	return []SDF2{s}
+}
+
+// difference2 drops the subtracted objects that are outside a bounding box.
+func difference2(bb Box2, s SDF2) SDF2 {
+	if u, ok := s.(*UnionSDF2); ok && isMin(u.min) {
+		list := make([]SDF2, 0, len(u.sdf))
+		for _, x := range u.sdf {
+			if bb.overlap(x.BoundingBox()) {
+				list = append(list, x)
+			}
+		}
+		if len(list) == len(u.sdf) {
+			return s
+		}
+		return Union2D(list...)
+	}
+	if !bb.overlap(s.BoundingBox()) {
+		return nil
+	}
+	return s
+}
+
+// transform2 returns the cheapest SDF2 for a transformed SDF2.
+func transform2(s SDF2, m M33) SDF2 {
+	// the transform must be a uniform scale and a translation
+	k := m[0]
+	if k == 0 ||
+		!isZero(m[4]-k) || !isZero(m[1]) || !isZero(m[3]) ||
+		!isZero(m[6]) || !isZero(m[7]) || !isZero(m[8]-1) {
+		return Transform2D(s, m)
+	}
+	v := v2.Vec{m[2], m[5]}
+	if isZero(k-1) && v == (v2.Vec{}) {
+		return s
+	}
+	return &translateSDF2{
+		sdf:    s,
+		v:      v,
+		invK:   1 / k,
+		matrix: m,
+		bb:     m.MulBox(s.BoundingBox()),
+	}
+}
+
+// prune2 drops the members of a list that are redundant given another member.
+// Members before x are compared with the pruned list, so of two members that
+// are redundant given each other one is kept.
+func prune2(sdf []SDF2, redundant func(x, y SDF2) bool) []SDF2 {
+	list := make([]SDF2, 0, len(sdf))
+	for i, x := range sdf {
+		drop := false
+		for _, y := range list {
+			if drop = redundant(x, y); drop {
+				break
+			}
+		}
+		if !drop {
+			for _, y := range sdf[i+1:] {
+				if drop = redundant(x, y); drop {
+					break
+				}
+			}
+		}
+		if !drop {
+			list = append(list, x)
+		}
+	}
+	return list
+}
+
+// unionPrune2 drops the members of a union that are within another member.
+func unionPrune2(sdf []SDF2) []SDF2 {
+	// x is within y if y is solid over the bounding box of x
+	within := func(x, y SDF2) bool {
+		bb, yb := x.BoundingBox(), y.BoundingBox()
+		return yb.Contains(bb.Min) && yb.Contains(bb.Max) && EvaluateInterval2(y, bb)[1] <= 0
+	}
+	return prune2(sdf, within)
+}
+
+// intersect2 returns the intersection of a list of SDF2s.
+// Members containing another member are dropped. If two members are
+// disjoint the intersection is empty and only those two are kept.
+func intersect2(sdf []SDF2) SDF2 {
+disjoint:
+	for i, x := range sdf {
+		for _, y := range sdf[i+1:] {
+			if !x.BoundingBox().overlap(y.BoundingBox()) {
+				sdf = []SDF2{x, y}
+				break disjoint
+			}
+		}
+	}
+	// x contains y if x is solid over the bounding box of y
+	contains := func(x, y SDF2) bool {
+		bb, xb := y.BoundingBox(), x.BoundingBox()
+		return xb.Contains(bb.Min) && xb.Contains(bb.Max) && EvaluateInterval2(x, bb)[1] <= 0
+	}
+	list := prune2(sdf, contains)
+	if len(list) == 1 {
+		return list[0]
+	}
+	bb := list[0].BoundingBox()
+	for _, x := range list[1:] {
+		bb = bb.intersect(x.BoundingBox())
+	}
+	return &intersectionSDF2{
+		sdf: list,
+		bb:  bb,
+	}
+}
+
+//-----------------------------------------------------------------------------
+// Optimized SDF3 nodes
+
+// translateSDF3 is an SDF3 with a translation and uniform scaling transform.
+// As with TransformSDF3 distance is *not* preserved with scaling.
+type translateSDF3 struct {
+	sdf    SDF3
+	v      v3.Vec
+	invK   float64
+	matrix M44 // the equivalent transformation matrix
+	bb     Box3
+}
+
+// Evaluate returns the minimum distance to a translated SDF3.
+func (s *translateSDF3) Evaluate(p v3.Vec) float64 {
+	return s.sdf.Evaluate(p.Sub(s.v).MulScalar(s.invK))
+}
+
+// EvaluateInterval returns an interval containing the values of a translated SDF3 within a box.
+func (s *translateSDF3) EvaluateInterval(b Box3) Interval {
+	m := Scale3d(v3.Vec{s.invK, s.invK, s.invK}).Mul(Translate3d(s.v.Neg()))
+	return EvaluateInterval3(s.sdf, m.MulBox(b))
+}
+
+// Gradient returns the gradient of a translated SDF3.
+func (s *translateSDF3) Gradient(p v3.Vec, eps float64) v3.Vec {
+	return Gradient3(s.sdf, p.Sub(s.v).MulScalar(s.invK), eps).MulScalar(s.invK)
+}
+
+// EvaluateBatch evaluates a translated SDF3 at a slice of points.
+func (s *translateSDF3) EvaluateBatch(ps []v3.Vec, out []float64) {
+	b := getBatch3(len(ps))
+	defer putBatch3(b)
+	q := *b
+	for i, p := range ps {
+		q[i] = p.Sub(s.v).MulScalar(s.invK)
+	}
+	EvaluateBatch3(s.sdf, q, out)
+}
+
+// BoundingBox returns the bounding box of a translated SDF3.
+func (s *translateSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+// intersectionSDF3 is the intersection of a list of SDF3s.
+type intersectionSDF3 struct {
+	sdf []SDF3
+	bb  Box3
+}
+
+// Evaluate returns the minimum distance to an SDF3 intersection.
+func (s *intersectionSDF3) Evaluate(p v3.Vec) float64 {
+	d := s.sdf[0].Evaluate(p)
+	for _, x := range s.sdf[1:] {
+		d = math.Max(d, x.Evaluate(p))
+	}
+	return d
+}
+
+// EvaluateInterval returns an interval containing the values of an SDF3 intersection within a box.
+func (s *intersectionSDF3) EvaluateInterval(b Box3) Interval {
+	d := EvaluateInterval3(s.sdf[0], b)
+	for _, x := range s.sdf[1:] {
+		d = maxInterval(math.Max, d, EvaluateInterval3(x, b))
+	}
+	return d
+}
+
+// Gradient returns the gradient of an SDF3 intersection.
+func (s *intersectionSDF3) Gradient(p v3.Vec, eps float64) v3.Vec {
+	j := 0
+	d := s.sdf[0].Evaluate(p)
+	for i, x := range s.sdf[1:] {
+		if dx := x.Evaluate(p); dx > d {
+			d = dx
+			j = i + 1
+		}
+	}
+	return Gradient3(s.sdf[j], p, eps)
+}
+
+// EvaluateBatch evaluates an SDF3 intersection at a slice of points.
+func (s *intersectionSDF3) EvaluateBatch(ps []v3.Vec, out []float64) {
+	EvaluateBatch3(s.sdf[0], ps, out)
+	b := getBatch1(len(ps))
+	defer putBatch1(b)
+	d := *b
+	for _, x := range s.sdf[1:] {
+		EvaluateBatch3(x, ps, d)
+		for j := range ps {
+			out[j] = math.Max(out[j], d[j])
+		}
+	}
+}
+
+// BoundingBox returns the bounding box of an SDF3 intersection.
+func (s *intersectionSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
+// Optimized SDF2 nodes
+
+// translateSDF2 is an SDF2 with a translation and uniform scaling transform.
+// As with TransformSDF2 distance is *not* preserved with scaling.
+type translateSDF2 struct {
+	sdf    SDF2
+	v      v2.Vec
+	invK   float64
+	matrix M33 // the equivalent transformation matrix
+	bb     Box2
+}
+
+// Evaluate returns the minimum distance to a translated SDF2.
+func (s *translateSDF2) Evaluate(p v2.Vec) float64 {
+	return s.sdf.Evaluate(p.Sub(s.v).MulScalar(s.invK))
+}
+
+// EvaluateInterval returns an interval containing the values of a translated SDF2 within a box.
+func (s *translateSDF2) EvaluateInterval(b Box2) Interval {
+	m := Scale2d(v2.Vec{s.invK, s.invK}).Mul(Translate2d(s.v.Neg()))
+	return EvaluateInterval2(s.sdf, m.MulBox(b))
+}
+
+// Gradient returns the gradient of a translated SDF2.
+func (s *translateSDF2) Gradient(p v2.Vec, eps float64) v2.Vec {
+	return Gradient2(s.sdf, p.Sub(s.v).MulScalar(s.invK), eps).MulScalar(s.invK)
+}
+
+// EvaluateBatch evaluates a translated SDF2 at a slice of points.
+func (s *translateSDF2) EvaluateBatch(ps []v2.Vec, out []float64) {
+	b := getBatch2(len(ps))
+	defer putBatch2(b)
+	q := *b
+	for i, p := range ps {
+		q[i] = p.Sub(s.v).MulScalar(s.invK)
+	}
+	EvaluateBatch2(s.sdf, q, out)
+}
+
+// BoundingBox returns the bounding box of a translated SDF2.
+func (s *translateSDF2) BoundingBox() Box2 {
+	return s.bb
+}
+
+// intersectionSDF2 is the intersection of a list of SDF2s.
+type intersectionSDF2 struct {
+	sdf []SDF2
+	bb  Box2
+}
+
+// Evaluate returns the minimum distance to an SDF2 intersection.
+func (s *intersectionSDF2) Evaluate(p v2.Vec) float64 {
+	d := s.sdf[0].Evaluate(p)
+	for _, x := range s.sdf[1:] {
+		d = math.Max(d, x.Evaluate(p))
+	}
+	return d
+}
+
+// EvaluateInterval returns an interval containing the values of an SDF2 intersection within a box.
+func (s *intersectionSDF2) EvaluateInterval(b Box2) Interval {
+	d := EvaluateInterval2(s.sdf[0], b)
+	for _, x := range s.sdf[1:] {
+		d = maxInterval(math.Max, d, EvaluateInterval2(x, b))
+	}
+	return d
+}
+
+// Gradient returns the gradient of an SDF2 intersection.
+func (s *intersectionSDF2) Gradient(p v2.Vec, eps float64) v2.Vec {
+	j := 0
+	d := s.sdf[0].Evaluate(p)
+	for i, x := range s.sdf[1:] {
+		if dx := x.Evaluate(p); dx > d {
+			d = dx
+			j = i + 1
+		}
+	}
+	return Gradient2(s.sdf[j], p, eps)
+}
+
+// EvaluateBatch evaluates an SDF2 intersection at a slice of points.
+func (s *intersectionSDF2) EvaluateBatch(ps []v2.Vec, out []float64) {
+	EvaluateBatch2(s.sdf[0], ps, out)
+	b := getBatch1(len(ps))
+	defer putBatch1(b)
+	d := *b
+	for _, x := range s.sdf[1:] {
+		EvaluateBatch2(x, ps, d)
+		for j := range ps {
+			out[j] = math.Max(out[j], d[j])
+		}
+	}
+}
+
+// BoundingBox returns the bounding box of an SDF2 intersection.
+func (s *intersectionSDF2) BoundingBox() Box2 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
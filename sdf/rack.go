@@ -104,6 +104,12 @@ func (s *GearRackSDF2) Evaluate(p v2.Vec) float64 {
 	return math.Max(d0, d1)
 }
 
+// EvaluateInterval returns an interval containing the values of the gear rack within a box.
+// The tooth profile is folded by a 1-lipschitz mapping, so the gear rack is 1-lipschitz.
+func (s *GearRackSDF2) EvaluateInterval(b Box2) Interval {
+	return exactInterval2(s, b)
+}
+
 // BoundingBox returns the bounding box for the gear rack.
 func (s *GearRackSDF2) BoundingBox() Box2 {
 	return s.bb
@@ -0,0 +1,613 @@
+//-----------------------------------------------------------------------------
+/*
+
+Redistancing
+
+Many SDFs return a bound on the distance rather than the true distance.
+E.g. twisted/scaled extrusions, screws, gyroids and some min/max blends.
+Offsets and shells of these SDFs are distorted and ray marching can overshoot.
+
+Redistancing samples an SDF on a grid and rebuilds the distance field within
+a narrow band around the surface:
+
+0) Blocks of grid points that interval evaluation places outside the band
+aren't sampled.
+
+1) Grid points next to a sign change get their distance from the crossing
+points found by linear interpolation of the sampled values along each axis.
+
+2) The closest surface points of these grid points (a step along the gradient)
+are propagated across the band with the fast sweeping method. Each grid point
+takes the closest of the surface points held by its neighbours, so the
+distances stay accurate near corners and edges. Grid points outside the band
+are set to +/- the band width, a lower bound on their distance.
+
+3) The signed distances are interpolated between the grid points.
+
+The surface is only as good as the grid, so features smaller than a cell may
+be lost.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"math"
+	"runtime"
+	"sync"
+
+	v2 "github.com/deadsy/sdfx/vec/v2"
+	"github.com/deadsy/sdfx/vec/v2i"
+	v3 "github.com/deadsy/sdfx/vec/v3"
+	"github.com/deadsy/sdfx/vec/v3i"
+)
+
+//-----------------------------------------------------------------------------
+
+// redistanceMargin is the number of grid cells added around the bounding box.
+const redistanceMargin = 4
+
+// redistanceMaxPoints is the maximum number of grid points.
+const redistanceMaxPoints = 1 << 24
+
+// redistanceBand is the default narrow band width in grid cells (see Redistance3D).
+const redistanceBand = 8
+
+// redistanceBlock is the number of grid points on each axis of a block that
+// isn't sampled if it's outside the narrow band.
+const redistanceBlock = 8
+
+// redistanceSnap is the largest value (relative to the value at the grid point) at
+// a gradient step from a grid point that is accepted as a surface point.
+const redistanceSnap = 0.1
+
+// redistanceCells returns the number of grid cells needed to cover a distance.
+func redistanceCells(size, cellSize float64) int {
+	return int(math.Ceil(size/cellSize)) + 2*redistanceMargin
+}
+
+// redistanceCellSize returns the smallest cell size (>= h) for which the grid that covers
+// a bounding box with the given size has at most redistanceMaxPoints.
+func redistanceCellSize(h float64, size ...float64) float64 {
+	fits := func(h float64) bool {
+		n := 1.0
+		for _, x := range size {
+			n *= float64(redistanceCells(x, h) + 1)
+		}
+		return n <= redistanceMaxPoints
+	}
+	if fits(h) {
+		return h
+	}
+	// the margin is a fixed number of cells, so bisect for the cell size
+	lo, hi := h, h
+	for !fits(hi) {
+		lo, hi = hi, 2*hi
+	}
+	for i := 0; i < 64 && hi-lo > hi*1e-9; i++ {
+		mid := 0.5 * (lo + hi)
+		if fits(mid) {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+	return hi
+}
+
+//-----------------------------------------------------------------------------
+// Fast Sweeping
+
+// crossingDistance returns the distance along a grid axis from a grid point with value
+// d0 to the surface crossing between it and a neighbouring grid point with value d1.
+func crossingDistance(d0, d1, h float64) float64 {
+	if d0 == 0 {
+		return 0
+	}
+	if (d0 < 0) == (d1 < 0) {
+		return math.Inf(1)
+	}
+	return h * d0 / (d0 - d1)
+}
+
+// surfaceDistance returns the distance to the surface from the crossing distances along each axis.
+func surfaceDistance(d []float64) float64 {
+	k := 0.0
+	for _, x := range d {
+		if x == 0 {
+			return 0
+		}
+		k += 1 / (x * x)
+	}
+	if k == 0 {
+		return math.Inf(1)
+	}
+	return 1 / math.Sqrt(k)
+}
+
+// axisGradient returns the gradient of the grid values along an axis at grid point k.
+func axisGradient(f []float64, k, j, m, di int, h float64) float64 {
+	switch {
+	case j > 0 && j < m-1:
+		return (f[k+di] - f[k-di]) / (2 * h)
+	case j > 0:
+		return (f[k] - f[k-di]) / h
+	case j < m-1:
+		return (f[k+di] - f[k]) / h
+	}
+	return 0
+}
+
+// sweepOrder returns the start, end and step for a sweep along an axis with n grid points.
+func sweepOrder(n int, reverse bool) (int, int, int) {
+	if reverse {
+		return n - 1, -1, -1
+	}
+	return 0, n, 1
+}
+
+// redistance3 rebuilds the distance field within a narrow band on a 3d grid with cell size h.
+// It returns false if the grid has no surface.
+func redistance3(g *grid3, h, band float64) bool {
+	n := g.n
+	dx, dy, dz := 1, n.X, n.X*n.Y
+	f := g.data
+	u := make([]float64, len(f))
+	cp := make([]v3.Vec, len(f))
+	fixed := make([]bool, len(f))
+	axes := [3]v3.Vec{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}
+	// distances and closest surface points at the grid points next to the surface
+	for z := 0; z < n.Z; z++ {
+		for y := 0; y < n.Y; y++ {
+			for x := 0; x < n.X; x++ {
+				k := g.index(x, y, z)
+				p := g.point(x, y, z)
+				var d [3]float64
+				crossing := p
+				dmin := math.Inf(1)
+				for i, axis := range [3]struct{ j, m, di int }{{x, n.X, dx}, {y, n.Y, dy}, {z, n.Z, dz}} {
+					d[i] = math.Inf(1)
+					for _, dir := range [2]int{-1, 1} {
+						if (dir < 0 && axis.j == 0) || (dir > 0 && axis.j == axis.m-1) {
+							continue
+						}
+						if c := crossingDistance(f[k], f[k+dir*axis.di], h); c < d[i] {
+							d[i] = c
+							if c < dmin {
+								dmin = c
+								crossing = p.Add(axes[i].MulScalar(float64(dir) * c))
+							}
+						}
+					}
+				}
+				u[k] = surfaceDistance(d[:])
+				fixed[k] = !math.IsInf(u[k], 1)
+				if fixed[k] {
+					// Step to the surface along the gradient. Near edges and corners
+					// this misses the surface, so use the closest axis crossing.
+					grad := v3.Vec{
+						axisGradient(f, k, x, n.X, dx, h),
+						axisGradient(f, k, y, n.Y, dy, h),
+						axisGradient(f, k, z, n.Z, dz, h),
+					}
+					cp[k] = crossing
+					if l := grad.Length(); l > 0 {
+						q := p.Sub(grad.MulScalar(math.Copysign(u[k], f[k]) / l))
+						if math.Abs(g.trilinear(q)) <= redistanceSnap*math.Abs(f[k]) {
+							cp[k] = q
+						}
+					}
+				}
+			}
+		}
+	}
+	// propagate the closest surface points with alternating sweep directions until they don't change
+	for changed := true; changed; {
+		changed = false
+		for dir := 0; dir < 8; dir++ {
+			x0, x1, sx := sweepOrder(n.X, dir&1 != 0)
+			y0, y1, sy := sweepOrder(n.Y, dir&2 != 0)
+			z0, z1, sz := sweepOrder(n.Z, dir&4 != 0)
+			for z := z0; z != z1; z += sz {
+				for y := y0; y != y1; y += sy {
+					for x := x0; x != x1; x += sx {
+						k := g.index(x, y, z)
+						if fixed[k] {
+							continue
+						}
+						p := g.point(x, y, z)
+						for _, axis := range [3]struct{ j, m, di int }{{x, n.X, dx}, {y, n.Y, dy}, {z, n.Z, dz}} {
+							for _, i := range [2]int{k - axis.di, k + axis.di} {
+								if (i < k && axis.j == 0) || (i > k && axis.j == axis.m-1) || math.IsInf(u[i], 1) {
+									continue
+								}
+								if d := p.Sub(cp[i]).Length(); d < u[k] && d < band {
+									u[k] = d
+									cp[k] = cp[i]
+									changed = true
+								}
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	// restore the sign
+	surface := false
+	for k := range f {
+		f[k] = math.Copysign(math.Min(u[k], band), f[k])
+		surface = surface || fixed[k]
+	}
+	return surface
+}
+
+// redistance2 rebuilds the distance field within a narrow band on a 2d grid with cell size h.
+// It returns false if the grid has no surface.
+func redistance2(g *grid2, h, band float64) bool {
+	n := g.n
+	dx, dy := 1, n.X
+	f := g.data
+	u := make([]float64, len(f))
+	cp := make([]v2.Vec, len(f))
+	fixed := make([]bool, len(f))
+	axes := [2]v2.Vec{{1, 0}, {0, 1}}
+	// distances and closest surface points at the grid points next to the surface
+	for y := 0; y < n.Y; y++ {
+		for x := 0; x < n.X; x++ {
+			k := g.index(x, y)
+			p := g.point(x, y)
+			var d [2]float64
+			crossing := p
+			dmin := math.Inf(1)
+			for i, axis := range [2]struct{ j, m, di int }{{x, n.X, dx}, {y, n.Y, dy}} {
+				d[i] = math.Inf(1)
+				for _, dir := range [2]int{-1, 1} {
+					if (dir < 0 && axis.j == 0) || (dir > 0 && axis.j == axis.m-1) {
+						continue
+					}
+					if c := crossingDistance(f[k], f[k+dir*axis.di], h); c < d[i] {
+						d[i] = c
+						if c < dmin {
+							dmin = c
+							crossing = p.Add(axes[i].MulScalar(float64(dir) * c))
+						}
+					}
+				}
+			}
+			u[k] = surfaceDistance(d[:])
+			fixed[k] = !math.IsInf(u[k], 1)
+			if fixed[k] {
+				// Step to the surface along the gradient. Near corners
+				// this misses the surface, so use the closest axis crossing.
+				grad := v2.Vec{
+					axisGradient(f, k, x, n.X, dx, h),
+					axisGradient(f, k, y, n.Y, dy, h),
+				}
+				cp[k] = crossing
+				if l := grad.Length(); l > 0 {
+					q := p.Sub(grad.MulScalar(math.Copysign(u[k], f[k]) / l))
+					if math.Abs(g.bilinear(q)) <= redistanceSnap*math.Abs(f[k]) {
+						cp[k] = q
+					}
+				}
+			}
+		}
+	}
+	// propagate the closest surface points with alternating sweep directions until they don't change
+	for changed := true; changed; {
+		changed = false
+		for dir := 0; dir < 4; dir++ {
+			x0, x1, sx := sweepOrder(n.X, dir&1 != 0)
+			y0, y1, sy := sweepOrder(n.Y, dir&2 != 0)
+			for y := y0; y != y1; y += sy {
+				for x := x0; x != x1; x += sx {
+					k := g.index(x, y)
+					if fixed[k] {
+						continue
+					}
+					p := g.point(x, y)
+					for _, axis := range [2]struct{ j, m, di int }{{x, n.X, dx}, {y, n.Y, dy}} {
+						for _, i := range [2]int{k - axis.di, k + axis.di} {
+							if (i < k && axis.j == 0) || (i > k && axis.j == axis.m-1) || math.IsInf(u[i], 1) {
+								continue
+							}
+							if d := p.Sub(cp[i]).Length(); d < u[k] && d < band {
+								u[k] = d
+								cp[k] = cp[i]
+								changed = true
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	// restore the sign
+	surface := false
+	for k := range f {
+		f[k] = math.Copysign(math.Min(u[k], band), f[k])
+		surface = surface || fixed[k]
+	}
+	return surface
+}
+
+//-----------------------------------------------------------------------------
+
+// sampleBand3 sets the grid values to the values of an SDF3 near the surface.
+// Blocks of grid points outside the narrow band are set to +/- band.
+// The blocks are evaluated in parallel.
+func sampleBand3(g *grid3, s SDF3, band float64) {
+	var wg sync.WaitGroup
+	blocks := make(chan v3i.Vec)
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ps := make([]v3.Vec, redistanceBlock)
+			for i0 := range blocks {
+				i1 := v3i.Vec{
+					minInt(i0.X+redistanceBlock, g.n.X),
+					minInt(i0.Y+redistanceBlock, g.n.Y),
+					minInt(i0.Z+redistanceBlock, g.n.Z),
+				}
+				iv := EvaluateInterval3(s, Box3{g.point(i0.X, i0.Y, i0.Z), g.point(i1.X-1, i1.Y-1, i1.Z-1)})
+				for z := i0.Z; z < i1.Z; z++ {
+					for y := i0.Y; y < i1.Y; y++ {
+						k := g.index(i0.X, y, z)
+						out := g.data[k : k+i1.X-i0.X]
+						if iv[0] >= band || iv[1] <= -band {
+							for x := range out {
+								out[x] = math.Copysign(band, iv[0])
+							}
+							continue
+						}
+						for x := range out {
+							ps[x] = g.point(i0.X+x, y, z)
+						}
+						EvaluateBatch3(s, ps[:len(out)], out)
+					}
+				}
+			}
+		}()
+	}
+	var i0 v3i.Vec
+	for i0.Z = 0; i0.Z < g.n.Z; i0.Z += redistanceBlock {
+		for i0.Y = 0; i0.Y < g.n.Y; i0.Y += redistanceBlock {
+			for i0.X = 0; i0.X < g.n.X; i0.X += redistanceBlock {
+				blocks <- i0
+			}
+		}
+	}
+	close(blocks)
+	wg.Wait()
+}
+
+// sampleBand2 sets the grid values to the values of an SDF2 near the surface.
+// Blocks of grid points outside the narrow band are set to +/- band.
+func sampleBand2(g *grid2, s SDF2, band float64) {
+	ps := make([]v2.Vec, redistanceBlock)
+	for y0 := 0; y0 < g.n.Y; y0 += redistanceBlock {
+		y1 := minInt(y0+redistanceBlock, g.n.Y)
+		for x0 := 0; x0 < g.n.X; x0 += redistanceBlock {
+			x1 := minInt(x0+redistanceBlock, g.n.X)
+			iv := EvaluateInterval2(s, Box2{g.point(x0, y0), g.point(x1-1, y1-1)})
+			for y := y0; y < y1; y++ {
+				k := g.index(x0, y)
+				out := g.data[k : k+x1-x0]
+				if iv[0] >= band || iv[1] <= -band {
+					for x := range out {
+						out[x] = math.Copysign(band, iv[0])
+					}
+					continue
+				}
+				for x := range out {
+					ps[x] = g.point(x0+x, y)
+				}
+				EvaluateBatch2(s, ps[:len(out)], out)
+			}
+		}
+	}
+}
+
+// redistanceGrid3 returns a grid with the given cell size that covers a bounding box.
+func redistanceGrid3(bb Box3, cellSize float64) (*grid3, error) {
+	size := bb.Size()
+	cells := v3i.Vec{
+		redistanceCells(size.X, cellSize),
+		redistanceCells(size.Y, cellSize),
+		redistanceCells(size.Z, cellSize),
+	}
+	n := cells.AddScalar(1)
+	if float64(n.X)*float64(n.Y)*float64(n.Z) > redistanceMaxPoints {
+		return nil, ErrMsg("cellSize is too small")
+	}
+	// center the grid on the bounding box
+	size = v3.Vec{float64(cells.X), float64(cells.Y), float64(cells.Z)}.MulScalar(cellSize)
+	return newGrid3(NewBox3(bb.Center(), size), n), nil
+}
+
+// redistanceGrid2 returns a grid with the given cell size that covers a bounding box.
+func redistanceGrid2(bb Box2, cellSize float64) (*grid2, error) {
+	size := bb.Size()
+	cells := v2i.Vec{
+		redistanceCells(size.X, cellSize),
+		redistanceCells(size.Y, cellSize),
+	}
+	n := cells.AddScalar(1)
+	if float64(n.X)*float64(n.Y) > redistanceMaxPoints {
+		return nil, ErrMsg("cellSize is too small")
+	}
+	// center the grid on the bounding box
+	size = v2.Vec{float64(cells.X), float64(cells.Y)}.MulScalar(cellSize)
+	return newGrid2(NewBox2(bb.Center(), size), n), nil
+}
+
+// RedistanceSDF3 is an SDF3 rebuilt as a true distance field on a grid.
+type RedistanceSDF3 struct {
+	grid *grid3
+	k    float64 // lipschitz constant
+	// how the grid was made (for serialization)
+	sdf      SDF3
+	cellSize float64
+	band     float64
+	r        float64 // morphology radius (0 for redistancing)
+}
+
+// newRedistanceSDF3 returns a RedistanceSDF3 for a redistanced grid.
+func newRedistanceSDF3(g *grid3) *RedistanceSDF3 {
+	// outside the grid the lipschitz constant is >= 1
+	return &RedistanceSDF3{grid: g, k: math.Max(g.slope().Length(), 1)}
+}
+
+// Redistance3D returns an SDF3 with the true distance to the surface of an SDF3 within a narrow band.
+// The SDF3 is sampled on a grid with the given cell size that covers its bounding box.
+// The narrow band is 8 cells wide, use Redistance3DBand for a wider band.
+func Redistance3D(sdf SDF3, cellSize float64) (SDF3, error) {
+	return Redistance3DBand(sdf, cellSize, redistanceBand*cellSize)
+}
+
+// Redistance3DBand returns an SDF3 with the true distance to the surface of an SDF3 within a narrow band.
+// The SDF3 is sampled on a grid with the given cell size that covers its bounding box.
+// Further than band from the surface the distance is +/- band (a lower bound), so
+// the band should be at least as wide as any offset of the redistanced SDF3.
+func Redistance3DBand(sdf SDF3, cellSize, band float64) (SDF3, error) {
+	if cellSize <= 0 {
+		return nil, ErrMsg("cellSize <= 0")
+	}
+	if band <= 0 {
+		return nil, ErrMsg("band <= 0")
+	}
+	g, err := redistanceGrid3(sdf.BoundingBox(), cellSize)
+	if err != nil {
+		return nil, err
+	}
+	sampleBand3(g, sdf, band)
+	redistance3(g, cellSize, band)
+	s := newRedistanceSDF3(g)
+	s.sdf, s.cellSize, s.band = sdf, cellSize, band
+	return s, nil
+}
+
+// Evaluate returns the minimum distance to a RedistanceSDF3.
+func (s *RedistanceSDF3) Evaluate(p v3.Vec) float64 {
+	q := p.Clamp(s.grid.bb.Min, s.grid.bb.Max)
+	d := s.grid.trilinear(q)
+	if q == p {
+		return d
+	}
+	// Outside the grid: the closest surface point is inside the grid so this is a lower bound.
+	return math.Sqrt(d*d + p.Sub(q).Length2())
+}
+
+// EvaluateBatch evaluates a RedistanceSDF3 at each point of ps.
+func (s *RedistanceSDF3) EvaluateBatch(ps []v3.Vec, out []float64) {
+	for i, p := range ps {
+		out[i] = s.Evaluate(p)
+	}
+}
+
+// Gradient returns the gradient of a RedistanceSDF3.
+func (s *RedistanceSDF3) Gradient(p v3.Vec, eps float64) v3.Vec {
+	if !s.grid.bb.Contains(p) {
+		return centralGradient3(s, p, eps)
+	}
+	return s.grid.trilinearGradient(p)
+}
+
+// EvaluateInterval returns an interval containing the values of a RedistanceSDF3 within a box.
+func (s *RedistanceSDF3) EvaluateInterval(b Box3) Interval {
+	return lipschitzInterval3(s, b, s.k)
+}
+
+// BoundingBox returns the bounding box of a RedistanceSDF3.
+func (s *RedistanceSDF3) BoundingBox() Box3 {
+	return s.grid.bb
+}
+
+//-----------------------------------------------------------------------------
+
+// RedistanceSDF2 is an SDF2 rebuilt as a true distance field on a grid.
+type RedistanceSDF2 struct {
+	grid *grid2
+	k    float64 // lipschitz constant
+	// how the grid was made (for serialization)
+	sdf      SDF2
+	cellSize float64
+	band     float64
+	r        float64 // morphology radius (0 for redistancing)
+}
+
+// newRedistanceSDF2 returns a RedistanceSDF2 for a redistanced grid.
+func newRedistanceSDF2(g *grid2) *RedistanceSDF2 {
+	// outside the grid the lipschitz constant is >= 1
+	return &RedistanceSDF2{grid: g, k: math.Max(g.slope().Length(), 1)}
+}
+
+// Redistance2D returns an SDF2 with the true distance to the surface of an SDF2 within a narrow band.
+// The SDF2 is sampled on a grid with the given cell size that covers its bounding box.
+// The narrow band is 8 cells wide, use Redistance2DBand for a wider band.
+func Redistance2D(sdf SDF2, cellSize float64) (SDF2, error) {
+	return Redistance2DBand(sdf, cellSize, redistanceBand*cellSize)
+}
+
+// Redistance2DBand returns an SDF2 with the true distance to the surface of an SDF2 within a narrow band.
+// The SDF2 is sampled on a grid with the given cell size that covers its bounding box.
+// Further than band from the surface the distance is +/- band (a lower bound), so
+// the band should be at least as wide as any offset of the redistanced SDF2.
+func Redistance2DBand(sdf SDF2, cellSize, band float64) (SDF2, error) {
+	if cellSize <= 0 {
+		return nil, ErrMsg("cellSize <= 0")
+	}
+	if band <= 0 {
+		return nil, ErrMsg("band <= 0")
+	}
+	g, err := redistanceGrid2(sdf.BoundingBox(), cellSize)
+	if err != nil {
+		return nil, err
+	}
+	sampleBand2(g, sdf, band)
+	redistance2(g, cellSize, band)
+	s := newRedistanceSDF2(g)
+	s.sdf, s.cellSize, s.band = sdf, cellSize, band
+	return s, nil
+}
+
+// Evaluate returns the minimum distance to a RedistanceSDF2.
+func (s *RedistanceSDF2) Evaluate(p v2.Vec) float64 {
+	q := p.Clamp(s.grid.bb.Min, s.grid.bb.Max)
+	d := s.grid.bilinear(q)
+	if q == p {
+		return d
+	}
+	// Outside the grid: the closest surface point is inside the grid so this is a lower bound.
+	return math.Sqrt(d*d + p.Sub(q).Length2())
+}
+
+// EvaluateBatch evaluates a RedistanceSDF2 at each point of ps.
+func (s *RedistanceSDF2) EvaluateBatch(ps []v2.Vec, out []float64) {
+	for i, p := range ps {
+		out[i] = s.Evaluate(p)
+	}
+}
+
+// Gradient returns the gradient of a RedistanceSDF2.
+func (s *RedistanceSDF2) Gradient(p v2.Vec, eps float64) v2.Vec {
+	if !s.grid.bb.Contains(p) {
+		return centralGradient2(s, p, eps)
+	}
+	return s.grid.bilinearGradient(p)
+}
+
+// EvaluateInterval returns an interval containing the values of a RedistanceSDF2 within a box.
+func (s *RedistanceSDF2) EvaluateInterval(b Box2) Interval {
+	return lipschitzInterval2(s, b, s.k)
+}
+
+// BoundingBox returns the bounding box of a RedistanceSDF2.
+func (s *RedistanceSDF2) BoundingBox() Box2 {
+	return s.grid.bb
+}
+
+//-----------------------------------------------------------------------------
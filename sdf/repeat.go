@@ -0,0 +1,698 @@
+//-----------------------------------------------------------------------------
+/*
+
+Domain Repetition
+
+Array3D and RotateUnion3D evaluate every copy of an SDF. The SDFs in this file
+fold the query point into the nearest cell of the repetition lattice and only
+evaluate the copies in the neighbouring cells, so the cost doesn't depend on
+the number of copies.
+
+The number of neighbouring cells is worked out from the bounding box of the
+SDF. Copies that fit within a cell only need the cells on either side of the
+nearest cell. Larger copies need more cells. Copies that can't be closer than
+the current minimum distance (going by their bounding box) are skipped, if
+the SDF is no less than the distance to its bounding box (see bvhExact3).
+
+The result is the same as Array3D when the copies are combined with math.Min
+and the SDF is exact. Array3D and Array2D use the same lattice for that case
+if the copies don't overlap, otherwise Repeat3D and Repeat2D opt in to it.
+
+The interval of a box is the minimum over the intervals of the copies within
+reach of the box. If there are too many of them, the box is folded into a
+single cell (or sector) around the SDF.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"math"
+
+	v2 "github.com/deadsy/sdfx/vec/v2"
+	"github.com/deadsy/sdfx/vec/v2i"
+	v3 "github.com/deadsy/sdfx/vec/v3"
+	"github.com/deadsy/sdfx/vec/v3i"
+)
+
+//-----------------------------------------------------------------------------
+
+// latticeAxis works out the repetition along one axis.
+// It returns the (positive) step, the cell index range and the number of neighbouring cells to check.
+// A num <= 0 is an infinite repetition.
+func latticeAxis(step float64, num int, size float64) (float64, int, int, int) {
+	if step == 0 || num == 1 {
+		// no repetition
+		return 0, 0, 0, 0
+	}
+	lo, hi := 0, num-1
+	if step < 0 {
+		// the copies are at -i * |step|
+		step = -step
+		lo, hi = -hi, 0
+	}
+	// The copies of a point within the bounding box (relative to its center)
+	// are found within k cells of the nearest cell.
+	k := int(math.Floor(1 + 0.5*size/step))
+	if num > 0 && k > hi-lo {
+		k = hi - lo
+	}
+	return step, lo, hi, k
+}
+
+// latticeDisjoint returns true if the copies along an axis don't overlap.
+func latticeDisjoint(step float64, num int, size float64) bool {
+	return num == 1 || (step != 0 && math.Abs(step) >= size)
+}
+
+// latticeCell returns the index of the cell nearest to x.
+func latticeCell(x, step float64, lo, hi int, finite bool) int {
+	if step == 0 {
+		return 0
+	}
+	c := math.Round(x / step)
+	if finite {
+		c = Clamp(c, float64(lo), float64(hi))
+	}
+	return int(c)
+}
+
+// latticeRange returns the range of cells to check around cell c.
+func latticeRange(c, k, lo, hi int, finite bool) (int, int) {
+	c0, c1 := c-k, c+k
+	if finite {
+		if c0 < lo {
+			c0 = lo
+		}
+		if c1 > hi {
+			c1 = hi
+		}
+	}
+	return c0, c1
+}
+
+// latticeCells returns the range of cells checked for the points within [x0, x1],
+// and the range of cells checked for all of them.
+func latticeCells(x0, x1, step float64, k, lo, hi int, finite bool) (int, int, int, int) {
+	c0, a1 := latticeRange(latticeCell(x0, step, lo, hi, finite), k, lo, hi, finite)
+	a0, c1 := latticeRange(latticeCell(x1, step, lo, hi, finite), k, lo, hi, finite)
+	return c0, c1, a0, a1
+}
+
+// latticeFold returns the range [x0, x1] folded into the cells [c0, c1].
+// The points of an infinite repetition are also within k+1/2 cells of the sdf center.
+func latticeFold(x0, x1, step float64, c0, c1, k int, center float64, finite bool) (float64, float64) {
+	y0, y1 := x0-float64(c1)*step, x1-float64(c0)*step
+	if !finite && step != 0 {
+		w := (float64(k) + 0.5) * step
+		y0, y1 = math.Max(y0, center-w), math.Min(y1, center+w)
+	}
+	return y0, y1
+}
+
+// repeatCopies is the maximum number of copies evaluated separately for an interval.
+// Boxes with more copies are folded into a single box.
+const repeatCopies = 64
+
+// repeatInterval accumulates the intervals of the copies checked for the points within a box.
+// The lower bound is the minimum over all the copies. The upper bound is the minimum over the
+// copies checked for all of the points, or else the maximum over all the copies.
+type repeatInterval struct {
+	n            int
+	lower, upper float64
+	all          bool // upper is the minimum over copies checked for all of the points
+}
+
+// add adds the interval of a copy, all is true if the copy is checked for all of the points.
+func (r *repeatInterval) add(d Interval, all bool) {
+	if r.n == 0 {
+		r.lower, r.upper, r.all = d[0], d[1], all
+	} else {
+		r.lower = math.Min(r.lower, d[0])
+		switch {
+		case all && r.all:
+			r.upper = math.Min(r.upper, d[1])
+		case all:
+			r.upper, r.all = d[1], true
+		case !r.all:
+			r.upper = math.Max(r.upper, d[1])
+		}
+	}
+	r.n++
+}
+
+// interval returns the interval of the minimum distance to the copies.
+func (r *repeatInterval) interval() Interval {
+	return Interval{r.lower, r.upper}
+}
+
+//-----------------------------------------------------------------------------
+
+// lattice3 is a 3d repetition lattice for an SDF3.
+type lattice3 struct {
+	step   v3.Vec  // cell size (0 for no repetition)
+	lo, hi v3i.Vec // cell index range
+	k      v3i.Vec // number of neighbouring cells to check
+	finite bool
+	center v3.Vec // center of the sdf bounding box
+	bb     Box3   // sdf bounding box
+	skip   bool   // skip the copies by their bounding box
+}
+
+// newLattice3 returns a lattice of num copies of an SDF3 with a given step.
+// The repetition is infinite if finite is false.
+func newLattice3(sdf SDF3, num v3i.Vec, step v3.Vec, finite bool) *lattice3 {
+	if !finite {
+		num = v3i.Vec{0, 0, 0}
+	}
+	bb := sdf.BoundingBox()
+	size := bb.Size()
+	l := lattice3{finite: finite, center: bb.Center(), bb: bb, skip: bvhExact3(sdf)}
+	l.step.X, l.lo.X, l.hi.X, l.k.X = latticeAxis(step.X, num.X, size.X)
+	l.step.Y, l.lo.Y, l.hi.Y, l.k.Y = latticeAxis(step.Y, num.Y, size.Y)
+	l.step.Z, l.lo.Z, l.hi.Z, l.k.Z = latticeAxis(step.Z, num.Z, size.Z)
+	return &l
+}
+
+// evaluate returns the minimum distance to the copies of an SDF3 and the point in the nearest copy.
+func (l *lattice3) evaluate(s SDF3, p v3.Vec) (float64, v3.Vec) {
+	x := p.Sub(l.center)
+	cx := latticeCell(x.X, l.step.X, l.lo.X, l.hi.X, l.finite)
+	cy := latticeCell(x.Y, l.step.Y, l.lo.Y, l.hi.Y, l.finite)
+	cz := latticeCell(x.Z, l.step.Z, l.lo.Z, l.hi.Z, l.finite)
+	// start with the nearest cell
+	q := p.Sub(v3.Vec{float64(cx) * l.step.X, float64(cy) * l.step.Y, float64(cz) * l.step.Z})
+	d := s.Evaluate(q)
+	x0, x1 := latticeRange(cx, l.k.X, l.lo.X, l.hi.X, l.finite)
+	y0, y1 := latticeRange(cy, l.k.Y, l.lo.Y, l.hi.Y, l.finite)
+	z0, z1 := latticeRange(cz, l.k.Z, l.lo.Z, l.hi.Z, l.finite)
+	for i := x0; i <= x1; i++ {
+		for j := y0; j <= y1; j++ {
+			for k := z0; k <= z1; k++ {
+				if i == cx && j == cy && k == cz {
+					continue
+				}
+				y := p.Sub(v3.Vec{float64(i) * l.step.X, float64(j) * l.step.Y, float64(k) * l.step.Z})
+				if l.skip && bvhSkip(l.bb.minDist2(y), d) {
+					continue
+				}
+				if dy := s.Evaluate(y); dy < d {
+					d, q = dy, y
+				}
+			}
+		}
+	}
+	return d, q
+}
+
+// interval returns an interval containing the minimum distance to the copies of an SDF3 within a box.
+func (l *lattice3) interval(s SDF3, b Box3) Interval {
+	x := Box3{b.Min.Sub(l.center), b.Max.Sub(l.center)}
+	x0, x1, ax0, ax1 := latticeCells(x.Min.X, x.Max.X, l.step.X, l.k.X, l.lo.X, l.hi.X, l.finite)
+	y0, y1, ay0, ay1 := latticeCells(x.Min.Y, x.Max.Y, l.step.Y, l.k.Y, l.lo.Y, l.hi.Y, l.finite)
+	z0, z1, az0, az1 := latticeCells(x.Min.Z, x.Max.Z, l.step.Z, l.k.Z, l.lo.Z, l.hi.Z, l.finite)
+	copyInterval := func(i, j, k int) Interval {
+		ofs := v3.Vec{float64(i) * l.step.X, float64(j) * l.step.Y, float64(k) * l.step.Z}
+		return EvaluateInterval3(s, b.Translate(ofs.Neg()))
+	}
+	if float64(x1-x0+1)*float64(y1-y0+1)*float64(z1-z0+1) <= repeatCopies {
+		d := repeatInterval{}
+		for i := x0; i <= x1; i++ {
+			for j := y0; j <= y1; j++ {
+				for k := z0; k <= z1; k++ {
+					all := i >= ax0 && i <= ax1 && j >= ay0 && j <= ay1 && k >= az0 && k <= az1
+					d.add(copyInterval(i, j, k), all)
+				}
+			}
+		}
+		return d.interval()
+	}
+	// The copies of the box points are within the box folded into the cells.
+	var f Box3
+	f.Min.X, f.Max.X = latticeFold(b.Min.X, b.Max.X, l.step.X, x0, x1, l.k.X, l.center.X, l.finite)
+	f.Min.Y, f.Max.Y = latticeFold(b.Min.Y, b.Max.Y, l.step.Y, y0, y1, l.k.Y, l.center.Y, l.finite)
+	f.Min.Z, f.Max.Z = latticeFold(b.Min.Z, b.Max.Z, l.step.Z, z0, z1, l.k.Z, l.center.Z, l.finite)
+	d := EvaluateInterval3(s, f)
+	if ax0 <= ax1 && ay0 <= ay1 && az0 <= az1 {
+		d[1] = math.Min(d[1], copyInterval(ax0, ay0, az0)[1])
+	}
+	return d
+}
+
+//-----------------------------------------------------------------------------
+
+// lattice2 is a 2d repetition lattice for an SDF2.
+type lattice2 struct {
+	step   v2.Vec  // cell size (0 for no repetition)
+	lo, hi v2i.Vec // cell index range
+	k      v2i.Vec // number of neighbouring cells to check
+	finite bool
+	center v2.Vec // center of the sdf bounding box
+	bb     Box2   // sdf bounding box
+	skip   bool   // skip the copies by their bounding box
+}
+
+// newLattice2 returns a lattice of num copies of an SDF2 with a given step.
+// The repetition is infinite if finite is false.
+func newLattice2(sdf SDF2, num v2i.Vec, step v2.Vec, finite bool) *lattice2 {
+	if !finite {
+		num = v2i.Vec{0, 0}
+	}
+	bb := sdf.BoundingBox()
+	size := bb.Size()
+	l := lattice2{finite: finite, center: bb.Center(), bb: bb, skip: bvhExact2(sdf)}
+	l.step.X, l.lo.X, l.hi.X, l.k.X = latticeAxis(step.X, num.X, size.X)
+	l.step.Y, l.lo.Y, l.hi.Y, l.k.Y = latticeAxis(step.Y, num.Y, size.Y)
+	return &l
+}
+
+// evaluate returns the minimum distance to the copies of an SDF2 and the point in the nearest copy.
+func (l *lattice2) evaluate(s SDF2, p v2.Vec) (float64, v2.Vec) {
+	x := p.Sub(l.center)
+	cx := latticeCell(x.X, l.step.X, l.lo.X, l.hi.X, l.finite)
+	cy := latticeCell(x.Y, l.step.Y, l.lo.Y, l.hi.Y, l.finite)
+	// start with the nearest cell
+	q := p.Sub(v2.Vec{float64(cx) * l.step.X, float64(cy) * l.step.Y})
+	d := s.Evaluate(q)
+	x0, x1 := latticeRange(cx, l.k.X, l.lo.X, l.hi.X, l.finite)
+	y0, y1 := latticeRange(cy, l.k.Y, l.lo.Y, l.hi.Y, l.finite)
+	for i := x0; i <= x1; i++ {
+		for j := y0; j <= y1; j++ {
+			if i == cx && j == cy {
+				continue
+			}
+			y := p.Sub(v2.Vec{float64(i) * l.step.X, float64(j) * l.step.Y})
+			if l.skip && bvhSkip(l.bb.minDist2(y), d) {
+				continue
+			}
+			if dy := s.Evaluate(y); dy < d {
+				d, q = dy, y
+			}
+		}
+	}
+	return d, q
+}
+
+// interval returns an interval containing the minimum distance to the copies of an SDF2 within a box.
+func (l *lattice2) interval(s SDF2, b Box2) Interval {
+	x := Box2{b.Min.Sub(l.center), b.Max.Sub(l.center)}
+	x0, x1, ax0, ax1 := latticeCells(x.Min.X, x.Max.X, l.step.X, l.k.X, l.lo.X, l.hi.X, l.finite)
+	y0, y1, ay0, ay1 := latticeCells(x.Min.Y, x.Max.Y, l.step.Y, l.k.Y, l.lo.Y, l.hi.Y, l.finite)
+	copyInterval := func(i, j int) Interval {
+		ofs := v2.Vec{float64(i) * l.step.X, float64(j) * l.step.Y}
+		return EvaluateInterval2(s, b.Translate(ofs.Neg()))
+	}
+	if float64(x1-x0+1)*float64(y1-y0+1) <= repeatCopies {
+		d := repeatInterval{}
+		for i := x0; i <= x1; i++ {
+			for j := y0; j <= y1; j++ {
+				d.add(copyInterval(i, j), i >= ax0 && i <= ax1 && j >= ay0 && j <= ay1)
+			}
+		}
+		return d.interval()
+	}
+	// The copies of the box points are within the box folded into the cells.
+	var f Box2
+	f.Min.X, f.Max.X = latticeFold(b.Min.X, b.Max.X, l.step.X, x0, x1, l.k.X, l.center.X, l.finite)
+	f.Min.Y, f.Max.Y = latticeFold(b.Min.Y, b.Max.Y, l.step.Y, y0, y1, l.k.Y, l.center.Y, l.finite)
+	d := EvaluateInterval2(s, f)
+	if ax0 <= ax1 && ay0 <= ay1 {
+		d[1] = math.Min(d[1], copyInterval(ax0, ay0)[1])
+	}
+	return d
+}
+
+//-----------------------------------------------------------------------------
+
+// polarLattice is a repetition of num copies about the origin.
+type polarLattice struct {
+	num   int
+	theta float64  // sector angle
+	a0    float64  // angle of the sdf bounding box center
+	k     int      // number of neighbouring sectors to check
+	rot   []v2.Vec // cos/sin of the rotation angle of each copy
+}
+
+// newPolarLattice returns a polar lattice of num copies for an SDF with the given xy bounding box.
+func newPolarLattice(bb Box2, num int) *polarLattice {
+	l := polarLattice{
+		num:   num,
+		theta: Tau / float64(num),
+		k:     num,
+		rot:   make([]v2.Vec, num),
+	}
+	for i := range l.rot {
+		l.rot[i] = v2.Vec{math.Cos(float64(i) * l.theta), math.Sin(float64(i) * l.theta)}
+	}
+	if bb.minDist2(v2.Vec{}) > 0 {
+		// The bounding box doesn't contain the origin, so its angular range is the
+		// range of the corner angles about the angle of its center.
+		c := bb.Center()
+		l.a0 = math.Atan2(c.Y, c.X)
+		w := 0.0
+		for _, v := range bb.Vertices() {
+			w = math.Max(w, math.Abs(SawTooth(math.Atan2(v.Y, v.X)-l.a0, Tau)))
+		}
+		l.k = int(math.Floor(1 + w/l.theta))
+	}
+	return &l
+}
+
+// sectors returns the range of copies to check for a point.
+// The copy indices are modulo num.
+func (l *polarLattice) sectors(p v2.Vec) (int, int) {
+	if 2*l.k+1 >= l.num {
+		// check all the copies
+		return 0, l.num - 1
+	}
+	c := int(math.Round(SawTooth(math.Atan2(p.Y, p.X)-l.a0, Tau) / l.theta))
+	return c - l.k, c + l.k
+}
+
+// rotate returns a point rotated into the frame of copy i.
+func (l *polarLattice) rotate(p v2.Vec, i int) v2.Vec {
+	i %= l.num
+	if i < 0 {
+		i += l.num
+	}
+	r := l.rot[i]
+	return v2.Vec{p.X*r.X + p.Y*r.Y, p.Y*r.X - p.X*r.Y}
+}
+
+// rotateBox returns the bounding box of a box rotated into the frame of copy i.
+func (l *polarLattice) rotateBox(b Box2, i int) Box2 {
+	v := b.Vertices()
+	for j := range v {
+		v[j] = l.rotate(v[j], i)
+	}
+	return Box2{v.Min(), v.Max()}
+}
+
+// interval returns an interval containing the minimum distance to the copies within a box.
+// f returns the interval of the sdf within an xy box (in the frame of the sdf).
+func (l *polarLattice) interval(b Box2, f func(Box2) Interval) Interval {
+	// i0..i1 are the copies checked for the box points, a0..a1 are the copies checked for all of them
+	i0, i1, a0, a1 := 0, l.num-1, 0, l.num-1
+	if 2*l.k+1 < l.num {
+		a0, a1 = 0, -1
+		if !b.Contains(v2.Vec{}) {
+			// The box angles span < pi about the angle of the center.
+			// The extreme angles are at the vertices of the box.
+			c := b.Center()
+			ca := math.Atan2(c.Y, c.X)
+			m := Rotate(-ca)
+			x := Interval{math.Inf(1), math.Inf(-1)}
+			for _, v := range b.Vertices() {
+				v = m.MulPosition(v)
+				t := math.Atan2(v.Y, v.X)
+				x = x.extend(Interval{t, t})
+			}
+			x = x.offset(SawTooth(ca-l.a0, Tau))
+			c0 := int(math.Round(x[0] / l.theta))
+			c1 := int(math.Round(x[1] / l.theta))
+			i0, i1, a0, a1 = c0-l.k, c1+l.k, c1-l.k, c0+l.k
+		}
+	}
+	if i1-i0 < polarCopies {
+		d := repeatInterval{}
+		for i := i0; i <= i1; i++ {
+			d.add(f(l.rotateBox(b, i)), i >= a0 && i <= a1)
+		}
+		return d.interval()
+	}
+	// The copies of the box points are within the annular sector about the sdf.
+	r := radialInterval(b)
+	w := (float64(l.k) + 0.5) * l.theta
+	d := f(rotateBox2(Box2{v2.Vec{r[0], 0}, v2.Vec{r[1], 0}}, Interval{l.a0 - w, l.a0 + w}))
+	if a0 <= a1 {
+		d[1] = math.Min(d[1], f(l.rotateBox(b, a0))[1])
+	}
+	return d
+}
+
+// polarCopies is the maximum number of copies evaluated separately for an interval.
+const polarCopies = 16
+
+// polarBox returns the bounding box of the copies of a bounding box rotated about the origin.
+func polarBox(bb Box2) Box2 {
+	rmax := 0.0
+	for _, v := range bb.Vertices() {
+		rmax = math.Max(rmax, v.Length())
+	}
+	return Box2{v2.Vec{-rmax, -rmax}, v2.Vec{rmax, rmax}}
+}
+
+//-----------------------------------------------------------------------------
+
+// RepeatSDF3 is a finite or infinite XYZ repetition of an SDF3.
+type RepeatSDF3 struct {
+	sdf     SDF3
+	num     v3i.Vec
+	step    v3.Vec
+	lattice *lattice3
+	bb      Box3
+}
+
+// Repeat3D returns an XYZ array of an SDF3 with the copies at (i*step.X, j*step.Y, k*step.Z)
+// for 0 <= i < num.X, etc. It's the same as Array3D (for an SDF that is exact outside its bounding box),
+// but the evaluation cost doesn't depend on the number of copies.
+func Repeat3D(sdf SDF3, num v3i.Vec, step v3.Vec) (SDF3, error) {
+	if sdf == nil {
+		return nil, ErrMsg("sdf == nil")
+	}
+	if num.X <= 0 || num.Y <= 0 || num.Z <= 0 {
+		return nil, ErrMsg("num <= 0")
+	}
+	bb := sdf.BoundingBox()
+	return &RepeatSDF3{
+		sdf:     sdf,
+		num:     num,
+		step:    step,
+		lattice: newLattice3(sdf, num, step, true),
+		bb:      bb.Extend(bb.Translate(step.Mul(v3.Vec{float64(num.X - 1), float64(num.Y - 1), float64(num.Z - 1)}))),
+	}, nil
+}
+
+// RepeatInfinite3D returns an infinite XYZ repetition of an SDF3 with the given step.
+// A zero step doesn't repeat the SDF3 along that axis.
+func RepeatInfinite3D(sdf SDF3, step v3.Vec) (SDF3, error) {
+	if sdf == nil {
+		return nil, ErrMsg("sdf == nil")
+	}
+	return &RepeatSDF3{
+		sdf:     sdf,
+		step:    step,
+		lattice: newLattice3(sdf, v3i.Vec{}, step, false),
+	}, nil
+}
+
+// Evaluate returns the minimum distance to a repeated SDF3.
+func (s *RepeatSDF3) Evaluate(p v3.Vec) float64 {
+	d, _ := s.lattice.evaluate(s.sdf, p)
+	return d
+}
+
+// EvaluateInterval returns an interval containing the values of a repeated SDF3 within a box.
+func (s *RepeatSDF3) EvaluateInterval(b Box3) Interval {
+	return s.lattice.interval(s.sdf, b)
+}
+
+// Gradient returns the gradient of a repeated SDF3.
+func (s *RepeatSDF3) Gradient(p v3.Vec, eps float64) v3.Vec {
+	_, q := s.lattice.evaluate(s.sdf, p)
+	return Gradient3(s.sdf, q, eps)
+}
+
+// BoundingBox returns the bounding box of a repeated SDF3.
+func (s *RepeatSDF3) BoundingBox() Box3 {
+	// An infinite repetition is defined for all xyz, so the bounding box is a point at the origin.
+	// To use it, it needs to be intersected with an external bounding volume.
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
+
+// RepeatSDF2 is a finite or infinite XY repetition of an SDF2.
+type RepeatSDF2 struct {
+	sdf     SDF2
+	num     v2i.Vec
+	step    v2.Vec
+	lattice *lattice2
+	bb      Box2
+}
+
+// Repeat2D returns an XY array of an SDF2 with the copies at (i*step.X, j*step.Y)
+// for 0 <= i < num.X, etc. It's the same as Array2D (for an SDF that is exact outside its bounding box),
+// but the evaluation cost doesn't depend on the number of copies.
+func Repeat2D(sdf SDF2, num v2i.Vec, step v2.Vec) (SDF2, error) {
+	if sdf == nil {
+		return nil, ErrMsg("sdf == nil")
+	}
+	if num.X <= 0 || num.Y <= 0 {
+		return nil, ErrMsg("num <= 0")
+	}
+	bb := sdf.BoundingBox()
+	return &RepeatSDF2{
+		sdf:     sdf,
+		num:     num,
+		step:    step,
+		lattice: newLattice2(sdf, num, step, true),
+		bb:      bb.Extend(bb.Translate(step.Mul(v2.Vec{float64(num.X - 1), float64(num.Y - 1)}))),
+	}, nil
+}
+
+// RepeatInfinite2D returns an infinite XY repetition of an SDF2 with the given step.
+// A zero step doesn't repeat the SDF2 along that axis.
+func RepeatInfinite2D(sdf SDF2, step v2.Vec) (SDF2, error) {
+	if sdf == nil {
+		return nil, ErrMsg("sdf == nil")
+	}
+	return &RepeatSDF2{
+		sdf:     sdf,
+		step:    step,
+		lattice: newLattice2(sdf, v2i.Vec{}, step, false),
+	}, nil
+}
+
+// Evaluate returns the minimum distance to a repeated SDF2.
+func (s *RepeatSDF2) Evaluate(p v2.Vec) float64 {
+	d, _ := s.lattice.evaluate(s.sdf, p)
+	return d
+}
+
+// EvaluateInterval returns an interval containing the values of a repeated SDF2 within a box.
+func (s *RepeatSDF2) EvaluateInterval(b Box2) Interval {
+	return s.lattice.interval(s.sdf, b)
+}
+
+// Gradient returns the gradient of a repeated SDF2.
+func (s *RepeatSDF2) Gradient(p v2.Vec, eps float64) v2.Vec {
+	_, q := s.lattice.evaluate(s.sdf, p)
+	return Gradient2(s.sdf, q, eps)
+}
+
+// BoundingBox returns the bounding box of a repeated SDF2.
+func (s *RepeatSDF2) BoundingBox() Box2 {
+	// An infinite repetition is defined for all xy, so the bounding box is a point at the origin.
+	// To use it, it needs to be intersected with an external bounding volume.
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
+
+// RepeatPolarSDF3 is a repetition of an SDF3 about the z-axis.
+type RepeatPolarSDF3 struct {
+	sdf     SDF3
+	lattice *polarLattice
+	sdfBox  Box3 // sdf bounding box
+	skip    bool // skip the copies by their bounding box
+	bb      Box3
+}
+
+// RepeatPolar3D returns num copies of an SDF3 rotated about the z-axis.
+// Unlike RotateCopy3D the neighbouring copies are checked, so the copies can
+// extend beyond their sector.
+func RepeatPolar3D(sdf SDF3, num int) (SDF3, error) {
+	if sdf == nil {
+		return nil, ErrMsg("sdf == nil")
+	}
+	if num <= 0 {
+		return nil, ErrMsg("num <= 0")
+	}
+	bb := sdf.BoundingBox()
+	bb2 := polarBox(Box2{v2.Vec{bb.Min.X, bb.Min.Y}, v2.Vec{bb.Max.X, bb.Max.Y}})
+	return &RepeatPolarSDF3{
+		sdf:     sdf,
+		lattice: newPolarLattice(Box2{v2.Vec{bb.Min.X, bb.Min.Y}, v2.Vec{bb.Max.X, bb.Max.Y}}, num),
+		sdfBox:  bb,
+		skip:    bvhExact3(sdf),
+		bb:      Box3{v3.Vec{bb2.Min.X, bb2.Min.Y, bb.Min.Z}, v3.Vec{bb2.Max.X, bb2.Max.Y, bb.Max.Z}},
+	}, nil
+}
+
+// Evaluate returns the minimum distance to a polar repetition of an SDF3.
+func (s *RepeatPolarSDF3) Evaluate(p v3.Vec) float64 {
+	d := math.MaxFloat64
+	i0, i1 := s.lattice.sectors(v2.Vec{p.X, p.Y})
+	for i := i0; i <= i1; i++ {
+		r := s.lattice.rotate(v2.Vec{p.X, p.Y}, i)
+		y := v3.Vec{r.X, r.Y, p.Z}
+		if s.skip && bvhSkip(s.sdfBox.minDist2(y), d) {
+			continue
+		}
+		d = math.Min(d, s.sdf.Evaluate(y))
+	}
+	return d
+}
+
+// EvaluateInterval returns an interval containing the values of a polar repetition of an SDF3 within a box.
+func (s *RepeatPolarSDF3) EvaluateInterval(b Box3) Interval {
+	return s.lattice.interval(Box2{v2.Vec{b.Min.X, b.Min.Y}, v2.Vec{b.Max.X, b.Max.Y}}, func(xy Box2) Interval {
+		return EvaluateInterval3(s.sdf, Box3{v3.Vec{xy.Min.X, xy.Min.Y, b.Min.Z}, v3.Vec{xy.Max.X, xy.Max.Y, b.Max.Z}})
+	})
+}
+
+// BoundingBox returns the bounding box of a polar repetition of an SDF3.
+func (s *RepeatPolarSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
+
+// RepeatPolarSDF2 is a repetition of an SDF2 about the origin.
+type RepeatPolarSDF2 struct {
+	sdf     SDF2
+	lattice *polarLattice
+	sdfBox  Box2 // sdf bounding box
+	skip    bool // skip the copies by their bounding box
+	bb      Box2
+}
+
+// RepeatPolar2D returns num copies of an SDF2 rotated about the origin.
+// Unlike RotateCopy2D the neighbouring copies are checked, so the copies can
+// extend beyond their sector.
+func RepeatPolar2D(sdf SDF2, num int) (SDF2, error) {
+	if sdf == nil {
+		return nil, ErrMsg("sdf == nil")
+	}
+	if num <= 0 {
+		return nil, ErrMsg("num <= 0")
+	}
+	bb := sdf.BoundingBox()
+	return &RepeatPolarSDF2{
+		sdf:     sdf,
+		lattice: newPolarLattice(bb, num),
+		sdfBox:  bb,
+		skip:    bvhExact2(sdf),
+		bb:      polarBox(bb),
+	}, nil
+}
+
+// Evaluate returns the minimum distance to a polar repetition of an SDF2.
+func (s *RepeatPolarSDF2) Evaluate(p v2.Vec) float64 {
+	d := math.MaxFloat64
+	i0, i1 := s.lattice.sectors(p)
+	for i := i0; i <= i1; i++ {
+		y := s.lattice.rotate(p, i)
+		if s.skip && bvhSkip(s.sdfBox.minDist2(y), d) {
+			continue
+		}
+		d = math.Min(d, s.sdf.Evaluate(y))
+	}
+	return d
+}
+
+// EvaluateInterval returns an interval containing the values of a polar repetition of an SDF2 within a box.
+func (s *RepeatPolarSDF2) EvaluateInterval(b Box2) Interval {
+	return s.lattice.interval(b, func(xy Box2) Interval {
+		return EvaluateInterval2(s.sdf, xy)
+	})
+}
+
+// BoundingBox returns the bounding box of a polar repetition of an SDF2.
+func (s *RepeatPolarSDF2) BoundingBox() Box2 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
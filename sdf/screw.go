@@ -11,6 +11,10 @@ the x-axis as the screw axis. Most thread profiles are symmetric about the y-axi
 but a few aren't (E.g. buttress threads) so in general we build the profile of
 an entire pitch period.
 
+The distance to the thread surface is found by searching the axial half-planes
+near the point for the closest copy of the profile. For tapered threads the profile
+is sheared along the axis, so the distance is approximate.
+
 This code doesn't deal with thread tolerancing. If you want threads to fit properly
 the radius of the thread will need to be tweaked (+/-) to give internal/external thread
 clearance.
@@ -24,6 +28,7 @@ import (
 	"fmt"
 	"log"
 	"math"
+	"sort"
 
 	v2 "github.com/deadsy/sdfx/vec/v2"
 	v3 "github.com/deadsy/sdfx/vec/v3"
@@ -358,18 +363,178 @@ func PlasticButtressThread(
 
 //-----------------------------------------------------------------------------
 
+// screwProfileSDF2 repeats the part of a thread profile within x = [-pitch/2, pitch/2] every pitch.
+// The thread profile only needs the right shape within a single pitch period. For polygon
+// profiles the line segments within the period are repeated, which gives the exact distance.
+// For other profiles the neighbouring copies are clipped to their own period, which gives a
+// bound on the distance for points deeper than about a quarter pitch.
+type screwProfileSDF2 struct {
+	thread SDF2      // 2D thread profile
+	pitch  float64   // thread to thread distance
+	mesh   *MeshSDF2 // repeated line segments of a polygon profile
+	bb     Box2      // bounding box of a single pitch period
+}
+
+const screwProfileCopies = 2 // copies of the profile on each side of the central period
+
+// newScrewProfile returns the repeated thread profile for a screw.
+func newScrewProfile(thread SDF2, pitch float64) *screwProfileSDF2 {
+	bb := thread.BoundingBox()
+	s := screwProfileSDF2{
+		thread: thread,
+		pitch:  pitch,
+		bb:     Box2{v2.Vec{-0.5 * pitch, bb.Min.Y}, v2.Vec{0.5 * pitch, bb.Max.Y}},
+	}
+	if m, ok := thread.(*MeshSDF2); ok {
+		s.mesh = screwProfileMesh(m.mesh, pitch)
+	}
+	return &s
+}
+
+// screwProfileMesh clips the line segments of a profile to x = [-pitch/2, pitch/2] and
+// repeats them on either side. Where the profile has a different height at each side of
+// the period a vertical step joins the copies.
+func screwProfileMesh(mesh []*Line2, pitch float64) *MeshSDF2 {
+	hp := 0.5 * pitch
+	var period []Line2
+	var side [2][]float64 // y values where the profile meets x = -pitch/2 and x = pitch/2
+	for _, l := range mesh {
+		a, v := l[0], l[1].Sub(l[0])
+		// clip the x-range of the line segment
+		t0, t1 := 0.0, 1.0
+		if v.X != 0 {
+			ta, tb := (-hp-a.X)/v.X, (hp-a.X)/v.X
+			if ta > tb {
+				ta, tb = tb, ta
+			}
+			t0, t1 = math.Max(t0, ta), math.Min(t1, tb)
+		} else if math.Abs(a.X) > hp {
+			continue
+		}
+		if t0 >= t1 {
+			continue
+		}
+		c := Line2{a.Add(v.MulScalar(t0)), a.Add(v.MulScalar(t1))}
+		// put the clipped ends exactly on the period boundary
+		if t0 > 0 {
+			c[0].X = math.Copysign(hp, c[0].X)
+		}
+		if t1 < 1 {
+			c[1].X = math.Copysign(hp, c[1].X)
+		}
+		if math.Abs(c[0].X) == hp && c[0].X == c[1].X {
+			// the profile side is replaced by the neighbouring copy
+			continue
+		}
+		if c[0].Y == 0 && c[1].Y == 0 {
+			// the screw axis isn't part of the thread surface
+			continue
+		}
+		for _, v := range c {
+			if math.Abs(v.X) == hp {
+				i := 0
+				if v.X > 0 {
+					i = 1
+				}
+				side[i] = append(side[i], v.Y)
+			}
+		}
+		period = append(period, c)
+	}
+	// The profile is inside on one side of the join but not the other between
+	// alternate pairs of the sorted y values.
+	step := append(append([]float64{}, side[0]...), side[1]...)
+	sort.Float64s(step)
+	var lines []*Line2
+	for k := -screwProfileCopies; k <= screwProfileCopies; k++ {
+		ofs := v2.Vec{float64(k) * pitch, 0}
+		for i := range period {
+			lines = append(lines, &Line2{period[i][0].Add(ofs), period[i][1].Add(ofs)})
+		}
+		if k == screwProfileCopies {
+			break
+		}
+		x := hp + ofs.X
+		for i := 0; i+1 < len(step); i += 2 {
+			if step[i+1] > step[i] {
+				lines = append(lines, &Line2{{x, step[i]}, {x, step[i+1]}})
+			}
+		}
+	}
+	m, _ := Mesh2D(lines)
+	return m.(*MeshSDF2)
+}
+
+// distance2 returns the distance squared to the repeated thread profile.
+// The sign isn't needed, so for polygon profiles the winding number is skipped.
+func (s *screwProfileSDF2) distance2(p v2.Vec) float64 {
+	if s.mesh != nil {
+		return s.mesh.minDist2(v2.Vec{SawTooth(p.X, s.pitch), p.Y})
+	}
+	d := s.Evaluate(p)
+	return d * d
+}
+
+// Evaluate returns the minimum distance to the repeated thread profile.
+func (s *screwProfileSDF2) Evaluate(p v2.Vec) float64 {
+	x := SawTooth(p.X, s.pitch)
+	if s.mesh != nil {
+		// The sign comes from the central period of the profile.
+		// The profile continues below the axis.
+		q := v2.Vec{x, p.Y}
+		d := math.Sqrt(s.mesh.minDist2(q))
+		if s.thread.(*MeshSDF2).winding(v2.Vec{x, math.Max(p.Y, 0)}) != 0 {
+			return -d
+		}
+		return d
+	}
+	d0 := s.thread.Evaluate(v2.Vec{x, p.Y})
+	// Each copy of the profile is clipped to its own pitch period. Inside the profile we
+	// want the distance to the outside, so work with the distance to the other side of
+	// the surface. The neighbouring copies are only evaluated if they could be closer.
+	hp := 0.5 * s.pitch
+	sign := 1.0
+	if d0 < 0 {
+		sign = -1.0
+	}
+	d := math.Max(sign*d0, math.Abs(x)-hp)
+	for k := -1; k <= 1; k += 2 {
+		xk := x - float64(k)*s.pitch
+		if math.Abs(xk)-hp >= d {
+			// this copy can't be any closer
+			continue
+		}
+		dk := math.Max(sign*s.thread.Evaluate(v2.Vec{xk, p.Y}), math.Abs(xk)-hp)
+		d = math.Min(d, dk)
+	}
+	return sign * d
+}
+
+// BoundingBox returns the bounding box of a single pitch period of the thread profile.
+func (s *screwProfileSDF2) BoundingBox() Box2 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
+
 // ScrewSDF3 is a 3d screw form.
 type ScrewSDF3 struct {
-	thread SDF2    // 2D thread profile
-	pitch  float64 // thread to thread distance
-	lead   float64 // distance per turn (starts * pitch)
-	length float64 // total length of screw
-	taper  float64 // thread taper angle
-	starts int     // number of thread starts
-	bb     Box3    // bounding box
+	thread  SDF2              // 2D thread profile
+	profile *screwProfileSDF2 // thread profile repeated every pitch
+	pitch   float64           // thread to thread distance
+	lead    float64           // distance per turn (starts * pitch)
+	length  float64           // total length of screw
+	taper   float64           // thread taper angle
+	starts  int               // number of thread starts
+	bb      Box3              // bounding box
 }
 
 // Screw3D returns a screw SDF3.
+// The part of the thread profile within x = [-pitch/2, pitch/2] is repeated every pitch along the screw.
+// The distance is found by a search over the nearby axial half-planes. Each evaluation costs one
+// profile evaluation, plus up to ~70 more for points close enough to the thread for the search to be
+// needed. That's several times the cost of a simple profile mapping, so the screw has interval
+// evaluation to let the renderers skip the space away from the surface.
 func Screw3D(
 	thread SDF2, // 2D thread profile
 	length float64, // length of screw
@@ -401,6 +566,7 @@ func Screw3D(
 	// Work out the bounding box.
 	// The max-y axis of the sdf2 bounding box is the radius of the thread.
 	bb := s.thread.BoundingBox()
+	s.profile = newScrewProfile(thread, pitch)
 	r := bb.Max.Y
 	// add the taper increment
 	r += s.length * math.Tan(taper)
@@ -408,8 +574,21 @@ func Screw3D(
 	return &s, nil
 }
 
-// Evaluate returns the minimum distance to a 3d screw form.
-func (s *ScrewSDF3) Evaluate(p v3.Vec) float64 {
+// evaluateAxis returns the distance to the cone around the axis of a tapered screw.
+// The taper maps the points within the cone below the axis of the thread profile,
+// so they are outside the screw.
+func (s *ScrewSDF3) evaluateAxis(r, z float64) float64 {
+	c := math.Atan(s.taper)
+	if r*c-z < 0 {
+		// the closest point is the apex
+		return -math.Sqrt(r*r + z*z)
+	}
+	return -(r + c*z) / math.Sqrt(1+c*c)
+}
+
+// evaluateSawTooth returns the screw sdf by mapping the 3d point into the 2d profile.
+// This is not a true distance. It is retained for testing.
+func (s *ScrewSDF3) evaluateSawTooth(p v3.Vec) float64 {
 	// map the 3d point back to the xy space of the profile
 	p0 := v2.Vec{}
 	// the distance from the 3d z-axis maps to the 2d y-axis
@@ -423,7 +602,138 @@ func (s *ScrewSDF3) Evaluate(p v3.Vec) float64 {
 	z := p.Z + s.lead*theta/Tau
 	p0.X = SawTooth(z, s.pitch)
 	// get the thread profile distance
-	d0 := s.thread.Evaluate(p0)
+	d0 := s.profile.Evaluate(p0)
+	if s.taper != 0 {
+		d0 = math.Max(d0, s.evaluateAxis(p0.Y-p.Z*math.Atan(s.taper), p.Z))
+	}
+	// create a region for the screw length
+	d1 := math.Abs(p.Z) - s.length
+	// return the intersection
+	return math.Max(d0, d1)
+}
+
+const screwTolerance = 1e-3  // distance tolerance (as a fraction of the pitch)
+const screwBoundSamples = 16 // samples used to bound the search range
+const screwMaxSamples = 64   // maximum samples for the coarse search
+const screwRefineIters = 4   // parabolic refinement iterations
+
+// planeDistance2 returns the distance squared from a point (r, theta, z)
+// to the thread surface within the axial half-plane at angle theta + phi.
+func (s *ScrewSDF3) planeDistance2(r, theta, z, phi float64) float64 {
+	// project the point onto the plane
+	p0 := v2.Vec{}
+	p0.Y = r * math.Cos(phi)
+	if s.taper != 0 {
+		p0.Y += z * math.Atan(s.taper)
+	}
+	p0.X = SawTooth(z+s.lead*(theta+phi)/Tau, s.pitch)
+	// distance to the thread within the plane
+	d2 := s.profile.distance2(p0)
+	// distance from the point to the plane
+	h := r * math.Sin(phi)
+	return d2 + h*h
+}
+
+// minPlaneDistance2 returns the minimum planeDistance2 for phi within [phi0, phi1].
+func (s *ScrewSDF3) minPlaneDistance2(r, theta, z, phi0, phi1, step float64) float64 {
+	// coarse search
+	n := int(Clamp(math.Ceil((phi1-phi0)/step), 4, screwMaxSamples))
+	step = (phi1 - phi0) / float64(n)
+	var f [screwMaxSamples + 1]float64
+	k := 0
+	for i := 0; i <= n; i++ {
+		f[i] = s.planeDistance2(r, theta, z, phi0+float64(i)*step)
+		if f[i] < f[k] {
+			k = i
+		}
+	}
+	dmin := f[k]
+	// bracket the minimum
+	k = int(Clamp(float64(k), 1, float64(n-1)))
+	a := phi0 + float64(k-1)*step
+	b := phi0 + float64(k)*step
+	c := phi0 + float64(k+1)*step
+	fa, fb, fc := f[k-1], f[k], f[k+1]
+	// successive parabolic interpolation
+	for i := 0; i < screwRefineIters; i++ {
+		den := (b-a)*(fb-fc) - (b-c)*(fb-fa)
+		if den == 0 {
+			break
+		}
+		x := b - 0.5*((b-a)*(b-a)*(fb-fc)-(b-c)*(b-c)*(fb-fa))/den
+		if x <= a || x >= c || math.Abs(x-b) < tolerance {
+			break
+		}
+		fx := s.planeDistance2(r, theta, z, x)
+		dmin = math.Min(dmin, fx)
+		// keep the best point and its neighbours
+		px := [4]float64{a, b, c, x}
+		pf := [4]float64{fa, fb, fc, fx}
+		if x < b {
+			px = [4]float64{a, x, b, c}
+			pf = [4]float64{fa, fx, fb, fc}
+		}
+		j := 1
+		if pf[2] < pf[1] {
+			j = 2
+		}
+		a, b, c = px[j-1], px[j], px[j+1]
+		fa, fb, fc = pf[j-1], pf[j], pf[j+1]
+	}
+	return dmin
+}
+
+// Evaluate returns the minimum distance to a 3d screw form.
+// The thread surface is the helical sweep of the profile. Each axial half-plane
+// intersects it with a copy of the profile, so the distance is found by minimising
+// over the angular offset of the half-plane.
+func (s *ScrewSDF3) Evaluate(p v3.Vec) float64 {
+	r := math.Sqrt(p.X*p.X + p.Y*p.Y)
+	theta := math.Atan2(p.Y, p.X)
+	// distance within the axial plane of the point
+	p0 := v2.Vec{}
+	p0.Y = r
+	if s.taper != 0 {
+		p0.Y += p.Z * math.Atan(s.taper)
+	}
+	p0.X = SawTooth(p.Z+s.lead*theta/Tau, s.pitch)
+	ds := s.profile.Evaluate(p0)
+	d0 := math.Abs(ds)
+	if d0 != 0 && r > epsilon {
+		// Planes with an offset distance > d0 can't be any closer.
+		// Points on the other side of the axis are at least r away.
+		a := Pi
+		if d0 < r {
+			a = math.Asin(d0 / r)
+		}
+		// Narrow the search range using a lower bound on the plane distance.
+		// Within the profile the point moves by at most |phi| * sqrt(l^2 + (r*phi/2)^2).
+		l := math.Abs(s.lead) / Tau
+		dmax := d0 - screwTolerance*s.pitch
+		w := 0.0
+		for i := screwBoundSamples; i > 0; i-- {
+			phi := a * float64(i) / screwBoundSamples
+			x := math.Max(0, d0-phi*math.Sqrt(l*l+0.25*r*r*phi*phi))
+			h := r * math.Sin(phi)
+			if x*x+h*h < dmax*dmax {
+				w = math.Min(a, phi+a/screwBoundSamples)
+				break
+			}
+		}
+		if w > 0 {
+			// Choose a search step so the point moves < pitch/16 within the profile.
+			// Coarser steps can miss narrow profile features on multi-start threads.
+			step := 0.0625 * s.pitch / math.Max(l, r*math.Sin(math.Min(w, 0.5*Pi)))
+			d0 = math.Sqrt(math.Min(d0*d0, s.minPlaneDistance2(r, theta, p.Z, -w, w, step)))
+		}
+	}
+	// the sign comes from the axial plane of the point
+	if ds < 0 {
+		d0 = -d0
+	}
+	if s.taper != 0 {
+		d0 = math.Max(d0, s.evaluateAxis(r, p.Z))
+	}
 	// create a region for the screw length
 	d1 := math.Abs(p.Z) - s.length
 	// return the intersection
@@ -435,4 +745,15 @@ func (s *ScrewSDF3) BoundingBox() Box3 {
 	return s.bb
 }
 
+// EvaluateInterval returns the range of the screw distance within a box.
+func (s *ScrewSDF3) EvaluateInterval(b Box3) Interval {
+	// The search finds the distance to within the screw tolerance.
+	// A taper shears the profile along the axis, which scales the lipschitz constant.
+	d := s.Evaluate(b.Center())
+	c := math.Atan(s.taper)
+	k := 0.5 * (c + math.Sqrt(c*c+4))
+	h := 0.5*b.Size().Length()*k + screwTolerance*s.pitch
+	return Interval{d - h, d + h}
+}
+
 //-----------------------------------------------------------------------------
@@ -68,6 +68,16 @@ func (s *CircleSDF2) Evaluate(p v2.Vec) float64 {
 	return p.Length() - s.radius
 }
 
+// EvaluateInterval returns an interval containing the values of a 2d circle within a box.
+func (s *CircleSDF2) EvaluateInterval(b Box2) Interval {
+	return radialInterval(b).offset(-s.radius)
+}
+
+// Gradient returns the gradient of a 2d circle.
+func (s *CircleSDF2) Gradient(p v2.Vec, eps float64) v2.Vec {
+	return unitVector2(p)
+}
+
 // BoundingBox returns the bounding box of a 2d circle.
 func (s *CircleSDF2) BoundingBox() Box2 {
 	return s.bb
@@ -98,6 +108,17 @@ func (s *BoxSDF2) Evaluate(p v2.Vec) float64 {
 	return sdfBox2d(p, s.size) - s.round
 }
 
+// EvaluateInterval returns an interval containing the values of a 2d box within a box.
+func (s *BoxSDF2) EvaluateInterval(b Box2) Interval {
+	// exact distance field of a convex area
+	return convexInterval2(s, b)
+}
+
+// Gradient returns the gradient of a 2d box.
+func (s *BoxSDF2) Gradient(p v2.Vec, eps float64) v2.Vec {
+	return sdfBox2dGradient(p, s.size)
+}
+
 // BoundingBox returns the bounding box for a 2d box.
 func (s *BoxSDF2) BoundingBox() Box2 {
 	return s.bb
@@ -131,6 +152,22 @@ func (s *LineSDF2) Evaluate(p v2.Vec) float64 {
 	return p.Sub(v2.Vec{s.l, 0}).Length() - s.round
 }
 
+// EvaluateInterval returns an interval containing the values of a 2d line within a box.
+func (s *LineSDF2) EvaluateInterval(b Box2) Interval {
+	// exact distance field of a convex area
+	return convexInterval2(s, b)
+}
+
+// Gradient returns the gradient of a 2d line.
+func (s *LineSDF2) Gradient(p v2.Vec, eps float64) v2.Vec {
+	q := p.Abs()
+	if q.X <= s.l {
+		return v2.Vec{0, sign(p.Y)}
+	}
+	g := unitVector2(q.Sub(v2.Vec{s.l, 0}))
+	return v2.Vec{g.X * sign(p.X), g.Y * sign(p.Y)}
+}
+
 // BoundingBox returns the bounding box for a 2d line.
 func (s *LineSDF2) BoundingBox() Box2 {
 	return s.bb
@@ -161,6 +198,16 @@ func (s *OffsetSDF2) Evaluate(p v2.Vec) float64 {
 	return s.sdf.Evaluate(p) - s.offset
 }
 
+// EvaluateInterval returns an interval containing the values of an offset SDF2 within a box.
+func (s *OffsetSDF2) EvaluateInterval(b Box2) Interval {
+	return EvaluateInterval2(s.sdf, b).offset(-s.offset)
+}
+
+// Gradient returns the gradient of an offset SDF2.
+func (s *OffsetSDF2) Gradient(p v2.Vec, eps float64) v2.Vec {
+	return Gradient2(s.sdf, p, eps)
+}
+
 // BoundingBox returns the bounding box of an offset SDF2.
 func (s *OffsetSDF2) BoundingBox() Box2 {
 	return s.bb
@@ -170,10 +217,11 @@ func (s *OffsetSDF2) BoundingBox() Box2 {
 
 // IntersectionSDF2 is the intersection of two SDF2s.
 type IntersectionSDF2 struct {
-	s0  SDF2
-	s1  SDF2
-	max MaxFunc
-	bb  Box2
+	s0    SDF2
+	s1    SDF2
+	max   MaxFunc
+	blend blendParms // blend used to make the max function (for serialization)
+	bb    Box2
 }
 
 // Intersect2D returns the intersection of two SDF2s.
@@ -197,9 +245,35 @@ func (s *IntersectionSDF2) Evaluate(p v2.Vec) float64 {
 
 // SetMax sets the maximum function to control blending.
 func (s *IntersectionSDF2) SetMax(max MaxFunc) {
+	s.blend = blendParms{custom: !isMax(max)}
 	s.max = max
 }
 
+// SetBlend sets a blended maximum function with a blend size k, max(a, b) = -min(-a, -b).
+// A nil blend is math.Max. Unlike SetMax, the intersection can be serialized.
+func (s *IntersectionSDF2) SetBlend(blend *Blend, k float64) {
+	s.SetMax(blend.max(k))
+	s.blend = blendParms{blend: blend, k: k}
+}
+
+// EvaluateInterval returns an interval containing the values of the SDF2 intersection within a box.
+func (s *IntersectionSDF2) EvaluateInterval(b Box2) Interval {
+	return maxInterval(s.max, EvaluateInterval2(s.s0, b), EvaluateInterval2(s.s1, b))
+}
+
+// Gradient returns the gradient of the SDF2 intersection.
+func (s *IntersectionSDF2) Gradient(p v2.Vec, eps float64) v2.Vec {
+	k0, k1 := blendPartials(s.max, s.s0.Evaluate(p), s.s1.Evaluate(p))
+	var g v2.Vec
+	if k0 != 0 {
+		g = Gradient2(s.s0, p, eps).MulScalar(k0)
+	}
+	if k1 != 0 {
+		g = g.Add(Gradient2(s.s1, p, eps).MulScalar(k1))
+	}
+	return g
+}
+
 // BoundingBox returns the bounding box of an SDF2 intersection.
 func (s *IntersectionSDF2) BoundingBox() Box2 {
 	return s.bb
@@ -213,6 +287,7 @@ type CutSDF2 struct {
 	sdf SDF2
 	a   v2.Vec // point on line
 	n   v2.Vec // normal to line
+	v   v2.Vec // direction of the line (for serialization)
 	bb  Box2   // bounding box
 }
 
@@ -222,6 +297,7 @@ func Cut2D(sdf SDF2, a, v v2.Vec) SDF2 {
 	s := CutSDF2{}
 	s.sdf = sdf
 	s.a = a
+	s.v = v
 	v = v.Normalize()
 	s.n = v2.Vec{-v.Y, v.X}
 	// TODO - cut the bounding box
@@ -234,6 +310,19 @@ func (s *CutSDF2) Evaluate(p v2.Vec) float64 {
 	return math.Max(p.Sub(s.a).Dot(s.n), s.sdf.Evaluate(p))
 }
 
+// EvaluateInterval returns an interval containing the values of the cut SDF2 within a box.
+func (s *CutSDF2) EvaluateInterval(b Box2) Interval {
+	return maxInterval(math.Max, linearInterval2(s.n, -s.a.Dot(s.n), b), EvaluateInterval2(s.sdf, b))
+}
+
+// Gradient returns the gradient of the cut SDF2.
+func (s *CutSDF2) Gradient(p v2.Vec, eps float64) v2.Vec {
+	if p.Sub(s.a).Dot(s.n) > s.sdf.Evaluate(p) {
+		return s.n
+	}
+	return Gradient2(s.sdf, p, eps)
+}
+
 // BoundingBox returns the bounding box for the cut SDF2.
 func (s *CutSDF2) BoundingBox() Box2 {
 	return s.bb
@@ -244,9 +333,10 @@ func (s *CutSDF2) BoundingBox() Box2 {
 
 // TransformSDF2 transorms an SDF2 with rotation, translation and scaling.
 type TransformSDF2 struct {
-	sdf  SDF2
-	mInv M33
-	bb   Box2
+	sdf    SDF2
+	matrix M33
+	mInv   M33
+	bb     Box2
 }
 
 // Transform2D applies a transformation matrix to an SDF2.
@@ -254,6 +344,7 @@ type TransformSDF2 struct {
 func Transform2D(sdf SDF2, m M33) SDF2 {
 	s := TransformSDF2{}
 	s.sdf = sdf
+	s.matrix = m
 	s.mInv = m.Inverse()
 	s.bb = m.MulBox(sdf.BoundingBox())
 	return &s
@@ -266,6 +357,27 @@ func (s *TransformSDF2) Evaluate(p v2.Vec) float64 {
 	return s.sdf.Evaluate(q)
 }
 
+// EvaluateInterval returns an interval containing the values of a transformed SDF2 within a box.
+func (s *TransformSDF2) EvaluateInterval(b Box2) Interval {
+	return EvaluateInterval2(s.sdf, s.mInv.MulBox(b))
+}
+
+// Gradient returns the gradient of a transformed SDF2.
+func (s *TransformSDF2) Gradient(p v2.Vec, eps float64) v2.Vec {
+	return s.mInv.mulTranspose(Gradient2(s.sdf, s.mInv.MulPosition(p), eps))
+}
+
+// EvaluateBatch evaluates a transformed SDF2 at a slice of points.
+func (s *TransformSDF2) EvaluateBatch(ps []v2.Vec, out []float64) {
+	b := getBatch2(len(ps))
+	defer putBatch2(b)
+	q := *b
+	for i, p := range ps {
+		q[i] = s.mInv.MulPosition(p)
+	}
+	EvaluateBatch2(s.sdf, q, out)
+}
+
 // BoundingBox returns the bounding box of a transformed SDF2.
 func (s *TransformSDF2) BoundingBox() Box2 {
 	return s.bb
@@ -299,6 +411,17 @@ func (s *ScaleUniformSDF2) Evaluate(p v2.Vec) float64 {
 	return s.sdf.Evaluate(q) * s.k
 }
 
+// EvaluateInterval returns an interval containing the values of an SDF2 with uniform scaling within a box.
+func (s *ScaleUniformSDF2) EvaluateInterval(b Box2) Interval {
+	d := EvaluateInterval2(s.sdf, Scale2d(v2.Vec{s.invk, s.invk}).MulBox(b))
+	return Interval{d[0] * s.k, d[1] * s.k}.Sort()
+}
+
+// Gradient returns the gradient of an SDF2 with uniform scaling.
+func (s *ScaleUniformSDF2) Gradient(p v2.Vec, eps float64) v2.Vec {
+	return Gradient2(s.sdf, p.MulScalar(s.invk), eps)
+}
+
 // BoundingBox returns the bounding box of an SDF2 with uniform scaling.
 func (s *ScaleUniformSDF2) BoundingBox() Box2 {
 	return s.bb
@@ -325,11 +448,15 @@ func CenterAndScale2D(s SDF2, k float64) SDF2 {
 
 // ArraySDF2 defines an XY grid array of an existing SDF2.
 type ArraySDF2 struct {
-	sdf  SDF2
-	num  v2i.Vec // grid size
-	step v2.Vec  // grid step size
-	min  MinFunc
-	bb   Box2
+	sdf   SDF2
+	num   v2i.Vec // grid size
+	step  v2.Vec  // grid step size
+	min   MinFunc
+	blend blendParms // blend used to make the min function (for serialization)
+	bb    Box2
+	// lattice evaluates the nearest copies when min is math.Min, the copies don't overlap
+	// and the sdf is exact outside its bounding box (nil otherwise)
+	lattice *lattice2
 }
 
 // Array2D returns an XY grid array of an existing SDF2.
@@ -347,16 +474,43 @@ func Array2D(sdf SDF2, num v2i.Vec, step v2.Vec) SDF2 {
 	bb0 := sdf.BoundingBox()
 	bb1 := bb0.Translate(step.Mul(conv.V2iToV2(num.SubScalar(1))))
 	s.bb = bb0.Extend(bb1)
+	s.setLattice()
 	return &s
 }
 
 // SetMin sets the minimum function to control blending.
 func (s *ArraySDF2) SetMin(min MinFunc) {
+	s.blend = blendParms{custom: !isMin(min)}
 	s.min = min
+	s.setLattice()
+}
+
+// setLattice sets the lattice if it gives the same result as evaluating every copy.
+func (s *ArraySDF2) setLattice() {
+	s.lattice = nil
+	if !isMin(s.min) || !bvhExact2(s.sdf) {
+		return
+	}
+	size := s.sdf.BoundingBox().Size()
+	if latticeDisjoint(s.step.X, s.num.X, size.X) &&
+		latticeDisjoint(s.step.Y, s.num.Y, size.Y) {
+		s.lattice = newLattice2(s.sdf, s.num, s.step, true)
+	}
+}
+
+// SetBlend sets a blended minimum function with a blend size k (a nil blend is math.Min).
+// Unlike SetMin, the array can be serialized.
+func (s *ArraySDF2) SetBlend(blend *Blend, k float64) {
+	s.SetMin(blend.min(k))
+	s.blend = blendParms{blend: blend, k: k}
 }
 
 // Evaluate returns the minimum distance to a grid array of SDF2s.
 func (s *ArraySDF2) Evaluate(p v2.Vec) float64 {
+	if s.lattice != nil {
+		d, _ := s.lattice.evaluate(s.sdf, p)
+		return d
+	}
 	d := math.MaxFloat64
 	for j := 0; j < s.num.X; j++ {
 		for k := 0; k < s.num.Y; k++ {
@@ -367,6 +521,42 @@ func (s *ArraySDF2) Evaluate(p v2.Vec) float64 {
 	return d
 }
 
+// EvaluateInterval returns an interval containing the values of a grid array of SDF2s within a box.
+func (s *ArraySDF2) EvaluateInterval(b Box2) Interval {
+	d := Interval{math.MaxFloat64, math.MaxFloat64}
+	for j := 0; j < s.num.X; j++ {
+		for k := 0; k < s.num.Y; k++ {
+			x := b.Translate(v2.Vec{float64(j) * s.step.X, float64(k) * s.step.Y}.Neg())
+			d = minInterval(s.min, d, EvaluateInterval2(s.sdf, x))
+		}
+	}
+	return d
+}
+
+// Gradient returns the gradient of a grid array of SDF2s.
+func (s *ArraySDF2) Gradient(p v2.Vec, eps float64) v2.Vec {
+	if s.lattice != nil {
+		_, q := s.lattice.evaluate(s.sdf, p)
+		return Gradient2(s.sdf, q, eps)
+	}
+	var x []v2.Vec
+	var d []float64
+	for j := 0; j < s.num.X; j++ {
+		for k := 0; k < s.num.Y; k++ {
+			q := p.Sub(v2.Vec{float64(j) * s.step.X, float64(k) * s.step.Y})
+			x = append(x, q)
+			d = append(d, s.sdf.Evaluate(q))
+		}
+	}
+	var g v2.Vec
+	for i, w := range blendWeights(s.min, d) {
+		if w != 0 {
+			g = g.Add(Gradient2(s.sdf, x[i], eps).MulScalar(w))
+		}
+	}
+	return g
+}
+
 // BoundingBox returns the bounding box of a grid array of SDF2s.
 func (s *ArraySDF2) BoundingBox() Box2 {
 	return s.bb
@@ -376,11 +566,13 @@ func (s *ArraySDF2) BoundingBox() Box2 {
 
 // RotateUnionSDF2 defines a union of rotated SDF2s.
 type RotateUnionSDF2 struct {
-	sdf  SDF2
-	num  int
-	step M33
-	min  MinFunc
-	bb   Box2
+	sdf    SDF2
+	num    int
+	step   M33
+	matrix M33 // step matrix passed to RotateUnion2D (for serialization)
+	min    MinFunc
+	blend  blendParms // blend used to make the min function (for serialization)
+	bb     Box2
 }
 
 // RotateUnion2D returns a union of rotated SDF2s.
@@ -393,6 +585,7 @@ func RotateUnion2D(sdf SDF2, num int, step M33) SDF2 {
 	s.sdf = sdf
 	s.num = num
 	s.step = step.Inverse()
+	s.matrix = step
 	s.min = math.Min
 	// work out the bounding box
 	v := sdf.BoundingBox().Vertices()
@@ -421,9 +614,47 @@ func (s *RotateUnionSDF2) Evaluate(p v2.Vec) float64 {
 
 // SetMin sets the minimum function to control blending.
 func (s *RotateUnionSDF2) SetMin(min MinFunc) {
+	s.blend = blendParms{custom: !isMin(min)}
 	s.min = min
 }
 
+// SetBlend sets a blended minimum function with a blend size k (a nil blend is math.Min).
+// Unlike SetMin, the union can be serialized.
+func (s *RotateUnionSDF2) SetBlend(blend *Blend, k float64) {
+	s.SetMin(blend.min(k))
+	s.blend = blendParms{blend: blend, k: k}
+}
+
+// EvaluateInterval returns an interval containing the values of a union of rotated SDF2s within a box.
+func (s *RotateUnionSDF2) EvaluateInterval(b Box2) Interval {
+	d := Interval{math.MaxFloat64, math.MaxFloat64}
+	rot := Identity2d()
+	for i := 0; i < s.num; i++ {
+		d = minInterval(s.min, d, EvaluateInterval2(s.sdf, rot.MulBox(b)))
+		rot = rot.Mul(s.step)
+	}
+	return d
+}
+
+// Gradient returns the gradient of a rotate/union object.
+func (s *RotateUnionSDF2) Gradient(p v2.Vec, eps float64) v2.Vec {
+	rot := make([]M33, s.num)
+	d := make([]float64, s.num)
+	m := Identity2d()
+	for i := range rot {
+		rot[i] = m
+		d[i] = s.sdf.Evaluate(m.MulPosition(p))
+		m = m.Mul(s.step)
+	}
+	var g v2.Vec
+	for i, w := range blendWeights(s.min, d) {
+		if w != 0 {
+			g = g.Add(rot[i].mulTranspose(Gradient2(s.sdf, rot[i].MulPosition(p), eps)).MulScalar(w))
+		}
+	}
+	return g
+}
+
 // BoundingBox returns the bounding box of a union of rotated SDF2s.
 func (s *RotateUnionSDF2) BoundingBox() Box2 {
 	return s.bb
@@ -468,6 +699,11 @@ func (s *RotateCopySDF2) Evaluate(p v2.Vec) float64 {
 	return s.sdf.Evaluate(pnew)
 }
 
+// EvaluateInterval returns an interval containing the values of a rotate/copy SDF2 within a box.
+func (s *RotateCopySDF2) EvaluateInterval(b Box2) Interval {
+	return EvaluateInterval2(s.sdf, sectorBox2(b, s.theta))
+}
+
 // BoundingBox returns the bounding box of a rotate/copy SDF2.
 func (s *RotateCopySDF2) BoundingBox() Box2 {
 	return s.bb
@@ -481,6 +717,7 @@ type SliceSDF2 struct {
 	a   v3.Vec // 3d point for 2d origin
 	u   v3.Vec // vector for the 2d x-axis
 	v   v3.Vec // vector for the 2d y-axis
+	n   v3.Vec // normal to the slicing plane (for serialization)
 	bb  Box2   // bounding box
 }
 
@@ -493,6 +730,7 @@ func Slice2D(
 	s := SliceSDF2{}
 	s.sdf = sdf
 	s.a = a
+	s.n = n
 	// work out the x/y vectors on the plane.
 	if n.X == 0 {
 		s.u = v3.Vec{1, 0, 0}
@@ -530,6 +768,21 @@ func (s *SliceSDF2) Evaluate(p v2.Vec) float64 {
 	return s.sdf.Evaluate(pnew)
 }
 
+// Gradient returns the gradient of the sliced SDF2.
+func (s *SliceSDF2) Gradient(p v2.Vec, eps float64) v2.Vec {
+	g := Gradient3(s.sdf, s.a.Add(s.u.MulScalar(p.X)).Add(s.v.MulScalar(p.Y)), eps)
+	return v2.Vec{g.Dot(s.u), g.Dot(s.v)}
+}
+
+// EvaluateInterval returns an interval containing the values of the sliced SDF2 within a box.
+func (s *SliceSDF2) EvaluateInterval(b Box2) Interval {
+	v := v3.VecSet{}
+	for _, x := range b.Vertices() {
+		v = append(v, s.a.Add(s.u.MulScalar(x.X)).Add(s.v.MulScalar(x.Y)))
+	}
+	return EvaluateInterval3(s.sdf, Box3{v.Min(), v.Max()})
+}
+
 // BoundingBox returns the bounding box of the sliced SDF2.
 func (s *SliceSDF2) BoundingBox() Box2 {
 	return s.bb
@@ -539,9 +792,11 @@ func (s *SliceSDF2) BoundingBox() Box2 {
 
 // UnionSDF2 is a union of multiple SDF2 objects.
 type UnionSDF2 struct {
-	sdf []SDF2
-	min MinFunc
-	bb  Box2
+	sdf   []SDF2
+	min   MinFunc
+	blend blendParms // blend used to make the min function (for serialization)
+	bb    Box2
+	bvh   *bvh2 // bounding volume hierarchy (math.Min only)
 }
 
 // Union2D returns the union of multiple SDF2 objects.
@@ -571,11 +826,30 @@ func Union2D(sdf ...SDF2) SDF2 {
 	}
 	s.bb = bb
 	s.min = math.Min
+	s.setBVH()
 	return &s
 }
 
+// setBVH builds a BVH for the union if the BVH search gives the same minimum as evaluating every member.
+func (s *UnionSDF2) setBVH() {
+	s.bvh = nil
+	if len(s.sdf) < bvhMinSize || !isMin(s.min) {
+		// the BVH search only works for math.Min
+		return
+	}
+	for _, x := range s.sdf {
+		if !bvhExact2(x) {
+			return
+		}
+	}
+	s.bvh = newBVH2(s.sdf)
+}
+
 // Evaluate returns the minimum distance to the SDF2 union.
 func (s *UnionSDF2) Evaluate(p v2.Vec) float64 {
+	if s.bvh != nil {
+		return s.bvh.min(s.sdf, p)
+	}
 
 	// work out the min/max distance for every bounding box
 	vs := make([]Interval, len(s.sdf))
@@ -624,7 +898,57 @@ func (s *UnionSDF2) EvaluateSlow(p v2.Vec) float64 {
 
 // SetMin sets the minimum function to control SDF2 blending.
 func (s *UnionSDF2) SetMin(min MinFunc) {
+	s.blend = blendParms{custom: !isMin(min)}
 	s.min = min
+	s.setBVH()
+}
+
+// SetBlend sets a blended minimum function with a blend size k (a nil blend is math.Min).
+// Unlike SetMin, the union can be serialized.
+func (s *UnionSDF2) SetBlend(blend *Blend, k float64) {
+	s.SetMin(blend.min(k))
+	s.blend = blendParms{blend: blend, k: k}
+}
+
+// EvaluateInterval returns an interval containing the values of the SDF2 union within a box.
+func (s *UnionSDF2) EvaluateInterval(b Box2) Interval {
+	var d Interval
+	for i, x := range s.sdf {
+		if i == 0 {
+			d = EvaluateInterval2(x, b)
+		} else {
+			d = minInterval(s.min, d, EvaluateInterval2(x, b))
+		}
+	}
+	return d
+}
+
+// Gradient returns the gradient of the SDF2 union.
+func (s *UnionSDF2) Gradient(p v2.Vec, eps float64) v2.Vec {
+	// consider the same sdfs as Evaluate
+	vs := make([]Interval, len(s.sdf))
+	minIndex := 0
+	for i := range s.sdf {
+		vs[i] = s.sdf[i].BoundingBox().MinMaxDist2(p)
+		if vs[i][0] < vs[minIndex][0] {
+			minIndex = i
+		}
+	}
+	var idx []int
+	var d []float64
+	for i := range s.sdf {
+		if i == minIndex || vs[minIndex].Overlap(vs[i]) {
+			idx = append(idx, i)
+			d = append(d, s.sdf[i].Evaluate(p))
+		}
+	}
+	var g v2.Vec
+	for i, w := range blendWeights(s.min, d) {
+		if w != 0 {
+			g = g.Add(Gradient2(s.sdf[idx[i]], p, eps).MulScalar(w))
+		}
+	}
+	return g
 }
 
 // BoundingBox returns the bounding box of an SDF2 union.
@@ -636,10 +960,11 @@ func (s *UnionSDF2) BoundingBox() Box2 {
 
 // DifferenceSDF2 is the difference of two SDF2s.
 type DifferenceSDF2 struct {
-	s0  SDF2
-	s1  SDF2
-	max MaxFunc
-	bb  Box2
+	s0    SDF2
+	s1    SDF2
+	max   MaxFunc
+	blend blendParms // blend used to make the max function (for serialization)
+	bb    Box2
 }
 
 // Difference2D returns the difference of two SDF2 objects, s0 - s1.
@@ -665,9 +990,35 @@ func (s *DifferenceSDF2) Evaluate(p v2.Vec) float64 {
 
 // SetMax sets the maximum function to control blending.
 func (s *DifferenceSDF2) SetMax(max MaxFunc) {
+	s.blend = blendParms{custom: !isMax(max)}
 	s.max = max
 }
 
+// SetBlend sets a blended maximum function with a blend size k, max(a, b) = -min(-a, -b).
+// A nil blend is math.Max. Unlike SetMax, the difference can be serialized.
+func (s *DifferenceSDF2) SetBlend(blend *Blend, k float64) {
+	s.SetMax(blend.max(k))
+	s.blend = blendParms{blend: blend, k: k}
+}
+
+// EvaluateInterval returns an interval containing the values of the difference of two SDF2s within a box.
+func (s *DifferenceSDF2) EvaluateInterval(b Box2) Interval {
+	return maxInterval(s.max, EvaluateInterval2(s.s0, b), EvaluateInterval2(s.s1, b).neg())
+}
+
+// Gradient returns the gradient of the difference of two SDF2s.
+func (s *DifferenceSDF2) Gradient(p v2.Vec, eps float64) v2.Vec {
+	k0, k1 := blendPartials(s.max, s.s0.Evaluate(p), -s.s1.Evaluate(p))
+	var g v2.Vec
+	if k0 != 0 {
+		g = Gradient2(s.s0, p, eps).MulScalar(k0)
+	}
+	if k1 != 0 {
+		g = g.Sub(Gradient2(s.s1, p, eps).MulScalar(k1))
+	}
+	return g
+}
+
 // BoundingBox returns the bounding box of the difference of two SDF2s.
 func (s *DifferenceSDF2) BoundingBox() Box2 {
 	return s.bb
@@ -704,6 +1055,28 @@ func (s *ElongateSDF2) Evaluate(p v2.Vec) float64 {
 	return s.sdf.Evaluate(q)
 }
 
+// EvaluateInterval returns an interval containing the values of an elongated SDF2 within a box.
+func (s *ElongateSDF2) EvaluateInterval(b Box2) Interval {
+	// p - clamp(p) is monotonic on each axis
+	q0 := b.Min.Sub(b.Min.Clamp(s.hn, s.hp))
+	q1 := b.Max.Sub(b.Max.Clamp(s.hn, s.hp))
+	return EvaluateInterval2(s.sdf, Box2{q0, q1})
+}
+
+// Gradient returns the gradient of an elongated SDF2.
+func (s *ElongateSDF2) Gradient(p v2.Vec, eps float64) v2.Vec {
+	q := p.Sub(p.Clamp(s.hn, s.hp))
+	g := Gradient2(s.sdf, q, eps)
+	// the distance doesn't change along the elongated axes
+	if q.X == 0 {
+		g.X = 0
+	}
+	if q.Y == 0 {
+		g.Y = 0
+	}
+	return g
+}
+
 // BoundingBox returns the bounding box of an elongated SDF2.
 func (s *ElongateSDF2) BoundingBox() Box2 {
 	return s.bb
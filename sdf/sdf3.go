@@ -136,6 +136,42 @@ func (s *SorSDF3) Evaluate(p v3.Vec) float64 {
 	return math.Max(a, b)
 }
 
+// EvaluateInterval returns an interval containing the values of a solid of revolution within a box.
+func (s *SorSDF3) EvaluateInterval(b Box3) Interval {
+	xy := Box2{v2.Vec{b.Min.X, b.Min.Y}, v2.Vec{b.Max.X, b.Max.Y}}
+	r := radialInterval(xy)
+	a := EvaluateInterval2(s.sdf, Box2{v2.Vec{r[0], b.Min.Z}, v2.Vec{r[1], b.Max.Z}})
+	if s.theta != 0 {
+		d := linearInterval2(s.norm, 0, xy)
+		y := Interval{-b.Max.Y, -b.Min.Y}
+		if s.theta < Pi {
+			a = maxInterval(math.Max, a, maxInterval(math.Max, y, d))
+		} else {
+			a = maxInterval(math.Max, a, minInterval(math.Min, y, d))
+		}
+	}
+	return a
+}
+
+// Gradient returns the gradient of a solid of revolution.
+func (s *SorSDF3) Gradient(p v3.Vec, eps float64) v3.Vec {
+	x := math.Sqrt(p.X*p.X + p.Y*p.Y)
+	q := v2.Vec{x, p.Z}
+	if s.theta != 0 {
+		// is a wedge plane closer than the revolved surface?
+		a := s.sdf.Evaluate(q)
+		d := s.norm.Dot(v2.Vec{p.X, p.Y})
+		if (s.theta < Pi) == (-p.Y > d) {
+			if -p.Y > a {
+				return v3.Vec{0, -1, 0}
+			}
+		} else if d > a {
+			return v3.Vec{s.norm.X, s.norm.Y, 0}
+		}
+	}
+	return sorGradient(Gradient2(s.sdf, q, eps), p)
+}
+
 // BoundingBox returns the bounding box for a solid of revolution.
 func (s *SorSDF3) BoundingBox() Box3 {
 	return s.bb
@@ -148,6 +184,9 @@ type ExtrudeSDF3 struct {
 	sdf     SDF2
 	height  float64
 	extrude ExtrudeFunc
+	twist   float64 // twist over the height of the extrusion
+	scale   v2.Vec  // scale at the top of the extrusion
+	custom  bool    // the extrusion function has been set by the user
 	bb      Box3
 }
 
@@ -157,6 +196,7 @@ func Extrude3D(sdf SDF2, height float64) SDF3 {
 	s.sdf = sdf
 	s.height = height / 2
 	s.extrude = NormalExtrude
+	s.scale = v2.Vec{1, 1}
 	// work out the bounding box
 	bb := sdf.BoundingBox()
 	s.bb = Box3{v3.Vec{bb.Min.X, bb.Min.Y, -s.height}, v3.Vec{bb.Max.X, bb.Max.Y, s.height}}
@@ -169,6 +209,8 @@ func TwistExtrude3D(sdf SDF2, height, twist float64) SDF3 {
 	s.sdf = sdf
 	s.height = height / 2
 	s.extrude = TwistExtrude(height, twist)
+	s.twist = twist
+	s.scale = v2.Vec{1, 1}
 	// work out the bounding box
 	bb := sdf.BoundingBox()
 	l := bb.Max.Length()
@@ -182,6 +224,7 @@ func ScaleExtrude3D(sdf SDF2, height float64, scale v2.Vec) SDF3 {
 	s.sdf = sdf
 	s.height = height / 2
 	s.extrude = ScaleExtrude(height, scale)
+	s.scale = scale
 	// work out the bounding box
 	bb := sdf.BoundingBox()
 	bb = bb.Extend(Box2{bb.Min.Mul(scale), bb.Max.Mul(scale)})
@@ -195,6 +238,8 @@ func ScaleTwistExtrude3D(sdf SDF2, height, twist float64, scale v2.Vec) SDF3 {
 	s.sdf = sdf
 	s.height = height / 2
 	s.extrude = ScaleTwistExtrude(height, twist, scale)
+	s.twist = twist
+	s.scale = scale
 	// work out the bounding box
 	bb := sdf.BoundingBox()
 	bb = bb.Extend(Box2{bb.Min.Mul(scale), bb.Max.Mul(scale)})
@@ -216,6 +261,68 @@ func (s *ExtrudeSDF3) Evaluate(p v3.Vec) float64 {
 // SetExtrude sets the extrusion control function.
 func (s *ExtrudeSDF3) SetExtrude(extrude ExtrudeFunc) {
 	s.extrude = extrude
+	s.custom = true
+}
+
+// EvaluateInterval returns an interval containing the values of an extrusion within a box.
+func (s *ExtrudeSDF3) EvaluateInterval(b Box3) Interval {
+	if s.custom {
+		// we don't know how the extrusion function maps the box
+		return unboundedInterval
+	}
+	h := 2 * s.height
+	z := Interval{b.Min.Z, b.Max.Z}
+	// scaling (see ScaleExtrude)
+	inv := v2.Vec{1 / s.scale.X, 1 / s.scale.Y}
+	m := inv.Sub(v2.Vec{1, 1}).DivScalar(h)
+	c := inv.MulScalar(0.5).AddScalar(0.5)
+	x := Interval{b.Min.X, b.Max.X}.mul(Interval{m.X*z[0] + c.X, m.X*z[1] + c.X}.Sort())
+	y := Interval{b.Min.Y, b.Max.Y}.mul(Interval{m.Y*z[0] + c.Y, m.Y*z[1] + c.Y}.Sort())
+	bb := Box2{v2.Vec{x[0], y[0]}, v2.Vec{x[1], y[1]}}
+	// twisting (see TwistExtrude)
+	if s.twist != 0 {
+		k := s.twist / h
+		bb = rotateBox2(bb, Interval{k * z[0], k * z[1]}.Sort())
+	}
+	a := EvaluateInterval2(s.sdf, bb)
+	return maxInterval(math.Max, a, z.abs().offset(-s.height))
+}
+
+// Gradient returns the gradient of an extrusion.
+func (s *ExtrudeSDF3) Gradient(p v3.Vec, eps float64) v3.Vec {
+	if s.custom {
+		// we don't know the derivatives of the extrusion function
+		return centralGradient3(s, p, eps)
+	}
+	q := s.extrude(p)
+	if math.Abs(p.Z)-s.height > s.sdf.Evaluate(q) {
+		return v3.Vec{0, 0, sign(p.Z)}
+	}
+	g := Gradient2(s.sdf, q, eps)
+	// chain rule for the scaling and twisting of the extrusion
+	h := 2 * s.height
+	inv := v2.Vec{1 / s.scale.X, 1 / s.scale.Y}
+	m := inv.Sub(v2.Vec{1, 1}).DivScalar(h)
+	c := inv.MulScalar(0.5).AddScalar(0.5)
+	k := s.twist / h
+	gq := Rotate(p.Z * k).mulTranspose(g)
+	sc := m.MulScalar(p.Z).Add(c)
+	gz := gq.X*p.X*m.X + gq.Y*p.Y*m.Y + k*(g.Y*q.X-g.X*q.Y)
+	return v3.Vec{gq.X * sc.X, gq.Y * sc.Y, gz}
+}
+
+// EvaluateBatch evaluates an extrusion at a slice of points.
+func (s *ExtrudeSDF3) EvaluateBatch(ps []v3.Vec, out []float64) {
+	b := getBatch2(len(ps))
+	defer putBatch2(b)
+	q := *b
+	for i, p := range ps {
+		q[i] = s.extrude(p)
+	}
+	EvaluateBatch2(s.sdf, q, out)
+	for i, p := range ps {
+		out[i] = math.Max(out[i], math.Abs(p.Z)-s.height)
+	}
 }
 
 // BoundingBox returns the bounding box for an extrusion.
@@ -228,11 +335,48 @@ func (s *ExtrudeSDF3) BoundingBox() Box3 {
 // Note: The height of the extrusion is adjusted for the rounding.
 // The underlying SDF2 shape is not modified.
 
+// roundedMax combines the 2d distance (a) and the z distance (b) of a rounded extrusion.
+// It is monotonic in a and b.
+func roundedMax(a, b float64) float64 {
+	if b > 0 {
+		// outside the object Z extent
+		if a < 0 {
+			// inside the boundary
+			return b
+		}
+		// outside the boundary
+		return math.Sqrt((a * a) + (b * b))
+	}
+	// within the object Z extent
+	if a < 0 {
+		// inside the boundary
+		return math.Max(a, b)
+	}
+	// outside the boundary
+	return a
+}
+
+// roundedMaxPartials returns the partial derivatives of roundedMax with respect to a and b.
+func roundedMaxPartials(a, b float64) (float64, float64) {
+	if b > 0 {
+		if a < 0 {
+			return 0, 1
+		}
+		l := math.Sqrt((a * a) + (b * b))
+		return a / l, b / l
+	}
+	if a < 0 && b > a {
+		return 0, 1
+	}
+	return 1, 0
+}
+
 // ExtrudeRoundedSDF3 extrudes an SDF2 to an SDF3 with rounded edges.
 type ExtrudeRoundedSDF3 struct {
 	sdf    SDF2
 	height float64
 	round  float64
+	h      float64 // height of the extrusion (for serialization)
 	bb     Box3
 }
 
@@ -258,6 +402,7 @@ func ExtrudeRounded3D(sdf SDF2, height, round float64) (SDF3, error) {
 		sdf:    sdf,
 		height: (height / 2) - round,
 		round:  round,
+		h:      height,
 	}
 	// work out the bounding box
 	bb := sdf.BoundingBox()
@@ -270,27 +415,27 @@ func (s *ExtrudeRoundedSDF3) Evaluate(p v3.Vec) float64 {
 	// sdf for the projected 2d surface
 	a := s.sdf.Evaluate(v2.Vec{p.X, p.Y})
 	b := math.Abs(p.Z) - s.height
-	var d float64
-	if b > 0 {
-		// outside the object Z extent
-		if a < 0 {
-			// inside the boundary
-			d = b
-		} else {
-			// outside the boundary
-			d = math.Sqrt((a * a) + (b * b))
-		}
-	} else {
-		// within the object Z extent
-		if a < 0 {
-			// inside the boundary
-			d = math.Max(a, b)
-		} else {
-			// outside the boundary
-			d = a
-		}
+	return roundedMax(a, b) - s.round
+}
+
+// EvaluateInterval returns an interval containing the values of a rounded extrusion within a box.
+func (s *ExtrudeRoundedSDF3) EvaluateInterval(b Box3) Interval {
+	a := EvaluateInterval2(s.sdf, Box2{v2.Vec{b.Min.X, b.Min.Y}, v2.Vec{b.Max.X, b.Max.Y}})
+	z := Interval{b.Min.Z, b.Max.Z}.abs().offset(-s.height)
+	return Interval{roundedMax(a[0], z[0]), roundedMax(a[1], z[1])}.offset(-s.round)
+}
+
+// Gradient returns the gradient of a rounded extrusion.
+func (s *ExtrudeRoundedSDF3) Gradient(p v3.Vec, eps float64) v3.Vec {
+	q := v2.Vec{p.X, p.Y}
+	a := s.sdf.Evaluate(q)
+	b := math.Abs(p.Z) - s.height
+	ka, kb := roundedMaxPartials(a, b)
+	var g v2.Vec
+	if ka != 0 {
+		g = Gradient2(s.sdf, q, eps).MulScalar(ka)
 	}
-	return d - s.round
+	return v3.Vec{g.X, g.Y, kb * sign(p.Z)}
 }
 
 // BoundingBox returns the bounding box for a rounded extrusion.
@@ -307,6 +452,7 @@ type LoftSDF3 struct {
 	sdf0, sdf1 SDF2
 	height     float64
 	round      float64
+	h          float64 // height of the extrusion (for serialization)
 	bb         Box3
 }
 
@@ -332,6 +478,7 @@ func Loft3D(sdf0, sdf1 SDF2, height, round float64) (SDF3, error) {
 		sdf1:   sdf1,
 		height: (height / 2) - round,
 		round:  round,
+		h:      height,
 	}
 	// work out the bounding box
 	bb0 := sdf0.BoundingBox()
@@ -351,27 +498,39 @@ func (s *LoftSDF3) Evaluate(p v3.Vec) float64 {
 	a := Mix(a0, a1, k)
 
 	b := math.Abs(p.Z) - s.height
-	var d float64
-	if b > 0 {
-		// outside the object Z extent
-		if a < 0 {
-			// inside the boundary
-			d = b
-		} else {
-			// outside the boundary
-			d = math.Sqrt((a * a) + (b * b))
-		}
-	} else {
-		// within the object Z extent
-		if a < 0 {
-			// inside the boundary
-			d = math.Max(a, b)
-		} else {
-			// outside the boundary
-			d = a
+	return roundedMax(a, b) - s.round
+}
+
+// EvaluateInterval returns an interval containing the values of a loft extrusion within a box.
+func (s *LoftSDF3) EvaluateInterval(b Box3) Interval {
+	xy := Box2{v2.Vec{b.Min.X, b.Min.Y}, v2.Vec{b.Max.X, b.Max.Y}}
+	// the mix of the two SDF2s is between them
+	a := EvaluateInterval2(s.sdf0, xy).extend(EvaluateInterval2(s.sdf1, xy))
+	z := Interval{b.Min.Z, b.Max.Z}.abs().offset(-s.height)
+	return Interval{roundedMax(a[0], z[0]), roundedMax(a[1], z[1])}.offset(-s.round)
+}
+
+// Gradient returns the gradient of a loft extrusion.
+func (s *LoftSDF3) Gradient(p v3.Vec, eps float64) v3.Vec {
+	q := v2.Vec{p.X, p.Y}
+	k := Clamp((0.5*p.Z/s.height)+0.5, 0, 1)
+	a0 := s.sdf0.Evaluate(q)
+	a1 := s.sdf1.Evaluate(q)
+	a := Mix(a0, a1, k)
+	b := math.Abs(p.Z) - s.height
+	ka, kb := roundedMaxPartials(a, b)
+	var g v3.Vec
+	if ka != 0 {
+		g0 := Gradient2(s.sdf0, q, eps)
+		g1 := Gradient2(s.sdf1, q, eps)
+		gz := 0.0
+		if k > 0 && k < 1 {
+			gz = 0.5 * (a1 - a0) / s.height
 		}
+		g = v3.Vec{Mix(g0.X, g1.X, k), Mix(g0.Y, g1.Y, k), gz}.MulScalar(ka)
 	}
-	return d - s.round
+	g.Z += kb * sign(p.Z)
+	return g
 }
 
 // BoundingBox returns the bounding box for a loft extrusion.
@@ -410,6 +569,17 @@ func (s *BoxSDF3) Evaluate(p v3.Vec) float64 {
 	return sdfBox3d(p, s.size) - s.round
 }
 
+// EvaluateInterval returns an interval containing the values of a 3d box within a box.
+func (s *BoxSDF3) EvaluateInterval(b Box3) Interval {
+	// exact distance field of a convex solid
+	return convexInterval3(s, b)
+}
+
+// Gradient returns the gradient of a 3d box.
+func (s *BoxSDF3) Gradient(p v3.Vec, eps float64) v3.Vec {
+	return sdfBox3dGradient(p, s.size)
+}
+
 // BoundingBox returns the bounding box for a 3d box.
 func (s *BoxSDF3) BoundingBox() Box3 {
 	return s.bb
@@ -441,6 +611,18 @@ func (s *SphereSDF3) Evaluate(p v3.Vec) float64 {
 	return p.Length() - s.radius
 }
 
+// EvaluateInterval returns an interval containing the values of a sphere within a box.
+func (s *SphereSDF3) EvaluateInterval(b Box3) Interval {
+	// the farthest point is a vertex
+	d := b.Min.Abs().Max(b.Max.Abs()).Length()
+	return Interval{math.Sqrt(b.minDist2(v3.Vec{})) - s.radius, d - s.radius}
+}
+
+// Gradient returns the gradient of a sphere.
+func (s *SphereSDF3) Gradient(p v3.Vec, eps float64) v3.Vec {
+	return unitVector3(p)
+}
+
 // BoundingBox returns the bounding box for a sphere.
 func (s *SphereSDF3) BoundingBox() Box3 {
 	return s.bb
@@ -491,6 +673,18 @@ func (s *CylinderSDF3) Evaluate(p v3.Vec) float64 {
 	return d - s.round
 }
 
+// EvaluateInterval returns an interval containing the values of a cylinder within a box.
+func (s *CylinderSDF3) EvaluateInterval(b Box3) Interval {
+	// exact distance field of a convex solid
+	return convexInterval3(s, b)
+}
+
+// Gradient returns the gradient of a cylinder.
+func (s *CylinderSDF3) Gradient(p v3.Vec, eps float64) v3.Vec {
+	g := sdfBox2dGradient(v2.Vec{v2.Vec{p.X, p.Y}.Length(), p.Z}, v2.Vec{s.radius, s.height})
+	return sorGradient(g, p)
+}
+
 // BoundingBox returns the bounding box for a cylinder.
 func (s *CylinderSDF3) BoundingBox() Box3 {
 	return s.bb
@@ -508,6 +702,7 @@ type ConeSDF3 struct {
 	u      v2.Vec  // normalized cone slope vector
 	n      v2.Vec  // normal to cone slope (points outward)
 	l      float64 // length of cone slope
+	radii  v2.Vec  // base and top radii (for serialization)
 	bb     Box3    // bounding box
 }
 
@@ -523,6 +718,7 @@ func Cone3D(height, r0, r1, round float64) (SDF3, error) {
 		return nil, ErrMsg("height < 2 * round")
 	}
 	s := ConeSDF3{}
+	s.radii = v2.Vec{r0, r1}
 	s.height = (height / 2) - round
 	s.round = round
 	// cone slope vector and normal
@@ -572,6 +768,46 @@ func (s *ConeSDF3) Evaluate(p v3.Vec) float64 {
 	return p2.Sub(v2.Vec{s.r1, s.height}).Length() - s.round
 }
 
+// EvaluateInterval returns an interval containing the values of a truncated cone within a box.
+func (s *ConeSDF3) EvaluateInterval(b Box3) Interval {
+	// exact distance field of a convex solid
+	return convexInterval3(s, b)
+}
+
+// Gradient returns the gradient of a truncated cone.
+func (s *ConeSDF3) Gradient(p v3.Vec, eps float64) v3.Vec {
+	// convert to SoR 2d coordinates
+	p2 := v2.Vec{v2.Vec{p.X, p.Y}.Length(), p.Z}
+	var g v2.Vec
+	v := p2.Sub(v2.Vec{s.r0, -s.height})
+	dSlope := v.Dot(s.n)
+	t := v.Dot(s.u)
+	if p2.Y >= s.height && p2.X <= s.r1 {
+		// above the cone
+		g = v2.Vec{0, 1}
+	} else if p2.Y <= -s.height && p2.X <= s.r0 {
+		// below the cone
+		g = v2.Vec{0, -1}
+	} else if dSlope < 0 && math.Abs(p2.Y) < s.height {
+		// inside the cone
+		if -dSlope < s.height-math.Abs(p2.Y) {
+			g = s.n
+		} else {
+			g = v2.Vec{0, sign(p2.Y)}
+		}
+	} else if t >= 0 && t <= s.l {
+		// closest to the slope line
+		g = s.n
+	} else if t < 0 {
+		// closest to the base radius vertex
+		g = unitVector2(v)
+	} else {
+		// closest to the top radius vertex
+		g = unitVector2(p2.Sub(v2.Vec{s.r1, s.height}))
+	}
+	return sorGradient(g, p)
+}
+
 // BoundingBox return the bounding box for the trucated cone..
 func (s *ConeSDF3) BoundingBox() Box3 {
 	return s.bb
@@ -604,6 +840,27 @@ func (s *TransformSDF3) Evaluate(p v3.Vec) float64 {
 	return s.sdf.Evaluate(s.inverse.MulPosition(p))
 }
 
+// EvaluateInterval returns an interval containing the values of a transformed SDF3 within a box.
+func (s *TransformSDF3) EvaluateInterval(b Box3) Interval {
+	return EvaluateInterval3(s.sdf, s.inverse.MulBox(b))
+}
+
+// Gradient returns the gradient of a transformed SDF3.
+func (s *TransformSDF3) Gradient(p v3.Vec, eps float64) v3.Vec {
+	return s.inverse.mulTranspose(Gradient3(s.sdf, s.inverse.MulPosition(p), eps))
+}
+
+// EvaluateBatch evaluates a transformed SDF3 at a slice of points.
+func (s *TransformSDF3) EvaluateBatch(ps []v3.Vec, out []float64) {
+	b := getBatch3(len(ps))
+	defer putBatch3(b)
+	q := *b
+	for i, p := range ps {
+		q[i] = s.inverse.MulPosition(p)
+	}
+	EvaluateBatch3(s.sdf, q, out)
+}
+
 // BoundingBox returns the bounding box of a transformed SDF3.
 func (s *TransformSDF3) BoundingBox() Box3 {
 	return s.bb
@@ -637,6 +894,17 @@ func (s *ScaleUniformSDF3) Evaluate(p v3.Vec) float64 {
 	return s.sdf.Evaluate(q) * s.k
 }
 
+// EvaluateInterval returns an interval containing the values of a uniformly scaled SDF3 within a box.
+func (s *ScaleUniformSDF3) EvaluateInterval(b Box3) Interval {
+	d := EvaluateInterval3(s.sdf, Scale3d(v3.Vec{s.invK, s.invK, s.invK}).MulBox(b))
+	return Interval{d[0] * s.k, d[1] * s.k}.Sort()
+}
+
+// Gradient returns the gradient of a uniformly scaled SDF3.
+func (s *ScaleUniformSDF3) Gradient(p v3.Vec, eps float64) v3.Vec {
+	return Gradient3(s.sdf, p.MulScalar(s.invK), eps)
+}
+
 // BoundingBox returns the bounding box of a uniformly scaled SDF3.
 func (s *ScaleUniformSDF3) BoundingBox() Box3 {
 	return s.bb
@@ -646,9 +914,11 @@ func (s *ScaleUniformSDF3) BoundingBox() Box3 {
 
 // UnionSDF3 is a union of SDF3s.
 type UnionSDF3 struct {
-	sdf []SDF3
-	min MinFunc
-	bb  Box3
+	sdf   []SDF3
+	min   MinFunc
+	blend blendParms // blend used to make the min function (for serialization)
+	bb    Box3
+	bvh   *bvh3 // bounding volume hierarchy (math.Min only)
 }
 
 // Union3D returns the union of multiple SDF3 objects.
@@ -678,11 +948,30 @@ func Union3D(sdf ...SDF3) SDF3 {
 	}
 	s.bb = bb
 	s.min = math.Min
+	s.setBVH()
 	return &s
 }
 
+// setBVH builds a BVH for the union if the BVH search gives the same minimum as evaluating every member.
+func (s *UnionSDF3) setBVH() {
+	s.bvh = nil
+	if len(s.sdf) < bvhMinSize || !isMin(s.min) {
+		// the BVH search only works for math.Min
+		return
+	}
+	for _, x := range s.sdf {
+		if !bvhExact3(x) {
+			return
+		}
+	}
+	s.bvh = newBVH3(s.sdf)
+}
+
 // Evaluate returns the minimum distance to an SDF3 union.
 func (s *UnionSDF3) Evaluate(p v3.Vec) float64 {
+	if s.bvh != nil {
+		return s.bvh.min(s.sdf, p)
+	}
 	var d float64
 	for i, x := range s.sdf {
 		if i == 0 {
@@ -696,7 +985,67 @@ func (s *UnionSDF3) Evaluate(p v3.Vec) float64 {
 
 // SetMin sets the minimum function to control blending.
 func (s *UnionSDF3) SetMin(min MinFunc) {
+	s.blend = blendParms{custom: !isMin(min)}
 	s.min = min
+	s.setBVH()
+}
+
+// SetBlend sets a blended minimum function with a blend size k (a nil blend is math.Min).
+// Unlike SetMin, the union can be serialized.
+func (s *UnionSDF3) SetBlend(blend *Blend, k float64) {
+	s.SetMin(blend.min(k))
+	s.blend = blendParms{blend: blend, k: k}
+}
+
+// EvaluateInterval returns an interval containing the values of an SDF3 union within a box.
+func (s *UnionSDF3) EvaluateInterval(b Box3) Interval {
+	var d Interval
+	for i, x := range s.sdf {
+		if i == 0 {
+			d = EvaluateInterval3(x, b)
+		} else {
+			d = minInterval(s.min, d, EvaluateInterval3(x, b))
+		}
+	}
+	return d
+}
+
+// Gradient returns the gradient of an SDF3 union.
+func (s *UnionSDF3) Gradient(p v3.Vec, eps float64) v3.Vec {
+	d := make([]float64, len(s.sdf))
+	for i, x := range s.sdf {
+		d[i] = x.Evaluate(p)
+	}
+	var g v3.Vec
+	for i, w := range blendWeights(s.min, d) {
+		if w != 0 {
+			g = g.Add(Gradient3(s.sdf[i], p, eps).MulScalar(w))
+		}
+	}
+	return g
+}
+
+// EvaluateBatch evaluates an SDF3 union at a slice of points.
+func (s *UnionSDF3) EvaluateBatch(ps []v3.Vec, out []float64) {
+	if s.bvh != nil {
+		for i, p := range ps {
+			out[i] = s.bvh.min(s.sdf, p)
+		}
+		return
+	}
+	EvaluateBatch3(s.sdf[0], ps, out)
+	if len(s.sdf) == 1 {
+		return
+	}
+	b := getBatch1(len(ps))
+	defer putBatch1(b)
+	d := *b
+	for _, x := range s.sdf[1:] {
+		EvaluateBatch3(x, ps, d)
+		for j := range ps {
+			out[j] = s.min(out[j], d[j])
+		}
+	}
 }
 
 // BoundingBox returns the bounding box of an SDF3 union.
@@ -708,10 +1057,11 @@ func (s *UnionSDF3) BoundingBox() Box3 {
 
 // DifferenceSDF3 is the difference of two SDF3s, s0 - s1.
 type DifferenceSDF3 struct {
-	s0  SDF3
-	s1  SDF3
-	max MaxFunc
-	bb  Box3
+	s0    SDF3
+	s1    SDF3
+	max   MaxFunc
+	blend blendParms // blend used to make the max function (for serialization)
+	bb    Box3
 }
 
 // Difference3D returns the difference of two SDF3s, s0 - s1.
@@ -737,9 +1087,35 @@ func (s *DifferenceSDF3) Evaluate(p v3.Vec) float64 {
 
 // SetMax sets the maximum function to control blending.
 func (s *DifferenceSDF3) SetMax(max MaxFunc) {
+	s.blend = blendParms{custom: !isMax(max)}
 	s.max = max
 }
 
+// SetBlend sets a blended maximum function with a blend size k, max(a, b) = -min(-a, -b).
+// A nil blend is math.Max. Unlike SetMax, the difference can be serialized.
+func (s *DifferenceSDF3) SetBlend(blend *Blend, k float64) {
+	s.SetMax(blend.max(k))
+	s.blend = blendParms{blend: blend, k: k}
+}
+
+// EvaluateInterval returns an interval containing the values of the SDF3 difference within a box.
+func (s *DifferenceSDF3) EvaluateInterval(b Box3) Interval {
+	return maxInterval(s.max, EvaluateInterval3(s.s0, b), EvaluateInterval3(s.s1, b).neg())
+}
+
+// Gradient returns the gradient of the SDF3 difference.
+func (s *DifferenceSDF3) Gradient(p v3.Vec, eps float64) v3.Vec {
+	k0, k1 := blendPartials(s.max, s.s0.Evaluate(p), -s.s1.Evaluate(p))
+	var g v3.Vec
+	if k0 != 0 {
+		g = Gradient3(s.s0, p, eps).MulScalar(k0)
+	}
+	if k1 != 0 {
+		g = g.Sub(Gradient3(s.s1, p, eps).MulScalar(k1))
+	}
+	return g
+}
+
 // BoundingBox returns the bounding box of the SDF3 difference.
 func (s *DifferenceSDF3) BoundingBox() Box3 {
 	return s.bb
@@ -776,6 +1152,31 @@ func (s *ElongateSDF3) Evaluate(p v3.Vec) float64 {
 	return s.sdf.Evaluate(q)
 }
 
+// EvaluateInterval returns an interval containing the values of an elongated SDF3 within a box.
+func (s *ElongateSDF3) EvaluateInterval(b Box3) Interval {
+	// p - clamp(p) is monotonic on each axis
+	q0 := b.Min.Sub(b.Min.Clamp(s.hn, s.hp))
+	q1 := b.Max.Sub(b.Max.Clamp(s.hn, s.hp))
+	return EvaluateInterval3(s.sdf, Box3{q0, q1})
+}
+
+// Gradient returns the gradient of an elongated SDF3.
+func (s *ElongateSDF3) Gradient(p v3.Vec, eps float64) v3.Vec {
+	q := p.Sub(p.Clamp(s.hn, s.hp))
+	g := Gradient3(s.sdf, q, eps)
+	// the distance doesn't change along the elongated axes
+	if q.X == 0 {
+		g.X = 0
+	}
+	if q.Y == 0 {
+		g.Y = 0
+	}
+	if q.Z == 0 {
+		g.Z = 0
+	}
+	return g
+}
+
 // BoundingBox returns the bounding box of an elongated SDF3.
 func (s *ElongateSDF3) BoundingBox() Box3 {
 	return s.bb
@@ -785,10 +1186,11 @@ func (s *ElongateSDF3) BoundingBox() Box3 {
 
 // IntersectionSDF3 is the intersection of two SDF3s.
 type IntersectionSDF3 struct {
-	s0  SDF3
-	s1  SDF3
-	max MaxFunc
-	bb  Box3
+	s0    SDF3
+	s1    SDF3
+	max   MaxFunc
+	blend blendParms // blend used to make the max function (for serialization)
+	bb    Box3
 }
 
 // Intersect3D returns the intersection of two SDF3s.
@@ -812,9 +1214,35 @@ func (s *IntersectionSDF3) Evaluate(p v3.Vec) float64 {
 
 // SetMax sets the maximum function to control blending.
 func (s *IntersectionSDF3) SetMax(max MaxFunc) {
+	s.blend = blendParms{custom: !isMax(max)}
 	s.max = max
 }
 
+// SetBlend sets a blended maximum function with a blend size k, max(a, b) = -min(-a, -b).
+// A nil blend is math.Max. Unlike SetMax, the intersection can be serialized.
+func (s *IntersectionSDF3) SetBlend(blend *Blend, k float64) {
+	s.SetMax(blend.max(k))
+	s.blend = blendParms{blend: blend, k: k}
+}
+
+// EvaluateInterval returns an interval containing the values of the SDF3 intersection within a box.
+func (s *IntersectionSDF3) EvaluateInterval(b Box3) Interval {
+	return maxInterval(s.max, EvaluateInterval3(s.s0, b), EvaluateInterval3(s.s1, b))
+}
+
+// Gradient returns the gradient of the SDF3 intersection.
+func (s *IntersectionSDF3) Gradient(p v3.Vec, eps float64) v3.Vec {
+	k0, k1 := blendPartials(s.max, s.s0.Evaluate(p), s.s1.Evaluate(p))
+	var g v3.Vec
+	if k0 != 0 {
+		g = Gradient3(s.s0, p, eps).MulScalar(k0)
+	}
+	if k1 != 0 {
+		g = g.Add(Gradient3(s.s1, p, eps).MulScalar(k1))
+	}
+	return g
+}
+
 // BoundingBox returns the bounding box of an SDF3 intersection.
 func (s *IntersectionSDF3) BoundingBox() Box3 {
 	return s.bb
@@ -827,6 +1255,7 @@ type CutSDF3 struct {
 	sdf SDF3
 	a   v3.Vec // point on plane
 	n   v3.Vec // normal to plane
+	dir v3.Vec // direction of the normal (for serialization)
 	bb  Box3   // bounding box
 }
 
@@ -837,6 +1266,7 @@ func Cut3D(sdf SDF3, a, n v3.Vec) SDF3 {
 	s.sdf = sdf
 	s.a = a
 	s.n = n.Normalize().Neg()
+	s.dir = n
 	// TODO - cut the bounding box
 	s.bb = sdf.BoundingBox()
 	return &s
@@ -847,6 +1277,19 @@ func (s *CutSDF3) Evaluate(p v3.Vec) float64 {
 	return math.Max(p.Sub(s.a).Dot(s.n), s.sdf.Evaluate(p))
 }
 
+// EvaluateInterval returns an interval containing the values of the cut SDF3 within a box.
+func (s *CutSDF3) EvaluateInterval(b Box3) Interval {
+	return maxInterval(math.Max, linearInterval3(s.n, -s.a.Dot(s.n), b), EvaluateInterval3(s.sdf, b))
+}
+
+// Gradient returns the gradient of the cut SDF3.
+func (s *CutSDF3) Gradient(p v3.Vec, eps float64) v3.Vec {
+	if p.Sub(s.a).Dot(s.n) > s.sdf.Evaluate(p) {
+		return s.n
+	}
+	return Gradient3(s.sdf, p, eps)
+}
+
 // BoundingBox returns the bounding box of the cut SDF3.
 func (s *CutSDF3) BoundingBox() Box3 {
 	return s.bb
@@ -856,11 +1299,15 @@ func (s *CutSDF3) BoundingBox() Box3 {
 
 // ArraySDF3 stores an XYZ array of a given SDF3
 type ArraySDF3 struct {
-	sdf  SDF3
-	num  v3i.Vec
-	step v3.Vec
-	min  MinFunc
-	bb   Box3
+	sdf   SDF3
+	num   v3i.Vec
+	step  v3.Vec
+	min   MinFunc
+	blend blendParms // blend used to make the min function (for serialization)
+	bb    Box3
+	// lattice evaluates the nearest copies when min is math.Min, the copies don't overlap
+	// and the sdf is exact outside its bounding box (nil otherwise)
+	lattice *lattice3
 }
 
 // Array3D returns an XYZ array of a given SDF3
@@ -878,16 +1325,44 @@ func Array3D(sdf SDF3, num v3i.Vec, step v3.Vec) SDF3 {
 	bb0 := sdf.BoundingBox()
 	bb1 := bb0.Translate(step.Mul(conv.V3iToV3(num.SubScalar(1))))
 	s.bb = bb0.Extend(bb1)
+	s.setLattice()
 	return &s
 }
 
 // SetMin sets the minimum function to control blending.
 func (s *ArraySDF3) SetMin(min MinFunc) {
+	s.blend = blendParms{custom: !isMin(min)}
 	s.min = min
+	s.setLattice()
+}
+
+// setLattice sets the lattice if it gives the same result as evaluating every copy.
+func (s *ArraySDF3) setLattice() {
+	s.lattice = nil
+	if !isMin(s.min) || !bvhExact3(s.sdf) {
+		return
+	}
+	size := s.sdf.BoundingBox().Size()
+	if latticeDisjoint(s.step.X, s.num.X, size.X) &&
+		latticeDisjoint(s.step.Y, s.num.Y, size.Y) &&
+		latticeDisjoint(s.step.Z, s.num.Z, size.Z) {
+		s.lattice = newLattice3(s.sdf, s.num, s.step, true)
+	}
+}
+
+// SetBlend sets a blended minimum function with a blend size k (a nil blend is math.Min).
+// Unlike SetMin, the array can be serialized.
+func (s *ArraySDF3) SetBlend(blend *Blend, k float64) {
+	s.SetMin(blend.min(k))
+	s.blend = blendParms{blend: blend, k: k}
 }
 
 // Evaluate returns the minimum distance to an XYZ SDF3 array.
 func (s *ArraySDF3) Evaluate(p v3.Vec) float64 {
+	if s.lattice != nil {
+		d, _ := s.lattice.evaluate(s.sdf, p)
+		return d
+	}
 	d := math.MaxFloat64
 	for j := 0; j < s.num.X; j++ {
 		for k := 0; k < s.num.Y; k++ {
@@ -900,6 +1375,46 @@ func (s *ArraySDF3) Evaluate(p v3.Vec) float64 {
 	return d
 }
 
+// EvaluateInterval returns an interval containing the values of an XYZ SDF3 array within a box.
+func (s *ArraySDF3) EvaluateInterval(b Box3) Interval {
+	d := Interval{math.MaxFloat64, math.MaxFloat64}
+	for j := 0; j < s.num.X; j++ {
+		for k := 0; k < s.num.Y; k++ {
+			for l := 0; l < s.num.Z; l++ {
+				x := b.Translate(v3.Vec{float64(j) * s.step.X, float64(k) * s.step.Y, float64(l) * s.step.Z}.Neg())
+				d = minInterval(s.min, d, EvaluateInterval3(s.sdf, x))
+			}
+		}
+	}
+	return d
+}
+
+// Gradient returns the gradient of an XYZ SDF3 array.
+func (s *ArraySDF3) Gradient(p v3.Vec, eps float64) v3.Vec {
+	if s.lattice != nil {
+		_, q := s.lattice.evaluate(s.sdf, p)
+		return Gradient3(s.sdf, q, eps)
+	}
+	var x []v3.Vec
+	var d []float64
+	for j := 0; j < s.num.X; j++ {
+		for k := 0; k < s.num.Y; k++ {
+			for l := 0; l < s.num.Z; l++ {
+				q := p.Sub(v3.Vec{float64(j) * s.step.X, float64(k) * s.step.Y, float64(l) * s.step.Z})
+				x = append(x, q)
+				d = append(d, s.sdf.Evaluate(q))
+			}
+		}
+	}
+	var g v3.Vec
+	for i, w := range blendWeights(s.min, d) {
+		if w != 0 {
+			g = g.Add(Gradient3(s.sdf, x[i], eps).MulScalar(w))
+		}
+	}
+	return g
+}
+
 // BoundingBox returns the bounding box of an XYZ SDF3 array.
 func (s *ArraySDF3) BoundingBox() Box3 {
 	return s.bb
@@ -909,11 +1424,13 @@ func (s *ArraySDF3) BoundingBox() Box3 {
 
 // RotateUnionSDF3 creates a union of SDF3s rotated about the z-axis.
 type RotateUnionSDF3 struct {
-	sdf  SDF3
-	num  int
-	step M44
-	min  MinFunc
-	bb   Box3
+	sdf    SDF3
+	num    int
+	step   M44
+	matrix M44 // step matrix passed to RotateUnion3D (for serialization)
+	min    MinFunc
+	blend  blendParms // blend used to make the min function (for serialization)
+	bb     Box3
 }
 
 // RotateUnion3D creates a union of SDF3s rotated about the z-axis.
@@ -926,6 +1443,7 @@ func RotateUnion3D(sdf SDF3, num int, step M44) SDF3 {
 	s.sdf = sdf
 	s.num = num
 	s.step = step.Inverse()
+	s.matrix = step
 	s.min = math.Min
 	// work out the bounding box
 	v := sdf.BoundingBox().Vertices()
@@ -954,9 +1472,47 @@ func (s *RotateUnionSDF3) Evaluate(p v3.Vec) float64 {
 
 // SetMin sets the minimum function to control blending.
 func (s *RotateUnionSDF3) SetMin(min MinFunc) {
+	s.blend = blendParms{custom: !isMin(min)}
 	s.min = min
 }
 
+// SetBlend sets a blended minimum function with a blend size k (a nil blend is math.Min).
+// Unlike SetMin, the union can be serialized.
+func (s *RotateUnionSDF3) SetBlend(blend *Blend, k float64) {
+	s.SetMin(blend.min(k))
+	s.blend = blendParms{blend: blend, k: k}
+}
+
+// EvaluateInterval returns an interval containing the values of a rotate/union object within a box.
+func (s *RotateUnionSDF3) EvaluateInterval(b Box3) Interval {
+	d := Interval{math.MaxFloat64, math.MaxFloat64}
+	rot := Identity3d()
+	for i := 0; i < s.num; i++ {
+		d = minInterval(s.min, d, EvaluateInterval3(s.sdf, rot.MulBox(b)))
+		rot = rot.Mul(s.step)
+	}
+	return d
+}
+
+// Gradient returns the gradient of a rotate/union object.
+func (s *RotateUnionSDF3) Gradient(p v3.Vec, eps float64) v3.Vec {
+	rot := make([]M44, s.num)
+	d := make([]float64, s.num)
+	m := Identity3d()
+	for i := range rot {
+		rot[i] = m
+		d[i] = s.sdf.Evaluate(m.MulPosition(p))
+		m = m.Mul(s.step)
+	}
+	var g v3.Vec
+	for i, w := range blendWeights(s.min, d) {
+		if w != 0 {
+			g = g.Add(rot[i].mulTranspose(Gradient3(s.sdf, rot[i].MulPosition(p), eps)).MulScalar(w))
+		}
+	}
+	return g
+}
+
 // BoundingBox returns the bounding box of a rotate/union object.
 func (s *RotateUnionSDF3) BoundingBox() Box3 {
 	return s.bb
@@ -1008,6 +1564,12 @@ func (s *RotateCopySDF3) Evaluate(p v3.Vec) float64 {
 	return s.sdf.Evaluate(v3.Vec{p2d.X, p2d.Y, p.Z})
 }
 
+// EvaluateInterval returns an interval containing the values of a rotate/copy SDF3 within a box.
+func (s *RotateCopySDF3) EvaluateInterval(b Box3) Interval {
+	xy := sectorBox2(Box2{v2.Vec{b.Min.X, b.Min.Y}, v2.Vec{b.Max.X, b.Max.Y}}, s.theta)
+	return EvaluateInterval3(s.sdf, Box3{v3.Vec{xy.Min.X, xy.Min.Y, b.Min.Z}, v3.Vec{xy.Max.X, xy.Max.Y, b.Max.Z}})
+}
+
 // BoundingBox returns the bounding box of a rotate/copy SDF3.
 func (s *RotateCopySDF3) BoundingBox() Box3 {
 	return s.bb
@@ -1084,6 +1646,16 @@ func (s *OffsetSDF3) Evaluate(p v3.Vec) float64 {
 	return s.sdf.Evaluate(p) - s.offset
 }
 
+// EvaluateInterval returns an interval containing the values of an offset SDF3 within a box.
+func (s *OffsetSDF3) EvaluateInterval(b Box3) Interval {
+	return EvaluateInterval3(s.sdf, b).offset(-s.offset)
+}
+
+// Gradient returns the gradient of an offset SDF3.
+func (s *OffsetSDF3) Gradient(p v3.Vec, eps float64) v3.Vec {
+	return Gradient3(s.sdf, p, eps)
+}
+
 // BoundingBox returns the bounding box of an offset SDF3.
 func (s *OffsetSDF3) BoundingBox() Box3 {
 	return s.bb
@@ -1115,6 +1687,16 @@ func (s *ShellSDF3) Evaluate(p v3.Vec) float64 {
 	return math.Abs(s.sdf.Evaluate(p)) - s.delta
 }
 
+// EvaluateInterval returns an interval containing the values of a shelled SDF3 within a box.
+func (s *ShellSDF3) EvaluateInterval(b Box3) Interval {
+	return EvaluateInterval3(s.sdf, b).abs().offset(-s.delta)
+}
+
+// Gradient returns the gradient of a shelled SDF3.
+func (s *ShellSDF3) Gradient(p v3.Vec, eps float64) v3.Vec {
+	return Gradient3(s.sdf, p, eps).MulScalar(sign(s.sdf.Evaluate(p)))
+}
+
 // BoundingBox returns the bounding box of a shelled SDF3.
 func (s *ShellSDF3) BoundingBox() Box3 {
 	return s.bb
@@ -5,13 +5,21 @@
 package sdf
 
 import (
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
 	"math"
+	"os"
+	"path/filepath"
 	"reflect"
+	"sync"
 	"testing"
 
 	v2 "github.com/deadsy/sdfx/vec/v2"
 	"github.com/deadsy/sdfx/vec/v2i"
 	v3 "github.com/deadsy/sdfx/vec/v3"
+	"github.com/deadsy/sdfx/vec/v3i"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -816,3 +824,2501 @@ func Test_Normal(t *testing.T) {
 }
 
 //-----------------------------------------------------------------------------
+
+func Test_Sweep3D(t *testing.T) {
+	profile := Box2D(v2.Vec{1, 0.5}, 0.1)
+	extrude := Extrude3D(profile, 4)
+	// a straight sweep along the z-axis is an extrusion
+	p0, err := PolylinePath3([]v3.Vec{{0, 0, -2}, {0, 0, 2}})
+	assert.NoError(t, err)
+	p1, err := SplinePath3([]v3.Vec{{0, 0, -2}, {0, 0, -1}, {0, 0, 0}, {0, 0, 1}, {0, 0, 2}}, 4)
+	assert.NoError(t, err)
+	for _, path := range []Path3{p0, p1} {
+		s, err := Sweep3D(profile, path, 0)
+		assert.NoError(t, err)
+		bb := extrude.BoundingBox().ScaleAboutCenter(1.5)
+		for _, p := range bb.RandomSet(1000) {
+			if !EqualFloat64(s.Evaluate(p), extrude.Evaluate(p), tolerance) {
+				t.Fatalf("sweep != extrude at %v", p)
+			}
+		}
+	}
+	// a twisted sweep is a twisted extrusion (the box is the same after a half turn)
+	// The twist is clamped beyond the ends of the path, so only test between them.
+	s, err := Sweep3D(profile, p0, Tau)
+	assert.NoError(t, err)
+	extrude = TwistExtrude3D(profile, 4, Tau)
+	bb := Box3{v3.Vec{-2, -2, -2}, v3.Vec{2, 2, 2}}
+	for _, p := range bb.RandomSet(1000) {
+		if !EqualFloat64(s.Evaluate(p), extrude.Evaluate(p), tolerance) {
+			t.Fatalf("twisted sweep != twisted extrude at %v", p)
+		}
+	}
+	// a swept circle is a tube
+	path, err := BezierPath3([]v3.Vec{{0, 0, 0}, {10, 0, 0}, {20, 5, 5}, {20, 10, 10}}, 64)
+	assert.NoError(t, err)
+	circle, err := Circle2D(1)
+	assert.NoError(t, err)
+	s, err = Sweep3D(circle, path, 0)
+	assert.NoError(t, err)
+	for _, p := range path.Vertices()[8:56] {
+		assert.InDelta(t, -1, s.Evaluate(p), 1e-6)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_BezierPatch3D(t *testing.T) {
+	// a flat bicubic patch in the xy plane
+	cp := make([][]v3.Vec, 4)
+	for i := range cp {
+		cp[i] = make([]v3.Vec, 4)
+		for j := range cp[i] {
+			cp[i][j] = v3.Vec{float64(i), float64(j), 0}
+		}
+	}
+	s, err := BezierPatch3D(cp, 0.2)
+	assert.NoError(t, err)
+	bb := Box3{v3.Vec{0, 0, -2}, v3.Vec{3, 3, 2}}
+	for _, p := range bb.RandomSet(100) {
+		assert.InDelta(t, math.Abs(p.Z)-0.1, s.Evaluate(p), 1e-6)
+	}
+
+	// a cube made from 6 bilinear patches
+	v := []v3.Vec{
+		{-1, -1, -1}, {1, -1, -1}, {1, 1, -1}, {-1, 1, -1},
+		{-1, -1, 1}, {1, -1, 1}, {1, 1, 1}, {-1, 1, 1},
+	}
+	quad := func(a, b, c, d int) [][]v3.Vec {
+		return [][]v3.Vec{{v[a], v[b]}, {v[d], v[c]}}
+	}
+	faces := [][][]v3.Vec{
+		quad(0, 1, 5, 4), quad(1, 2, 6, 5), quad(2, 3, 7, 6),
+		quad(3, 0, 4, 7), quad(0, 3, 2, 1), quad(4, 5, 6, 7),
+	}
+	s, err = BezierSolid3D(faces)
+	assert.NoError(t, err)
+	box, err := Box3D(v3.Vec{2, 2, 2}, 0)
+	assert.NoError(t, err)
+	bb = s.BoundingBox().ScaleAboutCenter(2)
+	for _, p := range bb.RandomSet(1000) {
+		assert.InDelta(t, box.Evaluate(p), s.Evaluate(p), 1e-6, "%v", p)
+	}
+	// an open box is not watertight
+	_, err = BezierSolid3D(faces[:5])
+	assert.Error(t, err)
+
+	// A cube made from 6 bicubic patches, with the faces bulging in and out.
+	// The edges are straight, so the patches share control points along them.
+	bulge := func(a, b, c, d int, k float64) [][]v3.Vec {
+		n := v[b].Sub(v[a]).Cross(v[d].Sub(v[a])).Normalize()
+		cp := make([][]v3.Vec, 4)
+		for i := range cp {
+			cp[i] = make([]v3.Vec, 4)
+			x := float64(i) / 3
+			for j := range cp[i] {
+				y := float64(j) / 3
+				p := v[a].MulScalar((1 - x) * (1 - y)).Add(v[b].MulScalar((1 - x) * y))
+				p = p.Add(v[d].MulScalar(x * (1 - y))).Add(v[c].MulScalar(x * y))
+				if i > 0 && i < 3 && j > 0 && j < 3 {
+					p = p.Add(n.MulScalar(k))
+				}
+				cp[i][j] = p
+			}
+		}
+		return cp
+	}
+	faces = [][][]v3.Vec{
+		bulge(0, 1, 5, 4, -0.4), bulge(1, 2, 6, 5, 0.8), bulge(2, 3, 7, 6, -0.4),
+		bulge(3, 0, 4, 7, 0.8), bulge(0, 3, 2, 1, -0.5), bulge(4, 5, 6, 7, 1),
+	}
+	s, err = BezierSolid3D(faces)
+	assert.NoError(t, err)
+	// dense reference: surface samples for the distance, a fine tessellation for the sign
+	var samples []v3.Vec
+	var mesh []Triangle3
+	for _, f := range faces {
+		patch, err := newBezierPatch(f)
+		assert.NoError(t, err)
+		const n = 200
+		for i := 0; i <= n; i++ {
+			for j := 0; j <= n; j++ {
+				samples = append(samples, patch.position(float64(i)/n, float64(j)/n))
+			}
+		}
+		mesh = append(mesh, patch.triangles(32)...)
+	}
+	bb = s.BoundingBox().ScaleAboutCenter(1.5)
+	for _, p := range bb.RandomSet(200) {
+		ref := math.Inf(1)
+		for _, x := range samples {
+			ref = math.Min(ref, x.Sub(p).Length2())
+		}
+		ref = math.Sqrt(ref)
+		d := s.Evaluate(p)
+		// the samples are on the surface, so the closest one is no closer than the closest point
+		assert.LessOrEqual(t, math.Abs(d), ref+1e-9, "%v", p)
+		if ref > 0.05 {
+			// the samples are close to the closest point
+			assert.InDelta(t, ref, math.Abs(d), 2e-3, "%v", p)
+			w := 0.0
+			for i := range mesh {
+				w += mesh[i].solidAngle(p)
+			}
+			assert.Equal(t, math.Abs(w) > 2*Pi, d < 0, "%v", p)
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// screwProfile returns points (at most h apart) on the surface of the repeated thread profile of a screw.
+func screwProfile(s *ScrewSDF3, h float64) []v2.Vec {
+	f := s.profile.Evaluate
+	// find the sign changes along lines of x and y, in steps of pitch/16
+	step := s.pitch / 16
+	ymax := s.profile.BoundingBox().Max.Y + step
+	var pts []v2.Vec
+	scan := func(p0, dp v2.Vec, n int) {
+		for i := 0; i < n; i++ {
+			a := p0.Add(dp.MulScalar(float64(i)))
+			b := a.Add(dp)
+			if f(a)*f(b) > 0 {
+				continue
+			}
+			for k := 0; k < 30; k++ {
+				m := a.Add(b).MulScalar(0.5)
+				if f(a)*f(m) <= 0 {
+					b = m
+				} else {
+					a = m
+				}
+			}
+			pts = append(pts, a)
+		}
+	}
+	for x := -0.5 * s.pitch; x < 0.5*s.pitch; x += h {
+		scan(v2.Vec{x, 0.5 * h}, v2.Vec{0, step}, int(ymax/step))
+	}
+	for y := 0.5 * h; y < ymax; y += h {
+		scan(v2.Vec{-0.5 * s.pitch, y}, v2.Vec{step, 0}, 16)
+	}
+	return pts
+}
+
+// screwDistance returns the distance to a screw (without a taper) by brute force minimisation over
+// points on the thread profile and n axial half-planes, and a bound on the error from the spacing
+// of the half-planes.
+func screwDistance(s *ScrewSDF3, profile []v2.Vec, p v3.Vec, n int) (float64, float64) {
+	r := math.Hypot(p.X, p.Y)
+	theta := math.Atan2(p.Y, p.X)
+	d2 := math.Inf(1)
+	for i := 0; i <= n; i++ {
+		// search outwards from phi = 0
+		phi := Pi * float64((i+1)/2) / float64(n/2)
+		if i&1 == 0 {
+			phi = -phi
+		}
+		h := r * math.Sin(phi)
+		if h*h >= d2 || (math.Abs(phi) > 0.5*Pi && r*r >= d2) {
+			// this half-plane (and those beyond it) can't be closer
+			continue
+		}
+		// the point on the half-plane at theta + phi with the same z
+		q := v2.Vec{p.Z + s.lead*(theta+phi)/Tau, r * math.Cos(phi)}
+		for _, x := range profile {
+			dx := SawTooth(q.X-x.X, s.pitch)
+			dy := q.Y - x.Y
+			d2 = math.Min(d2, dx*dx+dy*dy+h*h)
+		}
+	}
+	d := math.Sqrt(d2)
+	if s.profile.Evaluate(v2.Vec{p.Z + s.lead*theta/Tau, r}) < 0 {
+		d = -d
+	}
+	// the point on the half-plane moves by at most sqrt(l^2 + r^2) per radian
+	l := s.lead / Tau
+	e := 0.5 * Tau / float64(n) * math.Sqrt(l*l+r*r)
+	return math.Max(d, math.Abs(p.Z)-s.length), e
+}
+
+func Test_ScrewSDF3(t *testing.T) {
+	iso, err := ISOThread(5, 1, true)
+	assert.NoError(t, err)
+	acme, err := AcmeThread(5, 2)
+	assert.NoError(t, err)
+	knurl, err := Polygon2D([]v2.Vec{{1, 0}, {1, 5}, {0.5, 5.5}, {0, 5}, {-0.5, 5.5}, {-1, 5}, {-1, 0}})
+	assert.NoError(t, err)
+	ansi, err := ANSIButtressThread(5, 1.5)
+	assert.NoError(t, err)
+	plastic, err := PlasticButtressThread(5, 1.5)
+	assert.NoError(t, err)
+	screws := []struct {
+		thread       SDF2
+		taper, pitch float64
+		starts       int
+	}{
+		{iso, 0, 1, 1},
+		{iso, DtoR(1.8), 1, 2},
+		{acme, 0, 2, -3},
+		{knurl, 0, 1, 20},
+		{ansi, 0, 1.5, 1},
+		{plastic, 0, 1.5, -2},
+	}
+	for _, x := range screws {
+		s0, err := Screw3D(x.thread, 10, x.taper, x.pitch, x.starts)
+		assert.NoError(t, err)
+		s := s0.(*ScrewSDF3)
+		h := x.pitch / 256
+		profile := screwProfile(s, h)
+		bb := s.BoundingBox()
+		ps := bb.RandomSet(1000)
+		for i, p := range ps {
+			d := s.Evaluate(p)
+			// the same surface as the profile mapping
+			d0 := s.evaluateSawTooth(p)
+			assert.False(t, d*d0 < 0, "sign mismatch at %v", p)
+			// never further than the profile mapping
+			assert.LessOrEqual(t, math.Abs(d), math.Abs(d0)+tolerance)
+			// a distance field has a lipschitz constant <= 1
+			q := ps[(i+1)%len(ps)].Sub(p).MulScalar(0.01).Add(p)
+			if d > 0 {
+				assert.LessOrEqual(t, math.Abs(s.Evaluate(q)-d), q.Sub(p).Length()*1.01+1e-3*x.pitch, "%v %v %v %v", x.starts, p, q, d)
+			}
+			// the exact distance
+			if x.taper == 0 && i < 50 {
+				dr, e := screwDistance(s, profile, p, 4096)
+				e += h + screwTolerance*x.pitch
+				assert.InDelta(t, dr, d, e, "starts %d at %v", x.starts, p)
+			}
+		}
+		// Profiles that aren't polygons are repeated by clipping the neighbouring copies.
+		// That has the same sign, and is a bound on the distance.
+		s1 := newScrewProfile(Offset2D(x.thread, 0), x.pitch)
+		pb := s.profile.BoundingBox()
+		pb = Box2{v2.Vec{-2 * x.pitch, pb.Min.Y}, v2.Vec{2 * x.pitch, pb.Max.Y}}
+		for _, p := range pb.RandomSet(1000) {
+			d0 := s.profile.Evaluate(p)
+			d1 := s1.Evaluate(p)
+			assert.False(t, d0*d1 < 0, "sign mismatch at %v", p)
+			assert.LessOrEqual(t, math.Abs(d1), math.Abs(d0)+tolerance, "at %v", p)
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// negSDF3 negates the sign of an SDF3.
+type negSDF3 struct {
+	SDF3
+}
+
+func (s negSDF3) Evaluate(p v3.Vec) float64 {
+	return -s.SDF3.Evaluate(p)
+}
+
+// holeSDF3 gives an SDF3 a negative region (without a surface) above the z = 0 plane.
+type holeSDF3 struct {
+	SDF3
+}
+
+func (s holeSDF3) Evaluate(p v3.Vec) float64 {
+	d := s.SDF3.Evaluate(p)
+	if d > 0.1 && p.Z > 0 {
+		return -d
+	}
+	return d
+}
+
+func Test_Audit(t *testing.T) {
+	// exact distance fields
+	b, err := Box3D(v3.Vec{1, 2, 3}, 0.1)
+	assert.NoError(t, err)
+	r3, err := Audit3D(b, 500)
+	assert.NoError(t, err)
+	assert.InDelta(t, 1, r3.MaxLipschitz, 1e-3, r3.String())
+	assert.Equal(t, 0, r3.Overestimates, r3.String())
+	assert.Equal(t, 0, r3.SignMismatches, r3.String())
+	assert.Equal(t, 0.0, r3.Sigmoid)
+	assert.InDelta(t, 1, r3.StepScale, 1e-3)
+
+	c, err := Circle2D(1)
+	assert.NoError(t, err)
+	r2, err := Audit2D(c, 500)
+	assert.NoError(t, err)
+	assert.InDelta(t, 1, r2.MaxLipschitz, 1e-3, r2.String())
+	assert.Equal(t, 0, r2.Overestimates, r2.String())
+	assert.Equal(t, 0, r2.SignMismatches, r2.String())
+
+	// bad distance fields
+	e := ScaleExtrude3D(c, 4, v2.Vec{0.1, 0.1})
+	r3, err = Audit3D(e, 500)
+	assert.NoError(t, err)
+	assert.Greater(t, r3.MaxLipschitz, 5.0, r3.String())
+	assert.Greater(t, r3.Overestimates, 0, r3.String())
+	assert.Equal(t, 0, r3.SignMismatches, r3.String())
+	assert.Equal(t, 1.0, r3.Sigmoid)
+	assert.Less(t, r3.StepScale, 0.2)
+
+	s := Transform2D(c, Scale2d(v2.Vec{0.25, 1}))
+	r2, err = Audit2D(s, 500)
+	assert.NoError(t, err)
+	assert.InDelta(t, 4, r2.MaxLipschitz, 0.1, r2.String())
+	assert.Greater(t, r2.Overestimates, 0, r2.String())
+
+	// a field with the wrong sign
+	r3, err = Audit3D(negSDF3{b}, 500)
+	assert.NoError(t, err)
+	assert.Greater(t, r3.SignMismatches, 200, r3.String())
+
+	// a field with an inside region that has no surface
+	r3, err = Audit3D(holeSDF3{b}, 500)
+	assert.NoError(t, err)
+	assert.Greater(t, r3.SignMismatches, 0, r3.String())
+	assert.Greater(t, r3.SignMismatchAt.Z, 0.0, r3.String())
+
+	_, err = Audit3D(b, 0)
+	assert.Error(t, err)
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_EvaluateInterval(t *testing.T) {
+	circle, err := Circle2D(1)
+	assert.NoError(t, err)
+	hex, err := Polygon2D(Nagon(6, 1.2))
+	assert.NoError(t, err)
+	sphere, err := Sphere3D(1)
+	assert.NoError(t, err)
+	box, err := Box3D(v3.Vec{1, 2, 3}, 0.2)
+	assert.NoError(t, err)
+	cylinder, err := Cylinder3D(2, 0.5, 0.1)
+	assert.NoError(t, err)
+	sor, err := RevolveTheta3D(Transform2D(hex, Translate2d(v2.Vec{2, 0})), 4)
+	assert.NoError(t, err)
+	loft, err := Loft3D(circle, hex, 2, 0.2)
+	assert.NoError(t, err)
+	rounded, err := ExtrudeRounded3D(hex, 2, 0.3)
+	assert.NoError(t, err)
+	gyroid, err := Gyroid3D(v3.Vec{1, 2, 3})
+	assert.NoError(t, err)
+	shell, err := Shell3D(sphere, 0.1)
+	assert.NoError(t, err)
+
+	blend := Union3D(box, Transform3D(sphere, Translate3d(v3.Vec{0, 0, 1.5})))
+	blend.(*UnionSDF3).SetMin(PolyMin(0.3))
+	cone, err := Cone3D(2, 1, 0.5, 0.1)
+	assert.NoError(t, err)
+
+	iso, err := ISOThread(1, 0.5, true)
+	assert.NoError(t, err)
+	screw, err := Screw3D(iso, 2, 0, 0.5, 1)
+	assert.NoError(t, err)
+	taperScrew, err := Screw3D(iso, 2, DtoR(10), 0.5, 2)
+	assert.NoError(t, err)
+
+	// SDFs without interval evaluation are unbounded
+	custom := Extrude3D(hex, 2)
+	custom.(*ExtrudeSDF3).SetExtrude(TwistExtrude(2, 1))
+	assert.Equal(t, unboundedInterval, EvaluateInterval3(custom, NewBox3(v3.Vec{}, v3.Vec{1, 1, 1})))
+	blendScrew := Union3D(box, screw)
+	blendScrew.(*UnionSDF3).SetMin(PolyMin(0.3))
+	path, err := SplinePath3([]v3.Vec{{0, 0, 0}, {2, 1, 1}, {3, 3, 0}, {1, 4, -2}}, 8)
+	assert.NoError(t, err)
+	sweep, err := Sweep3D(hex, path, Pi)
+	assert.NoError(t, err)
+	customSweep, err := Sweep3D(hex, path, 0)
+	assert.NoError(t, err)
+	customSweep.(*SweepSDF3).SetExtrude(TwistExtrude(2, 1))
+	assert.Equal(t, unboundedInterval, EvaluateInterval3(customSweep, NewBox3(v3.Vec{}, v3.Vec{1, 1, 1})))
+	draft, err := Draft3D(box, v3.Vec{0, 0.2, 1}, 0.5, DtoR(10))
+	assert.NoError(t, err)
+	voxel := NewVoxelSDF3(blend, 16, nil)
+	tricubic := NewVoxelSDF3(blend, 16, nil)
+	tricubic.(*VoxelSDF3).SetTricubic(true)
+	redistance, err := Redistance3DBand(blend, 0.1, 0.3)
+	assert.NoError(t, err)
+	sparse, err := NewSparseVoxelSDF3(blend, 0.05, nil)
+	assert.NoError(t, err)
+	repeat, err := Repeat3D(box, v3i.Vec{12, 10, 1}, v3.Vec{0.8, 1.5, 0})
+	assert.NoError(t, err)
+	repeatInfinite, err := RepeatInfinite3D(sphere, v3.Vec{0.5, 0, 2.5})
+	assert.NoError(t, err)
+	repeatPolar, err := RepeatPolar3D(Transform3D(box, Translate3d(v3.Vec{2, 0, 0})), 7)
+	assert.NoError(t, err)
+	repeatPolar40, err := RepeatPolar3D(Transform3D(box, Translate3d(v3.Vec{3, 1, 0})), 40)
+	assert.NoError(t, err)
+	mirror, err := Mirror3D(box, v3.Vec{0.1, 0.2, 0}, v3.Vec{1, 1, 0.5})
+	assert.NoError(t, err)
+	twist, err := Twist3D(box, v3.Vec{0.2, 0, 0}, v3.Vec{0, 0.3, 1}, 0.8)
+	assert.NoError(t, err)
+	taper, err := Taper3D(box, v3.Vec{0, 0, -0.5}, v3.Vec{0, 0, 1}, 0.3)
+	assert.NoError(t, err)
+	bend, err := Bend3D(box, v3.Vec{}, v3.Vec{0, 0, 1}, v3.Vec{1, 0, 0}, 3)
+	assert.NoError(t, err)
+	ridges, err := NewFuncTexture2(func(p v2.Vec) float64 { return 0.5 + 0.5*math.Sin(Tau*p.X) }, Pi)
+	assert.NoError(t, err)
+	planar, err := NewPlanarTexture3(ridges, PlaneXY)
+	assert.NoError(t, err)
+	displace, err := Displace3D(box, planar, 0.2)
+	assert.NoError(t, err)
+	engrave, err := Displace3D(sphere, planar, -0.2)
+	assert.NoError(t, err)
+
+	s3 := []SDF3{
+		sphere,
+		box,
+		cylinder,
+		sor,
+		loft,
+		rounded,
+		gyroid,
+		shell,
+		blend,
+		Extrude3D(hex, 2),
+		TwistExtrude3D(hex, 2, Pi),
+		ScaleExtrude3D(hex, 2, v2.Vec{0.2, 0.5}),
+		ScaleTwistExtrude3D(hex, 2, -3*Pi, v2.Vec{0.5, 0.3}),
+		Transform3D(box, RotateX(0.3).Mul(Scale3d(v3.Vec{0.5, 2, 1}))),
+		ScaleUniform3D(box, 2),
+		Difference3D(box, sphere),
+		Intersect3D(box, sphere),
+		Elongate3D(sphere, v3.Vec{1, 2, 0}),
+		Cut3D(box, v3.Vec{0, 0.5, 0}, v3.Vec{1, 1, 0}),
+		Array3D(sphere, v3i.Vec{2, 3, 1}, v3.Vec{2, 2, 2}),
+		RotateUnion3D(cylinder, 5, Translate3d(v3.Vec{1, 0, 0}).Mul(RotateZ(0.5))),
+		Offset3D(box, 0.3),
+		cone,
+		screw,
+		taperScrew,
+		blendScrew,
+		sweep,
+		draft,
+		voxel,
+		tricubic,
+		redistance,
+		sparse,
+		RotateCopy3D(Transform3D(box, Translate3d(v3.Vec{2, 0, 0})), 5),
+		repeat,
+		repeatInfinite,
+		repeatPolar,
+		repeatPolar40,
+		mirror,
+		twist,
+		taper,
+		bend,
+		displace,
+		engrave,
+	}
+	for _, s := range s3 {
+		bb := s.BoundingBox()
+		if bb.Size().Length() == 0 {
+			bb = NewBox3(v3.Vec{}, v3.Vec{3, 3, 3})
+		}
+		bb = bb.ScaleAboutCenter(1.5)
+		for i := 0; i < 200; i++ {
+			b := Box3{bb.Random(), bb.Random()}
+			b = Box3{b.Min.Min(b.Max), b.Min.Max(b.Max)}
+			d := EvaluateInterval3(s, b)
+			for j := 0; j < 20; j++ {
+				p := b.Random()
+				x := s.Evaluate(p)
+				assert.True(t, d[0] <= x+tolerance && x <= d[1]+tolerance, "%T %v not in %v", s, x, d)
+			}
+		}
+	}
+
+	flatCam, err := FlatFlankCam2D(3, 1, 0.5)
+	assert.NoError(t, err)
+	threeArcCam, err := ThreeArcCam2D(3, 1, 0.5, 4)
+	assert.NoError(t, err)
+	rack, err := GearRack2D(&GearRackParms{NumberTeeth: 5, Module: 0.5, PressureAngle: DtoR(20), BaseHeight: 0.5})
+	assert.NoError(t, err)
+	redistance2, err := Redistance2DBand(Difference2D(hex, circle), 0.05, 0.3)
+	assert.NoError(t, err)
+	repeat2, err := Repeat2D(hex, v2i.Vec{4, 20}, v2.Vec{-2, 0.3})
+	assert.NoError(t, err)
+	repeatInfinite2, err := RepeatInfinite2D(circle, v2.Vec{0.4, 0.7})
+	assert.NoError(t, err)
+	repeatPolar2, err := RepeatPolar2D(Transform2D(hex, Translate2d(v2.Vec{1.5, 0})), 5)
+	assert.NoError(t, err)
+	repeatPolar30, err := RepeatPolar2D(Transform2D(circle, Translate2d(v2.Vec{4, 0})), 30)
+	assert.NoError(t, err)
+	mirror2, err := Mirror2D(Transform2D(hex, Translate2d(v2.Vec{0.5, 0})), v2.Vec{0.2, 0}, v2.Vec{1, -1})
+	assert.NoError(t, err)
+
+	s2 := []SDF2{
+		circle,
+		Box2D(v2.Vec{1, 2}, 0.1),
+		Line2D(2, 0.1),
+		Offset2D(hex, 0.2),
+		Intersect2D(circle, hex),
+		Cut2D(hex, v2.Vec{0, 0}, v2.Vec{1, 1}),
+		Transform2D(hex, Rotate2d(0.5).Mul(Scale2d(v2.Vec{2, 0.5}))),
+		ScaleUniform2D(hex, 0.5),
+		Array2D(circle, v2i.Vec{3, 2}, v2.Vec{2, 3}),
+		RotateUnion2D(Transform2D(circle, Translate2d(v2.Vec{2, 0})), 4, Rotate2d(0.6)),
+		Union2D(circle, Transform2D(hex, Translate2d(v2.Vec{1, 0}))),
+		Difference2D(hex, circle),
+		Elongate2D(circle, v2.Vec{2, 1}),
+		hex,
+		flatCam,
+		threeArcCam,
+		rack,
+		NewFlange1(2, 1, 0.5),
+		RotateCopy2D(Transform2D(hex, Translate2d(v2.Vec{2, 0})), 3),
+		Slice2D(box, v3.Vec{0, 0, 0.5}, v3.Vec{0.2, 0.3, 1}),
+		redistance2,
+		repeat2,
+		repeatInfinite2,
+		repeatPolar2,
+		repeatPolar30,
+		mirror2,
+	}
+	for _, s := range s2 {
+		bb := s.BoundingBox().ScaleAboutCenter(1.5)
+		for i := 0; i < 200; i++ {
+			b := Box2{bb.Random(), bb.Random()}
+			b = Box2{b.Min.Min(b.Max), b.Min.Max(b.Max)}
+			d := EvaluateInterval2(s, b)
+			for j := 0; j < 20; j++ {
+				p := b.Random()
+				x := s.Evaluate(p)
+				assert.True(t, d[0] <= x+tolerance && x <= d[1]+tolerance, "%T %v not in %v", s, x, d)
+			}
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Gradient(t *testing.T) {
+	circle, err := Circle2D(1)
+	assert.NoError(t, err)
+	hex, err := Polygon2D(Nagon(6, 1.2))
+	assert.NoError(t, err)
+	rect := Box2D(v2.Vec{2, 1}, 0.2)
+	sphere, err := Sphere3D(1)
+	assert.NoError(t, err)
+	box, err := Box3D(v3.Vec{1, 2, 3}, 0.2)
+	assert.NoError(t, err)
+	cylinder, err := Cylinder3D(2, 0.5, 0.1)
+	assert.NoError(t, err)
+	cone, err := Cone3D(2, 1, 0.5, 0.1)
+	assert.NoError(t, err)
+	sor, err := RevolveTheta3D(Transform2D(hex, Translate2d(v2.Vec{2, 0})), 4)
+	assert.NoError(t, err)
+	loft, err := Loft3D(circle, hex, 2, 0.2)
+	assert.NoError(t, err)
+	rounded, err := ExtrudeRounded3D(hex, 2, 0.3)
+	assert.NoError(t, err)
+	shell, err := Shell3D(sphere, 0.1)
+	assert.NoError(t, err)
+
+	blend3 := Union3D(box, Transform3D(sphere, Translate3d(v3.Vec{0, 0, 1.5})))
+	blend3.(*UnionSDF3).SetMin(PolyMin(0.3))
+	blend2 := Union2D(rect, Transform2D(circle, Translate2d(v2.Vec{1, 1})))
+	blend2.(*UnionSDF2).SetMin(PolyMin(0.3))
+
+	s3 := []SDF3{
+		sphere,
+		box,
+		cylinder,
+		cone,
+		sor,
+		loft,
+		rounded,
+		shell,
+		blend3,
+		Extrude3D(rect, 2),
+		TwistExtrude3D(rect, 2, Pi),
+		ScaleExtrude3D(rect, 2, v2.Vec{0.2, 0.5}),
+		ScaleTwistExtrude3D(rect, 2, -3*Pi, v2.Vec{0.5, 0.3}),
+		Transform3D(box, RotateX(0.3).Mul(Scale3d(v3.Vec{0.5, 2, 1}))),
+		ScaleUniform3D(box, 2),
+		Difference3D(box, sphere),
+		Intersect3D(box, sphere),
+		Elongate3D(sphere, v3.Vec{1, 2, 0}),
+		Cut3D(box, v3.Vec{0, 0.5, 0}, v3.Vec{1, 1, 0}),
+		Array3D(sphere, v3i.Vec{2, 3, 1}, v3.Vec{2, 2, 2}),
+		RotateUnion3D(cylinder, 5, Translate3d(v3.Vec{1, 0, 0}).Mul(RotateZ(0.5))),
+		Offset3D(box, 0.3),
+	}
+	for _, s := range s3 {
+		n := 0
+		bb := s.BoundingBox().ScaleAboutCenter(1.5)
+		for _, p := range bb.RandomSet(500) {
+			g0 := centralGradient3(s, p, 1e-5)
+			// skip points close to a discontinuity in the gradient
+			if !g0.Equals(centralGradient3(s, p, 2e-5), 1e-4) {
+				continue
+			}
+			g1 := Gradient3(s, p, 1e-5)
+			if !g0.Equals(g1, 1e-3) {
+				t.Fatalf("%T gradient at %v is %v, expected %v", s, p, g1, g0)
+			}
+			n++
+		}
+		assert.Greater(t, n, 250)
+	}
+
+	s2 := []SDF2{
+		circle,
+		rect,
+		blend2,
+		Line2D(2, 0.3),
+		Offset2D(rect, 0.3),
+		Intersect2D(rect, circle),
+		Difference2D(rect, circle),
+		Cut2D(rect, v2.Vec{0, 0.5}, v2.Vec{1, 1}),
+		Transform2D(rect, Rotate2d(0.3).Mul(Scale2d(v2.Vec{0.5, 2}))),
+		ScaleUniform2D(rect, 2),
+		Array2D(circle, v2i.Vec{2, 3}, v2.Vec{2, 2}),
+		RotateUnion2D(rect, 5, Translate2d(v2.Vec{1, 0}).Mul(Rotate2d(0.5))),
+		Elongate2D(circle, v2.Vec{1, 2}),
+		Slice2D(box, v3.Vec{0, 0, 0.5}, v3.Vec{1, 1, 1}),
+	}
+	for _, s := range s2 {
+		n := 0
+		bb := s.BoundingBox()
+		if bb.Size().Length() == 0 {
+			bb = NewBox2(v2.Vec{}, v2.Vec{3, 3})
+		}
+		bb = bb.ScaleAboutCenter(1.5)
+		for _, p := range bb.RandomSet(500) {
+			g0 := centralGradient2(s, p, 1e-5)
+			if !g0.Equals(centralGradient2(s, p, 2e-5), 1e-4) {
+				continue
+			}
+			g1 := Gradient2(s, p, 1e-5)
+			if !g0.Equals(g1, 1e-3) {
+				t.Fatalf("%T gradient at %v is %v, expected %v", s, p, g1, g0)
+			}
+			n++
+		}
+		assert.Greater(t, n, 250)
+	}
+
+	// children without a gradient use the central difference step
+	s := Transform3D(negSDF3{sphere}, Translate3d(v3.Vec{1, 0, 0}))
+	p := v3.Vec{2.2, 0.9, 0.3}
+	g0 := Gradient3(s, p, 0.1)
+	assert.True(t, g0.Equals(centralGradient3(s, p, 0.1), 1e-9))
+	g1 := Gradient3(s, p, 1e-3)
+	assert.True(t, g1.Equals(centralGradient3(s, p, 1e-3), 1e-9))
+	assert.False(t, g0.Equals(g1, 1e-5))
+
+	// normals are exact on the faces of a box
+	n := Normal3(box, v3.Vec{0.5, 0.3, 0.1}, 1e-3)
+	assert.Equal(t, v3.Vec{1, 0, 0}, n)
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_EvaluateBatch(t *testing.T) {
+	hex, err := Polygon2D(Nagon(6, 1.2))
+	assert.NoError(t, err)
+	sphere, err := Sphere3D(1)
+	assert.NoError(t, err)
+	hex2 := Transform2D(hex, Rotate2d(0.3))
+	s0 := TwistExtrude3D(hex2, 2, Pi)
+	s1 := Transform3D(Extrude3D(hex2, 3), RotateX(0.5).Mul(Translate3d(v3.Vec{1, 0, 0})))
+	s2 := Union3D(s0, s1, sphere)
+	s2.(*UnionSDF3).SetMin(PolyMin(0.2))
+	for _, s := range []SDF3{s0, s1, s2} {
+		bb := s.BoundingBox().ScaleAboutCenter(1.5)
+		ps := bb.RandomSet(1000)
+		out := make([]float64, len(ps))
+		EvaluateBatch3(s, ps, out)
+		for i, p := range ps {
+			assert.Equal(t, s.Evaluate(p), out[i])
+		}
+		// the scratch buffers are reused
+		assert.Zero(t, testing.AllocsPerRun(10, func() { EvaluateBatch3(s, ps, out) }))
+	}
+	bb := hex2.BoundingBox().ScaleAboutCenter(1.5)
+	ps := bb.RandomSet(1000)
+	out := make([]float64, len(ps))
+	EvaluateBatch2(hex2, ps, out)
+	for i, p := range ps {
+		assert.Equal(t, hex2.Evaluate(p), out[i])
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_JSON(t *testing.T) {
+	hex, err := Polygon2D(Nagon(6, 1.2))
+	assert.NoError(t, err)
+	circle, err := Circle2D(0.7)
+	assert.NoError(t, err)
+	rect := Box2D(v2.Vec{2, 1}, 0.2)
+	sphere, err := Sphere3D(1)
+	assert.NoError(t, err)
+	box, err := Box3D(v3.Vec{1, 2, 3}, 0.2)
+	assert.NoError(t, err)
+	cylinder, err := Cylinder3D(2, 0.5, 0.1)
+	assert.NoError(t, err)
+	cone, err := Cone3D(2, 1, 0.5, 0.1)
+	assert.NoError(t, err)
+	sor, err := RevolveTheta3D(Transform2D(hex, Translate2d(v2.Vec{2, 0})), 4)
+	assert.NoError(t, err)
+	loft, err := Loft3D(circle, hex, 2, 0.2)
+	assert.NoError(t, err)
+	rounded, err := ExtrudeRounded3D(hex, 2, 0.3)
+	assert.NoError(t, err)
+	shell, err := Shell3D(sphere, 0.1)
+	assert.NoError(t, err)
+	thread, err := ISOThread(1, 0.2, true)
+	assert.NoError(t, err)
+	screw, err := Screw3D(thread, 3, 0.1, 0.2, 2)
+	assert.NoError(t, err)
+
+	u2 := Union2D(rect, Transform2D(circle, Translate2d(v2.Vec{1, 1})), Line2D(2, 0.1))
+	u2.(*UnionSDF2).SetBlend(RoundBlend, 0.3)
+	d2 := Difference2D(u2, Elongate2D(circle, v2.Vec{0.5, 0}))
+	d2.(*DifferenceSDF2).SetBlend(PolyBlend, 0.1)
+	a2 := Array2D(Cut2D(circle, v2.Vec{0, 0.2}, v2.Vec{1, 1}), v2i.Vec{2, 3}, v2.Vec{1.5, 1.5})
+	a2.(*ArraySDF2).SetBlend(ExpBlend, 16)
+	s2 := Union2D(d2, a2, RotateUnion2D(Offset2D(rect, 0.1), 3, Rotate2d(0.4)), RotateCopy2D(hex, 5),
+		ScaleUniform2D(Intersect2D(hex, circle), 1.5), Slice2D(box, v3.Vec{0, 0, 0.5}, v3.Vec{0, 1, 1}))
+
+	u3 := Union3D(box, Transform3D(sphere, Translate3d(v3.Vec{0, 0, 1.5})), cone)
+	u3.(*UnionSDF3).SetBlend(PolyBlend, 0.3)
+	i3 := Intersect3D(cylinder, Elongate3D(sphere, v3.Vec{1, 2, 0}))
+	i3.(*IntersectionSDF3).SetBlend(RoundBlend, 0.2)
+	a3 := Array3D(sphere, v3i.Vec{2, 3, 1}, v3.Vec{2, 2, 2})
+	a3.(*ArraySDF3).SetBlend(ChamferBlend, 0.1)
+	s3 := Union3D(
+		u3, i3, a3, sor, loft, rounded, shell, screw,
+		Extrude3D(s2, 2),
+		TwistExtrude3D(hex, 2, Pi),
+		ScaleExtrude3D(rect, 2, v2.Vec{0.2, 0.5}),
+		ScaleTwistExtrude3D(hex, 2, -3*Pi, v2.Vec{0.5, 0.3}),
+		Transform3D(box, RotateX(0.3).Mul(Scale3d(v3.Vec{0.5, 2, 1}))),
+		ScaleUniform3D(Difference3D(box, sphere), 2),
+		Cut3D(box, v3.Vec{0, 0.5, 0}, v3.Vec{1, 1, 0}),
+		RotateUnion3D(cylinder, 5, Translate3d(v3.Vec{1, 0, 0}).Mul(RotateZ(0.5))),
+		RotateCopy3D(box, 3),
+		Offset3D(box, 0.3),
+	)
+
+	// marshal and unmarshal
+	data, err := MarshalSDF3(s3)
+	assert.NoError(t, err)
+	s, err := UnmarshalSDF3(data)
+	assert.NoError(t, err)
+	bb := s3.BoundingBox()
+	assert.True(t, bb.Equals(s.BoundingBox(), tolerance))
+	for _, p := range bb.RandomSet(1000) {
+		if !EqualFloat64(s3.Evaluate(p), s.Evaluate(p), tolerance) {
+			t.Fatalf("unmarshalled sdf3 differs at %v", p)
+		}
+	}
+	// the document is stable
+	data2, err := MarshalSDF3(s)
+	assert.NoError(t, err)
+	assert.Equal(t, string(data), string(data2))
+	// a blended difference is the same as with PolyMax
+	assert.Equal(t, PolyMax(0.1)(0.3, 0.35), d2.(*DifferenceSDF2).max(0.3, 0.35))
+
+	// values aren't rounded
+	step := Translate3d(v3.Vec{0.1, 0.2, 0.3}).Mul(RotateZ(Tau / 7))
+	cone, err = Cone3D(0.7, 0.3, 0.1, 0.03)
+	assert.NoError(t, err)
+	data, err = MarshalSDF3(Union3D(RotateUnion3D(cone, 7, step), Cut3D(box, v3.Vec{}, v3.Vec{1, 1, 1})))
+	assert.NoError(t, err)
+	s, err = UnmarshalSDF3(data)
+	assert.NoError(t, err)
+	un := s.(*UnionSDF3)
+	r := un.sdf[0].(*RotateUnionSDF3)
+	assert.Equal(t, step, r.matrix)
+	assert.Equal(t, v2.Vec{0.3, 0.1}, r.sdf.(*ConeSDF3).radii)
+	assert.Equal(t, 0.7, 2*r.sdf.BoundingBox().Max.Z)
+	assert.Equal(t, v3.Vec{1, 1, 1}, un.sdf[1].(*CutSDF3).dir)
+
+	data, err = MarshalSDF2(s2)
+	assert.NoError(t, err)
+	s2b, err := UnmarshalSDF2(data)
+	assert.NoError(t, err)
+	bb2 := s2.BoundingBox()
+	for _, p := range bb2.RandomSet(1000) {
+		if !EqualFloat64(s2.Evaluate(p), s2b.Evaluate(p), tolerance) {
+			t.Fatalf("unmarshalled sdf2 differs at %v", p)
+		}
+	}
+
+	// file references
+	RegisterFileLoader3("test", func(path string, args []float64) (SDF3, error) {
+		return Sphere3D(args[0])
+	})
+	f, err := File3D("test", "sphere.test", 2)
+	assert.NoError(t, err)
+	data, err = MarshalSDF3(f)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "sphere.test")
+	f, err = UnmarshalSDF3(data)
+	assert.NoError(t, err)
+	assert.Equal(t, -2.0, f.Evaluate(v3.Vec{}))
+
+	// things that can't be serialized
+	e := Extrude3D(hex, 1)
+	e.(*ExtrudeSDF3).SetExtrude(NormalExtrude)
+	_, err = MarshalSDF3(e)
+	assert.Error(t, err)
+	u := Union3D(box, sphere)
+	u.(*UnionSDF3).SetMin(func(a, b float64) float64 { return math.Min(a, b) })
+	_, err = MarshalSDF3(u)
+	assert.Error(t, err)
+	u.(*UnionSDF3).SetMin(PolyMin(0.3))
+	_, err = MarshalSDF3(u)
+	assert.Error(t, err)
+	_, err = UnmarshalSDF3([]byte(`{"version": 99, "sdf3": {"type": "Sphere3D", "radius": 1}}`))
+	assert.Error(t, err)
+	_, err = UnmarshalSDF3([]byte(`{"version": 1, "sdf3": {"type": "Sphere3D"}}`))
+	assert.Error(t, err)
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_JSONRoundTrip(t *testing.T) {
+	hex, err := Polygon2D(Nagon(6, 0.5))
+	assert.NoError(t, err)
+	box, err := Box3D(v3.Vec{1, 1.5, 2}, 0.1)
+	assert.NoError(t, err)
+	sphere, err := Sphere3D(1)
+	assert.NoError(t, err)
+
+	path, err := SplinePath3([]v3.Vec{{0, 0, 0}, {4, 2, 2}, {6, 6, 0}}, 8)
+	assert.NoError(t, err)
+	sweep, err := Sweep3D(hex, path, Pi)
+	assert.NoError(t, err)
+	cp := [][]v3.Vec{{{0, 0, 0}, {0, 1, 1}, {0, 2, 0}}, {{1, 0, 1}, {1, 1, 2}, {1, 2, 1}}}
+	patch, err := BezierPatch3D(cp, 0.2)
+	assert.NoError(t, err)
+	v := []v3.Vec{
+		{-1, -1, -1}, {1, -1, -1}, {1, 1, -1}, {-1, 1, -1},
+		{-1, -1, 1}, {1, -1, 1}, {1, 1, 1}, {-1, 1, 1},
+	}
+	quad := func(a, b, c, d int) [][]v3.Vec {
+		return [][]v3.Vec{{v[a], v[b]}, {v[d], v[c]}}
+	}
+	solid, err := BezierSolid3D([][][]v3.Vec{
+		quad(0, 1, 5, 4), quad(1, 2, 6, 5), quad(2, 3, 7, 6),
+		quad(3, 0, 4, 7), quad(0, 3, 2, 1), quad(4, 5, 6, 7),
+	})
+	assert.NoError(t, err)
+
+	// image textures are serialized by reference
+	img := image.NewGray(image.Rect(0, 0, 4, 2))
+	img.SetGray(1, 0, color.Gray{255})
+	img.SetGray(2, 1, color.Gray{51})
+	fname := filepath.Join(t.TempDir(), "texture.png")
+	f, err := os.Create(fname)
+	assert.NoError(t, err)
+	assert.NoError(t, png.Encode(f, img))
+	f.Close()
+	tex, err := LoadImageTexture2(fname, v2.Vec{Pi / 2, Pi / 4})
+	assert.NoError(t, err)
+	planar, err := NewPlanarTexture3(tex, PlaneXZ)
+	assert.NoError(t, err)
+	cyl, err := NewCylindricalTexture3(tex, 1)
+	assert.NoError(t, err)
+	sph, err := NewSphericalTexture3(tex, 1)
+	assert.NoError(t, err)
+	tri, err := NewTriplanarTexture3(tex, v3.Vec{}, 0.5)
+	assert.NoError(t, err)
+
+	cache := Cache3D(box)
+	cache.(*CacheSDF3).SetLimit(1000)
+	redistance, err := Redistance3DBand(box, 0.1, 0.3)
+	assert.NoError(t, err)
+	redistanceDefault, err := Redistance3D(box, 0.1)
+	assert.NoError(t, err)
+	rounded, err := RoundEdges3D(box, 0.4)
+	assert.NoError(t, err)
+	filled, err := FillCorners3D(Union3D(box, sphere), 0.4)
+	assert.NoError(t, err)
+	sparse, err := NewSparseVoxelSDF3(box, 0.05, nil)
+	assert.NoError(t, err)
+
+	s3 := []SDF3{sweep, patch, solid, cache, redistance, redistanceDefault, rounded, filled, sparse}
+	for _, x := range []Texture3{planar, cyl, sph, tri} {
+		s, err := Displace3D(sphere, x, 0.1)
+		assert.NoError(t, err)
+		s3 = append(s3, s)
+	}
+	for _, s := range s3 {
+		data, err := MarshalSDF3(s)
+		if !assert.NoError(t, err, "%T", s) {
+			continue
+		}
+		s1, err := UnmarshalSDF3(data)
+		if !assert.NoError(t, err, "%T", s) {
+			continue
+		}
+		assert.IsType(t, s, s1)
+		bb := s.BoundingBox()
+		assert.True(t, bb.Equals(s1.BoundingBox(), tolerance), "%T", s)
+		for _, p := range bb.RandomSet(200) {
+			if !EqualFloat64(s.Evaluate(p), s1.Evaluate(p), tolerance) {
+				t.Fatalf("unmarshalled %T differs at %v", s, p)
+			}
+		}
+		data1, err := MarshalSDF3(s1)
+		assert.NoError(t, err)
+		assert.Equal(t, string(data), string(data1))
+	}
+
+	spline, err := CubicSpline2D([]v2.Vec{{0, 0}, {1, 2}, {3, 1}, {4, 3}})
+	assert.NoError(t, err)
+	cache2 := Cache2D(hex)
+	cache2.(*CacheSDF2).SetLimit(100)
+	redistance2, err := Redistance2DBand(hex, 0.02, 0.1)
+	assert.NoError(t, err)
+	redistance2Default, err := Redistance2D(hex, 0.02)
+	assert.NoError(t, err)
+	rounded2, err := RoundEdges2D(hex, 0.1)
+	assert.NoError(t, err)
+	filled2, err := FillCorners2D(hex, 0.1)
+	assert.NoError(t, err)
+	for _, s := range []SDF2{spline, cache2, redistance2, redistance2Default, rounded2, filled2} {
+		data, err := MarshalSDF2(s)
+		if !assert.NoError(t, err, "%T", s) {
+			continue
+		}
+		s1, err := UnmarshalSDF2(data)
+		if !assert.NoError(t, err, "%T", s) {
+			continue
+		}
+		assert.IsType(t, s, s1)
+		bb := s.BoundingBox()
+		for _, p := range bb.RandomSet(200) {
+			if !EqualFloat64(s.Evaluate(p), s1.Evaluate(p), tolerance) {
+				t.Fatalf("unmarshalled %T differs at %v", s, p)
+			}
+		}
+		data1, err := MarshalSDF2(s1)
+		assert.NoError(t, err)
+		assert.Equal(t, string(data), string(data1))
+	}
+	assert.Equal(t, 100, cache2.(*CacheSDF2).cache.limit)
+
+	// things that can't be serialized
+	sweep.(*SweepSDF3).SetExtrude(NormalExtrude)
+	_, err = MarshalSDF3(sweep)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "sweep")
+	}
+	tex, err = NewImageTexture2(img, v2.Vec{1, 1})
+	assert.NoError(t, err)
+	planar, err = NewPlanarTexture3(tex, PlaneXY)
+	assert.NoError(t, err)
+	s, err := Displace3D(box, planar, 0.1)
+	assert.NoError(t, err)
+	_, err = MarshalSDF3(s)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "image texture")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Optimize(t *testing.T) {
+	sphere, err := Sphere3D(0.5)
+	assert.NoError(t, err)
+	box, err := Box3D(v3.Vec{4, 4, 1}, 0)
+	assert.NoError(t, err)
+
+	// a union built in a loop
+	var row SDF3
+	for i := 0; i < 5; i++ {
+		x := Transform3D(sphere, Translate3d(v3.Vec{float64(i), 0, 0}))
+		row = Union3D(row, Transform3D(x, Translate3d(v3.Vec{0, 3, 0})))
+	}
+	// holes, some of which are outside the box
+	var holes SDF3
+	for i := 0; i < 6; i++ {
+		holes = Union3D(holes, Transform3D(sphere, Translate3d(v3.Vec{float64(i) - 1, -1, 0})))
+	}
+	plate := Difference3D(box, holes)
+	// intersection chain
+	s0 := Intersect3D(Intersect3D(box, Transform3D(box, RotateZ(0.5))), Transform3D(box, RotateZ(1.0)))
+	// stacked transforms
+	s1 := Transform3D(Transform3D(Transform3D(s0, RotateX(0.2)), Scale3d(v3.Vec{2, 2, 2})), RotateX(-0.2))
+	s2 := ScaleUniform3D(ScaleUniform3D(s1, 0.5), 3)
+	// a blended union is left alone
+	s3 := Union3D(row, Transform3D(s2, Translate3d(v3.Vec{0, 0, 10})))
+	s3.(*UnionSDF3).SetBlend(PolyBlend, 0.2)
+	s := Union3D(plate, row, s3)
+
+	o := Optimize3D(s)
+
+	// check the structure
+	u, ok := o.(*UnionSDF3)
+	assert.True(t, ok)
+	assert.Equal(t, 7, len(u.sdf))
+	d, ok := u.sdf[0].(*DifferenceSDF3)
+	assert.True(t, ok)
+	assert.Equal(t, 4, len(d.s1.(*UnionSDF3).sdf))
+	for _, x := range u.sdf[1:6] {
+		tr, ok := x.(*translateSDF3)
+		assert.True(t, ok)
+		assert.Equal(t, sphere, tr.sdf)
+	}
+	u3 := u.sdf[6].(*UnionSDF3)
+	assert.Equal(t, 2, len(u3.sdf))
+	su, ok := u3.sdf[1].(*translateSDF3).sdf.(*ScaleUniformSDF3)
+	assert.True(t, ok)
+	assert.InDelta(t, 1.5, su.k, tolerance)
+	tr, ok := su.sdf.(*translateSDF3)
+	assert.True(t, ok)
+	x, ok := tr.sdf.(*intersectionSDF3)
+	assert.True(t, ok)
+	assert.Equal(t, 3, len(x.sdf))
+
+	// check the distance field
+	bb := s.BoundingBox().ScaleAboutCenter(1.5)
+	for _, p := range bb.RandomSet(2000) {
+		assert.InDelta(t, s.Evaluate(p), o.Evaluate(p), tolerance)
+	}
+
+	// the original is unchanged
+	assert.Equal(t, 3, len(s.(*UnionSDF3).sdf))
+	assert.Equal(t, 2, len(holes.(*UnionSDF3).sdf))
+
+	// dominated members are dropped
+	small := Transform3D(sphere, Translate3d(v3.Vec{1, 1, 0}))
+	big, err := Sphere3D(3)
+	assert.NoError(t, err)
+	s6 := Union3D(small, box, box)
+	o6 := Optimize3D(s6)
+	assert.Equal(t, box, o6)
+	s7 := Intersect3D(Intersect3D(big, box), Transform3D(box, RotateZ(0.5)))
+	o7 := Optimize3D(s7)
+	x7, ok := o7.(*intersectionSDF3)
+	assert.True(t, ok)
+	assert.Equal(t, 2, len(x7.sdf))
+	assert.Equal(t, box.BoundingBox(), x7.bb)
+	// disjoint members give an empty intersection
+	s8 := Intersect3D(Intersect3D(box, small), Transform3D(sphere, Translate3d(v3.Vec{0, 0, 5})))
+	o8 := Optimize3D(s8)
+	assert.Equal(t, 2, len(o8.(*intersectionSDF3).sdf))
+	bb = box.BoundingBox().ScaleAboutCenter(2)
+	for _, p := range bb.RandomSet(2000) {
+		assert.InDelta(t, s6.Evaluate(p), o6.Evaluate(p), tolerance)
+		assert.InDelta(t, s7.Evaluate(p), o7.Evaluate(p), tolerance)
+		assert.True(t, o8.Evaluate(p) > 0)
+	}
+
+	// 2d
+	circle, err := Circle2D(0.5)
+	assert.NoError(t, err)
+	rect := Box2D(v2.Vec{4, 2}, 0.2)
+	var circles SDF2
+	for i := 0; i < 4; i++ {
+		circles = Union2D(circles, Transform2D(circle, Translate2d(v2.Vec{float64(i), 0})))
+	}
+	far := Transform2D(circle, Translate2d(v2.Vec{10, 10}))
+	s5 := Intersect2D(Intersect2D(rect, circles), Transform2D(rect, Rotate2d(0.5)))
+	s4 := Union2D(
+		Difference2D(rect, far),
+		Transform2D(Transform2D(circles, Rotate2d(0.3)), Translate2d(v2.Vec{0, 3})),
+		s5,
+	)
+	o2 := Optimize2D(s4)
+	u2, ok := o2.(*UnionSDF2)
+	assert.True(t, ok)
+	// the intersection is within the rectangle
+	assert.Equal(t, 2, len(u2.sdf))
+	assert.Equal(t, rect, u2.sdf[0])
+	_, ok = u2.sdf[1].(*TransformSDF2)
+	assert.True(t, ok)
+	o5 := Optimize2D(s5)
+	x2, ok := o5.(*intersectionSDF2)
+	assert.True(t, ok)
+	assert.Equal(t, 3, len(x2.sdf))
+	assert.Equal(t, Box2{v2.Vec{-0.5, -0.5}, v2.Vec{2, 0.5}}, x2.bb)
+	bb2 := s4.BoundingBox().ScaleAboutCenter(1.5)
+	for _, p := range bb2.RandomSet(2000) {
+		assert.InDelta(t, s4.Evaluate(p), o2.Evaluate(p), tolerance)
+		assert.InDelta(t, s5.Evaluate(p), o5.Evaluate(p), tolerance)
+	}
+
+	// the optimized tree can be serialized
+	_, err = MarshalSDF3(o)
+	assert.NoError(t, err)
+	_, err = MarshalSDF2(o2)
+	assert.NoError(t, err)
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_UnionBVH(t *testing.T) {
+	sphere, err := Sphere3D(0.4)
+	assert.NoError(t, err)
+	box, err := Box3D(v3.Vec{0.5, 0.7, 0.3}, 0.1)
+	assert.NoError(t, err)
+	cylinder, err := Cylinder3D(1, 0.2, 0)
+	assert.NoError(t, err)
+	shapes := []SDF3{sphere, box, cylinder}
+	var sdf []SDF3
+	for i := 0; i < 200; i++ {
+		m := Translate3d(v3.Vec{float64(i % 7), float64((i / 7) % 5), float64(i / 35)}.MulScalar(1.5)).Mul(RotateZ(float64(i)))
+		sdf = append(sdf, Transform3D(shapes[i%3], m))
+	}
+	s := Union3D(sdf...).(*UnionSDF3)
+	assert.NotNil(t, s.bvh)
+	bb := s.BoundingBox().ScaleAboutCenter(1.5)
+	for _, p := range bb.RandomSet(2000) {
+		d := sdf[0].Evaluate(p)
+		for _, x := range sdf[1:] {
+			d = math.Min(d, x.Evaluate(p))
+		}
+		assert.Equal(t, d, s.Evaluate(p))
+	}
+	// no BVH for blended unions
+	s.SetMin(PolyMin(0.1))
+	assert.Nil(t, s.bvh)
+	s.SetMin(math.Min)
+	assert.NotNil(t, s.bvh)
+
+	// no BVH for members that bound the distance
+	linear := func(sdf []SDF3, p v3.Vec) float64 {
+		d := sdf[0].Evaluate(p)
+		for _, x := range sdf[1:] {
+			d = math.Min(d, x.Evaluate(p))
+		}
+		return d
+	}
+	square := Box2D(v2.Vec{0.6, 0.6}, 0)
+	bound := []SDF3{
+		Transform3D(sphere, Scale3d(v3.Vec{3, 3, 3})),
+		Extrude3D(square, 0.6),
+		Transform3D(Extrude3D(square, 0.6), Translate3d(v3.Vec{2, 0, 0})),
+		Transform3D(sphere, Translate3d(v3.Vec{0, 2, 0}).Mul(Scale3d(v3.Vec{1, 2, 1}))),
+		Transform3D(sphere, Translate3d(v3.Vec{4, 4, 0})),
+		Transform3D(sphere, Translate3d(v3.Vec{6, 0, 0}).Mul(Scale3d(v3.Vec{10, 10, 10}))),
+	}
+	sb := Union3D(bound...).(*UnionSDF3)
+	assert.Nil(t, sb.bvh)
+	bb = sb.BoundingBox().ScaleAboutCenter(2)
+	ps := bb.RandomSet(2000)
+	// the scaled sphere is closer than the distance to its bounding box
+	ps = append(ps, v3.Vec{1, 0, 0})
+	out := make([]float64, len(ps))
+	EvaluateBatch3(sb, ps, out)
+	for i, p := range ps {
+		assert.Equal(t, linear(bound, p), sb.Evaluate(p))
+		assert.Equal(t, linear(bound, p), out[i])
+	}
+	// unions of exact members are exact
+	assert.NotNil(t, Union3D(s, sdf[0], sdf[1], sdf[2]).(*UnionSDF3).bvh)
+	assert.Nil(t, Union3D(sb, sdf[0], sdf[1], sdf[2]).(*UnionSDF3).bvh)
+
+	circle, err := Circle2D(0.4)
+	assert.NoError(t, err)
+	var sdf2 []SDF2
+	for i := 0; i < 100; i++ {
+		v := v2.Vec{float64(i % 10), float64(i / 10)}.MulScalar(1.1)
+		sdf2 = append(sdf2, Transform2D(circle, Translate2d(v)))
+	}
+	s2 := Union2D(sdf2...).(*UnionSDF2)
+	assert.NotNil(t, s2.bvh)
+	bb2 := s2.BoundingBox().ScaleAboutCenter(1.5)
+	for _, p := range bb2.RandomSet(2000) {
+		assert.Equal(t, s2.EvaluateSlow(p), s2.Evaluate(p))
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Redistance(t *testing.T) {
+	// a scaled sphere has the true distance after redistancing
+	sphere, err := Sphere3D(2)
+	assert.NoError(t, err)
+	s := Transform3D(sphere, Scale3d(v3.Vec{1, 2, 1}))
+	r, err := Redistance3DBand(s, 0.05, 1.5)
+	assert.NoError(t, err)
+	assert.True(t, r.BoundingBox().Contains(s.BoundingBox().Max))
+	for _, p := range []v3.Vec{{2, 0, 0}, {0, 4, 0}, {0, 0, -2}} {
+		assert.InDelta(t, 0, r.Evaluate(p), 0.01)
+	}
+	assert.InDelta(t, -1, r.Evaluate(v3.Vec{1, 0, 0}), 0.05)
+	assert.InDelta(t, -1, r.Evaluate(v3.Vec{0, 3, 0}), 0.05)
+	assert.InDelta(t, 0.1, r.Evaluate(v3.Vec{2.1, 0, 0}), 0.01)
+	assert.InDelta(t, 0.15, r.Evaluate(v3.Vec{0, 4.15, 0}), 0.01)
+	assert.InDelta(t, 1, Gradient3(r, v3.Vec{2.1, 0, 0}, 0).X, 0.01)
+	// outside the grid
+	assert.InDelta(t, 3, r.Evaluate(v3.Vec{0, 0, 5}), 0.3)
+	assert.LessOrEqual(t, r.Evaluate(v3.Vec{0, 0, 5}), 3.0)
+	// outside the narrow band
+	assert.Equal(t, -1.5, r.Evaluate(v3.Vec{0, 0, 0}))
+	assert.Equal(t, -1.5, r.Evaluate(v3.Vec{0, 0.3, 0.1}))
+
+	// blocks outside the band aren't sampled
+	r, err = Redistance3DBand(sphere, 0.05, 0.2)
+	assert.NoError(t, err)
+	assert.Equal(t, -0.2, r.Evaluate(v3.Vec{0, 0, 0}))
+	assert.InDelta(t, -0.1, r.Evaluate(v3.Vec{1.9, 0, 0}), 0.005)
+	assert.InDelta(t, 0.15, r.Evaluate(v3.Vec{0, -2.15, 0}), 0.005)
+	for _, x := range r.(*RedistanceSDF3).grid.data {
+		assert.LessOrEqual(t, math.Abs(x), 0.2)
+	}
+
+	// the default band is redistanceBand cells wide
+	r, err = Redistance3D(sphere, 0.05)
+	assert.NoError(t, err)
+	assert.InDelta(t, -redistanceBand*0.05, r.Evaluate(v3.Vec{0, 0, 0}), 1e-12)
+	assert.InDelta(t, 0.15, r.Evaluate(v3.Vec{0, -2.15, 0}), 0.005)
+
+	// a bound becomes a distance that is never overestimated
+	box := Box2D(v2.Vec{4, 2}, 0)
+	twist := TwistExtrude3D(box, 6, Pi)
+	a, err := Audit3D(twist, 500)
+	assert.NoError(t, err)
+	assert.Greater(t, a.Overestimates, 0, a.String())
+	r, err = Redistance3DBand(twist, 0.1, 1)
+	assert.NoError(t, err)
+	a, err = Audit3D(r, 500)
+	assert.NoError(t, err)
+	assert.Less(t, a.MaxLipschitz, 1.5, a.String())
+	assert.Equal(t, 0, a.Overestimates, a.String())
+	assert.Equal(t, 0, a.SignMismatches, a.String())
+
+	// 2d
+	circle, err := Circle2D(1)
+	assert.NoError(t, err)
+	r2, err := Redistance2DBand(Transform2D(circle, Scale2d(v2.Vec{0.25, 1})), 0.01, 0.5)
+	assert.NoError(t, err)
+	a2, err := Audit2D(r2, 500)
+	assert.NoError(t, err)
+	assert.Less(t, a2.MaxLipschitz, 1.5, a2.String())
+	assert.Equal(t, 0, a2.Overestimates, a2.String())
+	assert.Equal(t, 0, a2.SignMismatches, a2.String())
+	assert.InDelta(t, 0, r2.Evaluate(v2.Vec{0.25, 0}), 0.005)
+	assert.InDelta(t, 0.02, r2.Evaluate(v2.Vec{0, 1.02}), 0.005)
+	assert.InDelta(t, -0.25, r2.Evaluate(v2.Vec{0, 0}), 0.005)
+
+	_, err = Redistance3DBand(sphere, 0, 1)
+	assert.Error(t, err)
+	_, err = Redistance3DBand(sphere, 0.1, 0)
+	assert.Error(t, err)
+	_, err = Redistance2DBand(circle, 1e-6, 1)
+	assert.Error(t, err)
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_VoxelSDF3(t *testing.T) {
+	sphere, err := Sphere3D(1)
+	assert.NoError(t, err)
+	progress := make(chan float64, 64)
+	v := NewVoxelSDF3(sphere, 32, progress).(*VoxelSDF3)
+	close(progress)
+	last := 0.0
+	for x := range progress {
+		assert.Greater(t, x, last)
+		last = x
+	}
+	assert.Equal(t, 1.0, last)
+	assert.Equal(t, sphere.BoundingBox(), v.BoundingBox())
+
+	// exact at the voxel corners
+	for _, p := range []v3.Vec{{0, 0, 0}, {1, 0, 0}, {0.5, -0.5, 0.25}} {
+		assert.InDelta(t, sphere.Evaluate(p), v.Evaluate(p), tolerance)
+	}
+	// tricubic interpolation is closer to the sphere than trilinear interpolation
+	bb := sphere.BoundingBox()
+	points := bb.RandomSet(1000)
+	var errLinear, errCubic float64
+	for _, p := range points {
+		errLinear += math.Abs(v.Evaluate(p) - sphere.Evaluate(p))
+	}
+	v.SetTricubic(true)
+	for _, p := range points {
+		errCubic += math.Abs(v.Evaluate(p) - sphere.Evaluate(p))
+		if p.Length() > 0.2 {
+			assert.InDelta(t, 1, Gradient3(v, p, 0).Dot(p.Normalize()), 0.02)
+		}
+	}
+	assert.Less(t, errLinear/float64(len(points)), 1e-2)
+	assert.Less(t, errCubic, 0.25*errLinear)
+	// outside the grid the distance is a lower bound
+	p := v3.Vec{3, 3, 0}
+	assert.Less(t, v.Evaluate(p), sphere.Evaluate(p))
+	assert.Greater(t, v.Evaluate(p), 2.5)
+
+	// save and load
+	path := filepath.Join(t.TempDir(), "sphere.vox")
+	assert.NoError(t, v.Save(path))
+	s, err := LoadVoxelSDF3(path)
+	assert.NoError(t, err)
+	assert.True(t, s.(*VoxelSDF3).tricubic)
+	for _, p := range points {
+		assert.InDelta(t, v.Evaluate(p), s.Evaluate(p), 1e-6)
+	}
+	// as a file reference
+	f, err := File3D("voxel", path)
+	assert.NoError(t, err)
+	data, err := MarshalSDF3(f)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "sphere.vox")
+	f, err = UnmarshalSDF3(data)
+	assert.NoError(t, err)
+	assert.InDelta(t, -1, f.Evaluate(v3.Vec{}), 1e-6)
+
+	// the grid size doesn't match the file size
+	good, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	bad := filepath.Join(t.TempDir(), "short.vox")
+	assert.NoError(t, os.WriteFile(bad, good[:len(good)-4], 0o644))
+	_, err = LoadVoxelSDF3(bad)
+	assert.Error(t, err)
+	huge := append([]byte(nil), good...)
+	binary.LittleEndian.PutUint32(huge[8:], 1000)
+	binary.LittleEndian.PutUint32(huge[12:], 1000)
+	binary.LittleEndian.PutUint32(huge[16:], 1000)
+	assert.NoError(t, os.WriteFile(bad, huge, 0o644))
+	_, err = LoadVoxelSDF3(bad)
+	assert.Error(t, err)
+
+	// not a voxel file
+	path = filepath.Join(t.TempDir(), "bad.vox")
+	assert.NoError(t, os.WriteFile(path, make([]byte, 1024), 0o644))
+	_, err = LoadVoxelSDF3(path)
+	assert.Error(t, err)
+	_, err = LoadVoxelSDF3(filepath.Join(t.TempDir(), "missing.vox"))
+	assert.Error(t, err)
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_SparseVoxelSDF3(t *testing.T) {
+	sphere, err := Sphere3D(1)
+	assert.NoError(t, err)
+	progress := make(chan float64, 64)
+	s, err := NewSparseVoxelSDF3(sphere, 0.01, progress)
+	assert.NoError(t, err)
+	close(progress)
+	last := 0.0
+	for x := range progress {
+		assert.Greater(t, x, last)
+		last = x
+	}
+	assert.Equal(t, 1.0, last)
+	v := s.(*SparseVoxelSDF3)
+	assert.True(t, v.BoundingBox().Contains(sphere.BoundingBox().Min))
+	assert.True(t, v.BoundingBox().Contains(sphere.BoundingBox().Max))
+
+	// only the tiles near the surface are allocated
+	dense := (v.n.X / sparseTileSize) * (v.n.Y / sparseTileSize) * (v.n.Z / sparseTileSize)
+	assert.Greater(t, v.Tiles(), 0)
+	assert.Less(t, v.Tiles(), dense/3)
+
+	bb := v.BoundingBox().ScaleAboutCenter(1.5)
+	for _, p := range bb.RandomSet(5000) {
+		d0 := sphere.Evaluate(p)
+		d1 := v.Evaluate(p)
+		if math.Abs(d0) < 2*v.h {
+			// within the narrow band
+			assert.InDelta(t, d0, d1, 1e-3)
+		} else {
+			// a lower bound outside the narrow band
+			assert.Equal(t, d0 < 0, d1 < 0)
+			assert.LessOrEqual(t, math.Abs(d1), math.Abs(d0)+1e-3)
+			assert.GreaterOrEqual(t, math.Abs(d1), math.Min(math.Abs(d0), v.band)-v.h)
+			if v.bb.Contains(p) {
+				// allocated or not, the values are clamped to the narrow band
+				assert.LessOrEqual(t, math.Abs(d1), v.band+1e-6)
+			}
+		}
+	}
+	p := v3.Vec{0.6, 0.8, 0}
+	assert.InDelta(t, 1, Gradient3(v, p, 0).Dot(p), 0.01)
+	assert.InDelta(t, -v.band, v.Evaluate(v3.Vec{}), 1e-6)
+	assert.InDelta(t, v.band, v.Evaluate(v.bb.Max), 1e-6)
+
+	_, err = NewSparseVoxelSDF3(sphere, 0, nil)
+	assert.Error(t, err)
+
+	// without interval evaluation the sdf is assumed to be a distance bound
+	box, err := Box3D(v3.Vec{1, 1, 1}, 0.1)
+	assert.NoError(t, err)
+	for _, x := range []SDF3{struct{ SDF3 }{sphere}, Union3D(struct{ SDF3 }{box}, Transform3D(sphere, Translate3d(v3.Vec{1, 0, 0})))} {
+		s, err := NewSparseVoxelSDF3(x, 0.01, nil)
+		assert.NoError(t, err)
+		v := s.(*SparseVoxelSDF3)
+		dense := (v.n.X / sparseTileSize) * (v.n.Y / sparseTileSize) * (v.n.Z / sparseTileSize)
+		assert.Less(t, v.Tiles(), dense/3)
+		bb := x.BoundingBox()
+		for _, p := range bb.RandomSet(2000) {
+			if d0 := x.Evaluate(p); math.Abs(d0) < 2*v.h {
+				assert.InDelta(t, d0, v.Evaluate(p), 1e-3)
+			}
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Cache(t *testing.T) {
+	sphere, err := Sphere3D(1)
+	assert.NoError(t, err)
+	c := Cache3D(sphere).(*CacheSDF3)
+	bb := sphere.BoundingBox()
+	points := bb.RandomSet(1000)
+
+	// concurrent evaluation
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, p := range points {
+				assert.Equal(t, sphere.Evaluate(p), c.Evaluate(p))
+			}
+		}()
+	}
+	wg.Wait()
+	reads, hits := c.Stats()
+	assert.Equal(t, uint64(8000), reads)
+	assert.GreaterOrEqual(t, hits, uint64(7000))
+	assert.Equal(t, 1000, c.cache.size())
+	assert.Contains(t, c.String(), "reads 8000")
+
+	// a limited cache
+	c.SetLimit(256)
+	assert.Equal(t, 0, c.cache.size())
+	for i := 0; i < 2; i++ {
+		for _, p := range points {
+			assert.Equal(t, sphere.Evaluate(p), c.Evaluate(p))
+		}
+	}
+	assert.LessOrEqual(t, c.cache.size(), 256)
+	assert.Greater(t, c.cache.size(), 128)
+	// the most recent evaluations are still cached
+	_, hits = c.Stats()
+	c.Evaluate(points[len(points)-1])
+	_, n := c.Stats()
+	assert.Equal(t, hits+1, n)
+
+	// 2d
+	circle, err := Circle2D(1)
+	assert.NoError(t, err)
+	c2 := Cache2D(circle).(*CacheSDF2)
+	c2.SetLimit(100)
+	bb2 := circle.BoundingBox()
+	for _, p := range bb2.RandomSet(1000) {
+		assert.Equal(t, circle.Evaluate(p), c2.Evaluate(p))
+		assert.Equal(t, circle.Evaluate(p), c2.Evaluate(p))
+	}
+	reads, hits = c2.Stats()
+	assert.Equal(t, uint64(2000), reads)
+	assert.Equal(t, uint64(1000), hits)
+	assert.LessOrEqual(t, c2.cache.size(), 100)
+	assert.Equal(t, EvaluateInterval2(circle, bb2), EvaluateInterval2(c2, bb2))
+
+	// limits smaller than the number of shards
+	c2.SetLimit(3)
+	for _, p := range bb2.RandomSet(1000) {
+		assert.Equal(t, circle.Evaluate(p), c2.Evaluate(p))
+	}
+	assert.Equal(t, 3, c2.cache.size())
+
+	// -0 and 0 are the same point
+	c2.SetLimit(0)
+	reads, hits = c2.Stats()
+	c2.Evaluate(v2.Vec{0, 0.5})
+	c2.Evaluate(v2.Vec{math.Copysign(0, -1), 0.5})
+	r, h := c2.Stats()
+	assert.Equal(t, reads+2, r)
+	assert.Equal(t, hits+1, h)
+	assert.Equal(t, 1, c2.cache.size())
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_PolyMin(t *testing.T) {
+	for _, k := range []float64{0, -0.1} {
+		min := PolyMin(k)
+		max := PolyMax(k)
+		for _, x := range [][2]float64{{1, 2}, {2, 1}, {1, 1}, {-1, 0.5}, {0, 0}} {
+			assert.Equal(t, math.Min(x[0], x[1]), min(x[0], x[1]))
+			assert.Equal(t, math.Max(x[0], x[1]), max(x[0], x[1]))
+		}
+	}
+	// variable blends go to a zero blend size
+	assert.Equal(t, 1.0, PolyBlend.fieldMin(0)(1, 1))
+	assert.Equal(t, 1.0, PolyBlend.fieldMin(-0.5)(1, 3))
+	// blending is still smooth for k > 0
+	assert.Less(t, PolyMin(0.2)(1, 1), 1.0)
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_BlendUnion(t *testing.T) {
+	wall, err := Box3D(v3.Vec{4, 4, 1}, 0)
+	assert.NoError(t, err)
+	cylinder, err := Cylinder3D(2, 0.5, 0)
+	assert.NoError(t, err)
+	boss0 := Transform3D(cylinder, Translate3d(v3.Vec{1, 0, 1}))
+	boss1 := Transform3D(cylinder, Translate3d(v3.Vec{-1, 0, 1}))
+	bb := Box3{v3.Vec{-2, -2, -0.5}, v3.Vec{2, 2, 2}}
+
+	// a fillet on one boss and a sharp edge on the other
+	s, err := SmoothUnion3D([]SDF3{wall, boss0, boss1}, []float64{0.3, 0}, PolyBlend)
+	assert.NoError(t, err)
+	u := Union3D(wall, boss0, boss1)
+	assert.Less(t, s.Evaluate(v3.Vec{1.55, 0, 0.55}), 0.0)
+	assert.InDelta(t, u.Evaluate(v3.Vec{-1.55, 0, 0.55}), s.Evaluate(v3.Vec{-1.55, 0, 0.55}), tolerance)
+	assert.True(t, bb.Equals(s.BoundingBox(), tolerance))
+
+	// a single blend size is the same as a smoothed union
+	s, err = SmoothUnion3D([]SDF3{wall, boss0}, []float64{0.3}, PolyBlend)
+	assert.NoError(t, err)
+	u = Union3D(wall, boss0)
+	u.(*UnionSDF3).SetMin(PolyMin(0.3))
+	for _, p := range bb.RandomSet(1000) {
+		assert.InDelta(t, u.Evaluate(p), s.Evaluate(p), tolerance)
+	}
+
+	// a blend size that varies along the x-axis
+	radius := func(p v3.Vec) float64 {
+		return Clamp(0.2*(p.X+1.5), 0, 0.6)
+	}
+	for _, blend := range []*Blend{RoundBlend, ChamferBlend, PolyBlend} {
+		s, err = FieldUnion3D([]SDF3{wall, boss0, boss1}, radius, 0.2, blend)
+		assert.NoError(t, err)
+		assert.Less(t, s.Evaluate(v3.Vec{1.55, 0, 0.55}), 0.0)
+		assert.Greater(t, s.Evaluate(v3.Vec{-1.55, 0, 0.55}), 0.0)
+		r, err := Audit3D(s, 2000)
+		assert.NoError(t, err)
+		assert.LessOrEqual(t, r.MaxLipschitz, 1.001, r.String())
+		assert.Equal(t, 0, r.Overestimates, r.String())
+		assert.Equal(t, 0, r.SignMismatches, r.String())
+		// the interval contains the values within the box
+		for _, p := range bb.RandomSet(100) {
+			b := NewBox3(p, v3.Vec{0.4, 0.4, 0.4})
+			i := s.(IntervalSDF3).EvaluateInterval(b)
+			for _, q := range b.RandomSet(20) {
+				d := s.Evaluate(q)
+				assert.True(t, d >= i[0]-tolerance && d <= i[1]+tolerance)
+			}
+		}
+	}
+
+	// blending each child with the union of the earlier children compounds the lipschitz constants
+	var slabs []SDF3
+	for i := 0; i < 5; i++ {
+		slabs = append(slabs, Transform3D(wall, Translate3d(v3.Vec{0, 0, 0.05 * float64(i)})))
+	}
+	top := Box3{v3.Vec{-1, -1, 0.5}, v3.Vec{1, 1, 1.5}}
+	// the blends move the surface outside the bounding box, audit a bigger box
+	big, err := Box3D(v3.Vec{6, 6, 4}, 0)
+	assert.NoError(t, err)
+	for _, blend := range []*Blend{RoundBlend, ChamferBlend, PolyBlend} {
+		s, err = SmoothUnion3D(slabs, []float64{0.5, 0.5, 0.5, 0.5}, blend)
+		assert.NoError(t, err)
+		if blend == RoundBlend {
+			assert.InDelta(t, math.Sqrt(5), s.(*BlendUnionSDF3).k, tolerance)
+		}
+		f, err := FieldUnion3D(slabs, radius, 0.2, blend)
+		assert.NoError(t, err)
+		for _, x := range []SDF3{s, f} {
+			r, err := Audit3D(Intersect3D(big, x), 2000)
+			assert.NoError(t, err)
+			assert.LessOrEqual(t, r.MaxLipschitz, 1.001, r.String())
+			assert.Equal(t, 0, r.Overestimates, r.String())
+			// the worst case is above the parallel surfaces
+			for _, p := range top.RandomSet(200) {
+				g := Gradient3(x, p, 0)
+				assert.LessOrEqual(t, g.Length(), 1.001)
+			}
+		}
+	}
+
+	// a hole with a varying chamfer
+	hole, err := Cylinder3D(2, 0.5, 0)
+	assert.NoError(t, err)
+	d, err := FieldDifference3D(wall, hole, radius, 0.2, ChamferBlend)
+	assert.NoError(t, err)
+	assert.Greater(t, d.Evaluate(v3.Vec{0, 0, 0}), 0.0)
+	assert.Less(t, d.Evaluate(v3.Vec{1, 0, 0}), 0.0)
+	r, err := Audit3D(d, 2000)
+	assert.NoError(t, err)
+	assert.LessOrEqual(t, r.MaxLipschitz, 1.001, r.String())
+	assert.Equal(t, 0, r.Overestimates, r.String())
+
+	// marshal and unmarshal
+	s, err = SmoothUnion3D([]SDF3{wall, boss0, boss1}, []float64{0.3, 0.1}, ChamferBlend)
+	assert.NoError(t, err)
+	data, err := MarshalSDF3(Optimize3D(s))
+	assert.NoError(t, err)
+	x, err := UnmarshalSDF3(data)
+	assert.NoError(t, err)
+	for _, p := range bb.RandomSet(100) {
+		assert.InDelta(t, s.Evaluate(p), x.Evaluate(p), tolerance)
+	}
+	// radius functions can't be marshalled
+	s, err = FieldUnion3D([]SDF3{wall, boss0}, radius, 0.2, RoundBlend)
+	assert.NoError(t, err)
+	_, err = MarshalSDF3(s)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "radius function")
+	}
+	_, err = MarshalSDF3(d)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "radius function")
+	}
+
+	// errors
+	_, err = SmoothUnion3D([]SDF3{wall}, nil, RoundBlend)
+	assert.Error(t, err)
+	_, err = SmoothUnion3D([]SDF3{wall, boss0}, []float64{0.1, 0.2}, RoundBlend)
+	assert.Error(t, err)
+	_, err = SmoothUnion3D([]SDF3{wall, boss0}, []float64{-0.1}, RoundBlend)
+	assert.Error(t, err)
+	_, err = SmoothUnion3D([]SDF3{wall, boss0}, []float64{0.1}, nil)
+	assert.Error(t, err)
+	_, err = FieldUnion3D([]SDF3{wall, boss0}, nil, 0.2, RoundBlend)
+	assert.Error(t, err)
+	_, err = FieldUnion3D([]SDF3{wall, boss0}, radius, -1, RoundBlend)
+	assert.Error(t, err)
+	_, err = FieldDifference3D(wall, nil, radius, 0.2, RoundBlend)
+	assert.Error(t, err)
+	_, err = SmoothUnion3D([]SDF3{wall, boss0}, []float64{0.1}, PowBlend)
+	assert.Error(t, err)
+	_, err = FieldUnion3D([]SDF3{wall, boss0}, radius, 0.2, ExpBlend)
+	assert.Error(t, err)
+	_, err = FieldDifference3D(wall, hole, radius, 0.2, ExpBlend)
+	assert.Error(t, err)
+	// only the predefined blends can be serialized
+	custom := &Blend{Name: "RoundMin", Min: RoundMin, Lipschitz: math.Hypot}
+	s, err = SmoothUnion3D([]SDF3{wall, boss0}, []float64{0.1}, custom)
+	assert.NoError(t, err)
+	_, err = MarshalSDF3(s)
+	assert.Error(t, err)
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Morphology(t *testing.T) {
+	const r = 0.2
+	// sharp edges on the intermediate surface are cut by up to a grid cell
+	const tol = 1.5 * r / morphologyCells
+
+	// rounded outside edges and corners
+	box, err := Box3D(v3.Vec{1, 1, 1}, 0)
+	assert.NoError(t, err)
+	s, err := RoundEdges3D(box, r)
+	assert.NoError(t, err)
+	assert.InDelta(t, 0, s.Evaluate(v3.Vec{0.5, 0, 0}), tol)
+	assert.InDelta(t, -0.25, s.Evaluate(v3.Vec{0.25, 0, 0}), tol)
+	assert.InDelta(t, (math.Sqrt2-1)*r, s.Evaluate(v3.Vec{0.5, 0.5, 0}), tol)
+	assert.InDelta(t, (math.Sqrt(3)-1)*r, s.Evaluate(v3.Vec{0.5, 0.5, 0.5}), tol)
+
+	// a filled inside corner
+	b0 := Transform3D(box, Translate3d(v3.Vec{0.5, 0, 0}))
+	b1 := Transform3D(box, Translate3d(v3.Vec{0, 0.5, 0}))
+	s, err = FillCorners3D(Union3D(b0, b1), r)
+	assert.NoError(t, err)
+	assert.InDelta(t, -(math.Sqrt2-1)*r, s.Evaluate(v3.Vec{0.5, 0.5, 0}), tol)
+	assert.InDelta(t, 0, s.Evaluate(v3.Vec{1, 0, 0}), tol)
+	assert.InDelta(t, 0, s.Evaluate(v3.Vec{0, 1, 0}), tol)
+
+	// 2d
+	square := Box2D(v2.Vec{1, 1}, 0)
+	s2, err := RoundEdges2D(square, r)
+	assert.NoError(t, err)
+	assert.InDelta(t, 0, s2.Evaluate(v2.Vec{0.5, 0}), tol)
+	assert.InDelta(t, (math.Sqrt2-1)*r, s2.Evaluate(v2.Vec{0.5, 0.5}), tol)
+	l := Union2D(Transform2D(square, Translate2d(v2.Vec{0.5, 0})), Transform2D(square, Translate2d(v2.Vec{0, 0.5})))
+	s2, err = FillCorners2D(l, r)
+	assert.NoError(t, err)
+	assert.InDelta(t, -(math.Sqrt2-1)*r, s2.Evaluate(v2.Vec{0.5, 0.5}), tol)
+
+	// a bound on the distance is rounded the same way
+	rect := Transform2D(square, Scale2d(v2.Vec{1, 2}))
+	s2, err = RoundEdges2D(rect, r)
+	assert.NoError(t, err)
+	assert.InDelta(t, 0, s2.Evaluate(v2.Vec{0, 1}), tol)
+	assert.InDelta(t, (math.Sqrt2-1)*r, s2.Evaluate(v2.Vec{0.5, 1}), tol)
+
+	// no change to a shape without edges
+	circle, err := Circle2D(1)
+	assert.NoError(t, err)
+	s2, err = RoundEdges2D(circle, r)
+	assert.NoError(t, err)
+	bb := circle.BoundingBox()
+	for _, p := range bb.RandomSet(100) {
+		assert.InDelta(t, circle.Evaluate(p), s2.Evaluate(p), tol)
+	}
+
+	// large parts get larger cells, the grid (with its margin) is within the limit
+	for _, r := range []float64{0.1, -1} {
+		g, h, err := morphologyGrid3(NewBox3(v3.Vec{}, v3.Vec{100, 100, 100}), r)
+		assert.NoError(t, err)
+		assert.Greater(t, h, math.Abs(r)/morphologyCells)
+		assert.LessOrEqual(t, g.n.X*g.n.Y*g.n.Z, redistanceMaxPoints)
+		assert.Greater(t, g.n.X*g.n.Y*g.n.Z, redistanceMaxPoints*9/10)
+	}
+	g2, _, err := morphologyGrid2(NewBox2(v2.Vec{}, v2.Vec{1e4, 10}), 0.01)
+	assert.NoError(t, err)
+	assert.LessOrEqual(t, g2.n.X*g2.n.Y, redistanceMaxPoints)
+
+	// errors
+	_, err = RoundEdges3D(box, 0)
+	assert.Error(t, err)
+	_, err = FillCorners3D(box, -1)
+	assert.Error(t, err)
+	_, err = RoundEdges3D(box, 0.6)
+	assert.Error(t, err)
+	_, err = RoundEdges2D(square, 0.6)
+	assert.Error(t, err)
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Draft3D(t *testing.T) {
+	const tol = 5e-3
+	a := DtoR(5)
+	k := math.Tan(a)
+	box, err := Box3D(v3.Vec{2, 2, 2}, 0)
+	assert.NoError(t, err)
+
+	// neutral plane at the bottom face, the walls lean inwards
+	s, err := Draft3D(box, v3.Vec{0, 0, 1}, -1, a)
+	assert.NoError(t, err)
+	for _, z := range []float64{-1, -0.5, 0, 0.5, 0.99} {
+		x := 1 - (z+1)*k
+		assert.InDelta(t, 0, s.Evaluate(v3.Vec{x, 0, z}), tol)
+		assert.InDelta(t, 0, s.Evaluate(v3.Vec{0, -x, z}), tol)
+	}
+	// the top and bottom faces don't move
+	assert.InDelta(t, 0, s.Evaluate(v3.Vec{0, 0, 1}), tol)
+	assert.InDelta(t, 0, s.Evaluate(v3.Vec{0, 0, -1}), tol)
+	// no lip at the top edge
+	assert.Greater(t, s.Evaluate(v3.Vec{0.9, 0, 0.99}), 0.0)
+	r, err := Audit3D(s, 1000)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, r.Overestimates, r.String())
+	assert.Equal(t, 0, r.SignMismatches, r.String())
+
+	// neutral plane at the top face, the walls lean outwards going down
+	s, err = Draft3D(box, v3.Vec{0, 0, 1}, 1, a)
+	assert.NoError(t, err)
+	assert.InDelta(t, 0, s.Evaluate(v3.Vec{1 + k, 0, 0}), tol)
+	assert.True(t, s.BoundingBox().Contains(v3.Vec{1 + 1.99*k, 0, -0.99}))
+
+	// a hole gets wider in the pull direction
+	hole, err := Cylinder3D(2, 0.5, 0)
+	assert.NoError(t, err)
+	s, err = Draft3D(Difference3D(box, hole), v3.Vec{0, 0, 1}, 0, a)
+	assert.NoError(t, err)
+	assert.InDelta(t, 0, s.Evaluate(v3.Vec{0.5 + 0.5*k, 0, 0.5}), tol)
+	assert.InDelta(t, 0, s.Evaluate(v3.Vec{0.5 - 0.5*k, 0, -0.5}), tol)
+	data, err := MarshalSDF3(s)
+	assert.NoError(t, err)
+	x, err := UnmarshalSDF3(data)
+	assert.NoError(t, err)
+	bb := s.BoundingBox()
+	for _, p := range bb.RandomSet(100) {
+		assert.InDelta(t, s.Evaluate(p), x.Evaluate(p), tolerance)
+	}
+
+	// draft analysis
+	res, err := DraftAnalysis3D(box, v3.Vec{0, 0, 1}, DtoR(1), 20)
+	assert.NoError(t, err)
+	assert.Greater(t, len(res.Faults), 0, res.String())
+	assert.InDelta(t, 0, res.MinDraft, 1e-3, res.String())
+	assert.Less(t, math.Abs(res.Faults[0].Normal.Z), 1e-3)
+	res, err = DraftAnalysis3D(s, v3.Vec{0, 0, 1}, DtoR(4), 20)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(res.Faults), res.String())
+	assert.InDelta(t, 5, RtoD(res.MinDraft), 0.5, res.String())
+	// the walls are undercuts in the other direction
+	res, err = DraftAnalysis3D(s, v3.Vec{0, 0, -1}, DtoR(4), 20)
+	assert.NoError(t, err)
+	assert.Less(t, res.MinDraft, 0.0, res.String())
+	walls := 0
+	for _, f := range res.Faults {
+		if math.Abs(RtoD(f.Draft)+5) < 0.5 {
+			walls++
+		}
+	}
+	assert.Greater(t, walls, 0, res.String())
+	// the walls of an undrafted box don't count
+	res, err = DraftAnalysis3D(box, v3.Vec{0, 0, 1}, DtoR(1), 20)
+	assert.NoError(t, err)
+	for _, f := range res.Faults {
+		assert.Less(t, math.Abs(f.Normal.Z), 1e-3)
+	}
+
+	// errors
+	_, err = Draft3D(box, v3.Vec{}, 0, a)
+	assert.Error(t, err)
+	_, err = Draft3D(box, v3.Vec{0, 0, 1}, 0, -a)
+	assert.Error(t, err)
+	_, err = Draft3D(box, v3.Vec{0, 0, 1}, 0, 0.5*Pi)
+	assert.Error(t, err)
+	_, err = DraftAnalysis3D(box, v3.Vec{0, 0, 1}, a, 0)
+	assert.Error(t, err)
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Repeat(t *testing.T) {
+	// math.Min that doesn't take the Array3D/Array2D fast path
+	slowMin := func(a, b float64) float64 { return math.Min(a, b) }
+
+	// copies that overlap their neighbours, with a negative step
+	box, err := Box3D(v3.Vec{1.5, 0.5, 0.5}, 0.1)
+	assert.NoError(t, err)
+	box = Transform3D(box, Translate3d(v3.Vec{0.3, 0.1, 0}))
+	num := v3i.Vec{5, 3, 4}
+	step := v3.Vec{1, 1.2, -0.8}
+	s0 := Array3D(box, num, step)
+	s0.(*ArraySDF3).SetMin(slowMin)
+	s1 := Array3D(box, num, step)
+	s2, err := Repeat3D(box, num, step)
+	assert.NoError(t, err)
+	assert.True(t, s0.BoundingBox().Equals(s2.BoundingBox(), tolerance))
+	bb := s0.BoundingBox().ScaleAboutCenter(1.5)
+	for _, p := range bb.RandomSet(1000) {
+		d := s0.Evaluate(p)
+		assert.InDelta(t, d, s1.Evaluate(p), tolerance)
+		assert.InDelta(t, d, s2.Evaluate(p), tolerance)
+	}
+	for _, p := range bb.RandomSet(100) {
+		g := s2.(GradientSDF3).Gradient(p, gradientEpsilon)
+		assert.True(t, g.Equals(centralGradient3(s0, p, gradientEpsilon), 1e-4))
+	}
+
+	// overlapping copies don't take the fast path
+	assert.Nil(t, s1.(*ArraySDF3).lattice)
+
+	// copies of an sdf that isn't exact outside its bounding box aren't skipped
+	scaled := Transform3D(box, Scale3d(v3.Vec{2, 1, 1}))
+	num = v3i.Vec{3, 1, 1}
+	step = v3.Vec{3.5, 0, 0}
+	s0 = Array3D(scaled, num, step)
+	assert.Nil(t, s0.(*ArraySDF3).lattice)
+	s2, err = Repeat3D(scaled, num, step)
+	assert.NoError(t, err)
+	assert.False(t, s2.(*RepeatSDF3).lattice.skip)
+	bb = s0.BoundingBox().ScaleAboutCenter(1.5)
+	for _, p := range bb.RandomSet(1000) {
+		assert.InDelta(t, s0.Evaluate(p), s2.Evaluate(p), tolerance)
+	}
+	s2, err = RepeatPolar3D(scaled, 5)
+	assert.NoError(t, err)
+	assert.False(t, s2.(*RepeatPolarSDF3).skip)
+
+	// an infinite repetition is the same as a large array about the origin
+	sphere, err := Sphere3D(0.4)
+	assert.NoError(t, err)
+	step = v3.Vec{1, 0.7, 0}
+	assert.NotNil(t, Array3D(sphere, v3i.Vec{3, 3, 1}, v3.Vec{1, 0.8, 0}).(*ArraySDF3).lattice)
+	s0 = Array3D(sphere, v3i.Vec{11, 11, 1}, step)
+	s0.(*ArraySDF3).SetMin(slowMin)
+	s0 = Transform3D(s0, Translate3d(step.MulScalar(-5)))
+	s2, err = RepeatInfinite3D(sphere, step)
+	assert.NoError(t, err)
+	bb = NewBox3(v3.Vec{}, v3.Vec{4, 4, 4})
+	for _, p := range bb.RandomSet(1000) {
+		assert.InDelta(t, s0.Evaluate(p), s2.Evaluate(p), tolerance)
+	}
+
+	// polar copies that extend beyond their sector
+	box, err = Box3D(v3.Vec{2, 0.6, 0.5}, 0)
+	assert.NoError(t, err)
+	box = Transform3D(box, Translate3d(v3.Vec{1.5, 0.2, 0}))
+	for _, n := range []int{1, 2, 3, 8, 13} {
+		s0 = RotateUnion3D(box, n, RotateZ(Tau/float64(n)))
+		s2, err = RepeatPolar3D(box, n)
+		assert.NoError(t, err)
+		bb = s0.BoundingBox().ScaleAboutCenter(1.2)
+		for _, p := range bb.RandomSet(500) {
+			assert.InDelta(t, s0.Evaluate(p), s2.Evaluate(p), tolerance)
+		}
+	}
+
+	// 2d
+	rect := Transform2D(Box2D(v2.Vec{1.5, 0.4}, 0.1), Translate2d(v2.Vec{-0.2, 0.3}))
+	num2 := v2i.Vec{4, 6}
+	step2 := v2.Vec{-1.1, 0.5}
+	a0 := Array2D(rect, num2, step2)
+	a0.(*ArraySDF2).SetMin(slowMin)
+	a1 := Array2D(rect, num2, step2)
+	a2, err := Repeat2D(rect, num2, step2)
+	assert.NoError(t, err)
+	assert.Nil(t, a1.(*ArraySDF2).lattice)
+	bb2 := a0.BoundingBox().ScaleAboutCenter(1.5)
+	for i := 0; i < 1000; i++ {
+		p := bb2.Random()
+		d := a0.Evaluate(p)
+		assert.InDelta(t, d, a1.Evaluate(p), tolerance)
+		assert.InDelta(t, d, a2.Evaluate(p), tolerance)
+	}
+	circle, err := Circle2D(0.3)
+	assert.NoError(t, err)
+	step2 = v2.Vec{0.8, 0.9}
+	a0 = Array2D(circle, v2i.Vec{11, 11}, step2)
+	assert.NotNil(t, a0.(*ArraySDF2).lattice)
+	a0.(*ArraySDF2).SetMin(slowMin)
+	a0 = Transform2D(a0, Translate2d(step2.MulScalar(-5)))
+	a2, err = RepeatInfinite2D(circle, step2)
+	assert.NoError(t, err)
+	bb2 = Box2{v2.Vec{-3, -3}, v2.Vec{3, 3}}
+	for i := 0; i < 1000; i++ {
+		p := bb2.Random()
+		assert.InDelta(t, a0.Evaluate(p), a2.Evaluate(p), tolerance)
+	}
+	for _, n := range []int{1, 2, 5, 12} {
+		a0 = RotateUnion2D(rect, n, Rotate2d(Tau/float64(n)))
+		a2, err = RepeatPolar2D(rect, n)
+		assert.NoError(t, err)
+		bb2 = a0.BoundingBox().ScaleAboutCenter(1.2)
+		for i := 0; i < 500; i++ {
+			p := bb2.Random()
+			assert.InDelta(t, a0.Evaluate(p), a2.Evaluate(p), tolerance)
+		}
+	}
+
+	// marshal and unmarshal
+	s2, err = Repeat3D(box, v3i.Vec{3, 2, 1}, v3.Vec{2.5, 1, 0})
+	assert.NoError(t, err)
+	s2, err = RepeatPolar3D(s2, 5)
+	assert.NoError(t, err)
+	data, err := MarshalSDF3(s2)
+	assert.NoError(t, err)
+	x, err := UnmarshalSDF3(data)
+	assert.NoError(t, err)
+	bb = s2.BoundingBox()
+	for _, p := range bb.RandomSet(100) {
+		assert.InDelta(t, s2.Evaluate(p), x.Evaluate(p), tolerance)
+	}
+	s2, err = RepeatInfinite3D(sphere, v3.Vec{1, 1, 1})
+	assert.NoError(t, err)
+	data, err = MarshalSDF3(Intersect3D(Optimize3D(s2), box))
+	assert.NoError(t, err)
+	x, err = UnmarshalSDF3(data)
+	assert.NoError(t, err)
+	bb = box.BoundingBox()
+	for _, p := range bb.RandomSet(100) {
+		assert.InDelta(t, math.Max(s2.Evaluate(p), box.Evaluate(p)), x.Evaluate(p), tolerance)
+	}
+
+	// errors
+	_, err = Repeat3D(sphere, v3i.Vec{1, 0, 1}, v3.Vec{1, 1, 1})
+	assert.Error(t, err)
+	_, err = Repeat3D(nil, v3i.Vec{1, 1, 1}, v3.Vec{1, 1, 1})
+	assert.Error(t, err)
+	_, err = Repeat2D(circle, v2i.Vec{-1, 1}, v2.Vec{1, 1})
+	assert.Error(t, err)
+	_, err = RepeatPolar3D(sphere, 0)
+	assert.Error(t, err)
+	_, err = RepeatPolar2D(circle, -1)
+	assert.Error(t, err)
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Mirror(t *testing.T) {
+	// a part in the positive half-space is the same as a union with its mirror image
+	box, err := Box3D(v3.Vec{1, 0.6, 0.4}, 0.1)
+	assert.NoError(t, err)
+	box = Transform3D(box, Translate3d(v3.Vec{1, 0.5, 0.2}))
+	s0 := Union3D(box, Transform3D(box, MirrorYZ()))
+	s1, err := Mirror3D(box, v3.Vec{}, v3.Vec{1, 0, 0})
+	assert.NoError(t, err)
+	assert.True(t, s0.BoundingBox().Equals(s1.BoundingBox(), tolerance))
+	bb := s0.BoundingBox().ScaleAboutCenter(1.5)
+	for _, p := range bb.RandomSet(1000) {
+		assert.InDelta(t, s0.Evaluate(p), s1.Evaluate(p), tolerance)
+	}
+
+	// 4-fold symmetry
+	s0 = Union3D(box, Transform3D(box, MirrorXZ()))
+	s0 = Union3D(s0, Transform3D(s0, MirrorYZ()))
+	s1, err = Symmetry3D(box, PlaneXZ, PlaneYZ)
+	assert.NoError(t, err)
+	assert.True(t, s0.BoundingBox().Equals(s1.BoundingBox(), tolerance))
+	bb = s0.BoundingBox().ScaleAboutCenter(1.5)
+	for _, p := range bb.RandomSet(1000) {
+		assert.InDelta(t, s0.Evaluate(p), s1.Evaluate(p), tolerance)
+		g := s1.(GradientSDF3).Gradient(p, gradientEpsilon)
+		assert.True(t, g.Equals(centralGradient3(s0, p, gradientEpsilon), 1e-4))
+	}
+	for _, p := range bb.RandomSet(100) {
+		b := NewBox3(p, v3.Vec{0.4, 0.4, 0.4})
+		i := s1.(IntervalSDF3).EvaluateInterval(b)
+		for _, q := range b.RandomSet(20) {
+			d := s1.Evaluate(q)
+			assert.True(t, d >= i[0]-tolerance && d <= i[1]+tolerance)
+		}
+	}
+
+	// the part on the negative side of the plane is discarded
+	box, err = Box3D(v3.Vec{1, 1, 1}, 0)
+	assert.NoError(t, err)
+	s1, err = Mirror3D(Transform3D(box, Translate3d(v3.Vec{0, 0, 0.2})), v3.Vec{}, v3.Vec{0, 0, 1})
+	assert.NoError(t, err)
+	s0, err = Box3D(v3.Vec{1, 1, 1.4}, 0)
+	assert.NoError(t, err)
+	assert.True(t, s0.BoundingBox().Equals(s1.BoundingBox(), tolerance))
+	bb = s0.BoundingBox().ScaleAboutCenter(1.5)
+	for _, p := range bb.RandomSet(1000) {
+		d0, d1 := s0.Evaluate(p), s1.Evaluate(p)
+		if d0 >= 0 {
+			assert.InDelta(t, d0, d1, tolerance)
+		} else {
+			// the discarded face is closer on the inside
+			assert.True(t, d1 < 0 && d1 >= d0-tolerance)
+		}
+	}
+
+	// a tilted plane that doesn't go through the origin
+	box, err = Box3D(v3.Vec{1, 0.6, 0.4}, 0.1)
+	assert.NoError(t, err)
+	box = Transform3D(box, Translate3d(v3.Vec{1.5, 1, 0.2}))
+	point, n := v3.Vec{0.5, 0.2, 0}, v3.Vec{1, 1, 0.5}.Normalize()
+	t0 := n.MulScalar(2 * point.Dot(n))
+	m := M44{
+		1 - 2*n.X*n.X, -2 * n.X * n.Y, -2 * n.X * n.Z, t0.X,
+		-2 * n.Y * n.X, 1 - 2*n.Y*n.Y, -2 * n.Y * n.Z, t0.Y,
+		-2 * n.Z * n.X, -2 * n.Z * n.Y, 1 - 2*n.Z*n.Z, t0.Z,
+		0, 0, 0, 1}
+	s0 = Union3D(box, Transform3D(box, m))
+	s1, err = Mirror3D(box, point, n)
+	assert.NoError(t, err)
+	assert.True(t, s0.BoundingBox().Equals(s1.BoundingBox(), tolerance))
+	bb = s0.BoundingBox().ScaleAboutCenter(1.5)
+	for _, p := range bb.RandomSet(1000) {
+		assert.InDelta(t, s0.Evaluate(p), s1.Evaluate(p), tolerance)
+	}
+	for _, p := range bb.RandomSet(100) {
+		g := s1.(GradientSDF3).Gradient(p, gradientEpsilon)
+		assert.True(t, g.Equals(centralGradient3(s0, p, gradientEpsilon), 1e-4))
+	}
+	data, err := MarshalSDF3(s1)
+	assert.NoError(t, err)
+	x, err := UnmarshalSDF3(data)
+	assert.NoError(t, err)
+	for _, p := range bb.RandomSet(100) {
+		assert.InDelta(t, s1.Evaluate(p), x.Evaluate(p), tolerance)
+	}
+
+	// 2d
+	rect := Transform2D(Box2D(v2.Vec{1, 0.6}, 0.1), Translate2d(v2.Vec{0.8, 0.5}))
+	a0 := Union2D(rect, Transform2D(rect, MirrorX()))
+	a1, err := Mirror2D(rect, v2.Vec{}, v2.Vec{0, 1})
+	assert.NoError(t, err)
+	assert.True(t, a0.BoundingBox().Equals(a1.BoundingBox(), tolerance))
+	a0 = Union2D(a0, Transform2D(a0, MirrorY()))
+	a1, err = Symmetry2D(rect, AxisX, AxisY)
+	assert.NoError(t, err)
+	assert.True(t, a0.BoundingBox().Equals(a1.BoundingBox(), tolerance))
+	bb2 := a0.BoundingBox().ScaleAboutCenter(1.5)
+	for i := 0; i < 1000; i++ {
+		p := bb2.Random()
+		assert.InDelta(t, a0.Evaluate(p), a1.Evaluate(p), tolerance)
+	}
+	// a line through the rectangle, the bounding box contains the kept part and its mirror image
+	a2, err := Mirror2D(rect, v2.Vec{1, 0}, v2.Vec{1, -1})
+	assert.NoError(t, err)
+	bb3 := a2.BoundingBox()
+	big := bb3.ScaleAboutCenter(2)
+	for i := 0; i < 1000; i++ {
+		p := big.Random()
+		if a2.Evaluate(p) <= 0 {
+			assert.True(t, bb3.Contains(p))
+		}
+	}
+
+	// marshal and unmarshal
+	s1, err = Symmetry3D(box, PlaneXY, PlaneYZ)
+	assert.NoError(t, err)
+	data, err = MarshalSDF3(Optimize3D(s1))
+	assert.NoError(t, err)
+	x, err = UnmarshalSDF3(data)
+	assert.NoError(t, err)
+	bb = s1.BoundingBox().ScaleAboutCenter(1.5)
+	for _, p := range bb.RandomSet(100) {
+		assert.InDelta(t, s1.Evaluate(p), x.Evaluate(p), tolerance)
+	}
+	data, err = MarshalSDF2(a1)
+	assert.NoError(t, err)
+	y, err := UnmarshalSDF2(data)
+	assert.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		p := bb2.Random()
+		assert.InDelta(t, a1.Evaluate(p), y.Evaluate(p), tolerance)
+	}
+
+	// errors
+	_, err = Symmetry3D(box)
+	assert.Error(t, err)
+	_, err = Symmetry3D(box, Plane3(3))
+	assert.Error(t, err)
+	_, err = Mirror3D(nil, v3.Vec{}, v3.Vec{0, 0, 1})
+	assert.Error(t, err)
+	_, err = Mirror3D(box, v3.Vec{}, v3.Vec{})
+	assert.Error(t, err)
+	_, err = Mirror3D(box, v3.Vec{2, 2, 2}, v3.Vec{1, 1, 1})
+	assert.Error(t, err)
+	_, err = Symmetry2D(rect)
+	assert.Error(t, err)
+	_, err = Symmetry2D(rect, Axis2(-1))
+	assert.Error(t, err)
+	_, err = Mirror2D(rect, v2.Vec{}, v2.Vec{})
+	assert.Error(t, err)
+	_, err = UnmarshalSDF3([]byte(`{"type":"Symmetry3D","sdf":{"type":"Sphere3D","radius":1},"planes":["XX"]}`))
+	assert.Error(t, err)
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Deform(t *testing.T) {
+	const tol = 1e-6
+	box, err := Box3D(v3.Vec{2, 1, 4}, 0.1)
+	assert.NoError(t, err)
+
+	// twist
+	s, err := Twist3D(box, v3.Vec{}, v3.Vec{0, 0, 1}, 0)
+	assert.NoError(t, err)
+	bb := box.BoundingBox()
+	for _, p := range bb.RandomSet(100) {
+		assert.InDelta(t, box.Evaluate(p), s.Evaluate(p), tolerance)
+	}
+	s, err = Twist3D(box, v3.Vec{}, v3.Vec{0, 0, 1}, 0.5)
+	assert.NoError(t, err)
+	for _, z := range []float64{-1.5, 0, 1, 1.5} {
+		sin, cos := math.Sincos(0.5 * z)
+		assert.InDelta(t, 0, s.Evaluate(v3.Vec{cos, sin, z}), tol)
+		assert.Less(t, s.Evaluate(v3.Vec{0.9 * cos, 0.9 * sin, z}), 0.0)
+	}
+	for _, axis := range []v3.Vec{{0, 0, 1}, {1, 1, 1}} {
+		s, err = Twist3D(box, v3.Vec{0.3, 0, 0}, axis, 0.5)
+		assert.NoError(t, err)
+		r, err := Audit3D(s, 2000)
+		assert.NoError(t, err)
+		assert.LessOrEqual(t, r.MaxLipschitz, 1.001, r.String())
+		assert.Equal(t, 0, r.Overestimates, r.String())
+		assert.Equal(t, 0, r.SignMismatches, r.String())
+	}
+
+	// taper
+	s, err = Taper3D(box, v3.Vec{}, v3.Vec{0, 0, 1}, -0.2)
+	assert.NoError(t, err)
+	for _, z := range []float64{-1.5, 0, 1, 1.5} {
+		assert.InDelta(t, 0, s.Evaluate(v3.Vec{1 - 0.2*z, 0, z}), tol)
+	}
+	r, err := Audit3D(s, 2000)
+	assert.NoError(t, err)
+	assert.LessOrEqual(t, r.MaxLipschitz, 1.001, r.String())
+	assert.Equal(t, 0, r.Overestimates, r.String())
+	assert.Equal(t, 0, r.SignMismatches, r.String())
+
+	// bend a beam into an arc around the z-axis through (0, 2, 0)
+	beam, err := Box3D(v3.Vec{6, 1, 1}, 0)
+	assert.NoError(t, err)
+	s, err = Bend3D(beam, v3.Vec{}, v3.Vec{1, 0, 0}, v3.Vec{0, 1, 0}, 2)
+	assert.NoError(t, err)
+	arc := func(theta, r, z float64) v3.Vec {
+		return v3.Vec{r * math.Sin(theta), 2 - r*math.Cos(theta), z}
+	}
+	assert.Less(t, s.Evaluate(arc(1, 2, 0)), 0.0)
+	assert.InDelta(t, 0, s.Evaluate(arc(1, 2.5, 0)), tol)
+	assert.InDelta(t, 0, s.Evaluate(arc(-1, 1.5, 0)), tol)
+	assert.InDelta(t, 0, s.Evaluate(arc(1.5, 2, 0)), tol)
+	assert.InDelta(t, 0, s.Evaluate(arc(0.5, 2, 0.5)), tol)
+	expected := Box3{v3.Vec{-2.5 * math.Sin(1.5), -0.5, -0.5}, v3.Vec{2.5 * math.Sin(1.5), 2 - 1.5*math.Cos(1.5), 0.5}}
+	assert.True(t, s.BoundingBox().Equals(expected, tol))
+	r, err = Audit3D(s, 2000)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, r.Overestimates, r.String())
+	assert.Equal(t, 0, r.SignMismatches, r.String())
+
+	// the distance is a bound outside the bounding box, near the bend axis and across the far side
+	bar, err := Box3D(v3.Vec{4, 1, 1}, 0)
+	assert.NoError(t, err)
+	s, err = Bend3D(bar, v3.Vec{}, v3.Vec{1, 0, 0}, v3.Vec{0, 1, 0}, 2)
+	assert.NoError(t, err)
+	const h = 0.02
+	var surface []v3.Vec
+	for x := -2.0; x <= 2+h/2; x += h {
+		for y := -0.5; y <= 0.5+h/2; y += h {
+			for z := -0.5; z <= 0.5+h/2; z += h {
+				q := v3.Vec{x, y, z}
+				if math.Abs(bar.Evaluate(q)) < h/4 {
+					surface = append(surface, arc(0.5*x, 2-y, z))
+				}
+			}
+		}
+	}
+	bb = Box3{v3.Vec{-4, -2, -2}, v3.Vec{4, 6, 2}}
+	points := append(bb.RandomSet(300), v3.Vec{0, 3, 0}, v3.Vec{0, 2, 0}, v3.Vec{0, 2.5, 0.3})
+	for _, p := range points {
+		dmin := math.MaxFloat64
+		for _, x := range surface {
+			dmin = math.Min(dmin, p.Sub(x).Length())
+		}
+		d := s.Evaluate(p)
+		assert.LessOrEqual(t, math.Abs(d), dmin+h, p)
+		// lipschitz
+		near := NewBox3(p, v3.Vec{0.2, 0.2, 0.2})
+		q := near.Random()
+		assert.LessOrEqual(t, math.Abs(d-s.Evaluate(q)), 1.001*p.Sub(q).Length(), p)
+	}
+	assert.Greater(t, s.Evaluate(v3.Vec{0, 3, 0}), 0.0)
+	assert.Less(t, s.Evaluate(arc(0.9, 2, 0)), 0.0)
+
+	// marshal and unmarshal
+	s, err = Taper3D(beam, v3.Vec{}, v3.Vec{1, 0, 0}, 0.1)
+	assert.NoError(t, err)
+	s, err = Twist3D(s, v3.Vec{}, v3.Vec{1, 0, 0}, 0.2)
+	assert.NoError(t, err)
+	s, err = Bend3D(s, v3.Vec{}, v3.Vec{1, 0, 0}, v3.Vec{0, 0, 1}, 4)
+	assert.NoError(t, err)
+	data, err := MarshalSDF3(Optimize3D(s))
+	assert.NoError(t, err)
+	x, err := UnmarshalSDF3(data)
+	assert.NoError(t, err)
+	bb = s.BoundingBox()
+	for _, p := range bb.RandomSet(100) {
+		assert.InDelta(t, s.Evaluate(p), x.Evaluate(p), tolerance)
+	}
+
+	// errors
+	_, err = Twist3D(box, v3.Vec{}, v3.Vec{}, 1)
+	assert.Error(t, err)
+	_, err = Taper3D(box, v3.Vec{}, v3.Vec{0, 0, 1}, -0.6)
+	assert.Error(t, err)
+	_, err = Bend3D(beam, v3.Vec{}, v3.Vec{1, 0, 0}, v3.Vec{0, 1, 0}, 0)
+	assert.Error(t, err)
+	_, err = Bend3D(beam, v3.Vec{}, v3.Vec{1, 0, 0}, v3.Vec{2, 0, 0}, 2)
+	assert.Error(t, err)
+	_, err = Bend3D(beam, v3.Vec{}, v3.Vec{1, 0, 0}, v3.Vec{0, 1, 0}, 0.4)
+	assert.Error(t, err)
+	_, err = Bend3D(beam, v3.Vec{}, v3.Vec{1, 0, 0}, v3.Vec{0, 1, 0}, 0.9)
+	assert.Error(t, err)
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_FFD(t *testing.T) {
+	const tol = 1e-6
+	box, err := Box3D(v3.Vec{2, 1, 4}, 0.1)
+	assert.NoError(t, err)
+	lbb := Box3{v3.Vec{-1.5, -1, -2.5}, v3.Vec{1.5, 1, 2.5}}
+	n := v3i.Vec{4, 3, 5}
+
+	for _, tricubic := range []bool{false, true} {
+		// undeformed
+		l, err := NewFFDLattice(lbb, n)
+		assert.NoError(t, err)
+		l.SetTricubic(tricubic)
+		s, err := FFD3D(box, l)
+		assert.NoError(t, err)
+		bb := box.BoundingBox().ScaleAboutCenter(1.5)
+		for _, p := range bb.RandomSet(100) {
+			assert.InDelta(t, box.Evaluate(p), s.Evaluate(p), tol)
+		}
+
+		// translated
+		d := v3.Vec{0.3, -0.2, 0.5}
+		for z := 0; z < n.Z; z++ {
+			for y := 0; y < n.Y; y++ {
+				for x := 0; x < n.X; x++ {
+					l.SetPoint(x, y, z, l.Point(x, y, z).Add(d))
+				}
+			}
+		}
+		s, err = FFD3D(box, l)
+		assert.NoError(t, err)
+		for _, p := range bb.RandomSet(100) {
+			assert.InDelta(t, box.Evaluate(p.Sub(d)), s.Evaluate(p), tol)
+		}
+
+		// local deformation
+		l, err = NewFFDLattice(lbb, n)
+		assert.NoError(t, err)
+		l.SetTricubic(tricubic)
+		l.SetPoint(2, 1, 2, l.Point(2, 1, 2).Add(v3.Vec{0.4, 0.2, 0}))
+		l.SetPoint(3, 2, 4, l.Point(3, 2, 4).Add(v3.Vec{0.3, 0, 0.3}))
+		s, err = FFD3D(box, l)
+		assert.NoError(t, err)
+		// the lattice is copied
+		l.SetPoint(0, 0, 0, v3.Vec{})
+		// surface points move with the lattice
+		for _, p := range []v3.Vec{{1, 0, 0}, {1, 0.2, 0.5}, {0.5, 0.5, 0}} {
+			q, _ := s.(*FFDSDF3).lattice.forward(p)
+			assert.InDelta(t, 0, s.Evaluate(q), tol)
+			assert.Greater(t, q.Sub(p).Length(), 0.01)
+		}
+		// the distance is scaled by a bound on the jacobian
+		k := s.(*FFDSDF3).k
+		assert.True(t, k > 0.3 && k < 1, k)
+		r, err := Audit3D(s, 2000)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, r.Overestimates, r.String())
+		assert.Equal(t, 0, r.SignMismatches, r.String())
+		// the smallest singular value of the jacobian is no less than the bound
+		bb = s.BoundingBox().ScaleAboutCenter(1.2)
+		for _, p := range bb.RandomSet(1000) {
+			_, j := s.(*FFDSDF3).lattice.forward(p)
+			assert.GreaterOrEqual(t, minSingularValue(j[0], j[1], j[2]), k)
+		}
+		// interval evaluation
+		for i := 0; i < 100; i++ {
+			b := Box3{bb.Random(), bb.Random()}
+			b = Box3{b.Min.Min(b.Max), b.Min.Max(b.Max)}
+			d := EvaluateInterval3(s, b)
+			for _, p := range b.RandomSet(20) {
+				x := s.Evaluate(p)
+				assert.True(t, d[0] <= x+tolerance && x <= d[1]+tolerance, "%v not in %v", x, d)
+			}
+		}
+
+		// marshal and unmarshal
+		data, err := MarshalSDF3(Optimize3D(s))
+		assert.NoError(t, err)
+		x, err := UnmarshalSDF3(data)
+		assert.NoError(t, err)
+		bb = s.BoundingBox()
+		for _, p := range bb.RandomSet(100) {
+			assert.InDelta(t, s.Evaluate(p), x.Evaluate(p), tolerance)
+		}
+	}
+
+	// errors
+	_, err = NewFFDLattice(lbb, v3i.Vec{1, 3, 3})
+	assert.Error(t, err)
+	_, err = NewFFDLattice(Box3{v3.Vec{0, 0, 0}, v3.Vec{1, 0, 1}}, n)
+	assert.Error(t, err)
+	_, err = FFD3D(box, nil)
+	assert.Error(t, err)
+	// a folded lattice
+	l, err := NewFFDLattice(lbb, n)
+	assert.NoError(t, err)
+	l.SetPoint(1, 1, 1, l.Point(3, 1, 1))
+	_, err = FFD3D(box, l)
+	assert.Error(t, err)
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Displace(t *testing.T) {
+	const tol = 1e-6
+	audit := func(s SDF3) {
+		r, err := Audit3D(s, 2000)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, r.Overestimates, r.String())
+		assert.Equal(t, 0, r.SignMismatches, r.String())
+	}
+
+	// procedural ridges on the top of a box
+	box, err := Box3D(v3.Vec{4, 4, 1}, 0)
+	assert.NoError(t, err)
+	ridges, err := NewFuncTexture2(func(p v2.Vec) float64 { return 0.5 + 0.5*math.Sin(Tau*p.X) }, Pi)
+	assert.NoError(t, err)
+	planar, err := NewPlanarTexture3(ridges, PlaneXY)
+	assert.NoError(t, err)
+	s, err := Displace3D(box, planar, 0.1)
+	assert.NoError(t, err)
+	for _, x := range []float64{-1, 0.25, 0.5, 1.1} {
+		z := 0.5 + 0.1*ridges.Height(v2.Vec{x, 0})
+		assert.InDelta(t, 0, s.Evaluate(v3.Vec{x, 0.3, z}), tol)
+	}
+	assert.True(t, s.BoundingBox().Equals(Box3{v3.Vec{-2.1, -2.1, -0.6}, v3.Vec{2.1, 2.1, 0.6}}, tol))
+	audit(s)
+	// engraved
+	s, err = Displace3D(box, planar, -0.1)
+	assert.NoError(t, err)
+	assert.InDelta(t, 0, s.Evaluate(v3.Vec{0.25, 0, 0.4}), tol)
+	assert.True(t, s.BoundingBox().Equals(box.BoundingBox(), tol))
+
+	// image texture
+	img := image.NewGray(image.Rect(0, 0, 4, 2))
+	img.SetGray(1, 0, color.Gray{255})
+	img.SetGray(2, 1, color.Gray{51})
+	tex, err := NewImageTexture2(img, v2.Vec{4, 2})
+	assert.NoError(t, err)
+	assert.InDelta(t, 1, tex.Height(v2.Vec{1.5, 1.5}), tol)
+	assert.InDelta(t, 0.2, tex.Height(v2.Vec{2.5, 0.5}), tol)
+	assert.InDelta(t, 0.5, tex.Height(v2.Vec{2, 1.5}), tol)
+	assert.InDelta(t, 1, tex.Height(v2.Vec{-2.5, 3.5}), tol)
+	assert.InDelta(t, math.Hypot(1, 1), tex.Slope(), tol)
+	path := filepath.Join(t.TempDir(), "texture.png")
+	f, err := os.Create(path)
+	assert.NoError(t, err)
+	assert.NoError(t, png.Encode(f, img))
+	f.Close()
+	tex2, err := LoadImageTexture2(path, v2.Vec{4, 2})
+	assert.NoError(t, err)
+	for _, p := range []v2.Vec{{0.3, 0.2}, {1.7, 1.1}, {-3, 5}} {
+		assert.InDelta(t, tex.Height(p), tex2.Height(p), tol)
+	}
+
+	// wrapped textures
+	bumps, err := NewImageTexture2(img, v2.Vec{Pi / 2, Pi / 4})
+	assert.NoError(t, err)
+	cylinder, err := Cylinder3D(3, 1, 0)
+	assert.NoError(t, err)
+	cyl, err := NewCylindricalTexture3(bumps, 1)
+	assert.NoError(t, err)
+	s, err = Displace3D(cylinder, cyl, 0.1)
+	assert.NoError(t, err)
+	audit(s)
+	sphere, err := Sphere3D(1)
+	assert.NoError(t, err)
+	sph, err := NewSphericalTexture3(bumps, 1)
+	assert.NoError(t, err)
+	s, err = Displace3D(sphere, sph, 0.1)
+	assert.NoError(t, err)
+	audit(s)
+	tri, err := NewTriplanarTexture3(bumps, v3.Vec{}, 0.5)
+	assert.NoError(t, err)
+	s, err = Displace3D(sphere, tri, -0.1)
+	assert.NoError(t, err)
+	audit(s)
+
+	// solid texture
+	grain, err := NewFuncTexture3(func(p v3.Vec) float64 { return 0.5 + 0.5*math.Sin(4*p.X)*math.Sin(4*p.Y) }, 2*math.Sqrt2)
+	assert.NoError(t, err)
+	s, err = Displace3D(sphere, grain, 0.2)
+	assert.NoError(t, err)
+	audit(s)
+
+	// functions can't be marshalled
+	_, err = MarshalSDF3(s)
+	assert.Error(t, err)
+
+	// errors
+	_, err = NewFuncTexture2(nil, 1)
+	assert.Error(t, err)
+	_, err = NewFuncTexture3(grain.f, -1)
+	assert.Error(t, err)
+	_, err = NewImageTexture2(img, v2.Vec{0, 1})
+	assert.Error(t, err)
+	_, err = NewImageTexture2(image.NewGray(image.Rect(0, 0, 0, 0)), v2.Vec{1, 1})
+	assert.Error(t, err)
+	_, err = LoadImageTexture2(filepath.Join(t.TempDir(), "missing.png"), v2.Vec{1, 1})
+	assert.Error(t, err)
+	_, err = NewPlanarTexture3(ridges, Plane3(3))
+	assert.Error(t, err)
+	_, err = NewCylindricalTexture3(ridges, 0)
+	assert.Error(t, err)
+	_, err = NewSphericalTexture3(nil, 1)
+	assert.Error(t, err)
+	_, err = NewTriplanarTexture3(ridges, v3.Vec{}, 0)
+	assert.Error(t, err)
+	_, err = Displace3D(nil, planar, 1)
+	assert.Error(t, err)
+	_, err = Displace3D(box, nil, 1)
+	assert.Error(t, err)
+}
+
+//-----------------------------------------------------------------------------
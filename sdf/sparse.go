@@ -0,0 +1,400 @@
+//-----------------------------------------------------------------------------
+/*
+
+Sparse Voxel Grids
+
+A dense voxel grid over a large part at a fine resolution needs too much
+memory. Most of the grid is far from the surface, so a sparse grid only
+stores the values for a narrow band of points around the surface.
+
+The grid is a 2 level hierarchy (in the style of OpenVDB):
+
+Tiles are 8x8x8 blocks of grid points. Nodes are 16x16x16 blocks of tiles.
+The root is a dense array of nodes.
+
+A node or tile is only allocated if interval evaluation of the SDF finds it
+may contain points within the narrow band. Otherwise it stores +/- the band
+width. SDFs without interval evaluation are assumed to be distance bounds, so
+the value at the center of a node or tile bounds the values within it.
+
+Values within tiles are clamped to the narrow band, so the grid returns the
+interpolated SDF near the surface and a lower bound on the distance elsewhere.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"math"
+	"runtime"
+	"sync"
+
+	v3 "github.com/deadsy/sdfx/vec/v3"
+	"github.com/deadsy/sdfx/vec/v3i"
+)
+
+//-----------------------------------------------------------------------------
+
+const sparseTileBits = 3                                // tile size is 8 points
+const sparseNodeBits = 4                                // node size is 16 tiles
+const sparseTileSize = 1 << sparseTileBits              // grid points per tile axis
+const sparseNodeSize = 1 << sparseNodeBits              // tiles per node axis
+const sparseNodeShift = sparseTileBits + sparseNodeBits // grid point to node index shift
+const sparseTileMask = sparseTileSize - 1
+const sparseNodeMask = sparseNodeSize - 1
+
+// sparseBand is the half width of the narrow band in grid cells.
+const sparseBand = 3
+
+// sparseMaxRoots is the maximum number of root entries.
+const sparseMaxRoots = 1 << 24
+
+// sparseTile stores the values at the grid points of a tile.
+type sparseTile [sparseTileSize * sparseTileSize * sparseTileSize]float32
+
+// sparseNode stores the tiles of a node.
+type sparseNode struct {
+	tile  [sparseNodeSize * sparseNodeSize * sparseNodeSize]*sparseTile
+	value [sparseNodeSize * sparseNodeSize * sparseNodeSize]float32    // values of the unallocated tiles
+	limit [sparseNodeSize * sparseNodeSize * sparseNodeSize][2]float32 // value ranges of the allocated tiles
+}
+
+// sparseRoot is an entry of the root array.
+type sparseRoot struct {
+	node  *sparseNode
+	value float32 // value of an unallocated node
+}
+
+// SparseVoxelSDF3 is an SDF3 sampled on a sparse narrow band grid.
+type SparseVoxelSDF3 struct {
+	root  []sparseRoot
+	nr    v3i.Vec // number of root entries on each axis
+	n     v3i.Vec // number of grid points on each axis
+	h     float64 // grid cell size
+	band  float64 // narrow band half width
+	bb    Box3    // grid bounds
+	tiles int     // number of allocated tiles
+	sdf   SDF3    // source sdf (for serialization)
+}
+
+// NewSparseVoxelSDF3 returns an SDF3 sampled on a sparse grid with the given cell size.
+// The grid is filled in parallel.
+// The progress listener may be nil.
+func NewSparseVoxelSDF3(sdf SDF3, cellSize float64, progress chan float64) (SDF3, error) {
+	if cellSize <= 0 {
+		return nil, ErrMsg("cellSize <= 0")
+	}
+	bb := sdf.BoundingBox()
+	size := bb.Size()
+	margin := 2 * (sparseBand + 1)
+	cells := v3i.Vec{
+		int(math.Ceil(size.X/cellSize)) + margin,
+		int(math.Ceil(size.Y/cellSize)) + margin,
+		int(math.Ceil(size.Z/cellSize)) + margin,
+	}
+	n := cells.AddScalar(1)
+	nr := v3i.Vec{
+		(n.X + 1<<sparseNodeShift - 1) >> sparseNodeShift,
+		(n.Y + 1<<sparseNodeShift - 1) >> sparseNodeShift,
+		(n.Z + 1<<sparseNodeShift - 1) >> sparseNodeShift,
+	}
+	if float64(nr.X)*float64(nr.Y)*float64(nr.Z) > sparseMaxRoots {
+		return nil, ErrMsg("cellSize is too small")
+	}
+	// center the grid on the bounding box
+	size = v3.Vec{float64(cells.X), float64(cells.Y), float64(cells.Z)}.MulScalar(cellSize)
+	s := &SparseVoxelSDF3{
+		root: make([]sparseRoot, nr.X*nr.Y*nr.Z),
+		nr:   nr,
+		n:    n,
+		h:    cellSize,
+		band: sparseBand * cellSize,
+		bb:   NewBox3(bb.Center(), size),
+		sdf:  sdf,
+	}
+	s.fill(sdf, progress)
+	return s, nil
+}
+
+// point returns the position of a grid point.
+func (s *SparseVoxelSDF3) point(i v3i.Vec) v3.Vec {
+	return s.bb.Min.Add(v3.Vec{float64(i.X), float64(i.Y), float64(i.Z)}.MulScalar(s.h))
+}
+
+// region returns the box covering the cells with a minimum corner in a block of grid points.
+func (s *SparseVoxelSDF3) region(i v3i.Vec, size int) Box3 {
+	return Box3{s.point(i), s.point(i.AddScalar(size))}
+}
+
+// uniform returns true (and +/- the band width) if the values within a box are all outside the narrow band.
+func (s *SparseVoxelSDF3) uniform(sdf SDF3, b Box3) (float64, bool) {
+	iv := EvaluateInterval3(sdf, b)
+	if math.IsInf(iv[0], 0) || math.IsInf(iv[1], 0) {
+		// no interval evaluation (for some of the sdf), assume it's a distance bound
+		l := lipschitzInterval3(sdf, b, 1)
+		iv = Interval{math.Max(iv[0], l[0]), math.Min(iv[1], l[1])}
+	}
+	if iv[0] >= s.band {
+		return s.band, true
+	}
+	if iv[1] <= -s.band {
+		return -s.band, true
+	}
+	return 0, false
+}
+
+// fill evaluates an SDF3 at the grid points near the surface.
+func (s *SparseVoxelSDF3) fill(sdf SDF3, progress chan float64) {
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	done := 0
+	roots := make(chan v3i.Vec)
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ri := range roots {
+				tiles := s.fillNode(sdf, ri)
+				lock.Lock()
+				s.tiles += tiles
+				done++
+				if progress != nil {
+					progress <- float64(done) / float64(len(s.root))
+				}
+				lock.Unlock()
+			}
+		}()
+	}
+	var ri v3i.Vec
+	for ri.Z = 0; ri.Z < s.nr.Z; ri.Z++ {
+		for ri.Y = 0; ri.Y < s.nr.Y; ri.Y++ {
+			for ri.X = 0; ri.X < s.nr.X; ri.X++ {
+				roots <- ri
+			}
+		}
+	}
+	close(roots)
+	wg.Wait()
+}
+
+// fillNode fills a root entry and returns the number of allocated tiles.
+func (s *SparseVoxelSDF3) fillNode(sdf SDF3, ri v3i.Vec) int {
+	r := &s.root[(ri.Z*s.nr.Y+ri.Y)*s.nr.X+ri.X]
+	i0 := v3i.Vec{ri.X << sparseNodeShift, ri.Y << sparseNodeShift, ri.Z << sparseNodeShift}
+	if d, ok := s.uniform(sdf, s.region(i0, 1<<sparseNodeShift)); ok {
+		r.value = float32(d)
+		return 0
+	}
+	node := &sparseNode{}
+	tiles := 0
+	ps := make([]v3.Vec, sparseTileSize)
+	out := make([]float64, sparseTileSize)
+	var ti v3i.Vec
+	for ti.Z = 0; ti.Z < sparseNodeSize; ti.Z++ {
+		for ti.Y = 0; ti.Y < sparseNodeSize; ti.Y++ {
+			for ti.X = 0; ti.X < sparseNodeSize; ti.X++ {
+				k := (ti.Z*sparseNodeSize+ti.Y)*sparseNodeSize + ti.X
+				j0 := i0.Add(v3i.Vec{ti.X << sparseTileBits, ti.Y << sparseTileBits, ti.Z << sparseTileBits})
+				if d, ok := s.uniform(sdf, s.region(j0, sparseTileSize)); ok {
+					node.value[k] = float32(d)
+					continue
+				}
+				tile := &sparseTile{}
+				limit := [2]float32{float32(s.band), float32(-s.band)}
+				for z := 0; z < sparseTileSize; z++ {
+					for y := 0; y < sparseTileSize; y++ {
+						for x := range ps {
+							ps[x] = s.point(j0.Add(v3i.Vec{x, y, z}))
+						}
+						EvaluateBatch3(sdf, ps, out)
+						for x, d := range out {
+							v := float32(Clamp(d, -s.band, s.band))
+							tile[(z*sparseTileSize+y)*sparseTileSize+x] = v
+							if v < limit[0] {
+								limit[0] = v
+							}
+							if v > limit[1] {
+								limit[1] = v
+							}
+						}
+					}
+				}
+				node.tile[k] = tile
+				node.limit[k] = limit
+				tiles++
+			}
+		}
+	}
+	r.node = node
+	return tiles
+}
+
+//-----------------------------------------------------------------------------
+
+// lookup returns the tile containing a grid point, or the value of the unallocated region.
+func (s *SparseVoxelSDF3) lookup(i v3i.Vec) (*sparseTile, float64) {
+	ri := v3i.Vec{i.X >> sparseNodeShift, i.Y >> sparseNodeShift, i.Z >> sparseNodeShift}
+	r := &s.root[(ri.Z*s.nr.Y+ri.Y)*s.nr.X+ri.X]
+	if r.node == nil {
+		return nil, float64(r.value)
+	}
+	ti := v3i.Vec{(i.X >> sparseTileBits) & sparseNodeMask, (i.Y >> sparseTileBits) & sparseNodeMask, (i.Z >> sparseTileBits) & sparseNodeMask}
+	k := (ti.Z*sparseNodeSize+ti.Y)*sparseNodeSize + ti.X
+	if r.node.tile[k] == nil {
+		return nil, float64(r.node.value[k])
+	}
+	return r.node.tile[k], 0
+}
+
+// tileValue returns the value of a grid point within a tile.
+func tileValue(t *sparseTile, i v3i.Vec) float64 {
+	return float64(t[((i.Z&sparseTileMask)*sparseTileSize+(i.Y&sparseTileMask))*sparseTileSize+(i.X&sparseTileMask)])
+}
+
+// value returns the value at a grid point.
+func (s *SparseVoxelSDF3) value(i v3i.Vec) float64 {
+	t, d := s.lookup(i)
+	if t == nil {
+		return d
+	}
+	return tileValue(t, i)
+}
+
+// cellIndex returns the minimum corner of the grid cell containing a point within the grid.
+func (s *SparseVoxelSDF3) cellIndex(p v3.Vec) v3i.Vec {
+	u := p.Sub(s.bb.Min).DivScalar(s.h)
+	return v3i.Vec{
+		minInt(maxInt(int(math.Floor(u.X)), 0), s.n.X-2),
+		minInt(maxInt(int(math.Floor(u.Y)), 0), s.n.Y-2),
+		minInt(maxInt(int(math.Floor(u.Z)), 0), s.n.Z-2),
+	}
+}
+
+// valueRange returns the range of the values at the grid points (or of the unallocated
+// regions containing them) within a block of grid points from i0 to i1 (inclusive).
+func (s *SparseVoxelSDF3) valueRange(i0, i1 v3i.Vec) Interval {
+	iv := Interval{math.Inf(1), math.Inf(-1)}
+	add := func(lo, hi float32) {
+		iv = iv.extend(Interval{float64(lo), float64(hi)})
+	}
+	r0 := v3i.Vec{i0.X >> sparseNodeShift, i0.Y >> sparseNodeShift, i0.Z >> sparseNodeShift}
+	r1 := v3i.Vec{i1.X >> sparseNodeShift, i1.Y >> sparseNodeShift, i1.Z >> sparseNodeShift}
+	t0 := v3i.Vec{i0.X >> sparseTileBits, i0.Y >> sparseTileBits, i0.Z >> sparseTileBits}
+	t1 := v3i.Vec{i1.X >> sparseTileBits, i1.Y >> sparseTileBits, i1.Z >> sparseTileBits}
+	var ri v3i.Vec
+	for ri.Z = r0.Z; ri.Z <= r1.Z; ri.Z++ {
+		for ri.Y = r0.Y; ri.Y <= r1.Y; ri.Y++ {
+			for ri.X = r0.X; ri.X <= r1.X; ri.X++ {
+				r := &s.root[(ri.Z*s.nr.Y+ri.Y)*s.nr.X+ri.X]
+				if r.node == nil {
+					add(r.value, r.value)
+					continue
+				}
+				// the tiles of this node within the block
+				n0 := v3i.Vec{ri.X << sparseNodeBits, ri.Y << sparseNodeBits, ri.Z << sparseNodeBits}
+				a := v3i.Vec{maxInt(t0.X-n0.X, 0), maxInt(t0.Y-n0.Y, 0), maxInt(t0.Z-n0.Z, 0)}
+				b := v3i.Vec{minInt(t1.X-n0.X, sparseNodeMask), minInt(t1.Y-n0.Y, sparseNodeMask), minInt(t1.Z-n0.Z, sparseNodeMask)}
+				var ti v3i.Vec
+				for ti.Z = a.Z; ti.Z <= b.Z; ti.Z++ {
+					for ti.Y = a.Y; ti.Y <= b.Y; ti.Y++ {
+						for ti.X = a.X; ti.X <= b.X; ti.X++ {
+							k := (ti.Z*sparseNodeSize+ti.Y)*sparseNodeSize + ti.X
+							if r.node.tile[k] == nil {
+								add(r.node.value[k], r.node.value[k])
+							} else {
+								add(r.node.limit[k][0], r.node.limit[k][1])
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	return iv
+}
+
+// cell returns the grid cell containing a point within the grid, and the position of the point within the cell.
+// If the cell is within an unallocated region it returns false and the value of the region.
+func (s *SparseVoxelSDF3) cell(p v3.Vec) ([8]float64, v3.Vec, float64, bool) {
+	i := s.cellIndex(p)
+	u := p.Sub(s.point(i)).DivScalar(s.h)
+	var c [8]float64
+	t, d := s.lookup(i)
+	if t == nil {
+		return c, u, d, false
+	}
+	if i.X&sparseTileMask != sparseTileMask && i.Y&sparseTileMask != sparseTileMask && i.Z&sparseTileMask != sparseTileMask {
+		// all corners are within the tile
+		for j := range c {
+			c[j] = tileValue(t, i.Add(v3i.Vec{j & 1, (j >> 1) & 1, j >> 2}))
+		}
+	} else {
+		for j := range c {
+			c[j] = s.value(i.Add(v3i.Vec{j & 1, (j >> 1) & 1, j >> 2}))
+		}
+	}
+	return c, u, 0, true
+}
+
+// Evaluate returns the minimum distance to a SparseVoxelSDF3.
+func (s *SparseVoxelSDF3) Evaluate(p v3.Vec) float64 {
+	q := p.Clamp(s.bb.Min, s.bb.Max)
+	c, u, d, ok := s.cell(q)
+	if ok {
+		d = trilinear(c, u)
+	}
+	if q == p {
+		return d
+	}
+	// Outside the grid: the surface is inside the grid so this is a lower bound.
+	return math.Sqrt(d*d + p.Sub(q).Length2())
+}
+
+// EvaluateBatch evaluates a SparseVoxelSDF3 at each point of ps.
+func (s *SparseVoxelSDF3) EvaluateBatch(ps []v3.Vec, out []float64) {
+	for i, p := range ps {
+		out[i] = s.Evaluate(p)
+	}
+}
+
+// Gradient returns the gradient of a SparseVoxelSDF3.
+func (s *SparseVoxelSDF3) Gradient(p v3.Vec, eps float64) v3.Vec {
+	if s.bb.Contains(p) {
+		if c, u, _, ok := s.cell(p); ok {
+			return trilinearGradient(c, u).DivScalar(s.h)
+		}
+	}
+	return centralGradient3(s, p, eps)
+}
+
+// EvaluateInterval returns an interval containing the values of a SparseVoxelSDF3 within a box.
+func (s *SparseVoxelSDF3) EvaluateInterval(b Box3) Interval {
+	// The interpolated values are within the range of the values at the cell corners.
+	q := Box3{b.Min.Clamp(s.bb.Min, s.bb.Max), b.Max.Clamp(s.bb.Min, s.bb.Max)}
+	iv := s.valueRange(s.cellIndex(q.Min), s.cellIndex(q.Max).AddScalar(1))
+	if s.bb.Contains(b.Min) && s.bb.Contains(b.Max) {
+		return iv
+	}
+	// outside the grid
+	d := iv.abs()
+	e := Interval{b.boxDist2(s.bb), s.bb.maxDist2(b)}
+	out := Interval{math.Sqrt(d[0]*d[0] + e[0]), math.Sqrt(d[1]*d[1] + e[1])}
+	if e[0] > 0 {
+		return out
+	}
+	return iv.extend(out)
+}
+
+// BoundingBox returns the bounding box of a SparseVoxelSDF3.
+func (s *SparseVoxelSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+// Tiles returns the number of allocated tiles.
+// Each tile uses 2KiB of memory.
+func (s *SparseVoxelSDF3) Tiles() int {
+	return s.tiles
+}
+
+//-----------------------------------------------------------------------------
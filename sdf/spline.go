@@ -104,6 +104,38 @@ func (p *CubicPolynomial) f1Zeroes() []float64 {
 
 //-----------------------------------------------------------------------------
 
+// naturalSpline returns the cubic polynomials for a natural spline passing through the values.
+func naturalSpline(y []float64) ([]CubicPolynomial, error) {
+	// Build and solve the tridiagonal matrix
+	n := len(y)
+	m := make([]v3.Vec, n)
+	d := make([]float64, n)
+	for i := 1; i < n-1; i++ {
+		m[i] = v3.Vec{1, 4, 1}
+		d[i] = 3 * (y[i+1] - y[i-1])
+	}
+	// Special case the end splines.
+	// Assume the 2nd derivative at the end points is 0.
+	m[0] = v3.Vec{0, 2, 1}
+	d[0] = 3 * (y[1] - y[0])
+	m[n-1] = v3.Vec{1, 2, 0}
+	d[n-1] = 3 * (y[n-1] - y[n-2])
+	// solve to give the first derivatives at the knot points
+	x, err := triDiagonal(m, d)
+	if err != nil {
+		return nil, err
+	}
+	// The solution data are the first derivatives.
+	// Reformat as the cubic polynomial coefficients.
+	p := make([]CubicPolynomial, n-1)
+	for i := range p {
+		p[i].Set(y[i], y[i+1], x[i], x[i+1])
+	}
+	return p, nil
+}
+
+//-----------------------------------------------------------------------------
+
 // CubicSpline is a 2d cubic spline.
 type CubicSpline struct {
 	idx    int             // index within spline set
@@ -235,43 +267,27 @@ func CubicSpline2D(knot []v2.Vec) (SDF2, error) {
 	s := CubicSplineSDF2{}
 	s.maxiters = nrMaxIters
 
-	// Build and solve the tridiagonal matrices
 	n := len(knot)
-	m := make([]v3.Vec, n)
-	dx := make([]float64, n)
-	dy := make([]float64, n)
-	for i := 1; i < n-1; i++ {
-		m[i] = v3.Vec{1, 4, 1}
-		dx[i] = 3 * (knot[i+1].X - knot[i-1].X)
-		dy[i] = 3 * (knot[i+1].Y - knot[i-1].Y)
+	x := make([]float64, n)
+	y := make([]float64, n)
+	for i, k := range knot {
+		x[i], y[i] = k.X, k.Y
 	}
-	// Special case the end splines.
-	// Assume the 2nd derivative at the end points is 0.
-	m[0] = v3.Vec{0, 2, 1}
-	dx[0] = 3 * (knot[1].X - knot[0].X)
-	dy[0] = 3 * (knot[1].Y - knot[0].Y)
-	m[n-1] = v3.Vec{1, 2, 0}
-	dx[n-1] = 3 * (knot[n-1].X - knot[n-2].X)
-	dy[n-1] = 3 * (knot[n-1].Y - knot[n-2].Y)
-	// solve to give the first derivatives at the knot points
-	xx, err := triDiagonal(m, dx)
+	px, err := naturalSpline(x)
 	if err != nil {
 		return nil, err
 	}
-	xy, err := triDiagonal(m, dy)
+	py, err := naturalSpline(y)
 	if err != nil {
 		return nil, err
 	}
-
-	// The solution data are the first derivatives.
-	// Reformat as the cubic polynomial coefficients.
 	s.spline = make([]CubicSpline, n-1)
 	for i := 0; i < n-1; i++ {
 		s.spline[i].idx = i
 		s.spline[i].p0 = knot[i]
 		s.spline[i].p1 = knot[i+1]
-		s.spline[i].px.Set(knot[i].X, knot[i+1].X, xx[i], xx[i+1])
-		s.spline[i].py.Set(knot[i].Y, knot[i+1].Y, xy[i], xy[i+1])
+		s.spline[i].px = px[i]
+		s.spline[i].py = py[i]
 	}
 
 	// work out the bounding box
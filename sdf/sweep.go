@@ -0,0 +1,368 @@
+//-----------------------------------------------------------------------------
+/*
+
+Sweep a 2D profile along a 3D path.
+
+The path is approximated by a polyline. Each segment of the polyline is a
+linear extrusion of the profile, clipped by mitre planes at the vertices
+so that adjacent segments join without gaps. As with ExtrudeSDF3 the profile
+is evaluated at the point given by an ExtrudeFunc, where z is the distance
+along the path, so twisted and scaled sweeps use the same extrusion functions. The profile orientation is
+carried from segment to segment with rotation minimizing frames (parallel
+transport) so the profile does not spin around the path.
+
+The profile should be small compared to the radius of curvature of the path.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"errors"
+	"math"
+
+	v2 "github.com/deadsy/sdfx/vec/v2"
+	v3 "github.com/deadsy/sdfx/vec/v3"
+)
+
+//-----------------------------------------------------------------------------
+
+// Path3 is a 3d path used as the spine of a sweep.
+type Path3 interface {
+	Vertices() v3.VecSet
+}
+
+//-----------------------------------------------------------------------------
+
+type polylinePath3 struct {
+	v v3.VecSet
+}
+
+// PolylinePath3 returns a 3d path made from a set of line segments.
+func PolylinePath3(v []v3.Vec) (Path3, error) {
+	if len(v) < 2 {
+		return nil, errors.New("polyline paths need at least 2 vertices")
+	}
+	return &polylinePath3{v3.VecSet(v)}, nil
+}
+
+// Vertices returns the vertices of the polyline path.
+func (p *polylinePath3) Vertices() v3.VecSet {
+	return p.v
+}
+
+//-----------------------------------------------------------------------------
+
+type splinePath3 struct {
+	px, py, pz []CubicPolynomial
+	n          int // segments per spline
+}
+
+// SplinePath3 returns a 3d path made from a natural cubic spline passing through the knots (see CubicSpline2D).
+// Each spline is approximated with n line segments.
+func SplinePath3(knot []v3.Vec, n int) (Path3, error) {
+	if len(knot) < 2 {
+		return nil, errors.New("cubic splines need at least 2 knots")
+	}
+	if n < 1 {
+		return nil, ErrMsg("n < 1")
+	}
+	x := make([]float64, len(knot))
+	y := make([]float64, len(knot))
+	z := make([]float64, len(knot))
+	for i, k := range knot {
+		x[i], y[i], z[i] = k.X, k.Y, k.Z
+	}
+	p := splinePath3{n: n}
+	var err error
+	if p.px, err = naturalSpline(x); err != nil {
+		return nil, err
+	}
+	if p.py, err = naturalSpline(y); err != nil {
+		return nil, err
+	}
+	if p.pz, err = naturalSpline(z); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Vertices returns a polyline approximation of the spline path.
+func (p *splinePath3) Vertices() v3.VecSet {
+	v := v3.VecSet{}
+	for i := range p.px {
+		j0 := 1
+		if i == 0 {
+			j0 = 0
+		}
+		for j := j0; j <= p.n; j++ {
+			t := float64(j) / float64(p.n)
+			v = append(v, v3.Vec{p.px[i].f0(t), p.py[i].f0(t), p.pz[i].f0(t)})
+		}
+	}
+	return v
+}
+
+//-----------------------------------------------------------------------------
+
+type bezierPath3 struct {
+	px, py, pz []BezierPolynomial
+	n          int // segments per curve
+}
+
+// BezierPath3 returns a 3d path made from a chain of cubic bezier curves.
+// The control points are end, control, control, end, control, control, end...
+// Each curve is approximated with n line segments.
+func BezierPath3(v []v3.Vec, n int) (Path3, error) {
+	if len(v) < 4 || (len(v)-1)%3 != 0 {
+		return nil, errors.New("bezier paths need 3n+1 control points")
+	}
+	if n < 1 {
+		return nil, ErrMsg("n < 1")
+	}
+	k := (len(v) - 1) / 3
+	p := bezierPath3{n: n}
+	p.px = make([]BezierPolynomial, k)
+	p.py = make([]BezierPolynomial, k)
+	p.pz = make([]BezierPolynomial, k)
+	for i := 0; i < k; i++ {
+		c := v[3*i : 3*i+4]
+		p.px[i].Set([]float64{c[0].X, c[1].X, c[2].X, c[3].X})
+		p.py[i].Set([]float64{c[0].Y, c[1].Y, c[2].Y, c[3].Y})
+		p.pz[i].Set([]float64{c[0].Z, c[1].Z, c[2].Z, c[3].Z})
+	}
+	return &p, nil
+}
+
+// Vertices returns a polyline approximation of the bezier path.
+func (p *bezierPath3) Vertices() v3.VecSet {
+	v := v3.VecSet{}
+	for i := range p.px {
+		j0 := 1
+		if i == 0 {
+			j0 = 0
+		}
+		for j := j0; j <= p.n; j++ {
+			t := float64(j) / float64(p.n)
+			v = append(v, v3.Vec{p.px[i].f0(t), p.py[i].f0(t), p.pz[i].f0(t)})
+		}
+	}
+	return v
+}
+
+//-----------------------------------------------------------------------------
+
+// sweepSegment is a single extruded segment of a sweep.
+type sweepSegment struct {
+	p0, p1  v3.Vec // segment end points
+	t, n, b v3.Vec // segment frame (tangent, normal, binormal)
+	m0, m1  v3.Vec // mitre plane normals at p0 and p1
+	s0      float64
+	bb      Box3
+}
+
+// SweepSDF3 is a 2d profile swept along a 3d path.
+type SweepSDF3 struct {
+	profile SDF2
+	seg     []sweepSegment
+	extrude ExtrudeFunc
+	custom  bool    // set by SetExtrude
+	twist   float64 // twist over the path length
+	length  float64 // path length
+	bb      Box3
+}
+
+// Sweep3D sweeps a 2d profile along a 3d path, rotating the profile by twist radians over the path length.
+// The profile x/y axes start out aligned with the normal/binormal of the path, where the initial normal
+// is the x-axis (or the y-axis) made perpendicular to the path. A straight path along the z-axis is
+// equivalent to Extrude3D().
+func Sweep3D(profile SDF2, path Path3, twist float64) (SDF3, error) {
+	if profile == nil || path == nil {
+		return nil, ErrMsg("nil profile or path")
+	}
+	// remove duplicate vertices
+	v := v3.VecSet{}
+	for _, x := range path.Vertices() {
+		if len(v) == 0 || !x.Equals(v[len(v)-1], tolerance) {
+			v = append(v, x)
+		}
+	}
+	if len(v) < 2 {
+		return nil, ErrMsg("path has zero length")
+	}
+
+	s := SweepSDF3{}
+	s.profile = profile
+	s.seg = make([]sweepSegment, len(v)-1)
+
+	// segment tangents and lengths
+	length := 0.0
+	for i := range s.seg {
+		sg := &s.seg[i]
+		sg.p0 = v[i]
+		sg.p1 = v[i+1]
+		sg.t = sg.p1.Sub(sg.p0).Normalize()
+		sg.s0 = length
+		length += sg.p1.Sub(sg.p0).Length()
+	}
+	s.extrude = NormalExtrude
+	s.twist = twist
+	s.length = length
+	if twist != 0 {
+		s.extrude = TwistExtrude(length, twist)
+	}
+
+	// rotation minimizing frames
+	t := s.seg[0].t
+	n := v3.Vec{1, 0, 0}
+	if math.Abs(t.X) > 0.9 {
+		// the path starts out close to the x-axis
+		n = v3.Vec{0, 1, 0}
+	}
+	for i := range s.seg {
+		sg := &s.seg[i]
+		if i > 0 {
+			n = RotateToVector(s.seg[i-1].t, sg.t).MulPosition(n)
+		}
+		n = n.Sub(sg.t.MulScalar(sg.t.Dot(n))).Normalize()
+		sg.n = n
+		sg.b = sg.t.Cross(n)
+	}
+
+	// mitre planes
+	for i := range s.seg {
+		sg := &s.seg[i]
+		sg.m0 = sg.t
+		if i > 0 {
+			sg.m0 = s.seg[i-1].t.Add(sg.t)
+		}
+		sg.m1 = sg.t
+		if i < len(s.seg)-1 {
+			sg.m1 = sg.t.Add(s.seg[i+1].t)
+		}
+		if sg.m0.Length() < 0.2 || sg.m1.Length() < 0.2 {
+			return nil, ErrMsg("path turns too sharply")
+		}
+		sg.m0 = sg.m0.Normalize()
+		sg.m1 = sg.m1.Normalize()
+	}
+
+	// work out the bounding boxes
+	pbb := profile.BoundingBox()
+	r := math.Max(pbb.Min.Length(), pbb.Max.Length())
+	if twist == 0 {
+		r = v2.Vec{math.Max(math.Abs(pbb.Min.X), math.Abs(pbb.Max.X)), math.Max(math.Abs(pbb.Min.Y), math.Abs(pbb.Max.Y))}.Length()
+	}
+	for i := range s.seg {
+		sg := &s.seg[i]
+		// the mitre planes stretch the profile
+		k := r / math.Min(sg.m0.Dot(sg.t), sg.m1.Dot(sg.t))
+		sg.bb = Box3{sg.p0.Min(sg.p1), sg.p0.Max(sg.p1)}.Enlarge(v3.Vec{2 * k, 2 * k, 2 * k})
+		if i == 0 {
+			s.bb = sg.bb
+		} else {
+			s.bb = s.bb.Extend(sg.bb)
+		}
+	}
+	return &s, nil
+}
+
+// Evaluate returns the minimum distance to a swept profile.
+func (s *SweepSDF3) Evaluate(p v3.Vec) float64 {
+	d := math.Inf(1)
+	for i := range s.seg {
+		sg := &s.seg[i]
+		if lb := sg.bb.minDist2(p); lb > 0 && (d <= 0 || d*d < lb) {
+			// this segment can't be closer
+			continue
+		}
+		q := p.Sub(sg.p0)
+		l := sg.p1.Sub(sg.p0).Length()
+		w := Clamp(q.Dot(sg.t), 0, l)
+		// sdf for the profile
+		a := s.profile.Evaluate(s.extrude(v3.Vec{q.Dot(sg.n), q.Dot(sg.b), sg.s0 + w}))
+		// sdf for the region between the mitre planes
+		b := math.Max(-q.Dot(sg.m0), p.Sub(sg.p1).Dot(sg.m1))
+		if b <= 0 {
+			// The point is within the region of this segment.
+			// Only the end caps of the path are real surfaces.
+			b = math.Inf(-1)
+			if i == 0 {
+				b = -q.Dot(sg.m0)
+			}
+			if i == len(s.seg)-1 {
+				b = math.Max(b, p.Sub(sg.p1).Dot(sg.m1))
+			}
+		}
+		d = math.Min(d, math.Max(a, b))
+	}
+	return d
+}
+
+// SetExtrude sets the extrusion control function.
+// The z value of the point passed to the function is the distance along the path.
+// The bounding box isn't changed, so the function shouldn't make the profile larger.
+func (s *SweepSDF3) SetExtrude(extrude ExtrudeFunc) {
+	s.extrude = extrude
+	s.custom = true
+}
+
+// EvaluateInterval returns an interval containing the values of a swept profile within a box.
+func (s *SweepSDF3) EvaluateInterval(b Box3) Interval {
+	if s.custom {
+		// we don't know how the extrusion function maps the box
+		return unboundedInterval
+	}
+	d := Interval{math.Inf(1), math.Inf(1)}
+	for i := range s.seg {
+		sg := &s.seg[i]
+		if g := b.boxDist2(sg.bb); g > 0 && (d[1] <= 0 || g >= d[1]*d[1]) {
+			// this segment can't be closer
+			continue
+		}
+		// profile coordinates
+		x := linearInterval3(sg.n, -sg.p0.Dot(sg.n), b)
+		y := linearInterval3(sg.b, -sg.p0.Dot(sg.b), b)
+		l := sg.p1.Sub(sg.p0).Length()
+		w := linearInterval3(sg.t, -sg.p0.Dot(sg.t), b)
+		w = Interval{Clamp(w[0], 0, l), Clamp(w[1], 0, l)}
+		bb := Box2{v2.Vec{x[0], y[0]}, v2.Vec{x[1], y[1]}}
+		if s.twist != 0 {
+			// twisting (see TwistExtrude)
+			k := s.twist / s.length
+			bb = rotateBox2(bb, w.offset(sg.s0).scale(k))
+		}
+		a := EvaluateInterval2(s.profile, bb)
+		// the region between the mitre planes
+		b0 := linearInterval3(sg.m0.Neg(), sg.p0.Dot(sg.m0), b)
+		b1 := linearInterval3(sg.m1, -sg.p1.Dot(sg.m1), b)
+		bm := maxInterval(math.Max, b0, b1)
+		// the end caps
+		cap := Interval{math.Inf(-1), math.Inf(-1)}
+		if i == 0 {
+			cap = b0
+		}
+		if i == len(s.seg)-1 {
+			cap = maxInterval(math.Max, cap, b1)
+		}
+		var e Interval
+		switch {
+		case bm[0] > 0:
+			e = maxInterval(math.Max, a, bm)
+		case bm[1] <= 0:
+			e = maxInterval(math.Max, a, cap)
+		default:
+			e = maxInterval(math.Max, a, bm).extend(maxInterval(math.Max, a, cap))
+		}
+		d = minInterval(math.Min, d, e)
+	}
+	return d
+}
+
+// BoundingBox returns the bounding box for a swept profile.
+func (s *SweepSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,403 @@
+//-----------------------------------------------------------------------------
+/*
+
+Textures and Surface Displacement
+
+A texture is a height map with heights in [0, 1]. 2d textures (procedural
+functions or grayscale images) are tiled over the uv plane and projected onto
+3d with planar, cylindrical, spherical or triplanar projections.
+
+Displace3D raises the surface of an SDF3 by depth * height. The slope of the
+texture (the maximum gradient of the height) gives the lipschitz constant of
+the displaced field, 1 + depth * slope, and the distance is divided by this.
+Deep or high frequency textures make the field smaller, so raycasting takes
+more steps.
+The interval of a box is the interval of the SDF3 offset by the range of the
+displacement, so it doesn't depend on the texture.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"image"
+	"image/color"
+	_ "image/png" // register the png decoder
+	"math"
+	"os"
+
+	v2 "github.com/deadsy/sdfx/vec/v2"
+	v3 "github.com/deadsy/sdfx/vec/v3"
+)
+
+//-----------------------------------------------------------------------------
+
+// Texture2 is a height map on the uv plane.
+type Texture2 interface {
+	Height(p v2.Vec) float64 // height in [0, 1]
+	Slope() float64          // maximum gradient of the height
+}
+
+// Texture3 is a height map in 3d space.
+type Texture3 interface {
+	Height(p v3.Vec) float64 // height in [0, 1]
+	Slope() float64          // maximum gradient of the height
+}
+
+//-----------------------------------------------------------------------------
+// Procedural Textures
+
+// FuncTexture2 is a height map given by a function.
+type FuncTexture2 struct {
+	f     func(p v2.Vec) float64
+	slope float64
+}
+
+// NewFuncTexture2 returns a texture from a height function and its maximum gradient.
+// Heights outside [0, 1] are clamped.
+func NewFuncTexture2(f func(p v2.Vec) float64, slope float64) (*FuncTexture2, error) {
+	if f == nil {
+		return nil, ErrMsg("f == nil")
+	}
+	if slope < 0 {
+		return nil, ErrMsg("slope < 0")
+	}
+	return &FuncTexture2{f, slope}, nil
+}
+
+// Height returns the height of a function texture.
+func (t *FuncTexture2) Height(p v2.Vec) float64 {
+	return Clamp(t.f(p), 0, 1)
+}
+
+// Slope returns the maximum gradient of a function texture.
+func (t *FuncTexture2) Slope() float64 {
+	return t.slope
+}
+
+// FuncTexture3 is a 3d height map given by a function (a solid texture).
+type FuncTexture3 struct {
+	f     func(p v3.Vec) float64
+	slope float64
+}
+
+// NewFuncTexture3 returns a texture from a height function and its maximum gradient.
+// Heights outside [0, 1] are clamped.
+func NewFuncTexture3(f func(p v3.Vec) float64, slope float64) (*FuncTexture3, error) {
+	if f == nil {
+		return nil, ErrMsg("f == nil")
+	}
+	if slope < 0 {
+		return nil, ErrMsg("slope < 0")
+	}
+	return &FuncTexture3{f, slope}, nil
+}
+
+// Height returns the height of a function texture.
+func (t *FuncTexture3) Height(p v3.Vec) float64 {
+	return Clamp(t.f(p), 0, 1)
+}
+
+// Slope returns the maximum gradient of a function texture.
+func (t *FuncTexture3) Slope() float64 {
+	return t.slope
+}
+
+//-----------------------------------------------------------------------------
+// Image Textures
+
+// ImageTexture2 is a height map given by the brightness of an image.
+type ImageTexture2 struct {
+	n     [2]int    // image size in pixels
+	h     v2.Vec    // pixel size
+	data  []float64 // heights (bottom row first)
+	slope float64
+	size  v2.Vec // texture size
+	path  string // image file (for serialization)
+}
+
+// NewImageTexture2 returns a texture from the brightness of an image.
+// The image covers a size.X by size.Y rectangle with its lower left corner at the origin.
+// It's repeated over the rest of the plane, and interpolated between pixel centers.
+func NewImageTexture2(img image.Image, size v2.Vec) (*ImageTexture2, error) {
+	if img == nil {
+		return nil, ErrMsg("img == nil")
+	}
+	if size.X <= 0 || size.Y <= 0 {
+		return nil, ErrMsg("size <= 0")
+	}
+	r := img.Bounds()
+	nx, ny := r.Dx(), r.Dy()
+	if nx == 0 || ny == 0 {
+		return nil, ErrMsg("empty image")
+	}
+	t := ImageTexture2{
+		n:    [2]int{nx, ny},
+		h:    v2.Vec{size.X / float64(nx), size.Y / float64(ny)},
+		data: make([]float64, nx*ny),
+		size: size,
+	}
+	for j := 0; j < ny; j++ {
+		for i := 0; i < nx; i++ {
+			c := color.Gray16Model.Convert(img.At(r.Min.X+i, r.Max.Y-1-j)).(color.Gray16)
+			t.data[j*nx+i] = float64(c.Y) / 0xffff
+		}
+	}
+	// The bilinear interpolation is steepest across the biggest steps between neighbouring pixels.
+	var dx, dy float64
+	for j := 0; j < ny; j++ {
+		for i := 0; i < nx; i++ {
+			x := t.pixel(i, j)
+			dx = math.Max(dx, math.Abs(t.pixel(i+1, j)-x))
+			dy = math.Max(dy, math.Abs(t.pixel(i, j+1)-x))
+		}
+	}
+	t.slope = math.Hypot(dx/t.h.X, dy/t.h.Y)
+	return &t, nil
+}
+
+// LoadImageTexture2 returns a texture from the brightness of an image file (e.g. a grayscale png).
+func LoadImageTexture2(fname string, size v2.Vec) (*ImageTexture2, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, err
+	}
+	t, err := NewImageTexture2(img, size)
+	if err != nil {
+		return nil, err
+	}
+	t.path = fname
+	return t, nil
+}
+
+// pixel returns the height of a pixel, the image is repeated.
+func (t *ImageTexture2) pixel(i, j int) float64 {
+	i = ((i % t.n[0]) + t.n[0]) % t.n[0]
+	j = ((j % t.n[1]) + t.n[1]) % t.n[1]
+	return t.data[j*t.n[0]+i]
+}
+
+// Height returns the height of an image texture.
+func (t *ImageTexture2) Height(p v2.Vec) float64 {
+	// pixel centers are at (i + 0.5) * h
+	u := p.Div(t.h).SubScalar(0.5)
+	x, y := math.Floor(u.X), math.Floor(u.Y)
+	fx, fy := u.X-x, u.Y-y
+	i, j := int(x), int(y)
+	h0 := t.pixel(i, j)*(1-fx) + t.pixel(i+1, j)*fx
+	h1 := t.pixel(i, j+1)*(1-fx) + t.pixel(i+1, j+1)*fx
+	return h0*(1-fy) + h1*fy
+}
+
+// Slope returns the maximum gradient of an image texture.
+func (t *ImageTexture2) Slope() float64 {
+	return t.slope
+}
+
+//-----------------------------------------------------------------------------
+// Projections
+
+// PlanarTexture3 is a 2d texture projected along an axis.
+type PlanarTexture3 struct {
+	t     Texture2
+	plane Plane3
+}
+
+// NewPlanarTexture3 returns a 2d texture projected perpendicular to a plane.
+// The uv coordinates are xy, xz or yz.
+func NewPlanarTexture3(t Texture2, plane Plane3) (*PlanarTexture3, error) {
+	if t == nil {
+		return nil, ErrMsg("t == nil")
+	}
+	if plane < PlaneXY || plane > PlaneYZ {
+		return nil, ErrMsg("unknown plane")
+	}
+	return &PlanarTexture3{t, plane}, nil
+}
+
+// planeUV returns the uv coordinates of a point projected onto a plane.
+func planeUV(plane Plane3, p v3.Vec) v2.Vec {
+	switch plane {
+	case PlaneXZ:
+		return v2.Vec{p.X, p.Z}
+	case PlaneYZ:
+		return v2.Vec{p.Y, p.Z}
+	}
+	return v2.Vec{p.X, p.Y}
+}
+
+// Height returns the height of a planar texture.
+func (t *PlanarTexture3) Height(p v3.Vec) float64 {
+	return t.t.Height(planeUV(t.plane, p))
+}
+
+// Slope returns the maximum gradient of a planar texture.
+func (t *PlanarTexture3) Slope() float64 {
+	return t.t.Slope()
+}
+
+// CylindricalTexture3 is a 2d texture wrapped around the z-axis.
+type CylindricalTexture3 struct {
+	t      Texture2
+	radius float64
+}
+
+// NewCylindricalTexture3 returns a 2d texture wrapped around the z-axis.
+// The u coordinate is the arc length around a cylinder with the given radius and v is z.
+// A texture with width 2 * Pi * radius wraps without a seam. The slope holds for points
+// at least radius/2 from the axis.
+func NewCylindricalTexture3(t Texture2, radius float64) (*CylindricalTexture3, error) {
+	if t == nil {
+		return nil, ErrMsg("t == nil")
+	}
+	if radius <= 0 {
+		return nil, ErrMsg("radius <= 0")
+	}
+	return &CylindricalTexture3{t, radius}, nil
+}
+
+// Height returns the height of a cylindrical texture.
+func (t *CylindricalTexture3) Height(p v3.Vec) float64 {
+	return t.t.Height(v2.Vec{t.radius * math.Atan2(p.Y, p.X), p.Z})
+}
+
+// Slope returns the maximum gradient of a cylindrical texture.
+func (t *CylindricalTexture3) Slope() float64 {
+	// u is stretched by up to 2 at radius/2
+	return 2 * t.t.Slope()
+}
+
+// SphericalTexture3 is a 2d texture wrapped around the origin.
+type SphericalTexture3 struct {
+	t      Texture2
+	radius float64
+}
+
+// NewSphericalTexture3 returns a 2d texture wrapped around a sphere at the origin.
+// The texture is mapped with a sinusoidal projection, so there's no pinching at the poles.
+// The v coordinate is the arc length from the equator, and u is the arc length from the
+// xz plane along the circle of latitude. A texture with width 2 * Pi * radius and height
+// Pi * radius centered on the origin covers the sphere. The slope holds for points at
+// least radius/2 from the origin.
+func NewSphericalTexture3(t Texture2, radius float64) (*SphericalTexture3, error) {
+	if t == nil {
+		return nil, ErrMsg("t == nil")
+	}
+	if radius <= 0 {
+		return nil, ErrMsg("radius <= 0")
+	}
+	return &SphericalTexture3{t, radius}, nil
+}
+
+// Height returns the height of a spherical texture.
+func (t *SphericalTexture3) Height(p v3.Vec) float64 {
+	lon := math.Atan2(p.Y, p.X)
+	lat := math.Atan2(p.Z, math.Hypot(p.X, p.Y))
+	return t.t.Height(v2.Vec{t.radius * lon * math.Cos(lat), t.radius * lat})
+}
+
+// Slope returns the maximum gradient of a spherical texture.
+func (t *SphericalTexture3) Slope() float64 {
+	// At radius/2 u changes by up to 2 * sqrt(1 + Pi^2) and v by 2.
+	return 2 * math.Sqrt(2+Pi*Pi) * t.t.Slope()
+}
+
+// TriplanarTexture3 is a 2d texture projected along the x, y and z axes and blended.
+type TriplanarTexture3 struct {
+	t      Texture2
+	center v3.Vec
+	radius float64
+}
+
+// triplanarSlope is the maximum gradient (at unit distance from the center) of the blend of 3 heights in [0, 1].
+const triplanarSlope = 2.1
+
+// NewTriplanarTexture3 returns a 2d texture projected along the x, y and z axes.
+// The projections are blended by the direction from a center point, so each part of
+// a roughly convex SDF3 around the center gets the projection that's closest to its normal.
+// The slope holds for points at least radius from the center.
+func NewTriplanarTexture3(t Texture2, center v3.Vec, radius float64) (*TriplanarTexture3, error) {
+	if t == nil {
+		return nil, ErrMsg("t == nil")
+	}
+	if radius <= 0 {
+		return nil, ErrMsg("radius <= 0")
+	}
+	return &TriplanarTexture3{t, center, radius}, nil
+}
+
+// Height returns the height of a triplanar texture.
+func (t *TriplanarTexture3) Height(p v3.Vec) float64 {
+	d := p.Sub(t.center)
+	w := d.Mul(d)
+	w = w.Mul(w)
+	sum := w.X + w.Y + w.Z
+	if sum == 0 {
+		w, sum = v3.Vec{1, 1, 1}, 3
+	}
+	h := w.X*t.t.Height(planeUV(PlaneYZ, p)) + w.Y*t.t.Height(planeUV(PlaneXZ, p)) + w.Z*t.t.Height(planeUV(PlaneXY, p))
+	return h / sum
+}
+
+// Slope returns the maximum gradient of a triplanar texture.
+func (t *TriplanarTexture3) Slope() float64 {
+	return t.t.Slope() + triplanarSlope/t.radius
+}
+
+//-----------------------------------------------------------------------------
+
+// DisplaceSDF3 is an SDF3 with its surface displaced by a texture.
+type DisplaceSDF3 struct {
+	sdf     SDF3
+	texture Texture3
+	depth   float64
+	k       float64 // lipschitz constant
+	bb      Box3
+}
+
+// Displace3D returns an SDF3 with its surface raised by depth * the height of a texture.
+// A negative depth engraves the texture into the surface.
+func Displace3D(sdf SDF3, texture Texture3, depth float64) (SDF3, error) {
+	if sdf == nil {
+		return nil, ErrMsg("sdf == nil")
+	}
+	if texture == nil {
+		return nil, ErrMsg("texture == nil")
+	}
+	bb := sdf.BoundingBox()
+	if depth > 0 {
+		bb = bb.Enlarge(v3.Vec{2 * depth, 2 * depth, 2 * depth})
+	}
+	return &DisplaceSDF3{
+		sdf:     sdf,
+		texture: texture,
+		depth:   depth,
+		k:       1 + math.Abs(depth)*texture.Slope(),
+		bb:      bb,
+	}, nil
+}
+
+// Evaluate returns the minimum distance to a displaced SDF3.
+func (s *DisplaceSDF3) Evaluate(p v3.Vec) float64 {
+	return (s.sdf.Evaluate(p) - s.depth*s.texture.Height(p)) / s.k
+}
+
+// EvaluateInterval returns an interval containing the values of a displaced SDF3 within a box.
+func (s *DisplaceSDF3) EvaluateInterval(b Box3) Interval {
+	// the displacement is within [0, depth] (or [depth, 0])
+	d := EvaluateInterval3(s.sdf, b)
+	return Interval{d[0] - math.Max(s.depth, 0), d[1] - math.Min(s.depth, 0)}.scale(1 / s.k)
+}
+
+// BoundingBox returns the bounding box of a displaced SDF3.
+func (s *DisplaceSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
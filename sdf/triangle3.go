@@ -9,6 +9,7 @@
 package sdf
 
 import (
+	"math"
 	"sync"
 
 	v3 "github.com/deadsy/sdfx/vec/v3"
@@ -142,6 +143,23 @@ func (t *Triangle3) intersectRay(rp, rv v3.Vec) []v3.Vec {
 	return nil
 }
 
+//-----------------------------------------------------------------------------
+// https://en.wikipedia.org/wiki/Solid_angle#Tetrahedron
+
+// solidAngle returns the signed solid angle subtended by the triangle at point p.
+// The sum over a closed, outward facing mesh is 4*Pi for points inside the mesh.
+func (t *Triangle3) solidAngle(p v3.Vec) float64 {
+	a := t[0].Sub(p)
+	b := t[1].Sub(p)
+	c := t[2].Sub(p)
+	la := a.Length()
+	lb := b.Length()
+	lc := c.Length()
+	num := a.Dot(b.Cross(c))
+	den := la*lb*lc + a.Dot(b)*lc + b.Dot(c)*la + c.Dot(a)*lb
+	return 2 * math.Atan2(num, den)
+}
+
 //-----------------------------------------------------------------------------
 
 // WriteTriangles writes a stream of triangles to a slice.
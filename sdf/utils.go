@@ -158,11 +158,16 @@ func PowMin(k float64) MinFunc {
 }
 
 func poly(a, b, k float64) float64 {
+	if k <= 0 {
+		// no blending (and no division by zero)
+		return math.Min(a, b)
+	}
 	h := Clamp(0.5+0.5*(b-a)/k, 0.0, 1.0)
 	return Mix(b, a, h) - k*h*(1.0-h)
 }
 
 // PolyMin returns a minimum function (Try k = 0.1, a bigger k gives a bigger fillet).
+// It's math.Min for k <= 0.
 func PolyMin(k float64) MinFunc {
 	return func(a, b float64) float64 {
 		return poly(a, b, k)
@@ -175,6 +180,7 @@ func PolyMin(k float64) MinFunc {
 type MaxFunc func(a, b float64) float64
 
 // PolyMax returns a maximum function (Try k = 0.1, a bigger k gives a bigger fillet).
+// It's math.Max for k <= 0.
 func PolyMax(k float64) MaxFunc {
 	return func(a, b float64) float64 {
 		return -poly(-a, -b, k)
@@ -282,8 +288,12 @@ func Raycast2(s SDF2, from, dir v2.Vec, scaleAndSigmoid, stepScale, epsilon, max
 // Normals
 
 // Normal3 returns the normal of an SDF3 at a point (doesn't need to be on the surface).
-// Computed by sampling it several times inside a box of side 2*eps centered on p.
+// SDF3s with a Gradient method return their normalized gradient.
+// Otherwise it's computed by sampling it several times inside a box of side 2*eps centered on p.
 func Normal3(s SDF3, p v3.Vec, eps float64) v3.Vec {
+	if sg, ok := s.(GradientSDF3); ok {
+		return sg.Gradient(p, eps).Normalize()
+	}
 	return v3.Vec{
 		X: s.Evaluate(p.Add(v3.Vec{X: eps})) - s.Evaluate(p.Add(v3.Vec{X: -eps})),
 		Y: s.Evaluate(p.Add(v3.Vec{Y: eps})) - s.Evaluate(p.Add(v3.Vec{Y: -eps})),
@@ -291,9 +301,13 @@ func Normal3(s SDF3, p v3.Vec, eps float64) v3.Vec {
 	}.Normalize()
 }
 
-// Normal2 returns the normal of an SDF3 at a point (doesn't need to be on the surface).
-// Computed by sampling it several times inside a box of side 2*eps centered on p.
+// Normal2 returns the normal of an SDF2 at a point (doesn't need to be on the surface).
+// SDF2s with a Gradient method return their normalized gradient.
+// Otherwise it's computed by sampling it several times inside a box of side 2*eps centered on p.
 func Normal2(s SDF2, p v2.Vec, eps float64) v2.Vec {
+	if sg, ok := s.(GradientSDF2); ok {
+		return sg.Gradient(p, eps).Normalize()
+	}
 	return v2.Vec{
 		X: s.Evaluate(p.Add(v2.Vec{X: eps})) - s.Evaluate(p.Add(v2.Vec{X: -eps})),
 		Y: s.Evaluate(p.Add(v2.Vec{Y: eps})) - s.Evaluate(p.Add(v2.Vec{Y: -eps})),
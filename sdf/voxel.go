@@ -3,12 +3,30 @@
 
 Voxel-based cache/smoothing to remove deep SDF2/SDF3 hierarchies and speed up evaluation
 
+The SDF is sampled on a dense grid of points and interpolated between them.
+The grid can be saved to a file, so an expensive SDF (e.g. an imported mesh or
+a large CSG tree) only needs to be evaluated once.
+
+Voxel File Format (little endian):
+
+	magic     [8]byte    "SDFXVOX1"
+	n         [3]uint32  number of grid points on each axis
+	min, max  [3]float64 grid bounds
+	tricubic  uint32     1 for tricubic interpolation, else 0
+	values    []float32  n.X * n.Y * n.Z grid values (x varies fastest)
+
 */
 //-----------------------------------------------------------------------------
 
 package sdf
 
 import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"math"
+	"os"
+
 	"github.com/deadsy/sdfx/vec/conv"
 	v3 "github.com/deadsy/sdfx/vec/v3"
 	"github.com/deadsy/sdfx/vec/v3i"
@@ -23,81 +41,203 @@ import (
 // It can be used to speed up all evaluations required by the surface mesher at the cost of scene setup time and accuracy.
 //
 // SMOOTHING (meshCells <<< renderer's meshCells):
-// It performs trilinear mapping for inner values and may be used as a cache for any other SDF, losing some accuracy.
+// It performs trilinear (or tricubic) mapping for inner values and may be used as a cache for any other SDF, losing some accuracy.
 //
 // WARNING: It may lose sharp features, even if meshCells is high.
 type VoxelSDF3 struct {
-	// voxelCorners are the values of this SDF in each voxel corner
-	voxelCorners map[v3i.Vec]float64 // TODO: Octree + k-d tree to simplify/reduce memory consumption + speed-up access?
-	// bb is the bounding box.
-	bb Box3
-	// Number of voxelCorners to consider
-	numVoxels v3i.Vec
+	grid     *grid3 // values of the SDF at the voxel corners
+	slope    v3.Vec // slope of the grid values (see grid3.slope)
+	tricubic bool   // use tricubic rather than trilinear interpolation
 }
 
 // NewVoxelSDF3 returns a VoxelSDF3.
 // This populates the whole cache from the given SDF.
 // The progress listener may be nil.
 func NewVoxelSDF3(s SDF3, meshCells int, progress chan float64) SDF3 {
-	bb := s.BoundingBox() // TODO: Use default code to avoid duplication
+	bb := s.BoundingBox()
 	bbSize := bb.Size()
 	resolution := bbSize.MaxComponent() / float64(meshCells)
 	cells := conv.V3ToV3i(bbSize.DivScalar(resolution))
+	cells = v3i.Vec{maxInt(cells.X, 1), maxInt(cells.Y, 1), maxInt(cells.Z, 1)}
+	g := newGrid3(bb, cells.AddScalar(1))
+	g.sample(s, progress)
+	return &VoxelSDF3{grid: g, slope: g.slope()}
+}
 
-	voxelCorners := map[v3i.Vec]float64{}
-	voxelCornerIndex := v3i.Vec{}
-	for voxelCornerIndex.X = 0; voxelCornerIndex.X <= cells.X; voxelCornerIndex.X++ {
-		for voxelCornerIndex.Y = 0; voxelCornerIndex.Y <= cells.Y; voxelCornerIndex.Y++ {
-			for voxelCornerIndex.Z = 0; voxelCornerIndex.Z <= cells.Z; voxelCornerIndex.Z++ {
-				voxelCorner := bb.Min.Add(bbSize.Mul(conv.V3iToV3(voxelCornerIndex)).Div(conv.V3iToV3(cells)))
-				voxelCorners[voxelCornerIndex] = s.Evaluate(voxelCorner)
-			}
-		}
-		if progress != nil {
-			progress <- float64(voxelCornerIndex.X) / float64(cells.X)
-		}
-	}
+// SetTricubic sets tricubic (rather than trilinear) interpolation between the voxel corners.
+// The interpolated surface is smoother, but evaluation is slower.
+func (m *VoxelSDF3) SetTricubic(tricubic bool) {
+	m.tricubic = tricubic
+}
 
-	return &VoxelSDF3{
-		voxelCorners: voxelCorners,
-		bb:           bb,
-		numVoxels:    cells,
+// interpolate returns the interpolated value at a point within the grid.
+func (m *VoxelSDF3) interpolate(p v3.Vec) float64 {
+	if m.tricubic {
+		d, _ := m.grid.tricubic(p)
+		return d
 	}
+	return m.grid.trilinear(p)
 }
 
 // Evaluate returns the minimum distance to a VoxelSDF3.
 func (m *VoxelSDF3) Evaluate(p v3.Vec) float64 {
-	// Find the voxel's {0,0,0} corner quickly and compute p's displacement
-	voxelSize := m.bb.Size().Div(conv.V3iToV3(m.numVoxels))
-	voxelStartIndex := conv.V3ToV3i(p.Sub(m.bb.Min).Div(voxelSize))
-	voxelStart := m.bb.Min.Add(voxelSize.Mul(conv.V3iToV3(voxelStartIndex)))
-	d := p.Sub(voxelStart).Div(voxelSize) // [0, 1) for each dimension
-	// Get the values at the voxel's corners
-	c000 := m.voxelCorners[voxelStartIndex]
-	c001 := m.voxelCorners[voxelStartIndex.Add(v3i.Vec{0, 0, 1})]
-	c010 := m.voxelCorners[voxelStartIndex.Add(v3i.Vec{0, 1, 0})]
-	c011 := m.voxelCorners[voxelStartIndex.Add(v3i.Vec{0, 1, 1})]
-	c100 := m.voxelCorners[voxelStartIndex.Add(v3i.Vec{1, 0, 0})]
-	c101 := m.voxelCorners[voxelStartIndex.Add(v3i.Vec{1, 0, 1})]
-	c110 := m.voxelCorners[voxelStartIndex.Add(v3i.Vec{1, 1, 0})]
-	c111 := m.voxelCorners[voxelStartIndex.Add(v3i.Vec{1, 1, 1})]
-	// Perform trilinear interpolation over the voxel's corners
-	// - 4 linear interpolations
-	c00 := c000*(1-d.X) + c100*d.X
-	c01 := c001*(1-d.X) + c101*d.X
-	c10 := c010*(1-d.X) + c110*d.X
-	c11 := c011*(1-d.X) + c111*d.X
-	// - 2 bilinear interpolations
-	c0 := c00*(1-d.Y) + c10*d.Y
-	c1 := c01*(1-d.Y) + c11*d.Y
-	// - 1 trilinear interpolation
-	c := c0*(1-d.Z) + c1*d.Z
-	return c
+	q := p.Clamp(m.grid.bb.Min, m.grid.bb.Max)
+	d := m.interpolate(q)
+	if q == p {
+		return d
+	}
+	// Outside the grid: the surface is inside the grid so this is a lower bound.
+	return math.Sqrt(d*d + p.Sub(q).Length2())
+}
+
+// EvaluateBatch evaluates a VoxelSDF3 at each point of ps.
+func (m *VoxelSDF3) EvaluateBatch(ps []v3.Vec, out []float64) {
+	for i, p := range ps {
+		out[i] = m.Evaluate(p)
+	}
+}
+
+// Gradient returns the gradient of a VoxelSDF3.
+func (m *VoxelSDF3) Gradient(p v3.Vec, eps float64) v3.Vec {
+	if !m.grid.bb.Contains(p) {
+		return centralGradient3(m, p, eps)
+	}
+	if m.tricubic {
+		_, grad := m.grid.tricubic(p)
+		return grad
+	}
+	return m.grid.trilinearGradient(p)
+}
+
+// EvaluateInterval returns an interval containing the values of a VoxelSDF3 within a box.
+func (m *VoxelSDF3) EvaluateInterval(b Box3) Interval {
+	k := m.slope.Length()
+	if m.tricubic {
+		k *= tricubicSlope
+	}
+	// outside the grid the lipschitz constant is >= 1
+	return lipschitzInterval3(m, b, math.Max(k, 1))
 }
 
 // BoundingBox returns the bounding box for a VoxelSDF3.
 func (m *VoxelSDF3) BoundingBox() Box3 {
-	return m.bb
+	return m.grid.bb
+}
+
+//-----------------------------------------------------------------------------
+// Voxel Files
+
+// voxelMagic identifies a voxel file.
+var voxelMagic = [8]byte{'S', 'D', 'F', 'X', 'V', 'O', 'X', '1'}
+
+// voxelMaxPoints is the maximum number of grid points in a voxel file.
+const voxelMaxPoints = 1 << 30
+
+// voxelChunk is the number of values read or written at a time.
+const voxelChunk = 1 << 12
+
+// voxelHeader is the header of a voxel file.
+type voxelHeader struct {
+	Magic    [8]byte
+	N        [3]uint32
+	Min, Max [3]float64
+	Tricubic uint32
+}
+
+// Save writes a VoxelSDF3 to a file.
+// The values are stored as float32.
+func (m *VoxelSDF3) Save(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	buf := bufio.NewWriter(file)
+	g := m.grid
+	hdr := voxelHeader{
+		Magic: voxelMagic,
+		N:     [3]uint32{uint32(g.n.X), uint32(g.n.Y), uint32(g.n.Z)},
+		Min:   [3]float64{g.bb.Min.X, g.bb.Min.Y, g.bb.Min.Z},
+		Max:   [3]float64{g.bb.Max.X, g.bb.Max.Y, g.bb.Max.Z},
+	}
+	if m.tricubic {
+		hdr.Tricubic = 1
+	}
+	if err := binary.Write(buf, binary.LittleEndian, &hdr); err != nil {
+		return err
+	}
+	var chunk [4 * voxelChunk]byte
+	for i := 0; i < len(g.data); i += voxelChunk {
+		values := g.data[i:minInt(i+voxelChunk, len(g.data))]
+		for j, x := range values {
+			binary.LittleEndian.PutUint32(chunk[4*j:], math.Float32bits(float32(x)))
+		}
+		if _, err := buf.Write(chunk[:4*len(values)]); err != nil {
+			return err
+		}
+	}
+	return buf.Flush()
+}
+
+// LoadVoxelSDF3 reads a VoxelSDF3 from a file written by Save.
+func LoadVoxelSDF3(path string) (SDF3, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	buf := bufio.NewReader(file)
+	var hdr voxelHeader
+	if err := binary.Read(buf, binary.LittleEndian, &hdr); err != nil {
+		return nil, err
+	}
+	if hdr.Magic != voxelMagic {
+		return nil, ErrMsg("not a voxel file")
+	}
+	n := v3i.Vec{int(hdr.N[0]), int(hdr.N[1]), int(hdr.N[2])}
+	points := float64(n.X) * float64(n.Y) * float64(n.Z)
+	if n.X < 2 || n.Y < 2 || n.Z < 2 || points > voxelMaxPoints {
+		return nil, ErrMsg("bad voxel grid size")
+	}
+	// check the file has the values before allocating the grid
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() != int64(binary.Size(hdr))+4*int64(points) {
+		return nil, ErrMsg("voxel file size doesn't match the grid size")
+	}
+	bb := Box3{v3.Vec{hdr.Min[0], hdr.Min[1], hdr.Min[2]}, v3.Vec{hdr.Max[0], hdr.Max[1], hdr.Max[2]}}
+	g := newGrid3(bb, n)
+	var chunk [4 * voxelChunk]byte
+	for i := 0; i < len(g.data); i += voxelChunk {
+		values := g.data[i:minInt(i+voxelChunk, len(g.data))]
+		if _, err := io.ReadFull(buf, chunk[:4*len(values)]); err != nil {
+			return nil, err
+		}
+		for j := range values {
+			values[j] = float64(math.Float32frombits(binary.LittleEndian.Uint32(chunk[4*j:])))
+		}
+	}
+	return &VoxelSDF3{
+		grid:     g,
+		slope:    g.slope(),
+		tricubic: hdr.Tricubic != 0,
+	}, nil
+}
+
+func init() {
+	RegisterFileLoader3("voxel", loadVoxel)
+}
+
+// loadVoxel is the file loader for voxel files.
+func loadVoxel(path string, args []float64) (SDF3, error) {
+	if len(args) != 0 {
+		return nil, ErrMsg("voxel loader has no arguments")
+	}
+	return LoadVoxelSDF3(path)
 }
 
 //-----------------------------------------------------------------------------